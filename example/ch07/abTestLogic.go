@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"sync"
+)
+
+const (
+	// VariantAとVariantBは、ABTestLogicが選ぶ挨拶の版
+	VariantA = "A"
+	VariantB = "B"
+)
+
+// greetingVariantHeaderは、GreetingVariantMiddlewareがどちらの版で挨拶したかを返すレスポンスヘッダ
+const greetingVariantHeader = "X-Greeting-Variant"
+
+// ABTestLogicは、ユーザーIDのハッシュで利用者を100のバケットに分け、percentB未満のバケットのユーザーにはbで、
+// ほかのユーザーにはaで挨拶するLogic。同じユーザーIDは常に同じ版になる。
+// どちらの版で挨拶したかはログに書き、GreetingVariantMiddlewareの内側ならレスポンスヘッダでも返す。
+type ABTestLogic struct {
+	a, b     Logic
+	percentB int
+	l        Logger
+}
+
+// NewABTestLogicは、percentBパーセントのユーザーにb、残りにaで挨拶するABTestLogicを生成するファクトリ関数。
+// percentBが0なら全員がa、100なら全員がbになる。
+func NewABTestLogic(a, b Logic, percentB int, l Logger) ABTestLogic {
+	return ABTestLogic{
+		a:        a,
+		b:        b,
+		percentB: percentB,
+		l:        l,
+	}
+}
+
+func (al ABTestLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	return al.pick(ctx, userID).SayHello(ctx, userID)
+}
+
+// SayHelloDetailedは、SayHelloと同じ版のLogicで、名前や言語と一緒に挨拶を返す
+func (al ABTestLogic) SayHelloDetailed(ctx context.Context, userID string) (GreetingResult, error) {
+	return sayHelloDetailed(ctx, al.pick(ctx, userID), userID)
+}
+
+func (al ABTestLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	return al.pick(ctx, userID).SayGoodbye(ctx, userID)
+}
+
+// pickは、userIDの版を決めて記録し、その版のLogicを返す
+func (al ABTestLogic) pick(ctx context.Context, userID string) Logic {
+	variant, logic := VariantA, al.a
+	if abBucket(userID) < al.percentB {
+		variant, logic = VariantB, al.b
+	}
+	LoggerWithContext(ctx, al.l).Logf(LevelInfo, "greeting variant=%s user_id=%s", variant, escapeForLog(userID))
+	if gv, ok := ctx.Value(greetingVariantKey).(*greetingVariant); ok {
+		gv.set(variant)
+	}
+	return logic
+}
+
+// abBucketは、userIDのFNV-1aハッシュを100で割った余りを返す
+func abBucket(userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return int(h.Sum32() % 100)
+}
+
+// greetingVariantは、1つのリクエストの間にABTestLogicが選んだ版
+type greetingVariant struct {
+	mu      sync.Mutex
+	variant string
+}
+
+func (gv *greetingVariant) set(variant string) {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+	gv.variant = variant
+}
+
+func (gv *greetingVariant) get() string {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+	return gv.variant
+}
+
+// GreetingVariantMiddlewareは、ハンドラの中でABTestLogicが版を選んでいたら、それをX-Greeting-Variantヘッダで返す。
+// ヘッダは書き込む前にしか設定できないので、ハンドラが最初に書き込むまでに選ばれた版だけを返す。
+func GreetingVariantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gv := &greetingVariant{}
+		vw := &variantWriter{ResponseWriter: w, variant: gv}
+		next.ServeHTTP(vw, r.WithContext(context.WithValue(r.Context(), greetingVariantKey, gv)))
+	})
+}
+
+// variantWriterは、最初に書き込まれるときに、選ばれた版をX-Greeting-Variantヘッダに設定するhttp.ResponseWriter
+type variantWriter struct {
+	http.ResponseWriter
+	variant *greetingVariant
+	wrote   bool
+}
+
+func (vw *variantWriter) WriteHeader(status int) {
+	if !vw.wrote {
+		vw.wrote = true
+		if v := vw.variant.get(); v != "" {
+			vw.Header().Set(greetingVariantHeader, v)
+		}
+	}
+	vw.ResponseWriter.WriteHeader(status)
+}
+
+func (vw *variantWriter) Write(b []byte) (int, error) {
+	if !vw.wrote {
+		vw.WriteHeader(http.StatusOK)
+	}
+	return vw.ResponseWriter.Write(b)
+}
+
+// Flushは、包んだhttp.ResponseWriterがhttp.Flusherならそれを呼ぶ
+func (vw *variantWriter) Flush() {
+	if !vw.wrote {
+		vw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := vw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrapは、http.ResponseControllerが包まれたResponseWriterにたどり着けるようにする
+func (vw *variantWriter) Unwrap() http.ResponseWriter {
+	return vw.ResponseWriter
+}
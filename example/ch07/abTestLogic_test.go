@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newABTestLogicsは、Aは既定のテンプレート、Bは"B %s"で挨拶する2つのLogicを返す
+func newABTestLogics(l Logger) (a, b Logic) {
+	ds := NewSimpleDataStore()
+	cfgB := DefaultConfig()
+	cfgB.GreetingTemplates = map[string]string{"ja": "B %s"}
+	return NewSimpleLogic(l, ds, DefaultConfig()), NewSimpleLogic(l, ds, cfgB)
+}
+
+// 0%なら全員がA、100%なら全員がBで、どちらの版かをヘッダとログで返す
+func TestABTestLogicEdges(t *testing.T) {
+	tests := []struct {
+		percentB int
+		want     string
+	}{
+		{0, VariantA},
+		{100, VariantB},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.percentB), func(t *testing.T) {
+			l := &MemoryLogger{}
+			a, b := newABTestLogics(l)
+			c := NewController(l, NewABTestLogic(a, b, tt.percentB, l), nil)
+			h := GreetingVariantMiddleware(http.HandlerFunc(c.SayHello))
+			for _, id := range []string{"1", "2", "3"} {
+				w := send(h, http.MethodGet, "/hello?user_id="+id, nil)
+				if got := w.Header().Get(greetingVariantHeader); got != tt.want {
+					t.Errorf("user %s: %s = %q, want %q", id, greetingVariantHeader, got, tt.want)
+				}
+				if isB := strings.HasPrefix(w.Body.String(), "B "); isB != (tt.want == VariantB) {
+					t.Errorf("user %s: body %q does not match variant %s", id, w.Body.String(), tt.want)
+				}
+			}
+			if !containsMessage(l.Messages(), "greeting variant="+tt.want) {
+				t.Errorf("logs %v do not record the variant", l.Messages())
+			}
+		})
+	}
+}
+
+// 同じユーザーIDは、何度挨拶しても同じ版になる
+func TestABTestLogicDeterministic(t *testing.T) {
+	l := &MemoryLogger{}
+	a, b := newABTestLogics(l)
+	al := NewABTestLogic(a, b, 50, l)
+	for _, id := range []string{"1", "2", "3"} {
+		first, err := al.SayHello(context.Background(), id)
+		if err != nil {
+			t.Fatalf("SayHello(%s): %v", id, err)
+		}
+		if wantB := abBucket(id) < 50; strings.HasPrefix(first, "B ") != wantB {
+			t.Errorf("user %s got %q, want variant B = %v", id, first, wantB)
+		}
+		for i := 0; i < 20; i++ {
+			if got, _ := al.SayHello(context.Background(), id); got != first {
+				t.Fatalf("user %s: got %q, then %q", id, first, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config.AccessLogFormatに指定できる、アクセスログの形式
+const (
+	// AccessLogFormatTextは、"GET /hello 200 1.5ms"のような、項目を選べない従来の1行
+	AccessLogFormatText = "text"
+	// AccessLogFormatLogfmtは、"method=GET path=/hello"のようなkey=valueの並び
+	AccessLogFormatLogfmt = "logfmt"
+	// AccessLogFormatJSONは、1つのJSONオブジェクト
+	AccessLogFormatJSON = "json"
+)
+
+// Config.AccessLogFieldsに指定できる、アクセスログの項目の名前
+const (
+	AccessLogMethod     = "method"
+	AccessLogPath       = "path"
+	AccessLogStatus     = "status"
+	AccessLogDuration   = "duration"
+	AccessLogRemoteAddr = "remote_addr"
+	AccessLogRequestID  = "request_id"
+	AccessLogUserID     = "user_id"
+)
+
+// accessLogFieldNamesは、Config.AccessLogFieldsに指定できる名前の一覧。設定を間違えたときのエラーで示す。
+var accessLogFieldNames = []string{AccessLogMethod, AccessLogPath, AccessLogStatus, AccessLogDuration, AccessLogRemoteAddr, AccessLogRequestID, AccessLogUserID}
+
+// defaultAccessLogFieldsは、Config.AccessLogFieldsを書かなかったときの項目。
+// 接続元のアドレスとユーザーIDは個人を特定できる値なので、指定したときだけ書く。
+var defaultAccessLogFields = []string{AccessLogMethod, AccessLogPath, AccessLogStatus, AccessLogDuration, AccessLogRequestID}
+
+// unknownAccessLogFieldは、知らない項目の名前のエラーを、指定できる名前の一覧と一緒に返す
+func unknownAccessLogField(name string) error {
+	return fmt.Errorf("不明なaccess_log_fields: %q（%sのどれかを指定してください）", name, strings.Join(accessLogFieldNames, ", "))
+}
+
+// AccessLogEntryは、アクセスログの1行に書く、1つのリクエストの値
+type AccessLogEntry struct {
+	Method     string
+	Path       string
+	Status     int
+	Duration   time.Duration
+	RemoteAddr string
+	RequestID  string
+	UserID     string
+}
+
+// valueは、nameの項目の値を返す。文字列の項目は、値がなければ空文字列になる。
+func (e AccessLogEntry) value(name string) any {
+	switch name {
+	case AccessLogMethod:
+		return e.Method
+	case AccessLogPath:
+		return e.Path
+	case AccessLogStatus:
+		return e.Status
+	case AccessLogDuration:
+		return e.Duration.String()
+	case AccessLogRemoteAddr:
+		return e.RemoteAddr
+	case AccessLogRequestID:
+		return e.RequestID
+	case AccessLogUserID:
+		return e.UserID
+	}
+	return nil
+}
+
+// AccessLogFormatterは、AccessLogMiddlewareが1つのリクエストをアクセスログの1行にするインターフェイス
+type AccessLogFormatter interface {
+	Format(e AccessLogEntry) string
+}
+
+// NewAccessLogFormatterは、formatの形式で、fieldsの項目だけを書くAccessLogFormatterを生成するファクトリ関数。
+// fieldsが空なら既定の項目を書く。AccessLogFormatTextはfieldsを見ない。
+// 知らない形式や項目があればエラーを返す。
+func NewAccessLogFormatter(format string, fields []string) (AccessLogFormatter, error) {
+	if len(fields) == 0 {
+		fields = defaultAccessLogFields
+	}
+	for _, name := range fields {
+		known := false
+		for _, n := range accessLogFieldNames {
+			known = known || n == name
+		}
+		if !known {
+			return nil, unknownAccessLogField(name)
+		}
+	}
+	switch format {
+	case "", AccessLogFormatText:
+		return TextAccessLogFormatter{}, nil
+	case AccessLogFormatLogfmt:
+		return LogfmtAccessLogFormatter{Fields: fields}, nil
+	case AccessLogFormatJSON:
+		return JSONAccessLogFormatter{Fields: fields}, nil
+	}
+	return nil, fmt.Errorf("不明なaccess_log_format: %q", format)
+}
+
+// TextAccessLogFormatterは、メソッド、パス、ステータスコード、処理時間を空白で区切って書くAccessLogFormatter。
+// リクエストIDがあれば、LoggerWithContextと同じく"[ID] "を先頭に付ける。
+type TextAccessLogFormatter struct{}
+
+func (TextAccessLogFormatter) Format(e AccessLogEntry) string {
+	line := fmt.Sprintf("%s %s %d %s", e.Method, e.Path, e.Status, e.Duration)
+	if e.RequestID != "" {
+		line = "[" + e.RequestID + "] " + line
+	}
+	return line
+}
+
+// LogfmtAccessLogFormatterは、Fieldsの項目を順に"key=value"で書くAccessLogFormatter。
+// 空白や引用符、=を含む値と空の値は、引用符で囲む。
+type LogfmtAccessLogFormatter struct {
+	Fields []string
+}
+
+func (lf LogfmtAccessLogFormatter) Format(e AccessLogEntry) string {
+	parts := make([]string, 0, len(lf.Fields))
+	for _, name := range lf.Fields {
+		s := fmt.Sprint(e.value(name))
+		if s == "" || strings.ContainsAny(s, " \t\"=") || strings.IndexFunc(s, func(r rune) bool { return r < ' ' }) >= 0 {
+			s = strconv.Quote(s)
+		}
+		parts = append(parts, name+"="+s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// JSONAccessLogFormatterは、Fieldsの項目をキーにした1つのJSONオブジェクトを書くAccessLogFormatter。
+// statusは数、ほかは文字列で書く。
+type JSONAccessLogFormatter struct {
+	Fields []string
+}
+
+func (jf JSONAccessLogFormatter) Format(e AccessLogEntry) string {
+	obj := make(map[string]any, len(jf.Fields))
+	for _, name := range jf.Fields {
+		obj[name] = e.value(name)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Sprintf("%s %s %d %s", e.Method, e.Path, e.Status, e.Duration)
+	}
+	return string(data)
+}
+
+// accessLogRecordは、AccessLogMiddlewareの内側のミドルウェアが、アクセスログに書く値を伝えるためのもの。
+// AuthMiddlewareはリクエストのcontextを作り直すので、外側のAccessLogMiddlewareはcontextからユーザーIDを取り出せない。
+type accessLogRecord struct {
+	mu     sync.Mutex
+	userID string
+}
+
+// noteAccessLogUserは、AccessLogMiddlewareの内側で、アクセスログに書くユーザーIDをuserIDにする。外なら何もしない。
+func noteAccessLogUser(ctx context.Context, userID string) {
+	rec, ok := ctx.Value(accessLogKey).(*accessLogRecord)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.userID = userID
+}
+
+// AccessLogMiddlewareは、リクエストごとにfの形式で1行のアクセスログを記録する。
+// RequestIDMiddlewareの内側に置くとリクエストIDも、AuthMiddlewareの外側に置くとAPIキーのユーザーIDも記録できる。
+func AccessLogMiddleware(l Logger, f AccessLogFormatter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		rec := &accessLogRecord{}
+		next.ServeHTTP(sr, r.WithContext(context.WithValue(r.Context(), accessLogKey, rec)))
+		requestID, _ := RequestIDFromContext(r.Context())
+		rec.mu.Lock()
+		userID := rec.userID
+		rec.mu.Unlock()
+		l.Logf(LevelInfo, "%s", f.Format(AccessLogEntry{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     sr.status,
+			Duration:   time.Since(start),
+			RemoteAddr: r.RemoteAddr,
+			RequestID:  requestID,
+			UserID:     userID,
+		}))
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var sampleAccessLogEntry = AccessLogEntry{
+	Method:     http.MethodGet,
+	Path:       "/hello",
+	Status:     http.StatusOK,
+	Duration:   1500 * time.Microsecond,
+	RemoteAddr: "192.0.2.1:1234",
+	RequestID:  "rid",
+	UserID:     "u 1",
+}
+
+// logfmtは、指定した項目だけを指定した順に書き、空白を含む値は引用符で囲む
+func TestLogfmtAccessLogFormatter(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{"selected", []string{AccessLogMethod, AccessLogStatus, AccessLogUserID}, `method=GET status=200 user_id="u 1"`},
+		{"default", nil, `method=GET path=/hello status=200 duration=1.5ms request_id=rid`},
+		{"remote addr", []string{AccessLogRemoteAddr}, `remote_addr=192.0.2.1:1234`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewAccessLogFormatter(AccessLogFormatLogfmt, tt.fields)
+			if err != nil {
+				t.Fatalf("NewAccessLogFormatter: %v", err)
+			}
+			if got := f.Format(sampleAccessLogEntry); got != tt.want {
+				t.Errorf("Format = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// JSONは、指定した項目だけをキーに持つ
+func TestJSONAccessLogFormatter(t *testing.T) {
+	f, err := NewAccessLogFormatter(AccessLogFormatJSON, []string{AccessLogPath, AccessLogStatus, AccessLogDuration})
+	if err != nil {
+		t.Fatalf("NewAccessLogFormatter: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(f.Format(sampleAccessLogEntry)), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"path": "/hello", "status": float64(200), "duration": "1.5ms"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Format = %v, want %v", got, want)
+	}
+}
+
+func TestTextAccessLogFormatter(t *testing.T) {
+	f, err := NewAccessLogFormatter("", []string{AccessLogUserID})
+	if err != nil {
+		t.Fatalf("NewAccessLogFormatter: %v", err)
+	}
+	if got := f.Format(sampleAccessLogEntry); got != "[rid] GET /hello 200 1.5ms" {
+		t.Errorf("Format = %q, want the fixed text line", got)
+	}
+}
+
+// 知らない形式や項目は、NewAccessLogFormatterでもValidateでもエラーになる
+func TestAccessLogFormatterErrors(t *testing.T) {
+	if _, err := NewAccessLogFormatter(AccessLogFormatLogfmt, []string{"password"}); err == nil {
+		t.Error("unknown field: err = nil")
+	}
+	if _, err := NewAccessLogFormatter("xml", nil); err == nil {
+		t.Error("unknown format: err = nil")
+	}
+	cfg := DefaultConfig()
+	cfg.AccessLogFormat = AccessLogFormatJSON
+	cfg.AccessLogFields = []string{"nope"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate with an unknown field = nil")
+	}
+}
+
+// AuthMiddlewareの外側に置けば、APIキーのユーザーIDも書ける
+func TestAccessLogMiddlewareUserID(t *testing.T) {
+	l := &MemoryLogger{}
+	f, err := NewAccessLogFormatter(AccessLogFormatLogfmt, []string{AccessLogMethod, AccessLogPath, AccessLogStatus, AccessLogUserID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := AccessLogMiddleware(l, f, AuthMiddleware(map[string]string{"k": "42"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	sendWithHeader(h, http.MethodGet, "/x", nil, "X-API-Key", "k")
+	send(h, http.MethodGet, "/x", nil)
+	want := []string{"[INFO] method=GET path=/x status=204 user_id=42", `[INFO] method=GET path=/x status=401 user_id=""`}
+	if got := l.Messages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("logs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"net/http"
+)
+
+// Snapshotは、データストアの中身を丸ごとJSONで返す。
+// データストアがStreamSnapshotterなら、メモリに丸ごと作らずにレスポンスに直接書き込む。
+// その場合は途中で失敗してもステータスコードを変えられないので、ログに書いてレスポンスを打ち切る。
+func (c Controller) Snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if sss, ok := c.ds.(StreamSnapshotter); ok {
+		w.Header().Set("Content-Type", "application/json")
+		if err := sss.SnapshotTo(w); err != nil {
+			LoggerWithContext(r.Context(), c.l).Logf(LevelError, "スナップショットを書き込めません: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+		return
+	}
+	ss, ok := c.ds.(Snapshotter)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "スナップショットを取れないデータストア")
+		return
+	}
+	data, err := ss.Snapshot()
+	if err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Restoreは、リクエストボディのスナップショットでデータストアの中身を丸ごと置き換える
+func (c Controller) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	ss, ok := c.ds.(Snapshotter)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "スナップショットを戻せないデータストア")
+		return
+	}
+	data, err := io.ReadAll(c.body(w, r))
+	if err != nil {
+		c.writeError(w, bodyErrorStatus(err), err.Error())
+		return
+	}
+	if err := ss.Restore(data); err != nil {
+		c.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.forget()
+	LoggerWithContext(r.Context(), c.l).Logf(LevelWarn, "Restore: データストアを置き換えました")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reloadは、データストアのユーザーを元のファイルから読み直す
+func (c Controller) Reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	rl, ok := c.ds.(Reloader)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "読み直せないデータストア")
+		return
+	}
+	if err := rl.Reload(); err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	c.forget()
+	LoggerWithContext(r.Context(), c.l).Log("Reload: ユーザーを読み直しました")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Drainは、このインスタンスを終了の準備中にする。以後HealthCheckは503を返すが、他のリクエストは今までどおり処理する。
+func (c Controller) Drain() {
+	if c.draining != nil {
+		c.draining.Store(true)
+	}
+}
+
+// Drainingは、Drainされた後ならtrueを返す
+func (c Controller) Draining() bool {
+	return c.draining != nil && c.draining.Load()
+}
+
+// DrainHandlerは、POST /admin/drainでDrainする
+func (c Controller) DrainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	c.Drain()
+	LoggerWithContext(r.Context(), c.l).Logf(LevelWarn, "Drain: 終了の準備を始めました")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// DrainするとHealthCheckは503に変わるが、挨拶は今までどおり返す
+func TestDrainFlipsHealthCheck(t *testing.T) {
+	c, _, _ := newTestController()
+	if w := send(http.HandlerFunc(c.HealthCheck), http.MethodGet, "/healthz", nil); w.Code != http.StatusOK {
+		t.Fatalf("before draining: status = %d, want 200", w.Code)
+	}
+	if w := send(http.HandlerFunc(c.DrainHandler), http.MethodGet, "/admin/drain", nil); w.Code != http.StatusMethodNotAllowed || c.Draining() {
+		t.Fatalf("GET /admin/drain: status = %d, draining = %v; want 405 and not draining", w.Code, c.Draining())
+	}
+	if w := send(http.HandlerFunc(c.DrainHandler), http.MethodPost, "/admin/drain", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /admin/drain: status = %d, want 204", w.Code)
+	}
+	if w := send(http.HandlerFunc(c.HealthCheck), http.MethodGet, "/healthz", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("while draining: status = %d, want 503", w.Code)
+	}
+	if w := send(http.HandlerFunc(c.SayHello), http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+		t.Errorf("SayHello while draining: status = %d, want 200", w.Code)
+	}
+}
+
+// serveは、終了を始めるときにまずdrainを呼ぶ
+func TestServeCallsDrainOnShutdown(t *testing.T) {
+	c, _, l := newTestController()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	srv := newServer(freeAddr(t), http.NotFoundHandler(), DefaultConfig())
+	if err := serve(ctx, l, srv, "", "", c.Drain, nil); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+	if !c.Draining() {
+		t.Error("serve returned without draining the controller")
+	}
+}
+
+// POST /admin/reloadはファイルを読み直し、読み直せないデータストアなら501を返す
+func TestReloadHandler(t *testing.T) {
+	path := writeTempFile(t, "users.csv", "id,name\n1,Fred\n")
+	cds, err := NewCSVDataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("id,name\n1,Freddie\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewController(&MemoryLogger{}, nil, cds)
+	if w := send(http.HandlerFunc(c.Reload), http.MethodPost, "/admin/reload", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", w.Code)
+	}
+	if name, _, _ := cds.UserNameForID(context.Background(), "1"); name != "Freddie" {
+		t.Errorf("after POST /admin/reload: user 1 = %q, want Freddie", name)
+	}
+	sc, _, _ := newTestController()
+	if w := send(http.HandlerFunc(sc.Reload), http.MethodPost, "/admin/reload", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("SimpleDataStore: status = %d, want 501", w.Code)
+	}
+}
+
+// snapshotOnlyStoreは、SnapshotToのないSnapshotterとしてSimpleDataStoreを見せるDataStore
+type snapshotOnlyStore struct {
+	sds *SimpleDataStore
+}
+
+func (s snapshotOnlyStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	return s.sds.UserNameForID(ctx, userID)
+}
+
+func (s snapshotOnlyStore) Snapshot() ([]byte, error) {
+	return s.sds.Snapshot()
+}
+
+func (s snapshotOnlyStore) Restore(data []byte) error {
+	return s.sds.Restore(data)
+}
+
+// /admin/snapshotは、SnapshotToでもSnapshotでも同じJSONを返し、どちらもなければ501を返す
+func TestSnapshotHandler(t *testing.T) {
+	sds := NewSimpleDataStore()
+	want, err := sds.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		ds         DataStore
+		wantStatus int
+		wantBody   string
+	}{
+		{"streaming", sds, http.StatusOK, string(want)},
+		{"buffered", snapshotOnlyStore{sds}, http.StatusOK, string(want)},
+		{"unsupported", failingStore{}, http.StatusNotImplemented, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewController(&MemoryLogger{}, nil, tt.ds)
+			w := send(http.HandlerFunc(c.Snapshot), http.MethodGet, "/admin/snapshot", nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" || w.Body.String() != tt.wantBody {
+				t.Errorf("got %q %s, want application/json %s", ct, w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
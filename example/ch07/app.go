@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Appは、cfgに合わせて組み立てた、サーバーの全てのコンポーネント。
+// Handlerをhttp.Serverやhttptest.NewServerに渡せばそのまま動く。使い終わったらCloseを呼ぶ。
+type App struct {
+	// Handlerは、全てのルートとミドルウェアをまとめたハンドラ
+	Handler http.Handler
+
+	l         Logger
+	metrics   *Metrics
+	ds        DataStore
+	c         Controller
+	rl        *RateLimiter
+	inflight  *InflightCounter
+	templates *TemplateSource
+}
+
+// ComponentErrorは、Buildがどのコンポーネントを組み立てられなかったか。Errはその原因で、errors.Isやerrors.Asでたどれる。
+type ComponentError struct {
+	Component string
+	Err       error
+}
+
+func (ce ComponentError) Error() string {
+	return ce.Component + "を組み立てられません: " + ce.Err.Error()
+}
+
+func (ce ComponentError) Unwrap() error {
+	return ce.Err
+}
+
+// BuildOptionは、Buildに渡してコンポーネントの作り方を変える関数
+type BuildOption func(*buildOptions)
+
+// buildOptionsは、Buildがコンポーネントを作るのに使う関数
+type buildOptions struct {
+	newDataStore func(Config) (DataStore, error)
+}
+
+// WithDataStoreFactoryは、NewDataStoreFromConfigの代わりにfでデータストアを作るようにする
+func WithDataStoreFactory(f func(Config) (DataStore, error)) BuildOption {
+	return func(o *buildOptions) {
+		o.newDataStore = f
+	}
+}
+
+// Buildは、cfgのロガー、データストア、ロジック、コントローラー、ミドルウェアを結びつけたAppを生成するファクトリ関数。
+// 組み立て方をここにまとめておくと、デコレーターを足してもrunや結合テストを書き換えずに済む。
+// 組み立てられないコンポーネントがあれば、その名前を持ったComponentErrorを返す。
+// ログとメトリクスは全体ではなくルートごとに掛けるので、/healthzや/metricsのリクエストは記録しない。
+// cfg.LogFileを開けなければ、組み立てをやめずに標準出力に書き、そのことを警告としてログに書く。
+// cfg.CacheWarmupなら、返す前にcacheのデコレーターを温めておく。温められなくても組み立ては続ける。
+func Build(cfg Config, opts ...BuildOption) (*App, error) {
+	o := buildOptions{newDataStore: NewDataStoreFromConfig}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	base, logErr := NewLoggerFromConfig(cfg)
+	if base == nil {
+		return nil, ComponentError{Component: "logger", Err: logErr}
+	}
+	accessLog, err := NewAccessLogFormatter(cfg.AccessLogFormat, cfg.AccessLogFields)
+	if err != nil {
+		return nil, ComponentError{Component: "logger", Err: err}
+	}
+	fl := NewFanoutLogger(base)
+	l := LeveledLogger{Logger: fl, MinLevel: cfg.LogLevel}
+	if logErr != nil {
+		l.Logf(LevelWarn, "%v", logErr)
+	}
+	m := NewMetrics()
+	ds, err := o.newDataStore(cfg)
+	if err != nil {
+		return nil, ComponentError{Component: "store", Err: err}
+	}
+	decorated, caches, err := decorateDataStore(ds, cfg.StoreDecorators, m, RealClock{})
+	if err != nil {
+		closeDataStore(ds)
+		return nil, ComponentError{Component: "store", Err: err}
+	}
+	if cfg.CacheWarmup {
+		warmupCaches(context.Background(), l, ds, caches, cfg.CacheWarmupWorkers)
+	}
+	var templates *TemplateSource
+	if cfg.TemplateFile != "" {
+		if templates, err = NewTemplateSource(cfg.TemplateFile, cfg); err != nil {
+			closeDataStore(ds)
+			return nil, ComponentError{Component: "templates", Err: err}
+		}
+	}
+	var formatter Formatter
+	if cfg.TimeOfDayGreetings {
+		loc, err := time.LoadLocation(cfg.TimeZone)
+		if err != nil {
+			closeDataStore(ds)
+			return nil, ComponentError{Component: "formatter", Err: err}
+		}
+		formatter = NewTimeOfDayFormatter(RealClock{}, loc, cfg.DayBoundaries)
+	}
+	logic := NewHistoryLogic(NewErrorTranslatingLogic(newGreetingLogic(l, decorated, cfg, templates, formatter), l), RealClock{})
+	inflight := &InflightCounter{}
+	table := &RouteTable{}
+	supports := NewGreeterFromConfig(cfg).Supports
+	if templates != nil {
+		supports = templates.Supports
+	}
+	maintenance := NewMaintenanceMode(cfg.MaintenanceMessage, cfg.MaintenanceRetryAfter, l)
+	errorRate := NewErrorRateTracker(errorRateWindow, errorRateBuckets, cfg.ErrorRateThreshold, l, RealClock{})
+	observe := []func(http.Handler) http.Handler{
+		func(h http.Handler) http.Handler { return AccessLogMiddleware(l, accessLog, h) },
+		func(h http.Handler) http.Handler { return MetricsMiddleware(m, h) },
+	}
+	rl, err := NewRateLimiter(cfg.RateLimit, cfg.RateLimitInterval, RealClock{})
+	if err != nil {
+		closeDataStore(ds)
+		return nil, ComponentError{Component: "rate_limiter", Err: err}
+	}
+	// Controllerは、Listerのような機能を使えるように包む前のdsに書き込むので、書き込んだらcachesに忘れさせる
+	c := NewController(l, logic, ds, WithBodyReadTimeout(cfg.BodyReadTimeout), WithGuests(cfg.GuestMode), WithInflightCounter(inflight), WithRouteTable(table), WithErrorRateTracker(errorRate), WithLanguages(supports, cfg.DefaultLanguage), WithMaintenanceMode(maintenance), WithRequireIfMatch(cfg.RequireIfMatch),
+		WithAPIKeys(cfg.APIKeys), WithFeatureFlags(cfg.FeatureFlags), WithRouteMiddleware(observe...), WithStoreCaches(caches...),
+		WithMetrics(m), WithLogStream(fl), WithRateLimiter(rl), WithCORSOrigins(cfg.CORSOrigins), WithRequestLimits(cfg.MaxURLLength, cfg.MaxConcurrentRequests))
+	h, err := c.Handler()
+	if err != nil {
+		rl.Stop()
+		if c.idempotency != nil {
+			c.idempotency.Stop()
+		}
+		closeDataStore(ds)
+		return nil, ComponentError{Component: "routes", Err: err}
+	}
+	return &App{
+		Handler:   h,
+		l:         l,
+		metrics:   m,
+		ds:        ds,
+		c:         c,
+		rl:        rl,
+		inflight:  inflight,
+		templates: templates,
+	}, nil
+}
+
+// newGreetingLogicは、cfgのテンプレートで挨拶するSimpleLogicを作る。tsがあれば、tsの今のテンプレートで挨拶する。
+// fがnilでなければ、挨拶の文はfで作る。
+// cfg.ABTestTemplatesがあれば、cfg.ABTestPercentのユーザーにはそのテンプレートで挨拶するABTestLogicにする。
+func newGreetingLogic(l Logger, ds DataStore, cfg Config, ts *TemplateSource, f Formatter) Logic {
+	a := NewSimpleLogic(l, ds, cfg)
+	if ts != nil {
+		a = NewSimpleLogicWithTemplates(l, ds, cfg, ts)
+	}
+	a.formatter = f
+	if len(cfg.ABTestTemplates) == 0 {
+		return a
+	}
+	cfgB := cfg
+	cfgB.GreetingTemplates = map[string]string{}
+	for lang, tmpl := range cfg.GreetingTemplates {
+		cfgB.GreetingTemplates[lang] = tmpl
+	}
+	for lang, tmpl := range cfg.ABTestTemplates {
+		cfgB.GreetingTemplates[lang] = tmpl
+	}
+	b := NewSimpleLogic(l, ds, cfgB)
+	b.formatter = f
+	return NewABTestLogic(a, b, cfg.ABTestPercent, l)
+}
+
+// Closeは、Appが使っていたゴルーチンを止め、データストアが閉じられるものなら閉じる
+func (app *App) Close() error {
+	app.rl.Stop()
+	if app.c.idempotency != nil {
+		app.c.idempotency.Stop()
+	}
+	return closeDataStore(app.ds)
+}
+
+// closeDataStoreは、dsがio.Closerなら閉じる
+func closeDataStore(ds DataStore) error {
+	if c, ok := ds.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
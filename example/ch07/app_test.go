@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Buildで組み立てたAppに、本物のHTTPで/helloを送る
+func TestBuildServesHello(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LogLevel = LevelError
+	app, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer app.Close()
+	srv := httptest.NewServer(app.Handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/hello?user_id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || string(body) != "Fredさん　こんにちは。" {
+		t.Errorf("got %d %q, %v; want 200 and the greeting", resp.StatusCode, body, err)
+	}
+}
+
+// 組み立てられないコンポーネントがあれば、その名前を持ったComponentErrorを返す
+func TestBuildComponentErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		modify        func(*Config)
+		wantComponent string
+	}{
+		{"user source", func(cfg *Config) { cfg.UserSource = "nope" }, "store"},
+		{"store decorator", func(cfg *Config) { cfg.StoreDecorators = []string{"nope"} }, "store"},
+		{"access log", func(cfg *Config) { cfg.AccessLogFormat = "nope" }, "logger"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			_, err := Build(cfg)
+			var ce ComponentError
+			if !errors.As(err, &ce) || ce.Component != tt.wantComponent {
+				t.Errorf("err = %v, want a ComponentError for %s", err, tt.wantComponent)
+			}
+		})
+	}
+}
+
+// データストアを作れなければ、storeのComponentErrorを返し、元のエラーまでたどれる
+func TestBuildStoreFactoryError(t *testing.T) {
+	cause := errors.New("connection refused")
+	_, err := Build(DefaultConfig(), WithDataStoreFactory(func(Config) (DataStore, error) {
+		return nil, cause
+	}))
+	var ce ComponentError
+	if !errors.As(err, &ce) || ce.Component != "store" {
+		t.Fatalf("err = %v, want a ComponentError for store", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("err = %v does not unwrap to %v", err, cause)
+	}
+	if !strings.Contains(err.Error(), "store") || !strings.Contains(err.Error(), cause.Error()) {
+		t.Errorf("err = %q, want it to name the store and the cause", err)
+	}
+}
+
+// cacheのデコレーターを使っても、書き込んだ後の挨拶には新しい名前が出る
+func TestBuildCacheSeesWrites(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LogLevel = LevelError
+	cfg.StoreDecorators = []string{StoreDecoratorCache}
+	cfg.APIKeys = map[string]string{"k": ""}
+	app, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer app.Close()
+	hello := func(query string) *httptest.ResponseRecorder {
+		return send(app.Handler, http.MethodGet, "/v1/hello?"+query, nil)
+	}
+	if w := hello("user_id=1"); w.Body.String() != "Fredさん　こんにちは。" {
+		t.Fatalf("first greeting = %q", w.Body.String())
+	}
+	w := sendWithHeader(app.Handler, http.MethodPut, "/users", strings.NewReader(`{"user_id":"1","name":"Freddie"}`), "X-API-Key", "k")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("PUT /users: status %d, want 204", w.Code)
+	}
+	if w := hello("user_id=1"); w.Body.String() != "Freddieさん　こんにちは。" {
+		t.Errorf("after the update: greeting = %q, want Freddie", w.Body.String())
+	}
+
+	// 見つからなかったという結果も、追加したら忘れる
+	if w := hello("user_id=zz"); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown user: status %d, want 404", w.Code)
+	}
+	if w := hello("user_id=zz&name=Zoe&create-if-missing=true"); w.Code != http.StatusOK || w.Body.String() != "Zoeさん　こんにちは。" {
+		t.Errorf("create-if-missing: got %d %q, want 200 and Zoe", w.Code, w.Body.String())
+	}
+
+	w = sendWithHeader(app.Handler, http.MethodDelete, "/users?user_id=1", nil, "X-API-Key", "k")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /users: status %d, want 204", w.Code)
+	}
+	if w := hello("user_id=1"); w.Code != http.StatusNotFound {
+		t.Errorf("after the delete: status %d, want 404", w.Code)
+	}
+}
+
+// BuildのHandlerは、Controller.Handlerが組み立てたもので、RegisterRoutesの外のルートも/admin/routesに出る
+func TestBuildHandlerExtraRoutes(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LogLevel = LevelError
+	cfg.APIKeys = map[string]string{"k": ""}
+	app, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer app.Close()
+	body := sendWithHeader(app.Handler, http.MethodGet, "/admin/routes", nil, "X-API-Key", "k").Body.String()
+	for _, pattern := range []string{`"/metrics"`, `"/metrics.json"`, `"/logs/stream"`} {
+		if !strings.Contains(body, pattern) {
+			t.Errorf("/admin/routes %s does not list %s", body, pattern)
+		}
+	}
+	if w := send(app.Handler, http.MethodGet, "/metrics", nil); w.Code != http.StatusOK {
+		t.Errorf("/metrics: status %d, want 200", w.Code)
+	}
+	if w := send(app.Handler, http.MethodGet, "/logs/stream", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("/logs/stream without a key: status %d, want 401", w.Code)
+	}
+}
+
+// time_of_day_greetingsを設定ファイルで有効にすると、Buildしたハンドラがリクエストの言語で時間帯の挨拶を返す
+func TestBuildTimeOfDayGreetings(t *testing.T) {
+	cfg, err := LoadConfig(writeTempFile(t, "config.json",
+		`{"log_level":"error","time_of_day_greetings":true,"time_zone":"Asia/Tokyo","day_boundaries":{"morning":"6h"}}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.DayBoundaries.Morning != 6*time.Hour || cfg.DayBoundaries.Night != DefaultDayBoundaries().Night {
+		t.Errorf("DayBoundaries = %+v, want morning from 6h and the other defaults", cfg.DayBoundaries)
+	}
+	app, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer app.Close()
+	body := send(app.Handler, http.MethodGet, "/v1/hello?user_id=1&lang=en", nil).Body.String()
+	if !strings.HasPrefix(body, "Good ") || !strings.HasSuffix(body, ", Fred") {
+		t.Errorf("got %q, want an English time-of-day greeting", body)
+	}
+}
+
+// 設定ファイルのrate_limitとcors_originsが、Buildしたハンドラに使われる
+func TestBuildRateLimitAndCORSFromConfig(t *testing.T) {
+	cfg, err := LoadConfig(writeTempFile(t, "config.json",
+		`{"log_level":"error","rate_limit":1,"rate_limit_interval":"1h","cors_origins":["https://example.com"]}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	app, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer app.Close()
+	w := sendWithHeader(app.Handler, http.MethodGet, "/hello?user_id=1", nil, "Origin", "https://example.com")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Errorf("first request: got %d with Access-Control-Allow-Origin %q, want 200 and the origin", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w := send(app.Handler, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second request: status %d, want 429", w.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AuditEntryは、監査ログの1件。どのユーザーに何をしようとしたかを記録する。
+type AuditEntry struct {
+	Time   time.Time
+	Op     ChangeOp
+	UserID string
+}
+
+// AuditSinkは、AuditingDataStoreが監査ログを書き込む先
+type AuditSink interface {
+	Record(entry AuditEntry) error
+}
+
+// AuditSinkFuncは、関数をAuditSinkとして使うためのアダプタ
+type AuditSinkFunc func(entry AuditEntry) error
+
+func (f AuditSinkFunc) Record(entry AuditEntry) error {
+	return f(entry)
+}
+
+// AuditingDataStoreは、包んだWritableDataStoreに書き込む前に、その操作をAuditSinkに記録するWritableDataStore。
+// 記録できなかった操作は行わない。読み出しはそのまま包んだデータストアに渡す。
+// OnChangeと違って、失敗した操作も記録に残る。
+type AuditingDataStore struct {
+	ds    WritableDataStore
+	sink  AuditSink
+	clock Clock
+}
+
+// NewAuditingDataStoreは、dsへの書き込みをsinkに記録するAuditingDataStoreを生成するファクトリ関数。
+// 記録の時刻はclockで決める。clockがnilなら本当の時刻を使う。
+func NewAuditingDataStore(ds WritableDataStore, sink AuditSink, clock Clock) AuditingDataStore {
+	return AuditingDataStore{
+		ds:    ds,
+		sink:  sink,
+		clock: clockOrReal(clock),
+	}
+}
+
+func (ads AuditingDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	return ads.ds.UserNameForID(ctx, userID)
+}
+
+func (ads AuditingDataStore) AddUserForID(userID, name string) error {
+	if err := ads.record(ChangeAdd, userID); err != nil {
+		return err
+	}
+	return ads.ds.AddUserForID(userID, name)
+}
+
+func (ads AuditingDataStore) UpdateUserForID(userID, newName string) error {
+	if err := ads.record(ChangeUpdate, userID); err != nil {
+		return err
+	}
+	return ads.ds.UpdateUserForID(userID, newName)
+}
+
+func (ads AuditingDataStore) DeleteUserForID(userID string) error {
+	if err := ads.record(ChangeDelete, userID); err != nil {
+		return err
+	}
+	return ads.ds.DeleteUserForID(userID)
+}
+
+func (ads AuditingDataStore) record(op ChangeOp, userID string) error {
+	err := ads.sink.Record(AuditEntry{Time: ads.clock.Now(), Op: op, UserID: userID})
+	if err != nil {
+		return fmt.Errorf("監査ログを記録できません: %w", err)
+	}
+	return nil
+}
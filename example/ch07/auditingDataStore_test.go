@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 書き込みのたびに、行う前に時刻と操作とユーザーIDが順に記録される
+func TestAuditingDataStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	var got []AuditEntry
+	sink := AuditSinkFunc(func(e AuditEntry) error {
+		got = append(got, e)
+		return nil
+	})
+	ads := NewAuditingDataStore(NewSimpleDataStore(), sink, NewManualClock(now))
+	ads.AddUserForID("9", "Bob")
+	ads.UpdateUserForID("9", "Rob")
+	ads.DeleteUserForID("9")
+	ads.UserNameForID(context.Background(), "1")
+
+	want := []AuditEntry{
+		{Time: now, Op: ChangeAdd, UserID: "9"},
+		{Time: now, Op: ChangeUpdate, UserID: "9"},
+		{Time: now, Op: ChangeDelete, UserID: "9"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %+v, want %+v", got, want)
+	}
+}
+
+// 記録できなかった操作は行わない
+func TestAuditingDataStoreSinkFailure(t *testing.T) {
+	down := errors.New("audit log is down")
+	ds := NewSimpleDataStore()
+	ads := NewAuditingDataStore(ds, AuditSinkFunc(func(AuditEntry) error { return down }), nil)
+	if err := ads.AddUserForID("9", "Bob"); !errors.Is(err, down) {
+		t.Errorf("err = %v, want %v", err, down)
+	}
+	if _, ok, _ := ds.UserNameForID(context.Background(), "9"); ok {
+		t.Error("user 9 was added although the audit entry could not be recorded")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+// AuthMiddlewareは、X-API-KeyヘッダがvalidKeysのどれかと一致するリクエストだけをnextに渡す。
+// validKeysはAPIキーからそのキーを持つユーザーのIDへのマップで、ユーザーのいないキーは空文字列にする。
+// キーにユーザーがいれば、そのIDをリクエストのcontextに入れる。UserIDFromContextで取り出せる。
+// ヘッダがなければ401、一致しなければ403を返す。
+// 比較にかかる時間からキーを推測されないように、全てのキーと定数時間で比較する。
+func AuthMiddleware(validKeys map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		userID, ok := validAPIKey(validKeys, key)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if userID != "" {
+			noteAccessLogUser(r.Context(), userID)
+			r = r.WithContext(context.WithValue(r.Context(), authUserIDKey, userID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validAPIKeyは、keyがvalidKeysのどれかと一致するかを定数時間で比較し、一致したキーのユーザーIDと一緒に返す
+func validAPIKey(validKeys map[string]string, key string) (string, bool) {
+	found := 0
+	var userID string
+	for k, id := range validKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = 1
+			userID = id
+		}
+	}
+	return userID, found == 1
+}
+
+// UserIDFromContextは、AuthMiddlewareがctxに入れた、APIキーを持つユーザーのIDを取り出す
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(authUserIDKey).(string)
+	return id, ok
+}
+
+// WhoAmIは、X-API-Keyのキーを持つユーザーへの挨拶を返す。AuthMiddlewareの内側で使う。
+// キーにユーザーがいなければ404を返す。
+func (c Controller) WhoAmI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if _, ok := c.query(w, r); !ok {
+		return
+	}
+	userID, ok := UserIDFromContext(r.Context())
+	if !ok {
+		c.writeError(w, http.StatusNotFound, "このAPIキーにはユーザーがいません")
+		return
+	}
+	ctx, span := c.startSpan(r, "GET /whoami")
+	defer span.End()
+	message, err := c.logic.SayHello(ctx, userID)
+	if err != nil {
+		c.writeGreetingError(w, r, userID, err)
+		return
+	}
+	c.writeMessage(w, message)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	keys := map[string]string{"secret": "1", "service": ""}
+	var gotUser string
+	h := AuthMiddleware(keys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = UserIDFromContext(r.Context())
+	}))
+	tests := []struct {
+		name       string
+		key        string
+		wantStatus int
+		wantUser   string
+	}{
+		{"missing", "", http.StatusUnauthorized, ""},
+		{"invalid", "wrong", http.StatusForbidden, ""},
+		{"valid with user", "secret", http.StatusOK, "1"},
+		{"valid without user", "service", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser = ""
+			w := sendWithHeader(h, http.MethodGet, "/users", nil, "X-API-Key", tt.key)
+			if w.Code != tt.wantStatus || gotUser != tt.wantUser {
+				t.Errorf("got %d with user %q, want %d with user %q", w.Code, gotUser, tt.wantStatus, tt.wantUser)
+			}
+		})
+	}
+}
+
+// /healthzはキーがなくても使え、/usersはキーが必要
+func TestAuthAppliedSelectively(t *testing.T) {
+	c, _, _ := newTestController(WithAPIKeys(map[string]string{"secret": ""}))
+	h := newTestHandler(t, c)
+	tests := []struct {
+		target     string
+		key        string
+		wantStatus int
+	}{
+		{"/healthz", "", http.StatusOK},
+		{"/users", "", http.StatusUnauthorized},
+		{"/users", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := sendWithHeader(h, http.MethodGet, tt.target, nil, "X-API-Key", tt.key); w.Code != tt.wantStatus {
+			t.Errorf("GET %s with key %q: status = %d, want %d", tt.target, tt.key, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+// /whoamiは、APIキーのユーザーへの挨拶を返す
+func TestWhoAmI(t *testing.T) {
+	c, _, _ := newTestController(WithAPIKeys(map[string]string{"mary": "2", "service": ""}))
+	h := newTestHandler(t, c)
+	tests := []struct {
+		key        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"mary", http.StatusOK, "Hello, Mary"},
+		{"service", http.StatusNotFound, ""},
+		{"wrong", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			w := sendWithHeader(h, http.MethodGet, "/whoami?lang=en", nil, "X-API-Key", tt.key)
+			if w.Code != tt.wantStatus || (tt.wantBody != "" && w.Body.String() != tt.wantBody) {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrForbiddenは、呼び出し元に許されていないユーザーを検索しようとしたときのエラー
+var ErrForbidden = errors.New("このユーザーは検索できません")
+
+// WithTenantは、呼び出し元のテナントをctxに入れる。AuthorizedDataStoreはこれを見て検索を許すかを決める。
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantFromContextは、WithTenantでctxに入れたテナントを取り出す
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey).(string)
+	return tenant, ok
+}
+
+// AuthorizedDataStoreは、呼び出し元と同じテナントのユーザーだけを検索させるDataStore。
+// ユーザーIDは"tenantA:123"のように、テナントと":"で始まるものとする。
+// contextにテナントがない場合や、ユーザーIDのテナントが違う場合はErrForbiddenを返す。
+type AuthorizedDataStore struct {
+	ds DataStore
+}
+
+// NewAuthorizedDataStoreは、dsの検索をテナントごとに制限するAuthorizedDataStoreを生成するファクトリ関数
+func NewAuthorizedDataStore(ds DataStore) AuthorizedDataStore {
+	return AuthorizedDataStore{ds: ds}
+}
+
+func (ads AuthorizedDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok || tenant == "" || !strings.HasPrefix(userID, tenant+":") {
+		return "", false, ErrForbidden
+	}
+	return ads.ds.UserNameForID(ctx, userID)
+}
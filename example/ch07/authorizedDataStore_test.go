@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAuthorizedDataStore(t *testing.T) {
+	sds := &SimpleDataStore{}
+	sds.AddUserForID("a:1", "Ann")
+	sds.AddUserForID("b:1", "Ben")
+	ads := NewAuthorizedDataStore(sds)
+	tenantA := WithTenant(context.Background(), "a")
+
+	if name, ok, err := ads.UserNameForID(tenantA, "a:1"); err != nil || !ok || name != "Ann" {
+		t.Errorf("own tenant: got %q, %v, %v; want Ann, true, nil", name, ok, err)
+	}
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		userID string
+	}{
+		{"other tenant", tenantA, "b:1"},
+		{"tenant is only a prefix", tenantA, "ab:1"},
+		{"no tenant", context.Background(), "a:1"},
+		{"empty tenant", WithTenant(context.Background(), ""), ":1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ads.UserNameForID(tt.ctx, tt.userID); !errors.Is(err, ErrForbidden) {
+				t.Errorf("err = %v, want ErrForbidden", err)
+			}
+		})
+	}
+	if got := errorStatus(ErrForbidden); got != http.StatusForbidden {
+		t.Errorf("errorStatus(ErrForbidden) = %d, want 403", got)
+	}
+}
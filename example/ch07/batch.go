@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// BatchLogicは、一度に複数のユーザーに挨拶できるLogic
+type BatchLogic interface {
+	SayHelloToMany(ctx context.Context, userIDs []string) (map[string]string, error)
+}
+
+// BatchErrorは、SayHelloToManyで挨拶できなかったユーザーIDとその理由
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (be BatchError) Error() string {
+	ids := make([]string, 0, len(be.Errors))
+	for id := range be.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, id+": "+be.Errors[id].Error())
+	}
+	return "挨拶できなかったユーザーがいます: " + strings.Join(parts, ", ")
+}
+
+// SayHelloToManyは、userIDsのユーザーそれぞれに既定の言語で挨拶する。
+// 挨拶できなかったユーザーがいても残りのユーザーには挨拶し、挨拶の文と一緒にBatchErrorを返す。
+func (sl SimpleLogic) SayHelloToMany(ctx context.Context, userIDs []string) (map[string]string, error) {
+	return sayHelloToMany(ctx, sl, userIDs)
+}
+
+// sayHelloToManyは、logicのSayHelloでuserIDsのユーザーそれぞれに挨拶する。SayHelloToManyの中身。
+func sayHelloToMany(ctx context.Context, logic Logic, userIDs []string) (map[string]string, error) {
+	messages := map[string]string{}
+	errs := map[string]error{}
+	for _, id := range userIDs {
+		message, err := logic.SayHello(ctx, id)
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		messages[id] = message
+	}
+	if len(errs) > 0 {
+		return messages, BatchError{Errors: errs}
+	}
+	return messages, nil
+}
+
+// batchResponseは、SayHelloBatchが返すJSON
+type batchResponse struct {
+	Messages map[string]string `json:"messages"`
+	Errors   map[string]string `json:"errors"`
+}
+
+// SayHelloBatchは、リクエストボディのユーザーIDのJSON配列のそれぞれに挨拶し、
+// 挨拶の文とユーザーごとのエラーをJSONで返す。
+// ボディがユーザーIDの配列として読めなければ400を返す。不明なユーザーのような利用者の間違いはerrorsに入れて200で返すが、
+// データストアが失敗したような500になるエラーが1人でもあれば、全体を500にする。
+func (c Controller) SayHelloBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	bl, ok := c.logic.(BatchLogic)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "まとめて挨拶できないロジック")
+		return
+	}
+	var userIDs []string
+	if !c.decodeBody(w, r, &userIDs) {
+		return
+	}
+	messages, err := bl.SayHelloToMany(r.Context(), userIDs)
+	resp := batchResponse{Messages: messages, Errors: map[string]string{}}
+	var be BatchError
+	if errors.As(err, &be) {
+		if serr := serverError(be.Errors); serr != nil {
+			c.WriteError(w, r, serr)
+			return
+		}
+		for id, e := range be.Errors {
+			resp.Errors[id] = e.Error()
+		}
+	} else if err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	if resp.Messages == nil {
+		resp.Messages = map[string]string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// serverErrorは、errsのうち500以上のステータスコードになるエラーを1つ返す。どれを返すかが毎回変わらないように、ユーザーIDの順に探す。
+// なければnilを返す。
+func serverError(errs map[string]error) error {
+	ids := make([]string, 0, len(errs))
+	for id := range errs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if errorStatus(errs[id]) >= http.StatusInternalServerError {
+			return errs[id]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 不明なユーザーが混ざっていても、残りのユーザーには挨拶し、不明なユーザーはエラーのマップに入れる
+func TestSayHelloToMany(t *testing.T) {
+	l := &MemoryLogger{}
+	logic := NewSimpleLogic(l, NewSimpleDataStore(), DefaultConfig())
+	messages, err := logic.SayHelloToMany(context.Background(), []string{"1", "99", "2"})
+	want := map[string]string{"1": "Fredさん　こんにちは。", "2": "Maryさん　こんにちは。"}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("messages = %v, want %v", messages, want)
+	}
+	var be BatchError
+	if !errors.As(err, &be) {
+		t.Fatalf("err = %v, want a BatchError", err)
+	}
+	if len(be.Errors) != 1 || !errors.Is(be.Errors["99"], ErrUnknownUser) {
+		t.Errorf("Errors = %v, want only 99 with ErrUnknownUser", be.Errors)
+	}
+}
+
+func TestSayHelloBatch(t *testing.T) {
+	c, _, _ := newTestController()
+	w := send(http.HandlerFunc(c.SayHelloBatch), http.MethodPost, "/hello/batch", strings.NewReader(`["1","99"]`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", w.Code, w.Body.String())
+	}
+	var got batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Messages["1"] != "Fredさん　こんにちは。" || len(got.Messages) != 1 {
+		t.Errorf("messages = %v, want only user 1", got.Messages)
+	}
+	if _, ok := got.Errors["99"]; !ok || len(got.Errors) != 1 {
+		t.Errorf("errors = %v, want only user 99", got.Errors)
+	}
+
+	if w := send(http.HandlerFunc(c.SayHelloBatch), http.MethodPost, "/hello/batch", strings.NewReader(`{"1":"x"}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("non-array body: status = %d, want 400", w.Code)
+	}
+}
+
+// 読めない本文は400、データストアの失敗は500、不明なユーザーだけならその項目のエラーにして200にする
+func TestBatchAndStreamStatus(t *testing.T) {
+	sds := NewSimpleDataStore()
+	broken := failingStore{errors.New("sql: connection refused")}
+	tests := []struct {
+		name     string
+		ds       DataStore
+		body     string
+		want     int
+		contains string
+	}{
+		{"malformed body", sds, `{"not":"array"}`, http.StatusBadRequest, ""},
+		{"truncated body", sds, `["1",`, http.StatusBadRequest, ""},
+		{"store failure", broken, `["1"]`, http.StatusInternalServerError, ""},
+		{"unknown user", sds, `["1","nope"]`, http.StatusOK, "不明なユーザー"},
+	}
+	for _, path := range []string{"/hello/batch", "/hello/stream"} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				l := &MemoryLogger{}
+				h := newTestHandler(t, NewController(l, NewSimpleLogic(l, tt.ds, DefaultConfig()), sds))
+				w := send(h, http.MethodPost, path, strings.NewReader(tt.body))
+				if w.Code != tt.want {
+					t.Errorf("status %d, want %d (body %q)", w.Code, tt.want, w.Body.String())
+				}
+				if !strings.Contains(w.Body.String(), tt.contains) {
+					t.Errorf("body %q does not contain %q", w.Body.String(), tt.contains)
+				}
+				if strings.Contains(w.Body.String(), "sql:") {
+					t.Errorf("body %q leaks the store error", w.Body.String())
+				}
+			})
+		}
+	}
+}
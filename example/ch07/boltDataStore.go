@@ -0,0 +1,115 @@
+//go:build bolt
+
+package main
+
+import (
+	"context"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// このファイルはgo.etcd.io/bboltに依存するので、-tags boltを付けたときだけビルドする。
+// implementations.goはタグなしでもビルドできるように、ここで実装を確かめる。
+var (
+	_ WritableDataStore = (*BoltDataStore)(nil)
+	_ Lister            = (*BoltDataStore)(nil)
+)
+
+// boltUsersBucketは、BoltDataStoreがユーザーIDから名前を保存するバケット
+var boltUsersBucket = []byte("users")
+
+// boltOpenTimeoutは、ほかのプロセスがファイルをロックしているときに、開くのをあきらめるまでの時間
+const boltOpenTimeout = time.Second
+
+// BoltDataStoreは、埋め込みのbboltファイルのusersバケットにユーザーを保存するデータストア。
+// ほかのデータベースを動かさずに、1つのバイナリとファイルだけでユーザーを永続化できる。
+// 読み出しはViewの、書き込みはUpdateのトランザクションで行う。使い終わったらCloseを呼ぶ。
+type BoltDataStore struct {
+	db *bolt.DB
+}
+
+// NewBoltDataStoreは、pathのbboltファイルを使うBoltDataStoreを生成するファクトリ関数。
+// ファイルとバケットがなければ作る。
+func NewBoltDataStore(path string) (*BoltDataStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltUsersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltDataStore{db: db}, nil
+}
+
+// UserNameForIDは、userIDの名前を返す。bboltのトランザクションは途中で打ち切れないので、ctxは始める前にだけ確かめる。
+func (bds *BoltDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	var name string
+	var ok bool
+	err := bds.db.View(func(tx *bolt.Tx) error {
+		// Getが返すスライスはトランザクションの間しか使えないので、文字列に写す
+		if v := tx.Bucket(boltUsersBucket).Get([]byte(userID)); v != nil {
+			name, ok = string(v), true
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return name, ok, nil
+}
+
+// AllUsersは、全てのユーザーをユーザーIDから名前へのマップで返す。読めなければ空のマップを返す。
+func (bds *BoltDataStore) AllUsers() map[string]string {
+	users := map[string]string{}
+	bds.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUsersBucket).ForEach(func(k, v []byte) error {
+			users[string(k)] = string(v)
+			return nil
+		})
+	})
+	return users
+}
+
+func (bds *BoltDataStore) AddUserForID(userID, name string) error {
+	return bds.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltUsersBucket)
+		if b.Get([]byte(userID)) != nil {
+			return ErrUserExists
+		}
+		return b.Put([]byte(userID), []byte(name))
+	})
+}
+
+func (bds *BoltDataStore) UpdateUserForID(userID, newName string) error {
+	return bds.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltUsersBucket)
+		if b.Get([]byte(userID)) == nil {
+			return ErrUnknownUser
+		}
+		return b.Put([]byte(userID), []byte(newName))
+	})
+}
+
+func (bds *BoltDataStore) DeleteUserForID(userID string) error {
+	return bds.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltUsersBucket)
+		if b.Get([]byte(userID)) == nil {
+			return ErrUnknownUser
+		}
+		return b.Delete([]byte(userID))
+	})
+}
+
+// Closeは、bboltのファイルを閉じる
+func (bds *BoltDataStore) Close() error {
+	return bds.db.Close()
+}
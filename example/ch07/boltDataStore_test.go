@@ -0,0 +1,74 @@
+//go:build bolt
+
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 書き込んだユーザーは、閉じて開き直したファイルから読める
+func TestBoltDataStoreReadWriteDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.db")
+	bds, err := NewBoltDataStore(path)
+	if err != nil {
+		t.Fatalf("NewBoltDataStore: %v", err)
+	}
+	ctx := context.Background()
+	if _, ok, err := bds.UserNameForID(ctx, "1"); ok || err != nil {
+		t.Fatalf("UserNameForID in an empty file = %v, %v; want not found", ok, err)
+	}
+	if err := bds.AddUserForID("1", "Fred"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	if err := bds.AddUserForID("1", "Fred"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("AddUserForID twice = %v, want ErrUserExists", err)
+	}
+	if err := bds.AddUserForID("2", "Mary"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	if err := bds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Fatalf("UpdateUserForID: %v", err)
+	}
+	if err := bds.UpdateUserForID("9", "Bob"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("UpdateUserForID(9) = %v, want ErrUnknownUser", err)
+	}
+	if err := bds.DeleteUserForID("2"); err != nil {
+		t.Fatalf("DeleteUserForID: %v", err)
+	}
+	if err := bds.DeleteUserForID("2"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("DeleteUserForID twice = %v, want ErrUnknownUser", err)
+	}
+	if err := bds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	bds, err = NewBoltDataStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer bds.Close()
+	if name, ok, err := bds.UserNameForID(ctx, "1"); err != nil || !ok || name != "Freddie" {
+		t.Errorf("UserNameForID(1) after reopen = %q, %v, %v; want Freddie", name, ok, err)
+	}
+	if got := bds.AllUsers(); !reflect.DeepEqual(got, map[string]string{"1": "Freddie"}) {
+		t.Errorf("AllUsers() = %v, want only Freddie", got)
+	}
+}
+
+// キャンセルしたcontextでは、トランザクションを始めずにエラーを返す
+func TestBoltDataStoreCancelled(t *testing.T) {
+	bds, err := NewBoltDataStore(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("NewBoltDataStore: %v", err)
+	}
+	defer bds.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := bds.UserNameForID(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("UserNameForID = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrCapacityExceededは、BoundedDataStoreのユーザーが上限に達しているのに追加しようとしたときのエラー
+var ErrCapacityExceeded = errors.New("ユーザーの数が上限に達しています")
+
+// BoundedDataStoreは、ユーザーの数がmax人に達したら、それ以上の追加をErrCapacityExceededで断るWritableDataStore。
+// 更新と削除はそのまま包んだデータストアに渡すので、削除すればまた追加できる。
+// 数えているのはこのBoundedDataStoreを通した追加と削除なので、包んだデータストアに直接書き込まないこと。
+// 数を確かめてから追加するまでを1つのロックで守るので、同時に追加されても上限を超えない。
+type BoundedDataStore struct {
+	ds  WritableDataStore
+	max int
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewBoundedDataStoreは、dsのユーザーをmax人までにするBoundedDataStoreを生成するファクトリ関数。
+// dsがCounterなら、今いるユーザーも数に入れる。
+func NewBoundedDataStore(ds WritableDataStore, max int) *BoundedDataStore {
+	bds := &BoundedDataStore{ds: ds, max: max}
+	if c, ok := ds.(Counter); ok {
+		bds.n = c.UserCount()
+	}
+	return bds
+}
+
+func (bds *BoundedDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	return bds.ds.UserNameForID(ctx, userID)
+}
+
+func (bds *BoundedDataStore) AddUserForID(userID, name string) error {
+	return bds.add(func() error {
+		return bds.ds.AddUserForID(userID, name)
+	})
+}
+
+// AddUserは、包んだデータストアがIDAssignerなら、上限を確かめてからそのAddUserでユーザーを追加する。
+// IDAssignerでなければ、IDを作れないというエラーを返す。
+func (bds *BoundedDataStore) AddUser(name string) (string, error) {
+	assigner, ok := bds.ds.(IDAssigner)
+	if !ok {
+		return "", errors.New("IDを作れないデータストア")
+	}
+	var id string
+	err := bds.add(func() error {
+		var err error
+		id, err = assigner.AddUser(name)
+		return err
+	})
+	return id, err
+}
+
+// addは、上限に達していなければaddUserで追加し、成功したら数を増やす
+func (bds *BoundedDataStore) add(addUser func() error) error {
+	bds.mu.Lock()
+	defer bds.mu.Unlock()
+	if bds.n >= bds.max {
+		return ErrCapacityExceeded
+	}
+	if err := addUser(); err != nil {
+		return err
+	}
+	bds.n++
+	return nil
+}
+
+func (bds *BoundedDataStore) UpdateUserForID(userID, newName string) error {
+	return bds.ds.UpdateUserForID(userID, newName)
+}
+
+func (bds *BoundedDataStore) DeleteUserForID(userID string) error {
+	bds.mu.Lock()
+	defer bds.mu.Unlock()
+	if err := bds.ds.DeleteUserForID(userID); err != nil {
+		return err
+	}
+	bds.n--
+	return nil
+}
+
+// UserCountは、このBoundedDataStoreが数えているユーザーの数を返す
+func (bds *BoundedDataStore) UserCount() int {
+	bds.mu.Lock()
+	defer bds.mu.Unlock()
+	return bds.n
+}
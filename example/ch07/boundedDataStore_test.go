@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 同時にたくさん追加しても上限を超えず、超えた分はErrCapacityExceededになる
+func TestBoundedDataStoreConcurrentAdds(t *testing.T) {
+	const max = 10
+	sds := NewSimpleDataStore()
+	bds := NewBoundedDataStore(sds, max)
+	var (
+		mu       sync.Mutex
+		added    int
+		rejected int
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				err = bds.AddUserForID("u"+strconv.Itoa(i), "Ann")
+			} else {
+				_, err = bds.AddUser("Bob")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				added++
+			case errors.Is(err, ErrCapacityExceeded):
+				rejected++
+			default:
+				t.Errorf("add %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// 最初からいる3人も数に入る
+	if added != max-3 || rejected != 50-(max-3) {
+		t.Errorf("added %d and rejected %d, want %d and %d", added, rejected, max-3, 50-(max-3))
+	}
+	if n := sds.UserCount(); n != max {
+		t.Errorf("the store has %d users, want %d", n, max)
+	}
+	if n := bds.UserCount(); n != max {
+		t.Errorf("UserCount() = %d, want %d", n, max)
+	}
+}
+
+// いっぱいでも更新と削除はでき、削除すれば空いた分だけまた追加できる
+func TestBoundedDataStoreUpdateAndDelete(t *testing.T) {
+	bds := NewBoundedDataStore(NewSimpleDataStore(), 3)
+	if err := bds.AddUserForID("4", "Ann"); !errors.Is(err, ErrCapacityExceeded) {
+		t.Fatalf("AddUserForID when full = %v, want ErrCapacityExceeded", err)
+	}
+	if err := bds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Errorf("UpdateUserForID when full: %v", err)
+	}
+	if err := bds.DeleteUserForID("1"); err != nil {
+		t.Fatalf("DeleteUserForID: %v", err)
+	}
+	if err := bds.AddUserForID("4", "Ann"); err != nil {
+		t.Errorf("AddUserForID after a delete: %v", err)
+	}
+	// 失敗した削除は数を変えない
+	if err := bds.DeleteUserForID("nope"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("DeleteUserForID(nope) = %v, want ErrUnknownUser", err)
+	}
+	if err := bds.AddUserForID("5", "Bob"); !errors.Is(err, ErrCapacityExceeded) {
+		t.Errorf("AddUserForID after a failed delete = %v, want ErrCapacityExceeded", err)
+	}
+}
+
+// いっぱいのデータストアへのPOST /usersは507になる
+func TestAddUserCapacityExceeded(t *testing.T) {
+	c := NewController(&MemoryLogger{}, nil, NewBoundedDataStore(NewSimpleDataStore(), 3))
+	w := send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(`{"user_id":"4","name":"Ann"}`))
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("status %d, want 507", w.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosedは、BusinessHoursLogicの営業時間外に挨拶しようとしたときのエラー
+var ErrClosed = errors.New("closed: 営業時間外です")
+
+// BusinessHoursLogicは、営業時間の間だけ包んだLogicに挨拶させ、それ以外はErrClosedを返すLogic
+type BusinessHoursLogic struct {
+	logic  Logic
+	opens  time.Duration
+	closes time.Duration
+	loc    *time.Location
+	clock  Clock
+}
+
+// NewBusinessHoursLogicは、locの0時からopensの時刻からclosesの時刻の前までだけlogicに挨拶させるBusinessHoursLogicを生成するファクトリ関数。
+// 9時から17時なら、opensに9*time.Hour、closesに17*time.Hourを渡す。
+// opensがclosesより後なら、22時から翌朝6時のように日をまたぐ営業時間になる。
+// locがnilならUTCを、clockがnilならRealClockを使う。
+func NewBusinessHoursLogic(logic Logic, opens, closes time.Duration, loc *time.Location, clock Clock) BusinessHoursLogic {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return BusinessHoursLogic{
+		logic:  logic,
+		opens:  opens,
+		closes: closes,
+		loc:    loc,
+		clock:  clockOrReal(clock),
+	}
+}
+
+func (bl BusinessHoursLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	if !bl.isOpen() {
+		return "", ErrClosed
+	}
+	return bl.logic.SayHello(ctx, userID)
+}
+
+func (bl BusinessHoursLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	if !bl.isOpen() {
+		return "", ErrClosed
+	}
+	return bl.logic.SayGoodbye(ctx, userID)
+}
+
+// isOpenは、今がbl.locで営業時間の間かを返す
+func (bl BusinessHoursLogic) isOpen() bool {
+	now := bl.clock.Now().In(bl.loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, bl.loc)
+	t := now.Sub(midnight)
+	if bl.opens <= bl.closes {
+		return bl.opens <= t && t < bl.closes
+	}
+	return bl.opens <= t || t < bl.closes
+}
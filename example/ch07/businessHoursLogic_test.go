@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBusinessHoursLogic(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	base := NewSimpleLogic(&MemoryLogger{}, NewSimpleDataStore(), DefaultConfig())
+	tests := []struct {
+		name          string
+		opens, closes time.Duration
+		now           time.Time
+		wantErr       error
+	}{
+		{"in hours", 9 * time.Hour, 17 * time.Hour, time.Date(2024, 1, 1, 10, 0, 0, 0, jst), nil},
+		{"at opening", 9 * time.Hour, 17 * time.Hour, time.Date(2024, 1, 1, 9, 0, 0, 0, jst), nil},
+		{"at closing", 9 * time.Hour, 17 * time.Hour, time.Date(2024, 1, 1, 17, 0, 0, 0, jst), ErrClosed},
+		{"before opening", 9 * time.Hour, 17 * time.Hour, time.Date(2024, 1, 1, 8, 59, 0, 0, jst), ErrClosed},
+		// UTCでは前日の23時だが、JSTでは営業時間の8時
+		{"in hours in JST", 8 * time.Hour, 17 * time.Hour, time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC), nil},
+		{"overnight, late", 22 * time.Hour, 6 * time.Hour, time.Date(2024, 1, 1, 23, 0, 0, 0, jst), nil},
+		{"overnight, early", 22 * time.Hour, 6 * time.Hour, time.Date(2024, 1, 1, 5, 0, 0, 0, jst), nil},
+		{"overnight, daytime", 22 * time.Hour, 6 * time.Hour, time.Date(2024, 1, 1, 12, 0, 0, 0, jst), ErrClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bl := NewBusinessHoursLogic(base, tt.opens, tt.closes, jst, NewManualClock(tt.now))
+			if _, err := bl.SayHello(context.Background(), "1"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("SayHello: err = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := bl.SayGoodbye(context.Background(), "1"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("SayGoodbye: err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 営業時間外は、Controllerが503を返す
+func TestBusinessHoursLogicController(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	l := &MemoryLogger{}
+	bl := NewBusinessHoursLogic(NewSimpleLogic(l, NewSimpleDataStore(), DefaultConfig()), 9*time.Hour, 17*time.Hour, nil, clock)
+	h := http.HandlerFunc(NewController(l, bl, nil).SayHello)
+	if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+		t.Errorf("in hours: status %d, want 200", w.Code)
+	}
+	clock.Advance(8 * time.Hour)
+	if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("out of hours: status %d, want 503", w.Code)
+	}
+}
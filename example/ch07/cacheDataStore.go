@@ -0,0 +1,183 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CacheDataStoreは、包んだDataStoreのUserNameForIDの結果をttlの間メモリに覚えておくDataStore。
+// 見つからなかったという結果も覚えておく。エラーは覚えない。
+// 包んだDataStoreを直接書き換えたら、InvalidateかPurgeで忘れさせること。
+// 覚えておくのはmaxEntries件までで、いっぱいになったら期限が一番近いものから忘れる。期限が切れたものは、次に覚えるときに忘れる。
+type CacheDataStore struct {
+	ds         DataStore
+	ttl        time.Duration
+	maxEntries int
+	clock      Clock
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// orderは、覚えた結果を期限の近い順に並べたもの。ttlは全て同じなので、覚えた順と同じになる。
+	order *list.List
+	// genは、InvalidateとPurgeのたびに増やす番号。検索している間に忘れさせられた古い結果を覚えないために使う。
+	gen    uint64
+	hits   int
+	misses int
+}
+
+// cacheEntryは、CacheDataStoreが覚えておく1件の結果
+type cacheEntry struct {
+	userID  string
+	name    string
+	ok      bool
+	expires time.Time
+}
+
+// NewCacheDataStoreは、dsの結果をttlの間、最大maxEntries件まで覚えておくCacheDataStoreを生成するファクトリ関数。
+// 期限はclockの時刻で判断する。clockがnilなら本当の時刻を使う。maxEntriesが1より小さければ1件だけ覚える。
+func NewCacheDataStore(ds DataStore, ttl time.Duration, maxEntries int, clock Clock) *CacheDataStore {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &CacheDataStore{
+		ds:         ds,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		clock:      clockOrReal(clock),
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+func (cds *CacheDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	cds.mu.Lock()
+	if el, found := cds.entries[userID]; found {
+		e := el.Value.(cacheEntry)
+		if cds.clock.Now().Before(e.expires) {
+			cds.hits++
+			cds.mu.Unlock()
+			return e.name, e.ok, nil
+		}
+		cds.remove(el)
+	}
+	cds.misses++
+	cds.mu.Unlock()
+
+	return cds.fetch(ctx, userID)
+}
+
+// fetchは、包んだDataStoreでuserIDを検索し、エラーでなければ結果を覚えておく。
+// 検索している間にInvalidateかPurgeが呼ばれたら、書き換える前の結果かもしれないので覚えない。
+func (cds *CacheDataStore) fetch(ctx context.Context, userID string) (string, bool, error) {
+	cds.mu.Lock()
+	gen := cds.gen
+	cds.mu.Unlock()
+	name, ok, err := cds.ds.UserNameForID(ctx, userID)
+	if err != nil {
+		return "", false, err
+	}
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	if cds.gen != gen {
+		return name, ok, nil
+	}
+	now := cds.clock.Now()
+	if el, found := cds.entries[userID]; found {
+		cds.remove(el)
+	}
+	for front := cds.order.Front(); front != nil && !now.Before(front.Value.(cacheEntry).expires); front = cds.order.Front() {
+		cds.remove(front)
+	}
+	for cds.order.Len() >= cds.maxEntries {
+		cds.remove(cds.order.Front())
+	}
+	cds.entries[userID] = cds.order.PushBack(cacheEntry{userID: userID, name: name, ok: ok, expires: now.Add(cds.ttl)})
+	return name, ok, nil
+}
+
+// removeは、覚えていた結果elを忘れる。cds.muをロックしてから呼ぶこと。
+func (cds *CacheDataStore) remove(el *list.Element) {
+	cds.order.Remove(el)
+	delete(cds.entries, el.Value.(cacheEntry).userID)
+}
+
+// Warmupは、srcの全てのユーザーを包んだDataStoreで検索して覚えておく。起動したばかりで空のキャッシュのせいで、最初のリクエストが遅くならないように使う。
+// データストアに負荷を掛けすぎないように、同時にはconcurrency件までしか検索しない。
+// 検索できなかったユーザーは飛ばして残りを続け、そのエラーをまとめて返す。ctxが終わったら、まだ検索していないユーザーは検索しない。
+// 当たった回数と外れた回数には数えない。
+func (cds *CacheDataStore) Warmup(ctx context.Context, src Lister, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for id := range src.AllUsers() {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, _, err := cds.fetch(ctx, id); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("user_id=%s: %w", id, err))
+				mu.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Invalidateは、userIDについて覚えている結果を忘れる。包んだDataStoreを直接書き換えた後に呼ぶ。
+func (cds *CacheDataStore) Invalidate(userID string) {
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	cds.gen++
+	if el, found := cds.entries[userID]; found {
+		cds.remove(el)
+	}
+}
+
+// Purgeは、覚えている結果を全て忘れる。Restoreのように中身を丸ごと置き換えた後に呼ぶ。
+func (cds *CacheDataStore) Purge() {
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	cds.gen++
+	cds.entries = map[string]*list.Element{}
+	cds.order.Init()
+}
+
+// Statsは、これまでにキャッシュに当たった回数と外れた回数を返す
+func (cds *CacheDataStore) Stats() (hits, misses int) {
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	return cds.hits, cds.misses
+}
+
+// Lenは、今覚えている結果の件数を返す。期限が切れてまだ忘れていないものも数える。
+func (cds *CacheDataStore) Len() int {
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	return cds.order.Len()
+}
+
+// Unwrapは、包んだデータストアを返す
+func (cds *CacheDataStore) Unwrap() DataStore {
+	return cds.ds
+}
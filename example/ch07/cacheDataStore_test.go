@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingStoreは、包んだDataStoreが何回検索されたかを数えるDataStore
+type countingStore struct {
+	DataStore
+	mu    sync.Mutex
+	calls int
+}
+
+func (cs *countingStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	cs.mu.Lock()
+	cs.calls++
+	cs.mu.Unlock()
+	return cs.DataStore.UserNameForID(ctx, userID)
+}
+
+func (cs *countingStore) Calls() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.calls
+}
+
+// ttlの間は覚えた結果を返し、時計を進めて期限を過ぎたら包んだデータストアから読み直すことを確かめる
+func TestCacheDataStoreExpiry(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cs := &countingStore{DataStore: NewSimpleDataStore()}
+	cds := NewCacheDataStore(cs, time.Minute, 100, clock)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if name, ok, err := cds.UserNameForID(ctx, "1"); name != "Fred" || !ok || err != nil {
+			t.Fatalf("UserNameForID(1) = %q, %v, %v", name, ok, err)
+		}
+	}
+	if hits, misses := cds.Stats(); hits != 2 || misses != 1 || cs.Calls() != 1 {
+		t.Errorf("before expiry: hits=%d misses=%d calls=%d, want 2, 1, 1", hits, misses, cs.Calls())
+	}
+
+	clock.Advance(time.Minute)
+	cds.UserNameForID(ctx, "1")
+	if hits, misses := cds.Stats(); hits != 2 || misses != 2 || cs.Calls() != 2 {
+		t.Errorf("after expiry: hits=%d misses=%d calls=%d, want 2, 2, 2", hits, misses, cs.Calls())
+	}
+}
+
+// 見つからなかったという結果も覚えておく
+func TestCacheDataStoreCachesNotFound(t *testing.T) {
+	cs := &countingStore{DataStore: NewSimpleDataStore()}
+	cds := NewCacheDataStore(cs, time.Minute, 100, NewManualClock(time.Now()))
+	for i := 0; i < 2; i++ {
+		if _, ok, _ := cds.UserNameForID(context.Background(), "99"); ok {
+			t.Fatal("user 99 was found")
+		}
+	}
+	if cs.Calls() != 1 {
+		t.Errorf("calls = %d, want 1", cs.Calls())
+	}
+}
+
+// maxEntries件を超えて覚えようとしたら、期限が一番近いものから忘れる
+func TestCacheDataStoreMaxEntries(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cds := NewCacheDataStore(NewSimpleDataStore(), time.Minute, 2, clock)
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		cds.UserNameForID(ctx, id)
+		clock.Advance(time.Second)
+	}
+	if n := cds.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+	cds.UserNameForID(ctx, "3")
+	cds.UserNameForID(ctx, "1")
+	if hits, misses := cds.Stats(); hits != 1 || misses != 4 {
+		t.Errorf("hits=%d misses=%d, want 1, 4 (user 1 should have been evicted)", hits, misses)
+	}
+}
+
+// 期限の切れた結果は、検索されなくても次に覚えるときに忘れるので、たまり続けない
+func TestCacheDataStoreDropsExpired(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cds := NewCacheDataStore(NewSimpleDataStore(), time.Minute, 1000, clock)
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		cds.UserNameForID(ctx, strconv.Itoa(i))
+	}
+	clock.Advance(time.Minute)
+	cds.UserNameForID(ctx, "1")
+	if n := cds.Len(); n != 1 {
+		t.Errorf("Len() = %d, want 1", n)
+	}
+}
+
+// Invalidateは1人分の結果だけを、Purgeは全ての結果を忘れさせる
+func TestCacheDataStoreInvalidateAndPurge(t *testing.T) {
+	sds := NewSimpleDataStore()
+	cs := &countingStore{DataStore: sds}
+	cds := NewCacheDataStore(cs, time.Hour, 100, NewManualClock(time.Now()))
+	ctx := context.Background()
+	cds.UserNameForID(ctx, "1")
+	cds.UserNameForID(ctx, "2")
+
+	sds.UpdateUserForID("1", "Freddie")
+	if name, _, _ := cds.UserNameForID(ctx, "1"); name != "Fred" {
+		t.Fatalf("before Invalidate: user 1 = %q, want the cached Fred", name)
+	}
+	cds.Invalidate("1")
+	if name, _, _ := cds.UserNameForID(ctx, "1"); name != "Freddie" {
+		t.Errorf("after Invalidate: user 1 = %q, want Freddie", name)
+	}
+	if n := cs.Calls(); n != 3 {
+		t.Errorf("store calls = %d, want 3: user 2 must still be cached", n)
+	}
+
+	cds.Purge()
+	if n := cds.Len(); n != 0 {
+		t.Errorf("after Purge: Len() = %d, want 0", n)
+	}
+	cds.UserNameForID(ctx, "2")
+	if n := cs.Calls(); n != 4 {
+		t.Errorf("store calls = %d, want 4 after Purge", n)
+	}
+}
+
+// pausingStoreは、包んだDataStoreで検索した後、releaseが閉じられるまで結果を返さないDataStore。
+// 検索を終えたことはlookedで知らせる。
+type pausingStore struct {
+	DataStore
+	looked  chan struct{}
+	release chan struct{}
+}
+
+func (ps pausingStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	name, ok, err := ps.DataStore.UserNameForID(ctx, userID)
+	ps.looked <- struct{}{}
+	<-ps.release
+	return name, ok, err
+}
+
+// 検索している間にInvalidateかPurgeが呼ばれたら、その検索の古い結果は覚えない
+func TestCacheDataStoreInvalidateDuringFetch(t *testing.T) {
+	for name, forget := range map[string]func(*CacheDataStore){
+		"invalidate": func(cds *CacheDataStore) { cds.Invalidate("1") },
+		"purge":      (*CacheDataStore).Purge,
+	} {
+		t.Run(name, func(t *testing.T) {
+			sds := NewSimpleDataStore()
+			ps := pausingStore{DataStore: sds, looked: make(chan struct{}, 4), release: make(chan struct{})}
+			cds := NewCacheDataStore(ps, time.Minute, 100, nil)
+			ctx := context.Background()
+			done := make(chan string)
+			go func() {
+				name, _, _ := cds.UserNameForID(ctx, "1")
+				done <- name
+			}()
+			<-ps.looked
+			if err := sds.UpdateUserForID("1", "Freddie"); err != nil {
+				t.Fatal(err)
+			}
+			forget(cds)
+			close(ps.release)
+			if got := <-done; got != "Fred" {
+				t.Errorf("the paused lookup returned %q, want the old Fred", got)
+			}
+			if got, _, _ := cds.UserNameForID(ctx, "1"); got != "Freddie" {
+				t.Errorf("UserNameForID after %s = %q, want Freddie", name, got)
+			}
+		})
+	}
+}
+
+// listingStoreは、usersを列挙でき、検索の回数を数え、failのIDの検索だけをエラーにするDataStore
+type listingStore struct {
+	mu    sync.Mutex
+	users map[string]string
+	fail  string
+	calls int
+}
+
+func (ls *listingStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.calls++
+	if userID == ls.fail {
+		return "", false, errors.New("boom")
+	}
+	name, ok := ls.users[userID]
+	return name, ok, nil
+}
+
+func (ls *listingStore) AllUsers() map[string]string {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	users := map[string]string{}
+	for id, name := range ls.users {
+		users[id] = name
+	}
+	return users
+}
+
+func (ls *listingStore) Calls() int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.calls
+}
+
+// 温めた後の検索は包んだデータストアに届かない。検索できなかったユーザーは飛ばして、そのエラーを返す。
+func TestCacheDataStoreWarmup(t *testing.T) {
+	ls := &listingStore{users: map[string]string{"1": "Fred", "2": "Mary", "3": "Bob", "bad": "x"}, fail: "bad"}
+	cds := NewCacheDataStore(ls, time.Minute, 10, nil)
+	if err := cds.Warmup(context.Background(), ls, 2); err == nil || !strings.Contains(err.Error(), "user_id=bad: boom") {
+		t.Errorf("Warmup = %v, want the error for bad", err)
+	}
+	before := ls.Calls()
+	for _, id := range []string{"1", "2", "3"} {
+		if name, ok, err := cds.UserNameForID(context.Background(), id); err != nil || !ok || name != ls.users[id] {
+			t.Errorf("UserNameForID(%s) = %q, %v, %v", id, name, ok, err)
+		}
+	}
+	if calls := ls.Calls(); calls != before {
+		t.Errorf("the backend was searched %d more times after the warmup", calls-before)
+	}
+	if hits, misses := cds.Stats(); hits != 3 || misses != 0 {
+		t.Errorf("Stats() = %d hits, %d misses; want 3 and 0 not counting the warmup", hits, misses)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewCacheDataStore(ls, time.Minute, 10, nil).Warmup(ctx, ls, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Warmup with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+// cfg.CacheWarmupなら、Buildが返す前に温め終わっている。温められないユーザーがいても組み立ては続ける。
+func TestBuildCacheWarmup(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LogLevel = LevelError
+	cfg.StoreDecorators = []string{"metrics", "cache"}
+	cfg.CacheWarmup = true
+	ls := &listingStore{users: map[string]string{"1": "Fred", "2": "Mary", "bad": "x"}, fail: "bad"}
+	app, err := Build(cfg, WithDataStoreFactory(func(Config) (DataStore, error) { return ls, nil }))
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer app.Close()
+	if calls := ls.Calls(); calls != 3 {
+		t.Fatalf("the warmup searched %d times, want 3", calls)
+	}
+	if w := send(app.Handler, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", w.Code)
+	}
+	if calls := ls.Calls(); calls != 3 {
+		t.Errorf("/hello reached the backend after the warmup (%d searches)", calls)
+	}
+
+	cfg.CacheWarmupWorkers = 0
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate with no warmup workers = nil, want an error")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// CachingLogicは、包んだLogicのSayHelloが成功したときの挨拶を、ユーザーIDとcontextの言語ごとに覚えておくLogic。
+// エラーは覚えない。ユーザーが変わったら、HandleChangeかInvalidateで忘れさせる。
+// SayGoodbyeはそのまま包んだLogicに渡す。
+type CachingLogic struct {
+	logic      Logic
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]map[string]string
+	size    int
+	// genは、Invalidateのたびに増やす。包んだLogicを呼んでいる間に忘れさせられた古い挨拶を覚えないために使う。
+	gen uint64
+}
+
+// NewCachingLogicは、logicの挨拶を最大maxEntries件まで覚えておくCachingLogicを生成するファクトリ関数。
+// 言語はリクエストで自由に指定できるので、覚える数に上限を設ける。上限に達したら、それ以上は覚えない。
+func NewCachingLogic(logic Logic, maxEntries int) *CachingLogic {
+	return &CachingLogic{
+		logic:      logic,
+		maxEntries: maxEntries,
+		entries:    map[string]map[string]string{},
+	}
+}
+
+func (cl *CachingLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	lang := LanguageFromContext(ctx)
+	cl.mu.Lock()
+	message, ok := cl.entries[userID][lang]
+	gen := cl.gen
+	cl.mu.Unlock()
+	if ok {
+		return message, nil
+	}
+	message, err := cl.logic.SayHello(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.gen != gen || cl.size >= cl.maxEntries {
+		return message, nil
+	}
+	byLang := cl.entries[userID]
+	if byLang == nil {
+		byLang = map[string]string{}
+		cl.entries[userID] = byLang
+	}
+	if _, ok := byLang[lang]; !ok {
+		cl.size++
+	}
+	byLang[lang] = message
+	return message, nil
+}
+
+func (cl *CachingLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	return cl.logic.SayGoodbye(ctx, userID)
+}
+
+// Invalidateは、userIDについて覚えている挨拶を全ての言語について忘れる
+func (cl *CachingLogic) Invalidate(userID string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.gen++
+	cl.size -= len(cl.entries[userID])
+	delete(cl.entries, userID)
+}
+
+// HandleChangeは、SimpleDataStoreのOnChangeに渡して、変わったユーザーの挨拶を忘れさせるための関数
+func (cl *CachingLogic) HandleChange(ev ChangeEvent) {
+	cl.Invalidate(ev.UserID)
+}
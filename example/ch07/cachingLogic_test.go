@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// 同じユーザーと言語への2回目の挨拶は、データストアを検索せずに覚えた文を返す
+func TestCachingLogicHits(t *testing.T) {
+	sds := NewSimpleDataStore()
+	cs := &countingStore{DataStore: sds}
+	cl := NewCachingLogic(NewSimpleLogic(&MemoryLogger{}, cs, DefaultConfig()), 100)
+	en := ContextWithLanguage(context.Background(), "en")
+
+	first, _ := cl.SayHello(en, "1")
+	second, _ := cl.SayHello(en, "1")
+	if first != "Hello, Fred" || second != first || cs.Calls() != 1 {
+		t.Errorf("got %q then %q with %d lookups, want Hello, Fred twice with 1 lookup", first, second, cs.Calls())
+	}
+	// 言語が違えば別の挨拶として検索する
+	if ja, _ := cl.SayHello(context.Background(), "1"); ja != "Fredさん　こんにちは。" || cs.Calls() != 2 {
+		t.Errorf("ja greeting = %q with %d lookups, want a new lookup", ja, cs.Calls())
+	}
+}
+
+// エラーになった挨拶は覚えない
+func TestCachingLogicSkipsErrors(t *testing.T) {
+	cs := &countingStore{DataStore: NewSimpleDataStore()}
+	cl := NewCachingLogic(NewSimpleLogic(&MemoryLogger{}, cs, DefaultConfig()), 100)
+	for i := 0; i < 2; i++ {
+		if _, err := cl.SayHello(context.Background(), "99"); err == nil {
+			t.Fatal("unknown user: no error")
+		}
+	}
+	if cs.Calls() != 2 {
+		t.Errorf("lookups = %d, want 2", cs.Calls())
+	}
+}
+
+// OnChangeで変更を伝えれば、そのユーザーの覚えた挨拶を捨てる
+func TestCachingLogicHandleChange(t *testing.T) {
+	sds := NewSimpleDataStore()
+	cl := NewCachingLogic(NewSimpleLogic(&MemoryLogger{}, sds, DefaultConfig()), 100)
+	sds.OnChange(cl.HandleChange)
+	ctx := context.Background()
+	cl.SayHello(ctx, "1")
+	sds.UpdateUserForID("1", "Freddie")
+	if got, _ := cl.SayHello(ctx, "1"); got != "Freddieさん　こんにちは。" {
+		t.Errorf("after the update: %q, want the new name", got)
+	}
+}
+
+func TestCachingLogicConcurrent(t *testing.T) {
+	cl := NewCachingLogic(NewSimpleLogic(&MemoryLogger{}, NewSimpleDataStore(), DefaultConfig()), 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := []string{"1", "2", "3"}[i%3]
+			if _, err := cl.SayHello(context.Background(), id); err != nil {
+				t.Errorf("SayHello(%s): %v", id, err)
+			}
+			if i%10 == 0 {
+				cl.Invalidate(id)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,28 @@
+package main
+
+import "context"
+
+// ChainDataStoreは、複数のDataStoreを順に検索し、最初に見つかった結果を返すDataStore。
+// 全てのDataStoreで見つからなかったときだけ、見つからなかったと報告する。
+// 途中のDataStoreがエラーを返したら、後ろのDataStoreは検索せずにそのエラーを返す。
+type ChainDataStore struct {
+	stores []DataStore
+}
+
+// NewChainDataStoreは、storesをこの順に検索するChainDataStoreを生成するファクトリ関数
+func NewChainDataStore(stores ...DataStore) ChainDataStore {
+	return ChainDataStore{stores: stores}
+}
+
+func (cds ChainDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	for _, ds := range cds.stores {
+		name, ok, err := ds.UserNameForID(ctx, userID)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return name, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestChainDataStore(t *testing.T) {
+	primary := NewSimpleDataStore()
+	secondary := &SimpleDataStore{}
+	if err := secondary.AddUserForID("4", "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	cds := NewChainDataStore(primary, secondary)
+	tests := []struct {
+		userID   string
+		wantName string
+		wantOK   bool
+	}{
+		{"1", "Fred", true},
+		{"4", "Ann", true},
+		{"5", "", false},
+	}
+	for _, tt := range tests {
+		name, ok, err := cds.UserNameForID(context.Background(), tt.userID)
+		if name != tt.wantName || ok != tt.wantOK || err != nil {
+			t.Errorf("UserNameForID(%s) = %q, %v, %v; want %q, %v, nil", tt.userID, name, ok, err, tt.wantName, tt.wantOK)
+		}
+	}
+}
+
+// 前のデータストアがエラーを返したら、後ろのデータストアは検索しない
+func TestChainDataStoreStopsOnError(t *testing.T) {
+	down := errors.New("primary is down")
+	secondary := &countingStore{DataStore: NewSimpleDataStore()}
+	_, _, err := NewChainDataStore(failingStore{down}, secondary).UserNameForID(context.Background(), "1")
+	if !errors.Is(err, down) {
+		t.Errorf("err = %v, want %v", err, down)
+	}
+	if secondary.Calls() != 0 {
+		t.Errorf("secondary was searched %d times, want 0", secondary.Calls())
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+// ChangeOpは、ユーザーに対する変更の種類
+type ChangeOp int
+
+const (
+	ChangeAdd ChangeOp = iota
+	ChangeUpdate
+	ChangeDelete
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeAdd:
+		return "add"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// ChangeEventは、ユーザーが追加、更新、削除されたことを表す。
+// OldNameは追加のときに、NewNameは削除のときに空になる。
+// IDを変えたときは、古いIDの削除と新しいIDの追加の2つで表す。
+type ChangeEvent struct {
+	Op      ChangeOp
+	UserID  string
+	OldName string
+	NewName string
+}
+
+// OnChangeは、ユーザーが変わるたびに呼ぶ関数fを登録する。
+// fは変更が成功した後に、ロックを外してから呼ぶので、fの中からSimpleDataStoreを使ってもよい。
+// 変更したゴルーチンでそのまま呼ぶため、時間のかかる処理はfの中で別のゴルーチンに渡すこと。
+func (sds *SimpleDataStore) OnChange(f func(ChangeEvent)) {
+	sds.mu.Lock()
+	defer sds.mu.Unlock()
+	sds.listeners = append(sds.listeners, f)
+}
+
+// emitは、登録された関数にeventsを順に渡す。sds.muを持たずに呼ぶこと。
+func (sds *SimpleDataStore) emit(events ...ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	sds.mu.RLock()
+	listeners := sds.listeners
+	sds.mu.RUnlock()
+	for _, ev := range events {
+		for _, f := range listeners {
+			f(ev)
+		}
+	}
+}
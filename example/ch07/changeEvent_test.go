@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 変更のたびに、その内容のChangeEventでOnChangeの関数が呼ばれる
+func TestSimpleDataStoreOnChange(t *testing.T) {
+	ds := NewSimpleDataStore()
+	var got []ChangeEvent
+	ds.OnChange(func(ev ChangeEvent) {
+		// ロックの外で呼ばれるので、データストアを使ってもデッドロックしない
+		ds.UserCount()
+		got = append(got, ev)
+	})
+	id, err := ds.AddUser("Bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.UpdateUserForID(id, "Rob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.DeleteUserForID("1"); err != nil {
+		t.Fatal(err)
+	}
+	ds.DeleteUserForID("missing")
+
+	want := []ChangeEvent{
+		{Op: ChangeAdd, UserID: id, NewName: "Bob"},
+		{Op: ChangeUpdate, UserID: id, OldName: "Bob", NewName: "Rob"},
+		{Op: ChangeDelete, UserID: "1", OldName: "Fred"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpenは、CircuitBreakerDataStoreが包んだDataStoreを呼ばずに失敗させたときのエラー
+var ErrCircuitOpen = errors.New("データストアが続けて失敗したので、しばらく使いません")
+
+// circuitStateは、CircuitBreakerDataStoreの状態
+type circuitState int
+
+const (
+	// circuitClosedは、包んだDataStoreをそのまま呼ぶ状態
+	circuitClosed circuitState = iota
+	// circuitOpenは、包んだDataStoreを呼ばずにErrCircuitOpenを返す状態
+	circuitOpen
+	// circuitHalfOpenは、直ったかを確かめるために1回だけ包んだDataStoreを呼んでいる状態
+	circuitHalfOpen
+)
+
+// CircuitBreakerDataStoreは、包んだDataStoreのUserNameForIDがthreshold回続けてエラーを返したら、
+// cooldownの間は呼ばずにErrCircuitOpenを返すDataStore。壊れたデータストアを待ち続けないために使う。
+// cooldownが過ぎたら1回だけ試し、成功すれば元に戻り、失敗すればまたcooldownの間休む。
+// 見つからなかったことや、呼び出し元がctxをキャンセルしたことは失敗として数えない。
+type CircuitBreakerDataStore struct {
+	ds        DataStore
+	threshold int
+	cooldown  time.Duration
+	clock     Clock
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreakerDataStoreは、dsがthreshold回続けて失敗したらcooldownの間休むCircuitBreakerDataStoreを生成するファクトリ関数。
+// clockがnilならRealClockを使う。
+func NewCircuitBreakerDataStore(ds DataStore, threshold int, cooldown time.Duration, clock Clock) *CircuitBreakerDataStore {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreakerDataStore{
+		ds:        ds,
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     clockOrReal(clock),
+	}
+}
+
+func (cb *CircuitBreakerDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if !cb.allow() {
+		return "", false, ErrCircuitOpen
+	}
+	name, ok, err := cb.ds.UserNameForID(ctx, userID)
+	cb.record(ctx, err)
+	return name, ok, err
+}
+
+// allowは、包んだDataStoreを呼んでよいかを返す。cooldownが過ぎていれば、1回だけ試すために半開きにする。
+func (cb *CircuitBreakerDataStore) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case circuitOpen:
+		if cb.clock.Now().Sub(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		return false
+	}
+	return true
+}
+
+// recordは、包んだDataStoreを呼んだ結果のerrで状態を変える。
+// ctxがキャンセルされていたら、成功とも失敗とも数えない。半開きの試しだったなら、次の呼び出しでもう一度試す。
+func (cb *CircuitBreakerDataStore) record(ctx context.Context, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if err == nil {
+		cb.state = circuitClosed
+		cb.failures = 0
+		return
+	}
+	if ctx.Err() != nil {
+		if cb.state == circuitHalfOpen {
+			cb.state = circuitOpen
+		}
+		return
+	}
+	cb.failures++
+	if cb.state == circuitHalfOpen || cb.failures >= cb.threshold {
+		cb.state = circuitOpen
+		cb.openedAt = cb.clock.Now()
+	}
+}
+
+// Unwrapは、包んだデータストアを返す
+func (cb *CircuitBreakerDataStore) Unwrap() DataStore {
+	return cb.ds
+}
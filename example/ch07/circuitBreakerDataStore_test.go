@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// switchableStoreは、errがnilならFredを返し、そうでなければerrを返すDataStore
+type switchableStore struct {
+	err   error
+	calls int
+}
+
+func (ss *switchableStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	ss.calls++
+	if ss.err != nil {
+		return "", false, ss.err
+	}
+	return "Fred", true, nil
+}
+
+// 閉→開→半開→閉と状態を移す
+func TestCircuitBreakerTransitions(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	down := errors.New("down")
+	ss := &switchableStore{err: down}
+	cb := NewCircuitBreakerDataStore(ss, 2, time.Minute, clock)
+	ctx := context.Background()
+
+	// 閉: 失敗が2回続くまではそのまま検索する
+	for i := 0; i < 2; i++ {
+		if _, _, err := cb.UserNameForID(ctx, "1"); !errors.Is(err, down) {
+			t.Fatalf("failure %d: err = %v, want the store error", i+1, err)
+		}
+	}
+	// 開: 検索せずにErrCircuitOpenを返す
+	if _, _, err := cb.UserNameForID(ctx, "1"); !errors.Is(err, ErrCircuitOpen) || ss.calls != 2 {
+		t.Fatalf("open: err = %v after %d calls, want ErrCircuitOpen after 2", err, ss.calls)
+	}
+	// 半開: 待つ時間が過ぎたら1回だけ試し、失敗すればまた開く
+	clock.Advance(time.Minute)
+	if _, _, err := cb.UserNameForID(ctx, "1"); !errors.Is(err, down) {
+		t.Fatalf("half-open trial: err = %v, want the store error", err)
+	}
+	if _, _, err := cb.UserNameForID(ctx, "1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after a failed trial: err = %v, want ErrCircuitOpen", err)
+	}
+	// 半開で成功すれば閉じる
+	clock.Advance(time.Minute)
+	ss.err = nil
+	if name, ok, err := cb.UserNameForID(ctx, "1"); err != nil || !ok || name != "Fred" {
+		t.Fatalf("successful trial = %q, %v, %v; want Fred", name, ok, err)
+	}
+	// 閉じた後は、また失敗を数え直す
+	ss.err = down
+	if _, _, err := cb.UserNameForID(ctx, "1"); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("opened after 1 failure, want 2 fresh failures")
+	}
+	if _, _, err := cb.UserNameForID(ctx, "1"); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("the second failure itself was short-circuited")
+	}
+	if _, _, err := cb.UserNameForID(ctx, "1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("after 2 fresh failures: err = %v, want ErrCircuitOpen", err)
+	}
+}
+
+// 呼び出し元がキャンセルしたのはデータストアの失敗ではないので、数えない
+func TestCircuitBreakerIgnoresCancellation(t *testing.T) {
+	cb := NewCircuitBreakerDataStore(slowStore{DataStore: NewSimpleDataStore(), delay: time.Hour}, 1, time.Minute, NewManualClock(time.Unix(0, 0)))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cb.UserNameForID(ctx, "1")
+	if _, _, err := cb.UserNameForID(ctx, "1"); errors.Is(err, ErrCircuitOpen) {
+		t.Error("a cancelled lookup opened the circuit")
+	}
+}
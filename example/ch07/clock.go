@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clockは、今の時刻を教えてくれるもの。時刻に依存する機能をテストしやすくするために使う。
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClockは、本当の時刻を返すClock
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// clockOrRealは、cがnilならRealClockを返す
+func clockOrReal(c Clock) Clock {
+	if c == nil {
+		return RealClock{}
+	}
+	return c
+}
+
+// ManualClockは、Advanceで進めたときだけ時刻が進むClock。待たずに時間の経過を試せる。
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClockは、時刻がnowで止まっているManualClockを生成するファクトリ関数
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (mc *ManualClock) Now() time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.now
+}
+
+// Advanceは、時刻をdだけ進める
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.now = mc.now.Add(d)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mc := NewManualClock(start)
+	if !mc.Now().Equal(start) {
+		t.Fatalf("Now() = %v, want %v", mc.Now(), start)
+	}
+	mc.Advance(90 * time.Second)
+	if want := start.Add(90 * time.Second); !mc.Now().Equal(want) {
+		t.Errorf("after Advance: Now() = %v, want %v", mc.Now(), want)
+	}
+}
+
+// 眠らずに時計を進めるだけで、CacheDataStoreの期限が切れる
+func TestManualClockExpiresCacheWithoutSleeping(t *testing.T) {
+	mc := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ds := NewSimpleDataStore()
+	cds := NewCacheDataStore(ds, time.Minute, 100, mc)
+	ctx := context.Background()
+	cds.UserNameForID(ctx, "1")
+	ds.UpdateUserForID("1", "Freddie")
+
+	mc.Advance(59 * time.Second)
+	if name, _, _ := cds.UserNameForID(ctx, "1"); name != "Fred" {
+		t.Errorf("before the TTL: name = %q, want the cached Fred", name)
+	}
+	mc.Advance(time.Second)
+	if name, _, _ := cds.UserNameForID(ctx, "1"); name != "Freddie" {
+		t.Errorf("after the TTL: name = %q, want Freddie from the store", name)
+	}
+}
+
+func TestClockOrReal(t *testing.T) {
+	if _, ok := clockOrReal(nil).(RealClock); !ok {
+		t.Error("clockOrReal(nil) is not a RealClock")
+	}
+	mc := NewManualClock(time.Time{})
+	if clockOrReal(mc) != Clock(mc) {
+		t.Error("clockOrReal did not return the given clock")
+	}
+}
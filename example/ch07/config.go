@@ -0,0 +1,486 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Configは、環境ごとに変えたい設定
+type Config struct {
+	// Addrは、サーバーが待ち受けるアドレス
+	Addr string
+
+	// GreetingTemplatesは、言語コードごとの「こんにちは」のテンプレート。%sを1つ含め、そこに名前が入る。
+	// ここにない言語はGreeterの既定のテンプレートを使う。
+	GreetingTemplates map[string]string
+	// ABTestTemplatesは、A/Bテストの版Bで使う、言語コードごとの「こんにちは」のテンプレート。空ならA/Bテストをしない。
+	// ABTestPercentは、版Bで挨拶するユーザーの割合（0から100のパーセント）。
+	ABTestTemplates map[string]string
+	ABTestPercent   int
+	// RequireIfMatchは、PUT /usersにIf-Matchヘッダを必須にするかどうか。falseなら、ないときは版を確かめずに上書きする。
+	RequireIfMatch bool
+	// DefaultLanguageは、langクエリとAccept-Languageヘッダのどちらにも挨拶できる言語がないときの言語。空ならGreeterの既定の言語（日本語）になる。
+	DefaultLanguage string
+	// TemplateFileは、「こんにちは」と「さようなら」のテンプレートを言語コードごとに書いたJSONファイル。
+	// GreetingTemplatesより優先し、SIGHUPで読み直す。空なら読まない。
+	TemplateFile string
+
+	// ReadTimeout、WriteTimeout、IdleTimeoutは、http.Serverにそのまま設定するタイムアウト。
+	// 0のままだと無制限になり、遅いクライアントに接続を占有されるので、DefaultConfigの値から変えて使う。
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// BodyReadTimeoutは、書き込みのリクエストボディの読み込みが進まないときに408を返すまでの時間。0なら待ち続ける。
+	BodyReadTimeout time.Duration
+
+	// LogLevelは、これより低いレベルのログを捨てるレベル
+	LogLevel Level
+	// LogFormatは、ログの形式。LogFormatTextかLogFormatJSON。
+	LogFormat string
+	// LogFileは、標準出力の代わりにログを書くファイル。空なら標準出力に書く。開けなければ、警告を書いて標準出力に書く。
+	LogFile string
+	// AccessLogFormatは、アクセスログの1行の形式。AccessLogFormatText、AccessLogFormatLogfmt、AccessLogFormatJSONのどれか。
+	// AccessLogFieldsは、logfmtやJSONで書く項目の名前。空ならdefaultAccessLogFieldsで、接続元のアドレスとユーザーIDは書かない。
+	AccessLogFormat string
+	AccessLogFields []string
+
+	// MaxConcurrentRequestsは、同時に処理するリクエストの最大数。0なら制限しない。
+	MaxConcurrentRequests int
+	// MaxURLLengthは、リクエストのURLの長さ（バイト数）の上限。超えると414を返す。0なら制限しない。
+	MaxURLLength int
+
+	// ErrorRateThresholdは、不明なユーザーのエラーが直近1分の1秒あたりの回数でこれを超えたら警告をログに書くしきい値。0なら書かない。
+	ErrorRateThreshold float64
+
+	// MaintenanceMessageは、メンテナンス中のリクエストに503と一緒に返すメッセージ。空なら既定のメッセージになる。
+	// MaintenanceRetryAfterは、メンテナンス中のリクエストにRetry-Afterヘッダで返す時間。0なら返さない。
+	MaintenanceMessage    string
+	MaintenanceRetryAfter time.Duration
+
+	// SuggestUsersは、見つからなかったユーザーIDに近いIDをエラーで提案するかどうか。存在するIDを教えることになるので、既定では提案しない。
+	// SuggestMaxDistanceは、提案するIDとのレーベンシュタイン距離の上限。
+	SuggestUsers       bool
+	SuggestMaxDistance int
+
+	// GuestModeは、user_idが空の挨拶を400にせず、ゲストへの挨拶を返すかどうか。
+	// GuestNameは、ゲストへの挨拶に入れる名前。
+	GuestMode bool
+	GuestName string
+
+	// TimeOfDayGreetingsは、日本語と英語の「こんにちは」を、TimeZoneでの今の時間帯に合った挨拶にするかどうか。
+	// そのときは、GreetingTemplatesで差し替えた日本語と英語の「こんにちは」は使わない。
+	// TimeZoneは"Asia/Tokyo"のようなtime.LoadLocationの名前で、空ならUTC。DayBoundariesは、時間帯の境目。
+	TimeOfDayGreetings bool
+	TimeZone           string
+	DayBoundaries      DayBoundaries
+
+	// StatsIntervalは、StatsReporterがログを書く間隔。0なら書かない。
+	StatsInterval time.Duration
+
+	// UserSourceは、最初のユーザーをどこから読むか。userSourcesのどれか。
+	// UserFileは、UserSourceFileのときのJSONファイル、UserSourceCSVのときのCSVファイル、UserSourceWALのときのスナップショット。
+	// UserFileFlushIntervalとUserFileMaxPendingは、UserSourceFileのときにファイルの書き直しをまとめる間隔と件数。
+	// UserFileFlushIntervalが0なら、書き込みのたびに書き直す。
+	UserSource            string
+	UserFile              string
+	UserFileFlushInterval time.Duration
+	UserFileMaxPending    int
+
+	// StoreDecoratorsは、ロジックが使うデータストアに掛けるデコレーターの名前。先に書いたものほど外側になる。
+	// 指定できる名前はstoreDecoratorNamesで、DecorateDataStoreが掛ける。
+	StoreDecorators []string
+	// CacheWarmupは、起動するときにデータストアの全てのユーザーをcacheのデコレーターに読み込んでおくかどうか。
+	// CacheWarmupWorkersは、そのときに同時に検索する件数の上限。
+	CacheWarmup        bool
+	CacheWarmupWorkers int
+
+	// FeatureFlagsは、バッチやストリーム、管理用のルートを登録するかどうか。書かれていないフラグは既定の値になる。
+	// 指定できる名前はFeatureBatchなどで、無効にしたルートは登録しないので404になる。
+	FeatureFlags FeatureFlags
+
+	// SQLDriverとSQLDSNは、UserSourceSQLのときにsql.Openに渡す値
+	SQLDriver string
+	SQLDSN    string
+
+	// TLSCertFileとTLSKeyFileは、HTTPSで待ち受けるときの証明書と秘密鍵のファイル。
+	// 両方を指定するとHTTPSとHTTP/2で、どちらも空ならHTTPで待ち受ける。
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// CORSOriginsは、CORSMiddlewareでブラウザからのリクエストを許すOriginの一覧
+	CORSOrigins []string
+
+	// RateLimitとRateLimitIntervalは、RateLimitMiddlewareがクライアントごとにRateLimitInterval当たり許すリクエストの数
+	RateLimit         int
+	RateLimitInterval time.Duration
+
+	// APIKeysは、AuthMiddlewareに渡すAPIキーからユーザーIDへのマップ。
+	// 秘密なので設定ファイルには書かず、環境変数API_KEYSから読む。
+	APIKeys map[string]string
+}
+
+// DefaultConfigは、既定の値を入れたConfigを返す
+func DefaultConfig() Config {
+	return Config{
+		Addr:                  defaultAddr,
+		GreetingTemplates:     map[string]string{},
+		ReadTimeout:           5 * time.Second,
+		WriteTimeout:          10 * time.Second,
+		IdleTimeout:           120 * time.Second,
+		BodyReadTimeout:       defaultBodyReadTimeout,
+		LogLevel:              LevelInfo,
+		LogFormat:             LogFormatText,
+		MaxConcurrentRequests: 100,
+		MaxURLLength:          defaultMaxURLLength,
+		StatsInterval:         time.Minute,
+		SuggestMaxDistance:    2,
+		GuestName:             "guest",
+		DayBoundaries:         DefaultDayBoundaries(),
+		UserSource:            UserSourceDefault,
+		StoreDecorators:       []string{StoreDecoratorMetrics},
+		CacheWarmupWorkers:    defaultCacheWarmupWorkers,
+		RateLimit:             10,
+		RateLimitInterval:     time.Second,
+	}
+}
+
+// ConfigFromEnvは、環境変数からConfigを作る。
+// GREETING_TEMPLATE_JAやGREETING_TEMPLATE_ENのように、言語コードごとにテンプレートを指定できる。
+// ログの形式はLOG_FORMATで、ログのファイルはLOG_FILEで指定する。最初のユーザーの読み込み元はUSER_SOURCEとUSER_FILE（SQLならSQL_DRIVERとSQL_DSN）で指定する。
+// HTTPSの証明書と秘密鍵はTLS_CERT_FILEとTLS_KEY_FILEで、テンプレートのファイルはTEMPLATE_FILEで指定する。
+// データストアのデコレーターはSTORE_DECORATORSに、CORSで許すOriginはCORS_ORIGINSに、"metrics,retry"のようにカンマ区切りで指定する。
+func ConfigFromEnv(getenv func(string) string) Config {
+	cfg := DefaultConfig()
+	if format := getenv("LOG_FORMAT"); format != "" {
+		cfg.LogFormat = format
+	}
+	cfg.LogFile = getenv("LOG_FILE")
+	if src := getenv("USER_SOURCE"); src != "" {
+		cfg.UserSource = src
+	}
+	cfg.UserFile = getenv("USER_FILE")
+	cfg.SQLDriver = getenv("SQL_DRIVER")
+	cfg.SQLDSN = getenv("SQL_DSN")
+	cfg.TLSCertFile = getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = getenv("TLS_KEY_FILE")
+	cfg.TemplateFile = getenv("TEMPLATE_FILE")
+	if decorators := getenv("STORE_DECORATORS"); decorators != "" {
+		cfg.StoreDecorators = splitList(decorators)
+	}
+	cfg.CORSOrigins = splitList(getenv("CORS_ORIGINS"))
+	for lang := range defaultGreeter.templates {
+		if tmpl := getenv("GREETING_TEMPLATE_" + strings.ToUpper(lang)); tmpl != "" {
+			cfg.GreetingTemplates[lang] = tmpl
+		}
+	}
+	return cfg
+}
+
+// configFileは、LoadConfigが読むJSONの形。
+// 書かれていない項目と区別できるように、ポインタやnilになりうる型にしておく。
+type configFile struct {
+	Addr                  *string            `json:"addr"`
+	GreetingTemplates     map[string]string  `json:"greeting_templates"`
+	ABTestTemplates       map[string]string  `json:"ab_test_templates"`
+	ABTestPercent         int                `json:"ab_test_percent"`
+	TemplateFile          string             `json:"template_file"`
+	DefaultLanguage       string             `json:"default_language"`
+	RequireIfMatch        bool               `json:"require_if_match"`
+	ReadTimeout           *string            `json:"read_timeout"`
+	WriteTimeout          *string            `json:"write_timeout"`
+	IdleTimeout           *string            `json:"idle_timeout"`
+	BodyReadTimeout       *string            `json:"body_read_timeout"`
+	StatsInterval         *string            `json:"stats_interval"`
+	SuggestUsers          bool               `json:"suggest_users"`
+	SuggestMaxDistance    *int               `json:"suggest_max_distance"`
+	GuestMode             bool               `json:"guest_mode"`
+	GuestName             *string            `json:"guest_name"`
+	TimeOfDayGreetings    bool               `json:"time_of_day_greetings"`
+	TimeZone              string             `json:"time_zone"`
+	DayBoundaries         *dayBoundariesFile `json:"day_boundaries"`
+	LogLevel              *Level             `json:"log_level"`
+	LogFormat             *string            `json:"log_format"`
+	LogFile               string             `json:"log_file"`
+	AccessLogFormat       string             `json:"access_log_format"`
+	AccessLogFields       []string           `json:"access_log_fields"`
+	MaxConcurrentRequests *int               `json:"max_concurrent_requests"`
+	MaxURLLength          *int               `json:"max_url_length"`
+	ErrorRateThreshold    float64            `json:"error_rate_threshold"`
+	MaintenanceMessage    string             `json:"maintenance_message"`
+	MaintenanceRetryAfter *string            `json:"maintenance_retry_after"`
+	UserSource            *string            `json:"user_source"`
+	UserFile              string             `json:"user_file"`
+	UserFileFlushInterval *string            `json:"user_file_flush_interval"`
+	UserFileMaxPending    int                `json:"user_file_max_pending"`
+	StoreDecorators       []string           `json:"store_decorators"`
+	CacheWarmup           bool               `json:"cache_warmup"`
+	CacheWarmupWorkers    *int               `json:"cache_warmup_workers"`
+	FeatureFlags          map[string]bool    `json:"feature_flags"`
+	SQLDriver             string             `json:"sql_driver"`
+	SQLDSN                string             `json:"sql_dsn"`
+	TLSCertFile           string             `json:"tls_cert_file"`
+	TLSKeyFile            string             `json:"tls_key_file"`
+	CORSOrigins           []string           `json:"cors_origins"`
+	RateLimit             *int               `json:"rate_limit"`
+	RateLimitInterval     *string            `json:"rate_limit_interval"`
+}
+
+// dayBoundariesFileは、configFileのday_boundariesの形。時刻は0時からの時間を"5h"のように書く。
+type dayBoundariesFile struct {
+	Morning   *string `json:"morning"`
+	Afternoon *string `json:"afternoon"`
+	Evening   *string `json:"evening"`
+	Night     *string `json:"night"`
+}
+
+// LoadConfigは、pathのJSONファイルからConfigを作る。
+// 書かれていない項目はDefaultConfigの値になる。タイムアウトは"5s"のようなtime.ParseDurationの形で書く。
+// 知らない項目や正しくない値があればエラーを返す。
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	var cf configFile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cf); err != nil {
+		return Config{}, fmt.Errorf("%s: 設定ファイルを読めません: %w", path, err)
+	}
+	cfg := DefaultConfig()
+	if cf.Addr != nil {
+		cfg.Addr = *cf.Addr
+	}
+	for lang, tmpl := range cf.GreetingTemplates {
+		cfg.GreetingTemplates[lang] = tmpl
+	}
+	cfg.ABTestTemplates = cf.ABTestTemplates
+	cfg.ABTestPercent = cf.ABTestPercent
+	cfg.TemplateFile = cf.TemplateFile
+	cfg.DefaultLanguage = cf.DefaultLanguage
+	cfg.RequireIfMatch = cf.RequireIfMatch
+	var bounds dayBoundariesFile
+	if cf.DayBoundaries != nil {
+		bounds = *cf.DayBoundaries
+	}
+	durations := []struct {
+		name  string
+		value *string
+		dst   *time.Duration
+	}{
+		{"read_timeout", cf.ReadTimeout, &cfg.ReadTimeout},
+		{"write_timeout", cf.WriteTimeout, &cfg.WriteTimeout},
+		{"idle_timeout", cf.IdleTimeout, &cfg.IdleTimeout},
+		{"body_read_timeout", cf.BodyReadTimeout, &cfg.BodyReadTimeout},
+		{"stats_interval", cf.StatsInterval, &cfg.StatsInterval},
+		{"maintenance_retry_after", cf.MaintenanceRetryAfter, &cfg.MaintenanceRetryAfter},
+		{"user_file_flush_interval", cf.UserFileFlushInterval, &cfg.UserFileFlushInterval},
+		{"rate_limit_interval", cf.RateLimitInterval, &cfg.RateLimitInterval},
+		{"day_boundaries.morning", bounds.Morning, &cfg.DayBoundaries.Morning},
+		{"day_boundaries.afternoon", bounds.Afternoon, &cfg.DayBoundaries.Afternoon},
+		{"day_boundaries.evening", bounds.Evening, &cfg.DayBoundaries.Evening},
+		{"day_boundaries.night", bounds.Night, &cfg.DayBoundaries.Night},
+	}
+	for _, d := range durations {
+		if d.value == nil {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(*d.value); err != nil {
+			return Config{}, fmt.Errorf("%s: %sが正しくありません: %w", path, d.name, err)
+		}
+	}
+	if cf.LogLevel != nil {
+		cfg.LogLevel = *cf.LogLevel
+	}
+	if cf.LogFormat != nil {
+		cfg.LogFormat = *cf.LogFormat
+	}
+	cfg.LogFile = cf.LogFile
+	cfg.AccessLogFormat = cf.AccessLogFormat
+	cfg.AccessLogFields = cf.AccessLogFields
+	if cf.MaxConcurrentRequests != nil {
+		cfg.MaxConcurrentRequests = *cf.MaxConcurrentRequests
+	}
+	if cf.MaxURLLength != nil {
+		cfg.MaxURLLength = *cf.MaxURLLength
+	}
+	cfg.ErrorRateThreshold = cf.ErrorRateThreshold
+	cfg.MaintenanceMessage = cf.MaintenanceMessage
+	cfg.SuggestUsers = cf.SuggestUsers
+	if cf.SuggestMaxDistance != nil {
+		cfg.SuggestMaxDistance = *cf.SuggestMaxDistance
+	}
+	cfg.GuestMode = cf.GuestMode
+	if cf.GuestName != nil {
+		cfg.GuestName = *cf.GuestName
+	}
+	cfg.TimeOfDayGreetings = cf.TimeOfDayGreetings
+	cfg.TimeZone = cf.TimeZone
+	if cf.UserSource != nil {
+		cfg.UserSource = *cf.UserSource
+	}
+	cfg.UserFile = cf.UserFile
+	cfg.UserFileMaxPending = cf.UserFileMaxPending
+	if cf.StoreDecorators != nil {
+		cfg.StoreDecorators = cf.StoreDecorators
+	}
+	cfg.CacheWarmup = cf.CacheWarmup
+	if cf.CacheWarmupWorkers != nil {
+		cfg.CacheWarmupWorkers = *cf.CacheWarmupWorkers
+	}
+	cfg.FeatureFlags = cf.FeatureFlags
+	cfg.SQLDriver = cf.SQLDriver
+	cfg.SQLDSN = cf.SQLDSN
+	cfg.TLSCertFile = cf.TLSCertFile
+	cfg.TLSKeyFile = cf.TLSKeyFile
+	cfg.CORSOrigins = cf.CORSOrigins
+	if cf.RateLimit != nil {
+		cfg.RateLimit = *cf.RateLimit
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validateは、cfgがサーバーを動かせる値かを確かめる。
+// ファイルがあるかまでは確かめないので、起動する前にCheckFilesも呼ぶ。
+func (cfg Config) Validate() error {
+	if cfg.Addr == "" {
+		return errors.New("addrが空です")
+	}
+	if cfg.ReadTimeout < 0 || cfg.WriteTimeout < 0 || cfg.IdleTimeout < 0 || cfg.BodyReadTimeout < 0 {
+		return errors.New("タイムアウトが負です")
+	}
+	if cfg.SuggestMaxDistance < 0 {
+		return errors.New("suggest_max_distanceが負です")
+	}
+	if cfg.StatsInterval < 0 {
+		return errors.New("stats_intervalが負です")
+	}
+	if cfg.GuestMode && cfg.GuestName == "" {
+		return errors.New("guest_modeのときはguest_nameが必要です")
+	}
+	if _, err := time.LoadLocation(cfg.TimeZone); err != nil {
+		return fmt.Errorf("time_zoneが正しくありません: %w", err)
+	}
+	if err := cfg.DayBoundaries.Validate(); err != nil {
+		return err
+	}
+	if cfg.MaxConcurrentRequests < 0 {
+		return errors.New("max_concurrent_requestsが負です")
+	}
+	if cfg.MaxURLLength < 0 {
+		return errors.New("max_url_lengthが負です")
+	}
+	if cfg.MaintenanceRetryAfter < 0 {
+		return errors.New("maintenance_retry_afterが負です")
+	}
+	if cfg.CacheWarmup && cfg.CacheWarmupWorkers < 1 {
+		return errors.New("cache_warmupのときはcache_warmup_workersを1以上にしてください")
+	}
+	if cfg.ErrorRateThreshold < 0 {
+		return errors.New("error_rate_thresholdが負です")
+	}
+	if cfg.RateLimit < 1 || cfg.RateLimitInterval <= 0 {
+		return errors.New("rate_limitは1以上に、rate_limit_intervalは正の値にしてください")
+	}
+	if cfg.UserFileFlushInterval < 0 || cfg.UserFileMaxPending < 0 {
+		return errors.New("user_file_flush_intervalかuser_file_max_pendingが負です")
+	}
+	switch cfg.LogFormat {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("不明なlog_format: %q", cfg.LogFormat)
+	}
+	if _, err := NewAccessLogFormatter(cfg.AccessLogFormat, cfg.AccessLogFields); err != nil {
+		return err
+	}
+	switch cfg.UserSource {
+	case "", UserSourceDefault, UserSourceEmpty:
+	case UserSourceFile, UserSourceCSV, UserSourceWAL:
+		if cfg.UserFile == "" {
+			return fmt.Errorf("user_sourceが%sのときはuser_fileが必要です", cfg.UserSource)
+		}
+	case UserSourceSQL:
+		if cfg.SQLDriver == "" {
+			return errors.New("user_sourceがsqlのときはsql_driverが必要です")
+		}
+	default:
+		return unknownUserSource(cfg.UserSource)
+	}
+	for _, name := range cfg.StoreDecorators {
+		known := false
+		for _, n := range storeDecoratorNames {
+			known = known || n == name
+		}
+		if !known {
+			return unknownStoreDecorator(name)
+		}
+	}
+	for name := range cfg.FeatureFlags {
+		if _, ok := defaultFeatureFlags[name]; !ok {
+			return unknownFeatureFlag(name)
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return errors.New("tls_cert_fileとtls_key_fileは両方を指定してください")
+	}
+	if cfg.ABTestPercent < 0 || cfg.ABTestPercent > 100 {
+		return errors.New("ab_test_percentは0から100にしてください")
+	}
+	for _, templates := range []map[string]string{cfg.GreetingTemplates, cfg.ABTestTemplates} {
+		for lang, tmpl := range templates {
+			if strings.Count(tmpl, "%s") != 1 {
+				return fmt.Errorf("%sのテンプレートには%%sを1つだけ含めてください: %q", lang, tmpl)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckFilesは、cfgで指定されたTLSの証明書と秘密鍵、テンプレートのファイルがあるかを確かめる。
+// 起動してから最初の接続で失敗しないように、runが待ち受ける前に呼ぶ。
+func (cfg Config) CheckFiles() error {
+	files := []struct {
+		name string
+		path string
+	}{
+		{"tls_cert_file", cfg.TLSCertFile},
+		{"tls_key_file", cfg.TLSKeyFile},
+		{"template_file", cfg.TemplateFile},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return fmt.Errorf("%sを読めません: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// redactedは、LogSummaryで秘密の値の代わりに書く文字列
+const redacted = "***"
+
+// LogSummaryは、実際に使われる設定をlに1行で書く。フラグと環境変数と設定ファイルを合わせた結果を確かめるために使う。
+// APIキーやSQLのDSNのような秘密の値は、設定されていれば"***"と書く。
+func (cfg Config) LogSummary(l Logger) {
+	secret := func(set bool) string {
+		if set {
+			return redacted
+		}
+		return ""
+	}
+	l.Logf(LevelInfo, "config: addr=%s log_level=%s log_format=%s log_file=%s access_log_format=%s user_source=%s user_file_flush_interval=%s read_timeout=%s write_timeout=%s idle_timeout=%s body_read_timeout=%s max_concurrent_requests=%d max_url_length=%d error_rate_threshold=%g rate_limit=%d rate_limit_interval=%s cors_origins=%s store_decorators=%s cache_warmup=%t time_of_day_greetings=%t time_zone=%s disabled_features=%s template_file=%s tls=%t sql_dsn=%s api_keys=%s",
+		cfg.Addr, cfg.LogLevel, cfg.LogFormat, cfg.LogFile, cfg.AccessLogFormat, cfg.UserSource, cfg.UserFileFlushInterval,
+		cfg.ReadTimeout, cfg.WriteTimeout, cfg.IdleTimeout, cfg.BodyReadTimeout,
+		cfg.MaxConcurrentRequests, cfg.MaxURLLength, cfg.ErrorRateThreshold, cfg.RateLimit, cfg.RateLimitInterval, strings.Join(cfg.CORSOrigins, ","), strings.Join(cfg.StoreDecorators, ","), cfg.CacheWarmup, cfg.TimeOfDayGreetings, cfg.TimeZone, strings.Join(cfg.FeatureFlags.Disabled(), ","), cfg.TemplateFile, cfg.TLSCertFile != "",
+		secret(cfg.SQLDSN != ""), secret(len(cfg.APIKeys) > 0))
+}
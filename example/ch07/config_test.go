@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 環境変数で指定したテンプレートが、SimpleLogicの挨拶に使われることを確かめる
+func TestGreetingTemplateFromConfig(t *testing.T) {
+	env := map[string]string{"GREETING_TEMPLATE_JA": "%sさん　こんにちは。(staging)"}
+	cfg := ConfigFromEnv(func(key string) string { return env[key] })
+	logic := NewSimpleLogic(&MemoryLogger{}, NewSimpleDataStore(), cfg)
+
+	message, err := logic.SayHello(context.Background(), "1")
+	if err != nil || message != "Fredさん　こんにちは。(staging)" {
+		t.Errorf("SayHello(1) = %q, %v; want the staging template", message, err)
+	}
+	// 指定していない言語は既定のテンプレートのまま
+	message, _ = logic.SayHello(ContextWithLanguage(context.Background(), "en"), "1")
+	if message != "Hello, Fred" {
+		t.Errorf("SayHello(1) in en = %q, want Hello, Fred", message)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(writeTempFile(t, "config.json",
+		`{"addr":":9000","read_timeout":"1s","log_level":"debug","greeting_templates":{"en":"Hi %s"}}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Addr != ":9000" || cfg.ReadTimeout != time.Second || cfg.LogLevel != LevelDebug || cfg.GreetingTemplates["en"] != "Hi %s" {
+		t.Errorf("cfg = %+v, want the values from the file", cfg)
+	}
+	if cfg.WriteTimeout != 10*time.Second {
+		t.Errorf("WriteTimeout = %v, want the default 10s", cfg.WriteTimeout)
+	}
+}
+
+// 書かれていない項目は既定の値になる
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig(writeTempFile(t, "config.json", `{}`))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Addr != defaultAddr || cfg.ReadTimeout != 5*time.Second || cfg.IdleTimeout != 120*time.Second {
+		t.Errorf("cfg = %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"broken JSON", `{`},
+		{"unknown field", `{"x":1}`},
+		{"bad duration", `{"read_timeout":"abc"}`},
+		{"bad log level", `{"log_level":"loud"}`},
+		{"empty addr", `{"addr":""}`},
+		{"template without %s", `{"greeting_templates":{"en":"Hi"}}`},
+		{"negative flush interval", `{"user_source":"file","user_file":"u.json","user_file_flush_interval":"-1s"}`},
+		{"csv without a file", `{"user_source":"csv"}`},
+		{"zero rate limit", `{"rate_limit":0}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadConfig(writeTempFile(t, "config.json", tt.content)); err == nil {
+				t.Errorf("LoadConfig(%s) returned no error", tt.content)
+			}
+		})
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want os.ErrNotExist", err)
+	}
+}
+
+// -configのファイルがあっても、-addrフラグが優先する
+func TestResolveConfigFromFile(t *testing.T) {
+	path := writeTempFile(t, "config.json", `{"addr":":1","log_level":"warn"}`)
+	cfg, err := resolveConfig([]string{"-config", path, "-addr", ":2"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":2" || cfg.LogLevel != LevelWarn {
+		t.Errorf("Addr = %q, LogLevel = %v; want :2 from the flag and warn from the file", cfg.Addr, cfg.LogLevel)
+	}
+}
+
+// LogSummaryは、合わせた後のaddrを書き、APIキーとDSNは"***"にする
+func TestConfigLogSummaryRedacts(t *testing.T) {
+	cfg, err := resolveConfig([]string{"-addr", ":9999"}, func(k string) string {
+		if k == "API_KEYS" {
+			return "secret-key:1"
+		}
+		return ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SQLDSN = "user:hunter2@/db"
+	l := &MemoryLogger{}
+	cfg.LogSummary(l)
+	msgs := l.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("messages = %v, want one line", msgs)
+	}
+	for _, want := range []string{"addr=:9999", "api_keys=***", "sql_dsn=***"} {
+		if !strings.Contains(msgs[0], want) {
+			t.Errorf("summary %q does not contain %q", msgs[0], want)
+		}
+	}
+	for _, secret := range []string{"secret-key", "hunter2"} {
+		if strings.Contains(msgs[0], secret) {
+			t.Errorf("summary %q leaks %q", msgs[0], secret)
+		}
+	}
+	l = &MemoryLogger{}
+	DefaultConfig().LogSummary(l)
+	if msg := strings.Join(l.Messages(), ""); !strings.HasSuffix(msg, "api_keys=") {
+		t.Errorf("without API keys: summary %q, want an empty api_keys", msg)
+	}
+}
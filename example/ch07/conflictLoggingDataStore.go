@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ConflictLoggingDataStoreは、最後に読まれてから書き換えられたユーザーを上書きしたときに、警告をログに書くWritableDataStore。
+// ユーザーごとに書き込みのたびに増える版と、最後に読まれたときの版を覚えておき、書き込む前に比べる。
+// 2つが違えば、書き込む側は前の書き込みを見ていないかもしれないので、上書きされる名前と一緒にログに書く。
+// 書き込みは止めず、後に書いたものが残る。失われたかもしれない更新に気づくために使う。
+// 書き込みはロックを持って順に行うが、読み込みは遅いデータストアで他を待たせないように、ロックを持たずに包んだデータストアを呼ぶ。
+// 追加したユーザーは、追加した側がその名前を知っているので、その版を読まれた版とする。
+type ConflictLoggingDataStore struct {
+	ds WritableDataStore
+	l  Logger
+
+	mu sync.Mutex
+	// versionsは、ユーザーごとの書き込みの版。readは、最後に読まれたときの版。
+	versions map[string]uint64
+	read     map[string]uint64
+}
+
+// NewConflictLoggingDataStoreは、dsへの上書きの衝突をlに書くConflictLoggingDataStoreを生成するファクトリ関数
+func NewConflictLoggingDataStore(ds WritableDataStore, l Logger) *ConflictLoggingDataStore {
+	return &ConflictLoggingDataStore{
+		ds:       ds,
+		l:        l,
+		versions: map[string]uint64{},
+		read:     map[string]uint64{},
+	}
+}
+
+// UserNameForIDは、包んだデータストアから名前を探し、見つかれば探し始めたときの版を読まれた版として覚える。
+// 探している間に書き換えられたら、どちらの名前を読んだかわからないので、古い方の版にして衝突を見逃さないようにする。
+func (cds *ConflictLoggingDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	cds.mu.Lock()
+	version := cds.versions[userID]
+	cds.mu.Unlock()
+	name, ok, err := cds.ds.UserNameForID(ctx, userID)
+	if err == nil && ok {
+		cds.mu.Lock()
+		// 後から始めた読み込みが先に新しい版を覚えていれば、それを古い版で戻さない
+		if version > cds.read[userID] {
+			cds.read[userID] = version
+		}
+		cds.mu.Unlock()
+	}
+	return name, ok, err
+}
+
+func (cds *ConflictLoggingDataStore) AddUserForID(userID, name string) error {
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	if err := cds.ds.AddUserForID(userID, name); err != nil {
+		return err
+	}
+	cds.versions[userID]++
+	cds.read[userID] = cds.versions[userID]
+	return nil
+}
+
+func (cds *ConflictLoggingDataStore) UpdateUserForID(userID, newName string) error {
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	cds.checkConflict(ChangeUpdate, userID)
+	if err := cds.ds.UpdateUserForID(userID, newName); err != nil {
+		return err
+	}
+	cds.versions[userID]++
+	return nil
+}
+
+func (cds *ConflictLoggingDataStore) DeleteUserForID(userID string) error {
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	cds.checkConflict(ChangeDelete, userID)
+	if err := cds.ds.DeleteUserForID(userID); err != nil {
+		return err
+	}
+	cds.versions[userID]++
+	return nil
+}
+
+// checkConflictは、userIDが最後に読まれてから書き換えられていれば、上書きされる名前をログに書く。cds.muを持って呼ぶ。
+func (cds *ConflictLoggingDataStore) checkConflict(op ChangeOp, userID string) {
+	if cds.versions[userID] == cds.read[userID] {
+		return
+	}
+	prior, _, _ := cds.ds.UserNameForID(context.Background(), userID)
+	cds.l.Logf(LevelWarn, "conflict: %s user_id=%s: 読まれた版%dの後に版%dに書き換えられた名前%qを上書きします",
+		op, escapeForLog(userID), cds.read[userID], cds.versions[userID], escapeForLog(prior))
+}
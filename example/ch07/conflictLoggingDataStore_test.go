@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 同時に読んでから書いた更新は、最初の1つを除いて、前の更新を上書きしたとログに出る
+func TestConflictLoggingDataStoreConcurrentUpdates(t *testing.T) {
+	const writers = 4
+	l := &MemoryLogger{}
+	cds := NewConflictLoggingDataStore(NewSimpleDataStore(), l)
+	ctx := context.Background()
+
+	// 読んでから書けば衝突ではない
+	cds.UserNameForID(ctx, "1")
+	if err := cds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Fatalf("UpdateUserForID: %v", err)
+	}
+	if msgs := l.Messages(); len(msgs) != 0 {
+		t.Fatalf("logs %v after a read-then-write, want none", msgs)
+	}
+
+	var read, wg sync.WaitGroup
+	read.Add(writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cds.UserNameForID(ctx, "1")
+			// 全員が読み終わってから書く
+			read.Done()
+			read.Wait()
+			if err := cds.UpdateUserForID("1", "W"+strconv.Itoa(i)); err != nil {
+				t.Errorf("UpdateUserForID: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	conflicts := 0
+	for _, m := range l.Messages() {
+		if strings.Contains(m, "conflict: update user_id=1") {
+			conflicts++
+		}
+	}
+	if conflicts != writers-1 {
+		t.Errorf("%d conflicts logged, want %d: %v", conflicts, writers-1, l.Messages())
+	}
+}
+
+// 読まずに消すと、その前の書き込みを上書きしたとログに出る
+func TestConflictLoggingDataStoreDeleteWithoutRead(t *testing.T) {
+	l := &MemoryLogger{}
+	cds := NewConflictLoggingDataStore(NewSimpleDataStore(), l)
+	if err := cds.UpdateUserForID("2", "Maria"); err != nil {
+		t.Fatalf("UpdateUserForID: %v", err)
+	}
+	if err := cds.DeleteUserForID("2"); err != nil {
+		t.Fatalf("DeleteUserForID: %v", err)
+	}
+	if !containsMessage(l.Messages(), `conflict: delete user_id=2`) || !containsMessage(l.Messages(), `"Maria"`) {
+		t.Errorf("logs %v do not show the overwritten name", l.Messages())
+	}
+}
+
+// 自分で追加したユーザーを読まずに更新しても、衝突とはしない
+func TestConflictLoggingDataStoreAddThenUpdate(t *testing.T) {
+	l := &MemoryLogger{}
+	cds := NewConflictLoggingDataStore(NewSimpleDataStore(), l)
+	if err := cds.AddUserForID("9", "Zed"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	if err := cds.UpdateUserForID("9", "Zack"); err != nil {
+		t.Fatalf("UpdateUserForID: %v", err)
+	}
+	if msgs := l.Messages(); len(msgs) != 0 {
+		t.Errorf("logs %v after an add-then-update, want none", msgs)
+	}
+}
+
+// slowReadStoreは、読み始めたことをreadingで知らせ、releaseが閉じられるまで読み込みを返さないWritableDataStore。
+// readingがいっぱいなら知らせずに読む。
+type slowReadStore struct {
+	*SimpleDataStore
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (srs slowReadStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	select {
+	case srs.reading <- struct{}{}:
+	default:
+	}
+	<-srs.release
+	return srs.SimpleDataStore.UserNameForID(ctx, userID)
+}
+
+// 遅い読み込みの間も書き込みは待たされず、その書き込みの後に読み込みを基にした更新は衝突になる
+func TestConflictLoggingDataStoreSlowRead(t *testing.T) {
+	l := &MemoryLogger{}
+	srs := slowReadStore{SimpleDataStore: NewSimpleDataStore(), reading: make(chan struct{}, 1), release: make(chan struct{})}
+	cds := NewConflictLoggingDataStore(srs, l)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cds.UserNameForID(context.Background(), "1")
+	}()
+	<-srs.reading
+	if err := cds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Fatalf("UpdateUserForID during a slow read: %v", err)
+	}
+	close(srs.release)
+	<-done
+	if err := cds.UpdateUserForID("1", "Fritz"); err != nil {
+		t.Fatalf("UpdateUserForID: %v", err)
+	}
+	if !containsMessage(l.Messages(), "conflict: update user_id=1") {
+		t.Errorf("logs %v, want a conflict for the update based on the slow read", l.Messages())
+	}
+}
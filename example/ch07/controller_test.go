@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestControllerは、最初のユーザーを入れたSimpleDataStoreと、記録を確かめられるMemoryLoggerを使うControllerを作る
+func newTestController(opts ...ControllerOption) (Controller, *SimpleDataStore, *MemoryLogger) {
+	l := &MemoryLogger{}
+	ds := NewSimpleDataStore()
+	return NewController(l, NewSimpleLogic(l, ds, DefaultConfig()), ds, opts...), ds, l
+}
+
+// sendは、hにmethodとtargetのリクエストを送り、記録したレスポンスを返す
+func send(h http.Handler, method, target string, body io.Reader) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, body))
+	return w
+}
+
+func TestSayGoodbye(t *testing.T) {
+	c, _, _ := newTestController()
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"known user", "/goodbye?user_id=1", http.StatusOK, "Fredさん　さようなら"},
+		{"unknown user", "/goodbye?user_id=99", http.StatusNotFound, "user_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(http.HandlerFunc(c.SayGoodbye), http.MethodGet, tt.target, nil)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// NewControllerJSONは、成功も失敗もJSONで返し、ステータスコードはテキストのときと同じにする
+func TestNewControllerJSON(t *testing.T) {
+	l := &MemoryLogger{}
+	ds := NewSimpleDataStore()
+	c := NewControllerJSON(l, NewSimpleLogic(l, ds, DefaultConfig()), ds)
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   map[string]string
+	}{
+		{"success", "/hello?user_id=1", http.StatusOK, map[string]string{"message": "Fredさん　こんにちは。"}},
+		{"missing user_id", "/hello", http.StatusBadRequest, map[string]string{"error": "user_id is required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(http.HandlerFunc(c.SayHello), http.MethodGet, tt.target, nil)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", w.Body.String(), err)
+			}
+			if !reflect.DeepEqual(got, tt.wantBody) {
+				t.Errorf("body = %v, want %v", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	c, ds, l := newTestController()
+	h := http.HandlerFunc(c.DeleteUser)
+
+	w := send(h, http.MethodDelete, "/users?user_id=2", nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("deleting an existing user: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if _, ok, _ := ds.UserNameForID(context.Background(), "2"); ok {
+		t.Error("user 2 is still in the store after DELETE")
+	}
+	if msgs := l.Messages(); len(msgs) == 0 || !strings.Contains(msgs[len(msgs)-1], "DeleteUser(2)") {
+		t.Errorf("log = %q, want the deletion to be logged", msgs)
+	}
+
+	if w := send(h, http.MethodDelete, "/users?user_id=2", nil); w.Code != http.StatusNotFound {
+		t.Errorf("deleting a missing user: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w = send(h, http.MethodGet, "/users?user_id=1", nil)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodDelete {
+		t.Errorf("GET: status = %d, Allow = %q; want 405, DELETE", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+// failingStoreは、どのユーザーの検索にもerrを返すDataStore
+type failingStore struct {
+	err error
+}
+
+func (s failingStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	return "", false, s.err
+}
+
+// failingPingerは、検索には成功するがPingにはerrを返すDataStore
+type failingPinger struct {
+	*SimpleDataStore
+	err error
+}
+
+func (fp failingPinger) Ping(ctx context.Context) error {
+	return fp.err
+}
+
+func TestHealthCheck(t *testing.T) {
+	down := errors.New("store is down")
+	tests := []struct {
+		name       string
+		ds         DataStore
+		wantStatus int
+		wantBody   string
+	}{
+		{"healthy pinger", NewSimpleDataStore(), http.StatusOK, "ok"},
+		{"failing pinger", failingPinger{NewSimpleDataStore(), down}, http.StatusServiceUnavailable, down.Error()},
+		{"failing lookup without Ping", failingStore{down}, http.StatusServiceUnavailable, down.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &MemoryLogger{}
+			c := NewController(l, NewSimpleLogic(l, tt.ds, DefaultConfig()), tt.ds)
+			w := send(http.HandlerFunc(c.HealthCheck), http.MethodGet, "/healthz", nil)
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	c, ds, _ := newTestController()
+	h := http.HandlerFunc(c.ListUsers)
+
+	w := send(h, http.MethodGet, "/users", nil)
+	if want := `{"1":"Fred","2":"Mary","3":"Pat"}` + "\n"; w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("got %d %q, want 200 %q", w.Code, w.Body.String(), want)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := ds.DeleteUserForID(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w := send(h, http.MethodGet, "/users", nil); w.Body.String() != "{}\n" {
+		t.Errorf("empty store: body = %q, want {}", w.Body.String())
+	}
+}
+
+func TestSayHelloValidatesUserID(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []ControllerOption
+		userID     string
+		wantStatus int
+	}{
+		{"empty", nil, "", http.StatusBadRequest},
+		{"default limit", nil, strings.Repeat("a", defaultMaxUserIDLength), http.StatusNotFound},
+		{"too long", nil, strings.Repeat("a", defaultMaxUserIDLength+1), http.StatusUnprocessableEntity},
+		{"configured limit", []ControllerOption{WithMaxUserIDLength(3)}, "1234", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newTestController(tt.opts...)
+			w := send(http.HandlerFunc(c.SayHello), http.MethodGet, "/hello?user_id="+tt.userID, nil)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// 改行を含むuser_idは、エスケープしてからログに書くので、1つのメッセージが複数の行に分かれない
+func TestSayHelloEscapesUserIDInLog(t *testing.T) {
+	c, _, l := newTestController()
+	send(http.HandlerFunc(c.SayHello), http.MethodGet, "/hello?user_id=1%0A[INFO]%20forged", nil)
+	for _, m := range l.Messages() {
+		if strings.ContainsAny(m, "\r\n") {
+			t.Errorf("log message %q contains a raw newline", m)
+		}
+	}
+	if want := `SayHello(1\n[INFO] forged)`; !containsMessage(l.Messages(), want) {
+		t.Errorf("log = %q, want it to contain %q", l.Messages(), want)
+	}
+}
+
+// POSTは新しいユーザーだけを、PUTは既にいるユーザーだけを受け付ける
+func TestAddAndUpdateUser(t *testing.T) {
+	c, ds, _ := newTestController()
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"POST new user", c.AddUser, http.MethodPost, `{"user_id":"4","name":"Ann"}`, http.StatusCreated},
+		{"POST existing user", c.AddUser, http.MethodPost, `{"user_id":"1","name":"Ann"}`, http.StatusConflict},
+		{"PUT existing user", c.UpdateUser, http.MethodPut, `{"user_id":"1","name":"Freddie"}`, http.StatusNoContent},
+		{"PUT missing user", c.UpdateUser, http.MethodPut, `{"user_id":"99","name":"Ann"}`, http.StatusNotFound},
+		{"PUT without name", c.UpdateUser, http.MethodPut, `{"user_id":"1"}`, http.StatusBadRequest},
+		{"POST to update", c.UpdateUser, http.MethodPost, `{"user_id":"1","name":"Ann"}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.handler, tt.method, "/users", strings.NewReader(tt.body))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+	for id, want := range map[string]string{"1": "Freddie", "4": "Ann"} {
+		if name, _, _ := ds.UserNameForID(context.Background(), id); name != want {
+			t.Errorf("UserNameForID(%s) = %q, want %q", id, name, want)
+		}
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	c, _, _ := newTestController()
+	h := http.HandlerFunc(c.ImportUsers)
+
+	w := send(h, http.MethodPost, "/users/import?overwrite=true", strings.NewReader(`{"1":"Freddie","4":"Ann"}`))
+	if w.Code != http.StatusOK || w.Body.String() != `{"imported":2}`+"\n" {
+		t.Errorf("got %d %q, want 200 {\"imported\":2}", w.Code, w.Body.String())
+	}
+
+	w = send(h, http.MethodPost, "/users/import", strings.NewReader(`{"5":""}`))
+	var got struct {
+		Failed []string `json:"failed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusBadRequest || !reflect.DeepEqual(got.Failed, []string{"5"}) {
+		t.Errorf("got %d %q, want 400 with failed [5]", w.Code, w.Body.String())
+	}
+}
+
+func TestCountUsers(t *testing.T) {
+	c, ds, _ := newTestController()
+	h := http.HandlerFunc(c.CountUsers)
+	if w := send(h, http.MethodGet, "/users/count", nil); w.Body.String() != `{"count":3}`+"\n" {
+		t.Errorf("body = %q, want {\"count\":3}", w.Body.String())
+	}
+	ds.AddUserForID("4", "Ann")
+	if w := send(h, http.MethodGet, "/users/count", nil); w.Body.String() != `{"count":4}`+"\n" {
+		t.Errorf("after adding a user: body = %q, want {\"count\":4}", w.Body.String())
+	}
+}
+
+// /admin/snapshotで取ったものを/admin/restoreに送ると、元の中身に戻る
+func TestSnapshotAndRestoreHandlers(t *testing.T) {
+	c, ds, _ := newTestController()
+	snap := send(http.HandlerFunc(c.Snapshot), http.MethodGet, "/admin/snapshot", nil)
+	if snap.Code != http.StatusOK || snap.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("snapshot: status = %d, Content-Type = %q", snap.Code, snap.Header().Get("Content-Type"))
+	}
+	ds.DeleteUserForID("1")
+	if w := send(http.HandlerFunc(c.Restore), http.MethodPost, "/admin/restore", snap.Body); w.Code != http.StatusNoContent {
+		t.Fatalf("restore: status = %d, want 204", w.Code)
+	}
+	if name, _, _ := ds.UserNameForID(context.Background(), "1"); name != "Fred" {
+		t.Errorf("user 1 = %q after restoring, want Fred", name)
+	}
+}
+
+// 上限をちょうど1バイト超えたボディは413にし、壊れたJSONの400とは区別する
+func TestAddUserBodyLimit(t *testing.T) {
+	const body = `{"user_id":"9","name":"Bob"}`
+	tests := []struct {
+		name       string
+		limit      int64
+		body       string
+		wantStatus int
+	}{
+		{"at the limit", int64(len(body)), body, http.StatusCreated},
+		{"one byte over", int64(len(body)) - 1, body, http.StatusRequestEntityTooLarge},
+		{"malformed", 1 << 20, `{"user_id":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newTestController(WithMaxBodyBytes(tt.limit))
+			w := send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(tt.body))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+// 一致するユーザーがいなくても、nullではなく空の配列を返す
+func TestSearchUsers(t *testing.T) {
+	c, ds, _ := newTestController()
+	ds.AddUserForID("4", "mark")
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"ma", `["2","4"]`},
+		{"MA", `["2","4"]`},
+		{"zz", `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			w := send(http.HandlerFunc(c.SearchUsers), http.MethodGet, "/users/search?prefix="+tt.prefix, nil)
+			if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != tt.want {
+				t.Errorf("got %d %s, want 200 %s", w.Code, got, tt.want)
+			}
+		})
+	}
+}
+
+// 正しくエンコードされていないクエリは、不明なユーザーではなく400 "malformed query"にする
+func TestMalformedQuery(t *testing.T) {
+	c, _, _ := newTestController()
+	tests := []struct {
+		name string
+		h    http.HandlerFunc
+	}{
+		{"hello", c.SayHello},
+		{"goodbye", c.SayGoodbye},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.h, http.MethodGet, "/hello?user_id=%zz", nil)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "malformed query") {
+				t.Errorf("got %d %q, want 400 malformed query", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// 遅い検索の途中でクライアントが切断したら、ボディを書かずに499を記録し、"client cancelled"をログに書く
+func TestClientCancelled(t *testing.T) {
+	l := &MemoryLogger{}
+	slow := slowStore{DataStore: NewSimpleDataStore(), delay: time.Hour}
+	c := NewController(l, NewSimpleLogic(l, slow, DefaultConfig()), slow)
+	for _, h := range []http.HandlerFunc{c.SayHello, c.Greet} {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/hello?user_id=1", nil).WithContext(ctx))
+		if w.Code != statusClientClosedRequest || w.Body.Len() != 0 {
+			t.Errorf("got %d %q, want 499 with no body", w.Code, w.Body.String())
+		}
+	}
+	if n := strings.Count(strings.Join(l.Messages(), "\n"), "client cancelled"); n != 2 {
+		t.Errorf("logged client cancelled %d times, want 2: %v", n, l.Messages())
+	}
+}
+
+func TestRekeyUserHandler(t *testing.T) {
+	c, _, _ := newTestController()
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"old_id":"2","new_id":"20"}`, http.StatusNoContent},
+		{`{"old_id":"2","new_id":"21"}`, http.StatusNotFound},
+		{`{"old_id":"20","new_id":"3"}`, http.StatusConflict},
+		{`{"old_id":"20"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := send(http.HandlerFunc(c.RekeyUser), http.MethodPost, "/users/rekey", strings.NewReader(tt.body)); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.body, w.Code, tt.want)
+		}
+	}
+}
+
+// ゲストモードなら空のuser_idにゲストへの挨拶を返し、そうでなければ400を返す
+func TestSayHelloGuestMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		guestMode  bool
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"on, empty user_id", true, "/hello?user_id=", http.StatusOK, "Visitorさん　こんにちは。"},
+		{"on, no user_id", true, "/hello", http.StatusOK, "Visitorさん　こんにちは。"},
+		{"on, known user", true, "/hello?user_id=1", http.StatusOK, "Fredさん　こんにちは。"},
+		{"off, empty user_id", false, "/hello?user_id=", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.GuestMode = tt.guestMode
+			cfg.GuestName = "Visitor"
+			l := &MemoryLogger{}
+			ds := NewSimpleDataStore()
+			c := NewController(l, NewSimpleLogic(l, ds, cfg), ds, WithGuests(cfg.GuestMode))
+			w := send(http.HandlerFunc(c.SayHello), http.MethodGet, tt.target, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// 無効にしたユーザーへの挨拶は403になり、有効に戻すと200に戻る
+func TestSayHelloDisabledUser(t *testing.T) {
+	c, ds, _ := newTestController()
+	h := http.HandlerFunc(c.SayHello)
+	if err := ds.DisableUser("1"); err != nil {
+		t.Fatal(err)
+	}
+	if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusForbidden {
+		t.Errorf("disabled: status %d, want 403", w.Code)
+	}
+	if err := ds.EnableUser("1"); err != nil {
+		t.Fatal(err)
+	}
+	if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+		t.Errorf("enabled again: status %d, want 200", w.Code)
+	}
+}
+
+// FuzzUserIDParsingは、どんなクエリ文字列でも、user_idを読むハンドラがパニックせず5xxも返さないことを確かめる。
+// go test -fuzz=FuzzUserIDParsingで走らせる。
+func FuzzUserIDParsing(f *testing.F) {
+	for _, seed := range []string{
+		"user_id=1",
+		"user_id=",
+		"",
+		"user_id=%zz",
+		"user_id=%00",
+		"user_id=1&user_id=2",
+		";;",
+		"user_id=1;lang=en",
+		"user_id=" + strings.Repeat("a", 1000),
+		"user_id=%E3%80%80",
+		"user_id=nope&create-if-missing=true&name=%0A",
+		"user_id=1&lang=*;q=0",
+	} {
+		f.Add(seed)
+	}
+	c, _, _ := newTestController()
+	handlers := map[string]http.HandlerFunc{"SayHello": c.SayHello, "SayGoodbye": c.SayGoodbye, "Greet": c.Greet}
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		for name, h := range handlers {
+			r := httptest.NewRequest(http.MethodGet, "/hello", nil)
+			r.URL.RawQuery = rawQuery
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code >= http.StatusInternalServerError {
+				t.Errorf("%s with query %q: status %d", name, rawQuery, w.Code)
+			}
+		}
+	})
+}
+
+// create-if-missing=trueのときだけ、いないユーザーを追加してから挨拶する
+func TestSayHelloCreateIfMissing(t *testing.T) {
+	c, ds, _ := newTestController()
+	h := http.HandlerFunc(c.SayHello)
+	if w := send(h, http.MethodGet, "/hello?user_id=zz&name=Zoe", nil); w.Code != http.StatusNotFound {
+		t.Errorf("without the flag: status %d, want 404", w.Code)
+	}
+	w := send(h, http.MethodGet, "/hello?user_id=zz&name=Zoe&create-if-missing=true", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "Zoeさん　こんにちは。" {
+		t.Errorf("with the flag: got %d %q, want 200 and a greeting for Zoe", w.Code, w.Body.String())
+	}
+	if name, ok, _ := ds.UserNameForID(context.Background(), "zz"); !ok || name != "Zoe" {
+		t.Errorf("user zz = %q, %v; want Zoe", name, ok)
+	}
+	// 既にいるユーザーの名前は変えない
+	if w := send(h, http.MethodGet, "/hello?user_id=1&name=Zoe&create-if-missing=true", nil); w.Body.String() != "Fredさん　こんにちは。" {
+		t.Errorf("existing user: body %q, want Fred's greeting", w.Body.String())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "net/http"
+
+// corsAllowMethodsとcorsAllowHeadersは、プリフライトリクエストに返す許可の一覧
+const (
+	corsAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders = "Content-Type, X-API-Key, X-Request-ID, Idempotency-Key, If-Match, X-Request-Timeout, Accept-Language"
+)
+
+// CORSMiddlewareは、リクエストのOriginがallowedOriginsにあれば、Access-Control-Allow-Originヘッダを付ける。
+// allowedOriginsに"*"があれば、どのOriginも許す。許されないOriginには何のヘッダも付けない。
+// プリフライトのOPTIONSリクエストには、nextに渡さずに204で答える。
+func CORSMiddleware(allowedOrigins []string, next http.Handler) http.Handler {
+	allowAll := false
+	allowed := map[string]bool{}
+	for _, o := range allowedOrigins {
+		if o == "*" {
+			allowAll = true
+		}
+		allowed[o] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		ok := origin != "" && (allowAll || allowed[origin])
+		if ok {
+			h := w.Header()
+			if allowAll {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Add("Vary", "Origin")
+			}
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if ok {
+				h := w.Header()
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	h := CORSMiddleware([]string{"https://app.example.com"}, next)
+
+	t.Run("preflight", func(t *testing.T) {
+		called = false
+		w := sendWithHeader(h, http.MethodOptions, "/hello", nil,
+			"Origin", "https://app.example.com", "Access-Control-Request-Method", http.MethodGet)
+		if w.Code != http.StatusNoContent || called {
+			t.Errorf("status = %d, handler called = %v; want 204 without calling the handler", w.Code, called)
+		}
+		for key, want := range map[string]string{
+			"Access-Control-Allow-Origin":  "https://app.example.com",
+			"Access-Control-Allow-Methods": corsAllowMethods,
+			"Access-Control-Allow-Headers": corsAllowHeaders,
+		} {
+			if got := w.Header().Get(key); got != want {
+				t.Errorf("%s = %q, want %q", key, got, want)
+			}
+		}
+		// ハンドラが読むヘッダは、ブラウザからも送れる
+		for _, name := range []string{"Idempotency-Key", "If-Match", "X-Request-Timeout", "Accept-Language"} {
+			if !strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), name) {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %s in it", w.Header().Get("Access-Control-Allow-Headers"), name)
+			}
+		}
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		called = false
+		w := sendWithHeader(h, http.MethodGet, "/hello", nil, "Origin", "https://evil.example.com")
+		if !called {
+			t.Error("handler was not called")
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+		}
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		w := sendWithHeader(CORSMiddleware([]string{"*"}, next), http.MethodGet, "/hello", nil, "Origin", "https://any.example.com")
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CSVDataStoreは、id,nameの2列のCSVファイルから読み込んだユーザーを持つ、読み取り専用のデータストア
+type CSVDataStore struct {
+	mu       sync.RWMutex
+	path     string
+	userData map[string]string
+}
+
+// NewCSVDataStoreは、pathのCSVファイルを読み込んでCSVDataStoreを生成するファクトリ関数。
+// 1行目が"id,name"なら見出しとして飛ばす。
+func NewCSVDataStore(path string) (*CSVDataStore, error) {
+	userData, err := readUsersCSV(path)
+	if err != nil {
+		return nil, err
+	}
+	return &CSVDataStore{
+		path:     path,
+		userData: userData,
+	}, nil
+}
+
+// Reloadは、CSVファイルを読み直して、中身を丸ごと置き換える。
+// 読めない行があれば、前の中身のままエラーを返す。
+func (cds *CSVDataStore) Reload() error {
+	userData, err := readUsersCSV(cds.path)
+	if err != nil {
+		return err
+	}
+	cds.mu.Lock()
+	defer cds.mu.Unlock()
+	cds.userData = userData
+	return nil
+}
+
+// readUsersCSVは、pathのCSVファイルをユーザーIDから名前へのマップにする。
+// 正しくない行があれば、その行番号の付いたエラーを返す。
+func readUsersCSV(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%sを開けません: %w", path, err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	userData := map[string]string{}
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return userData, nil
+		}
+		if err != nil {
+			// csv.ParseErrorは行番号を含んでいる
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if first && strings.EqualFold(record[0], "id") && strings.EqualFold(record[1], "name") {
+			continue
+		}
+		if record[0] == "" {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("%s:%d: idが空です", path, line)
+		}
+		userData[record[0]] = record[1]
+	}
+}
+
+func (cds *CSVDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	cds.mu.RLock()
+	defer cds.mu.RUnlock()
+	name, ok := cds.userData[userID]
+	return name, ok, nil
+}
+
+func (cds *CSVDataStore) AllUsers() map[string]string {
+	cds.mu.RLock()
+	defer cds.mu.RUnlock()
+	users := make(map[string]string, len(cds.userData))
+	for id, name := range cds.userData {
+		users[id] = name
+	}
+	return users
+}
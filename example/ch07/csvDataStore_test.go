@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTempFileは、テスト用の一時ディレクトリにcontentのファイルを作り、そのパスを返す
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCSVDataStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"without header", "1,Fred\n2,\"Smith, Mary\"\n"},
+		{"with header", "id,name\n1,Fred\n2,\"Smith, Mary\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cds, err := NewCSVDataStore(writeTempFile(t, "users.csv", tt.content))
+			if err != nil {
+				t.Fatalf("NewCSVDataStore: %v", err)
+			}
+			for id, want := range map[string]string{"1": "Fred", "2": "Smith, Mary"} {
+				if name, ok, err := cds.UserNameForID(context.Background(), id); name != want || !ok || err != nil {
+					t.Errorf("UserNameForID(%s) = %q, %v, %v; want %q, true, nil", id, name, ok, err, want)
+				}
+			}
+			if _, ok, _ := cds.UserNameForID(context.Background(), "id"); ok {
+				t.Error("the header row was read as a user")
+			}
+		})
+	}
+}
+
+// 列の数が違う行があれば、その行番号の付いたエラーを返す
+func TestCSVDataStoreMalformed(t *testing.T) {
+	_, err := NewCSVDataStore(writeTempFile(t, "users.csv", "1,Fred\n2,Mary,extra\n"))
+	var pe *csv.ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 {
+		t.Fatalf("err = %v, want a *csv.ParseError on line 2", err)
+	}
+
+	_, err = NewCSVDataStore(writeTempFile(t, "users.csv", "1,Fred\n,Mary\n"))
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("empty id: err = %v, want an error naming line 2", err)
+	}
+}
+
+// ファイルを書き換えてReloadすれば新しい内容が見え、壊れたファイルなら前の内容のまま残る
+func TestCSVDataStoreReload(t *testing.T) {
+	path := writeTempFile(t, "users.csv", "id,name\n1,Fred\n")
+	cds, err := NewCSVDataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := os.WriteFile(path, []byte("id,name\n1,Freddie\n2,Mary\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cds.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if name, _, _ := cds.UserNameForID(ctx, "1"); name != "Freddie" {
+		t.Errorf("after Reload: user 1 = %q, want Freddie", name)
+	}
+	if err := os.WriteFile(path, []byte("id,name\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cds.Reload(); err == nil {
+		t.Error("Reload of a broken file: no error")
+	}
+	if name, ok, _ := cds.UserNameForID(ctx, "2"); !ok || name != "Mary" {
+		t.Errorf("after a failed Reload: user 2 = %q, %v; want the previous Mary", name, ok)
+	}
+}
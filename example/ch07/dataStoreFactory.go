@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config.UserSourceに指定できる、最初のユーザーの読み込み元
+const (
+	// UserSourceDefaultは、NewSimpleDataStoreと同じFred、Mary、Patを入れる
+	UserSourceDefault = "default"
+	// UserSourceFileは、Config.UserFileのJSONファイルのFileDataStoreを使う
+	UserSourceFile = "file"
+	// UserSourceCSVは、Config.UserFileのCSVファイルのCSVDataStoreを使う。書き込めない。
+	UserSourceCSV = "csv"
+	// UserSourceWALは、Config.UserFileをスナップショットにしたWALDataStoreを使う
+	UserSourceWAL = "wal"
+	// UserSourceEmptyは、ユーザーのいない状態で始める
+	UserSourceEmpty = "empty"
+	// UserSourceSQLは、Config.SQLDriverとConfig.SQLDSNで開いたデータベースのSQLDataStoreを使う
+	UserSourceSQL = "sql"
+)
+
+// userSourcesは、Config.UserSourceに指定できる値の一覧。設定を間違えたときのエラーで示す。
+var userSources = []string{UserSourceDefault, UserSourceFile, UserSourceCSV, UserSourceWAL, UserSourceEmpty, UserSourceSQL}
+
+// unknownUserSourceは、知らないUserSourceのエラーを、指定できる値の一覧と一緒に返す
+func unknownUserSource(source string) error {
+	return fmt.Errorf("不明なuser_source: %q（%sのどれかを指定してください）", source, strings.Join(userSources, ", "))
+}
+
+// NewDataStoreFromConfigは、cfg.UserSourceに応じて最初のユーザーを入れたデータストアを生成するファクトリ関数。
+// UserSourceFileのファイルは、Snapshotと同じユーザーIDから名前へのJSONオブジェクトで書く。
+// 書き込みはそのファイルに書き戻し、cfg.UserFileFlushIntervalが正ならNewBatchedFileDataStoreで書き直しをまとめる。
+// UserSourceFileとUserSourceCSVでは、ファイルがない場合や読めない場合はエラーを返す。
+// UserSourceWALでは、ファイルがなければ空のデータストアで始める。
+// UserSourceSQLのときは、使う前にMigrateでテーブルを作る。ドライバはmainパッケージでインポートしておくこと。
+func NewDataStoreFromConfig(cfg Config) (DataStore, error) {
+	switch cfg.UserSource {
+	case "", UserSourceDefault:
+		return NewSimpleDataStore(), nil
+	case UserSourceEmpty:
+		return &SimpleDataStore{}, nil
+	case UserSourceFile:
+		// FileDataStoreはファイルがなければ空で始めるが、最初のユーザーの読み込み元としては指定の間違いなので弾く
+		if _, err := os.Stat(cfg.UserFile); err != nil {
+			return nil, fmt.Errorf("ユーザーのファイルを読めません: %w", err)
+		}
+		if cfg.UserFileFlushInterval > 0 {
+			return NewBatchedFileDataStore(cfg.UserFile, cfg.UserFileFlushInterval, cfg.UserFileMaxPending, nil)
+		}
+		return NewFileDataStore(cfg.UserFile)
+	case UserSourceCSV:
+		return NewCSVDataStore(cfg.UserFile)
+	case UserSourceWAL:
+		return NewWALDataStore(cfg.UserFile)
+	case UserSourceSQL:
+		db, err := sql.Open(cfg.SQLDriver, cfg.SQLDSN)
+		if err != nil {
+			return nil, err
+		}
+		if err := Migrate(context.Background(), db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return NewSQLDataStore(db), nil
+	}
+	return nil, unknownUserSource(cfg.UserSource)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDataStoreFromConfig(t *testing.T) {
+	path := writeTempFile(t, "users.json", `{"9":"Bob"}`)
+	csvPath := writeTempFile(t, "users.csv", "id,name\n8,Ann\n")
+	tests := []struct {
+		name     string
+		cfg      Config
+		id       string
+		wantName string
+		wantOK   bool
+	}{
+		{"unset", Config{}, "1", "Fred", true},
+		{"default", Config{UserSource: UserSourceDefault}, "1", "Fred", true},
+		{"empty", Config{UserSource: UserSourceEmpty}, "1", "", false},
+		{"file", Config{UserSource: UserSourceFile, UserFile: path}, "9", "Bob", true},
+		{"file has only its users", Config{UserSource: UserSourceFile, UserFile: path}, "1", "", false},
+		{"csv", Config{UserSource: UserSourceCSV, UserFile: csvPath}, "8", "Ann", true},
+		{"wal without a snapshot", Config{UserSource: UserSourceWAL, UserFile: filepath.Join(t.TempDir(), "users.json")}, "1", "", false},
+		{"sql", Config{UserSource: UserSourceSQL, SQLDriver: "memsql", SQLDSN: "TestNewDataStoreFromConfig/sql"}, "1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, err := NewDataStoreFromConfig(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewDataStoreFromConfig: %v", err)
+			}
+			defer closeDataStore(ds)
+			name, ok, err := ds.UserNameForID(context.Background(), tt.id)
+			if err != nil || ok != tt.wantOK || name != tt.wantName {
+				t.Errorf("UserNameForID(%s) = %q, %v, %v; want %q, %v, nil", tt.id, name, ok, err, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+// fileのデータストアは、読み直せて、書き込みをファイルに書き戻す。間隔を指定すれば書き直しをまとめる。
+func TestNewDataStoreFromConfigFileWritesBack(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Hour} {
+		path := writeTempFile(t, "users.json", `{"9":"Bob"}`)
+		ds, err := NewDataStoreFromConfig(Config{UserSource: UserSourceFile, UserFile: path, UserFileFlushInterval: interval, UserFileMaxPending: 1})
+		if err != nil {
+			t.Fatalf("interval %v: NewDataStoreFromConfig: %v", interval, err)
+		}
+		if _, ok := ds.(Reloader); !ok {
+			t.Errorf("interval %v: %T is not a Reloader", interval, ds)
+		}
+		if err := ds.(WritableDataStore).AddUserForID("10", "Ann"); err != nil {
+			t.Fatalf("interval %v: AddUserForID: %v", interval, err)
+		}
+		if err := closeDataStore(ds); err != nil {
+			t.Fatalf("interval %v: close: %v", interval, err)
+		}
+		got, err := readUsersJSON(path)
+		if err != nil || got["10"] != "Ann" {
+			t.Errorf("interval %v: file has %v, %v; want Ann written back", interval, got, err)
+		}
+	}
+}
+
+func TestNewDataStoreFromConfigErrors(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		_, err := NewDataStoreFromConfig(Config{UserSource: UserSourceFile, UserFile: writeTempFile(t, "x", "") + ".missing"})
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("err = %v, want a wrapped os.ErrNotExist", err)
+		}
+	})
+	t.Run("corrupt file", func(t *testing.T) {
+		if _, err := NewDataStoreFromConfig(Config{UserSource: UserSourceFile, UserFile: writeTempFile(t, "users.json", "{not json")}); err == nil {
+			t.Error("corrupt file: no error")
+		}
+	})
+}
+
+// 知らないUserSourceのエラーは、NewDataStoreFromConfigでもValidateでも、指定できる値をすべて挙げる
+func TestUnknownUserSource(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.UserSource = "fiel"
+	_, factoryErr := NewDataStoreFromConfig(cfg)
+	for name, err := range map[string]error{"NewDataStoreFromConfig": factoryErr, "Validate": cfg.Validate()} {
+		if err == nil {
+			t.Errorf("%s: no error for user_source %q", name, cfg.UserSource)
+			continue
+		}
+		for _, want := range append([]string{`"fiel"`}, userSources...) {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %s", name, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodeJSONは、rのボディのJSONをdstに読み込む。
+// dstにない項目や、JSONの後ろに余計なデータがあればエラーにする。
+// エラーは、そのままクライアントに返せるように、どこが悪いのかがわかる文にする。
+// ボディが大きすぎたときの*http.MaxBytesErrorはラップして返すので、bodyErrorStatusで413にできる。
+// JSONの後ろを読んでいる間のエラーも同じように返すので、読み込みのタイムアウトは408にできる。
+func decodeJSON(r *http.Request, dst any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	// dec.Moreは後ろの"}"や"]"を見逃すので、次のトークンがEOFかどうかで確かめる。
+	// トークンが読めたときと、"}"のようにJSONとして読めないデータがあったときだけを余計なデータとする。
+	_, err := dec.Token()
+	var se *json.SyntaxError
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil
+	case err == nil, errors.As(err, &se):
+		return errors.New("JSONの後ろに余計なデータがあります")
+	}
+	return decodeError(err)
+}
+
+// decodeErrorは、json.Decoderのエラーを、どこが悪いのかがわかる文のエラーにする
+func decodeError(err error) error {
+	var se *json.SyntaxError
+	var ute *json.UnmarshalTypeError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return errors.New("リクエストボディが空です")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("JSONが途中で終わっています")
+	case errors.As(err, &se):
+		return fmt.Errorf("JSONの%dバイト目が正しくありません", se.Offset)
+	case errors.As(err, &ute):
+		if ute.Field == "" {
+			return fmt.Errorf("%dバイト目は%sにしてください", ute.Offset, ute.Type)
+		}
+		return fmt.Errorf("%sは%sにしてください（%dバイト目）", ute.Field, ute.Type, ute.Offset)
+	case errors.As(err, &mbe):
+		return fmt.Errorf("リクエストボディは%dバイトまでです: %w", mbe.Limit, err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/jsonは不明な項目を専用のエラー型で返さないので、文で見分ける
+		return fmt.Errorf("不明な項目%sがあります", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return err
+}
+
+// decodeBodyは、最大でmaxBodyBytesまでのリクエストボディのJSONをdstに読み込む。
+// 読み込めなければエラーのレスポンスを書き込み、falseを返す。
+func (c Controller) decodeBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	r.Body = c.body(w, r)
+	if err := decodeJSON(r, dst); err != nil {
+		c.writeError(w, bodyErrorStatus(err), err.Error())
+		return false
+	}
+	return true
+}
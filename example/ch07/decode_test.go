@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"valid", `{"name":"Ann"}`, ""},
+		{"empty", ``, "リクエストボディが空です"},
+		{"truncated", `{"name":`, "JSONが途中で終わっています"},
+		{"syntax", `{"name" 1}`, "JSONの9バイト目が正しくありません"},
+		{"type mismatch", `{"name":1}`, "nameはstringにしてください"},
+		{"not an object", `[]`, "1バイト目は"},
+		{"unknown field", `{"x":"a"}`, `不明な項目"x"があります`},
+		{"trailing data", `{"name":"a"} {}`, "JSONの後ろに余計なデータがあります"},
+		{"trailing brace", `{"name":"a"}}`, "JSONの後ろに余計なデータがあります"},
+		{"trailing bracket", `{"name":"a"}]`, "JSONの後ろに余計なデータがあります"},
+		{"trailing whitespace", "{\"name\":\"Ann\"}\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u user
+			err := decodeJSON(httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tt.body)), &u)
+			if tt.wantErr == "" {
+				if err != nil || u.Name != "Ann" {
+					t.Errorf("decodeJSON = %+v, %v; want Ann, nil", u, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 大きすぎるボディは413、それ以外の読めないボディは400で、理由をそのまま返す
+func TestDecodeBodyStatus(t *testing.T) {
+	c, _, _ := newTestController(WithMaxBodyBytes(16))
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"name":"aaaaaaaaaaaaaaaa"}`, http.StatusRequestEntityTooLarge},
+		{`{"x":"a"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(tt.body))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.body, w.Code, tt.want)
+		}
+	}
+}
+
+// JSONの後ろを読んでいる間のエラーは余計なデータとせず、413や408にできるように返す
+func TestDecodeJSONReadErrorAfterValue(t *testing.T) {
+	const body = `{"name":"Ann"}`
+	tests := []struct {
+		name string
+		r    func(w http.ResponseWriter) io.ReadCloser
+		want int
+	}{
+		{"too large", func(w http.ResponseWriter) io.ReadCloser {
+			return http.MaxBytesReader(w, io.NopCloser(strings.NewReader(body+"   ")), int64(len(body)))
+		}, http.StatusRequestEntityTooLarge},
+		{"read timeout", func(http.ResponseWriter) io.ReadCloser {
+			return io.NopCloser(io.MultiReader(strings.NewReader(body), iotest.ErrReader(ErrBodyReadTimeout)))
+		}, http.StatusRequestTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/users", nil)
+			r.Body = tt.r(httptest.NewRecorder())
+			var u struct {
+				Name string `json:"name"`
+			}
+			err := decodeJSON(r, &u)
+			if err == nil || strings.Contains(err.Error(), "余計なデータ") {
+				t.Fatalf("err = %v, want the read error", err)
+			}
+			if got := bodyErrorStatus(err); got != tt.want {
+				t.Errorf("bodyErrorStatus(%v) = %d, want %d", err, got, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzDecodeUserは、どんなボディでもdecodeJSONがパニックせず、エラーか正しいJSONから読んだuserRequestを返すことを確かめる。
+// go test -fuzz=FuzzDecodeUserで走らせる。
+func FuzzDecodeUser(f *testing.F) {
+	for _, seed := range []string{
+		`{"user_id":"1","name":"Fred"}`,
+		``,
+		`{`,
+		`{}{}`,
+		`{}}`,
+		`{}]`,
+		`{"user_id":"1"} trailing`,
+		`{"x":1}`,
+		`{"user_id":1}`,
+		`[]`,
+		`null`,
+		`"\ud800"`,
+		`{"name":"\u0000"}`,
+		`{"name":"` + strings.Repeat("あ", 100) + `"}`,
+		"\xff\xfe",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req userRequest
+		err := decodeJSON(httptest.NewRequest(http.MethodPost, "/users", bytes.NewReader(data)), &req)
+		if err == nil && !json.Valid(data) {
+			t.Errorf("decodeJSON(%q) accepted invalid JSON as %+v", data, req)
+		}
+		if err != nil && err.Error() == "" {
+			t.Errorf("decodeJSON(%q) returned an empty error message", data)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrDuplicateNameは、大文字と小文字や空白の違いを除くと同じ名前のユーザーが既にいるときのエラー
+var ErrDuplicateName = errors.New("同じ名前のユーザーが既に存在します")
+
+// normalizeNameは、前後の空白を除き、続いた空白を1つにまとめ、小文字にした名前を返す。
+// "  Fred  Smith "と"fred smith"は同じ名前になる。
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// DedupingDataStoreは、normalizeNameで比べて同じ名前のユーザーを追加させないWritableDataStore。
+// 正規化した名前からユーザーIDへの索引を持ち、更新と削除のたびに直すので、名前を変えたユーザーの古い名前はまた使える。
+// 更新で別のユーザーと同じ名前にすることもErrDuplicateNameにする。
+type DedupingDataStore struct {
+	ds WritableDataStore
+
+	mu sync.Mutex
+	// byNameは正規化した名前からユーザーIDへの、byIDはユーザーIDから正規化した名前への索引
+	byName map[string]string
+	byID   map[string]string
+}
+
+// NewDedupingDataStoreは、dsへの書き込みで名前の重複を防ぐDedupingDataStoreを生成するファクトリ関数。
+// dsがListerなら、今いるユーザーから索引を作る。
+func NewDedupingDataStore(ds WritableDataStore) *DedupingDataStore {
+	dds := &DedupingDataStore{
+		ds:     ds,
+		byName: map[string]string{},
+		byID:   map[string]string{},
+	}
+	if lister, ok := ds.(Lister); ok {
+		for id, name := range lister.AllUsers() {
+			dds.index(id, name)
+		}
+	}
+	return dds
+}
+
+func (dds *DedupingDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	return dds.ds.UserNameForID(ctx, userID)
+}
+
+func (dds *DedupingDataStore) AddUserForID(userID, name string) error {
+	dds.mu.Lock()
+	defer dds.mu.Unlock()
+	if _, ok := dds.byName[normalizeName(name)]; ok {
+		return ErrDuplicateName
+	}
+	if err := dds.ds.AddUserForID(userID, name); err != nil {
+		return err
+	}
+	dds.index(userID, name)
+	return nil
+}
+
+func (dds *DedupingDataStore) UpdateUserForID(userID, newName string) error {
+	dds.mu.Lock()
+	defer dds.mu.Unlock()
+	if id, ok := dds.byName[normalizeName(newName)]; ok && id != userID {
+		return ErrDuplicateName
+	}
+	if err := dds.ds.UpdateUserForID(userID, newName); err != nil {
+		return err
+	}
+	dds.unindex(userID)
+	dds.index(userID, newName)
+	return nil
+}
+
+func (dds *DedupingDataStore) DeleteUserForID(userID string) error {
+	dds.mu.Lock()
+	defer dds.mu.Unlock()
+	if err := dds.ds.DeleteUserForID(userID); err != nil {
+		return err
+	}
+	dds.unindex(userID)
+	return nil
+}
+
+// indexは、userIDのユーザーをnameで索引に入れる。dds.muを持って呼ぶ。
+func (dds *DedupingDataStore) index(userID, name string) {
+	n := normalizeName(name)
+	dds.byName[n] = userID
+	dds.byID[userID] = n
+}
+
+// unindexは、userIDのユーザーを索引から除く。dds.muを持って呼ぶ。
+func (dds *DedupingDataStore) unindex(userID string) {
+	if n, ok := dds.byID[userID]; ok {
+		delete(dds.byName, n)
+		delete(dds.byID, userID)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Fred", "fred"},
+		{"  fred ", "fred"},
+		{"Fred \t Smith", "fred smith"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeName(tt.name); got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 大文字と小文字や空白だけが違う名前は追加できず、名前を変えたり消したりすれば、その名前はまた使える
+func TestDedupingDataStore(t *testing.T) {
+	sds := NewSimpleDataStore()
+	if err := sds.DeleteUserForID("1"); err != nil {
+		t.Fatal(err)
+	}
+	dds := NewDedupingDataStore(sds)
+	steps := []struct {
+		name  string
+		write func() error
+		want  error
+	}{
+		{"add Fred", func() error { return dds.AddUserForID("f1", "Fred") }, nil},
+		{"add a spaced lower-case Fred", func() error { return dds.AddUserForID("f2", "  fred ") }, ErrDuplicateName},
+		{"add a user already in the store", func() error { return dds.AddUserForID("m", "mary") }, ErrDuplicateName},
+		{"rename f1", func() error { return dds.UpdateUserForID("f1", "Freddie") }, nil},
+		{"add the freed name", func() error { return dds.AddUserForID("f2", "FRED") }, nil},
+		{"rename to another user's name", func() error { return dds.UpdateUserForID("f2", "freddie  ") }, ErrDuplicateName},
+		{"rename to its own name", func() error { return dds.UpdateUserForID("f2", "Fred") }, nil},
+		{"delete f1", func() error { return dds.DeleteUserForID("f1") }, nil},
+		{"rename to the deleted user's name", func() error { return dds.UpdateUserForID("f2", "freddie") }, nil},
+	}
+	for _, s := range steps {
+		if err := s.write(); !errors.Is(err, s.want) {
+			t.Fatalf("%s: err = %v, want %v", s.name, err, s.want)
+		}
+	}
+	// 弾かれた書き込みは包んだデータストアに届かない
+	if n := sds.UserCount(); n != 3 {
+		t.Errorf("the store has %d users, want 3", n)
+	}
+}
+
+// 重複した名前でのPOST /usersは409になる
+func TestAddUserDuplicateName(t *testing.T) {
+	dds := NewDedupingDataStore(NewSimpleDataStore())
+	c := NewController(&MemoryLogger{}, nil, dds)
+	w := send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(`{"user_id":"4","name":" FRED "}`))
+	if w.Code != http.StatusConflict {
+		t.Errorf("status %d, want 409", w.Code)
+	}
+}
@@ -1,9 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode/utf8"
 )
 
 // LogOutputはログを記録する関数
@@ -11,35 +26,557 @@ func LogOutput(message string) {
 	fmt.Println(message)
 }
 
-// SimpleDataStoreは簡単なデータの保存場所
+// SimpleDataStoreは簡単なデータの保存場所。
+// 複数のゴルーチンから同時に使ってもよい。ゼロ値は空のデータストアとして使える。
 type SimpleDataStore struct {
-	userData map[string]string
+	mu        sync.RWMutex
+	userData  map[string]userRecord
+	idGen     IDGenerator
+	listeners []func(ChangeEvent)
+	// versionsは、ユーザーごとの、最後に書き込んだときのseqの値。一度も書き込んでいないユーザーは0になる。
+	// 削除してから同じIDで追加しても前と違う版になるように、seqはデータストア全体で増やす。
+	versions map[string]uint64
+	seq      uint64
 }
 
-func (sds SimpleDataStore) UserNameForID(userID string) (string, bool) {
-	name, ok := sds.userData[userID]
-	return name, ok
+// userRecordは、SimpleDataStoreが持つ1人のユーザー
+type userRecord struct {
+	Name     string
+	Disabled bool
+}
+
+// userRecordJSONは、無効にしたユーザーをJSONにするときの形
+type userRecordJSON struct {
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled"`
+}
+
+// MarshalJSONは、無効にしていないユーザーを名前だけの文字列にする。
+// 無効にしたユーザーがいなければ、ユーザーを名前の文字列で持っていたころのSnapshotと同じJSONになる。
+func (rec userRecord) MarshalJSON() ([]byte, error) {
+	if !rec.Disabled {
+		return json.Marshal(rec.Name)
+	}
+	return json.Marshal(userRecordJSON(rec))
+}
+
+// UnmarshalJSONは、名前だけの文字列と、nameとdisabledを持ったオブジェクトのどちらも読めるようにする
+func (rec *userRecord) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*rec = userRecord{Name: name}
+		return nil
+	}
+	var rj userRecordJSON
+	if err := json.Unmarshal(data, &rj); err != nil {
+		return err
+	}
+	*rec = userRecord(rj)
+	return nil
+}
+
+// UserNameForIDは、userIDのユーザーの名前を返す。無効にしたユーザーならErrUserDisabledを返す。
+func (sds *SimpleDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	sds.mu.RLock()
+	defer sds.mu.RUnlock()
+	rec, ok := sds.userData[userID]
+	if ok && rec.Disabled {
+		return "", false, ErrUserDisabled
+	}
+	return rec.Name, ok, nil
+}
+
+// Pingは、データストアが使える状態かを確かめる
+func (sds *SimpleDataStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// AllUsersは、全てのユーザーをユーザーIDから名前へのマップのコピーで返す
+func (sds *SimpleDataStore) AllUsers() map[string]string {
+	sds.mu.RLock()
+	defer sds.mu.RUnlock()
+	return sds.namesLocked()
+}
+
+// namesLockedは、全てのユーザーのユーザーIDから名前へのマップを作る。無効にしたユーザーも含む。sds.muを持って呼ぶこと。
+func (sds *SimpleDataStore) namesLocked() map[string]string {
+	users := make(map[string]string, len(sds.userData))
+	for id, rec := range sds.userData {
+		users[id] = rec.Name
+	}
+	return users
+}
+
+// UsersPageは、ユーザーID順にoffset番目からlimit人のユーザーと、全てのユーザーの数を返す
+func (sds *SimpleDataStore) UsersPage(offset, limit int) ([]User, int) {
+	sds.mu.RLock()
+	defer sds.mu.RUnlock()
+	return pageUsers(sds.namesLocked(), offset, limit)
+}
+
+// ErrUserExistsは、既に存在するユーザーIDを追加しようとしたときのエラー
+var ErrUserExists = errors.New("ユーザーIDは既に存在します")
+
+// AddUserForIDは、ユーザーを追加する。userIDが既に存在する場合はErrUserExistsを返す。
+func (sds *SimpleDataStore) AddUserForID(userID, name string) error {
+	sds.mu.Lock()
+	if _, ok := sds.userData[userID]; ok {
+		sds.mu.Unlock()
+		return ErrUserExists
+	}
+	if sds.userData == nil {
+		sds.userData = map[string]userRecord{}
+	}
+	sds.userData[userID] = userRecord{Name: name}
+	sds.touchLocked(userID)
+	sds.mu.Unlock()
+	sds.emit(ChangeEvent{Op: ChangeAdd, UserID: userID, NewName: name})
+	return nil
+}
+
+// GetOrCreateは、userIDのユーザーがいればその名前を、いなければdefaultNameで追加してその名前を返す。
+// 1回のロックの中で確かめて追加するので、同時に呼ばれても追加するのは1つだけで、createdがtrueになるのもそれだけ。
+// 無効にしたユーザーも、いるものとして名前を返す。
+func (sds *SimpleDataStore) GetOrCreate(userID, defaultName string) (string, bool, error) {
+	sds.mu.Lock()
+	if rec, ok := sds.userData[userID]; ok {
+		sds.mu.Unlock()
+		return rec.Name, false, nil
+	}
+	if sds.userData == nil {
+		sds.userData = map[string]userRecord{}
+	}
+	sds.userData[userID] = userRecord{Name: defaultName}
+	sds.touchLocked(userID)
+	sds.mu.Unlock()
+	sds.emit(ChangeEvent{Op: ChangeAdd, UserID: userID, NewName: defaultName})
+	return defaultName, true, nil
+}
+
+// UserCountは、ユーザーの数を返す
+func (sds *SimpleDataStore) UserCount() int {
+	sds.mu.RLock()
+	defer sds.mu.RUnlock()
+	return len(sds.userData)
+}
+
+// SearchByNamePrefixは、名前がprefixで始まるユーザーのIDを並べ替えて返す。大文字と小文字は区別しない。
+// 見つからなければ空のスライスを返す。
+func (sds *SimpleDataStore) SearchByNamePrefix(prefix string) []string {
+	prefix = strings.ToLower(prefix)
+	sds.mu.RLock()
+	defer sds.mu.RUnlock()
+	ids := []string{}
+	for id, rec := range sds.userData {
+		if strings.HasPrefix(strings.ToLower(rec.Name), prefix) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ImportErrorは、ImportUsersに渡されたユーザーのうち、正しくなかったもののユーザーID
+type ImportError struct {
+	Keys []string
+}
+
+func (ie ImportError) Error() string {
+	return "user_idかnameが空のユーザーがあります: " + strings.Join(ie.Keys, ", ")
+}
+
+// ImportUsersは、usersをまとめて追加する。既に存在するユーザーIDは、overwriteがtrueなら上書きし、falseなら飛ばす。
+// 追加や上書きをしたユーザーの数を返す。IDか名前が空のユーザーが1つでもあれば、何も変えずにImportErrorを返す。
+func (sds *SimpleDataStore) ImportUsers(users map[string]string, overwrite bool) (int, error) {
+	var bad []string
+	for id, name := range users {
+		if id == "" || name == "" {
+			bad = append(bad, id)
+		}
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return 0, ImportError{Keys: bad}
+	}
+	sds.mu.Lock()
+	if sds.userData == nil {
+		sds.userData = map[string]userRecord{}
+	}
+	var events []ChangeEvent
+	for id, name := range users {
+		old, ok := sds.userData[id]
+		if ok && !overwrite {
+			continue
+		}
+		// 上書きしても、無効にしたユーザーは無効のままにする
+		sds.userData[id] = userRecord{Name: name, Disabled: old.Disabled}
+		sds.touchLocked(id)
+		if ok {
+			events = append(events, ChangeEvent{Op: ChangeUpdate, UserID: id, OldName: old.Name, NewName: name})
+		} else {
+			events = append(events, ChangeEvent{Op: ChangeAdd, UserID: id, NewName: name})
+		}
+	}
+	sds.mu.Unlock()
+	sds.emit(events...)
+	return len(events), nil
+}
+
+// SetIDGeneratorは、AddUserがIDを作るのに使うIDGeneratorを差し替える。
+// 差し替えなければSequentialIDGeneratorを使う。
+func (sds *SimpleDataStore) SetIDGenerator(g IDGenerator) {
+	sds.mu.Lock()
+	defer sds.mu.Unlock()
+	sds.idGen = g
+}
+
+// AddUserは、IDGeneratorで作ったIDでユーザーを追加し、そのIDを返す。
+// 作ったIDが既に使われていれば、使われていないIDができるまで作り直す。
+func (sds *SimpleDataStore) AddUser(name string) (string, error) {
+	id, err := sds.addUser(name)
+	if err != nil {
+		return "", err
+	}
+	sds.emit(ChangeEvent{Op: ChangeAdd, UserID: id, NewName: name})
+	return id, nil
+}
+
+func (sds *SimpleDataStore) addUser(name string) (string, error) {
+	sds.mu.Lock()
+	defer sds.mu.Unlock()
+	if sds.idGen == nil {
+		sds.idGen = &SequentialIDGenerator{}
+	}
+	if sds.userData == nil {
+		sds.userData = map[string]userRecord{}
+	}
+	for {
+		id, err := sds.idGen.NewID()
+		if err != nil {
+			return "", err
+		}
+		if _, ok := sds.userData[id]; ok {
+			continue
+		}
+		sds.userData[id] = userRecord{Name: name}
+		sds.touchLocked(id)
+		return id, nil
+	}
+}
+
+// Snapshotは、全てのユーザーをJSONにする。
+// 無効にしていないユーザーは、これまでと同じくユーザーIDから名前へのマップの形で書く。
+func (sds *SimpleDataStore) Snapshot() ([]byte, error) {
+	sds.mu.RLock()
+	defer sds.mu.RUnlock()
+	if sds.userData == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(sds.userData)
+}
+
+// SnapshotToは、Snapshotと同じJSONを、全体をメモリに作らずに1人ずつwに書き込む。
+// 書き込みが遅くても書き込みのロックを待たせないように、ユーザーの一覧を写してからロックを外して書く。
+func (sds *SimpleDataStore) SnapshotTo(w io.Writer) error {
+	sds.mu.RLock()
+	userData := make(map[string]userRecord, len(sds.userData))
+	for id, rec := range sds.userData {
+		userData[id] = rec
+	}
+	sds.mu.RUnlock()
+	ids := make([]string, 0, len(userData))
+	for id := range userData {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	for i, id := range ids {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		key, err := json.Marshal(id)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(userData[id])
+		if err != nil {
+			return err
+		}
+		bw.Write(key)
+		bw.WriteByte(':')
+		if _, err := bw.Write(value); err != nil {
+			return err
+		}
+	}
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+// Restoreは、Snapshotで作ったJSONでユーザーを丸ごと置き換える。
+// dataが正しくなければ何も変えずにエラーを返す。ユーザーごとの変更ではないので、OnChangeの関数は呼ばない。
+func (sds *SimpleDataStore) Restore(data []byte) error {
+	var userData map[string]userRecord
+	if err := json.Unmarshal(data, &userData); err != nil {
+		return err
+	}
+	if userData == nil {
+		userData = map[string]userRecord{}
+	}
+	sds.mu.Lock()
+	defer sds.mu.Unlock()
+	sds.userData = userData
+	// 戻す前と同じ版のまま別の名前にならないように、全てのユーザーを新しい版にする
+	sds.versions = nil
+	for id := range userData {
+		sds.touchLocked(id)
+	}
+	return nil
+}
+
+// ErrUnknownUserは、存在しないユーザーIDを検索したり操作しようとしたときのエラー。
+// errors.Isで見分けられるように、Logicやデータストアはこれをそのまま（またはラップして）返す。
+var ErrUnknownUser = errors.New("不明なユーザー")
+
+// UpdateUserForIDは、ユーザーの名前を変える。userIDが存在しない場合はErrUnknownUserを返す。
+func (sds *SimpleDataStore) UpdateUserForID(userID, newName string) error {
+	_, err := sds.updateUser(userID, newName, nil)
+	return err
+}
+
+// ErrVersionMismatchは、UpdateUserIfVersionに渡した版が、ユーザーの今の版と違うときのエラー
+var ErrVersionMismatch = errors.New("ユーザーは読まれた後に変更されています")
+
+// UserVersionは、userIDのユーザーの今の版を返す。書き込むたびに変わる。userIDが存在しなければokがfalseになる。
+func (sds *SimpleDataStore) UserVersion(userID string) (uint64, bool) {
+	sds.mu.RLock()
+	defer sds.mu.RUnlock()
+	if _, ok := sds.userData[userID]; !ok {
+		return 0, false
+	}
+	return sds.versions[userID], true
+}
+
+// UpdateUserIfVersionは、userIDのユーザーの今の版がversionのときだけ名前を変え、新しい版を返す。
+// 版が違えばErrVersionMismatchを、userIDが存在しなければErrUnknownUserを返す。1回のロックの中で確かめて書き込む。
+func (sds *SimpleDataStore) UpdateUserIfVersion(userID, newName string, version uint64) (uint64, error) {
+	return sds.updateUser(userID, newName, &version)
+}
+
+// updateUserは、userIDのユーザーの名前を変えて、新しい版を返す。versionがnilでなければ、今の版がそれと同じときだけ変える。
+func (sds *SimpleDataStore) updateUser(userID, newName string, version *uint64) (uint64, error) {
+	sds.mu.Lock()
+	old, ok := sds.userData[userID]
+	if !ok {
+		sds.mu.Unlock()
+		return 0, ErrUnknownUser
+	}
+	if version != nil && sds.versions[userID] != *version {
+		sds.mu.Unlock()
+		return 0, ErrVersionMismatch
+	}
+	sds.userData[userID] = userRecord{Name: newName, Disabled: old.Disabled}
+	sds.touchLocked(userID)
+	newVersion := sds.versions[userID]
+	sds.mu.Unlock()
+	sds.emit(ChangeEvent{Op: ChangeUpdate, UserID: userID, OldName: old.Name, NewName: newName})
+	return newVersion, nil
+}
+
+// touchLockedは、userIDのユーザーを新しい版にする。sds.muを持って呼ぶこと。
+func (sds *SimpleDataStore) touchLocked(userID string) {
+	if sds.versions == nil {
+		sds.versions = map[string]uint64{}
+	}
+	sds.seq++
+	sds.versions[userID] = sds.seq
+}
+
+// DeleteUserForIDは、ユーザーを削除する。userIDが存在しない場合はErrUnknownUserを返す。
+func (sds *SimpleDataStore) DeleteUserForID(userID string) error {
+	sds.mu.Lock()
+	old, ok := sds.userData[userID]
+	if !ok {
+		sds.mu.Unlock()
+		return ErrUnknownUser
+	}
+	delete(sds.userData, userID)
+	delete(sds.versions, userID)
+	sds.mu.Unlock()
+	sds.emit(ChangeEvent{Op: ChangeDelete, UserID: userID, OldName: old.Name})
+	return nil
+}
+
+// RekeyUserは、oldIDのユーザーをnewIDに移す。名前と無効かどうかはそのまま引き継ぐ。
+// oldIDが存在しない場合はErrUnknownUserを、newIDが既に存在する場合はErrUserExistsを返す。
+// 途中の状態が見えないように、1回のロックの中で移す。OnChangeにはoldIDの削除とnewIDの追加を順に知らせる。
+func (sds *SimpleDataStore) RekeyUser(oldID, newID string) error {
+	sds.mu.Lock()
+	rec, ok := sds.userData[oldID]
+	if !ok {
+		sds.mu.Unlock()
+		return ErrUnknownUser
+	}
+	if _, ok := sds.userData[newID]; ok {
+		sds.mu.Unlock()
+		return ErrUserExists
+	}
+	delete(sds.userData, oldID)
+	delete(sds.versions, oldID)
+	sds.userData[newID] = rec
+	sds.touchLocked(newID)
+	sds.mu.Unlock()
+	sds.emit(
+		ChangeEvent{Op: ChangeDelete, UserID: oldID, OldName: rec.Name},
+		ChangeEvent{Op: ChangeAdd, UserID: newID, NewName: rec.Name},
+	)
+	return nil
+}
+
+// ErrUserDisabledは、DisableUserで無効にしたユーザーを検索したときのエラー
+var ErrUserDisabled = errors.New("無効なユーザー")
+
+// DisableUserは、userIDのユーザーを消さずに無効にする。無効にしたユーザーを検索するとErrUserDisabledになる。
+// userIDが存在しない場合はErrUnknownUserを返す。
+// 名前は変わらないが、覚えている挨拶を忘れさせるために、OnChangeには名前の同じ更新として知らせる。
+func (sds *SimpleDataStore) DisableUser(userID string) error {
+	return sds.setDisabled(userID, true)
+}
+
+// EnableUserは、DisableUserで無効にしたユーザーを元に戻す。userIDが存在しない場合はErrUnknownUserを返す。
+func (sds *SimpleDataStore) EnableUser(userID string) error {
+	return sds.setDisabled(userID, false)
+}
+
+func (sds *SimpleDataStore) setDisabled(userID string, disabled bool) error {
+	sds.mu.Lock()
+	rec, ok := sds.userData[userID]
+	if !ok {
+		sds.mu.Unlock()
+		return ErrUnknownUser
+	}
+	if rec.Disabled == disabled {
+		sds.mu.Unlock()
+		return nil
+	}
+	rec.Disabled = disabled
+	sds.userData[userID] = rec
+	sds.touchLocked(userID)
+	sds.mu.Unlock()
+	sds.emit(ChangeEvent{Op: ChangeUpdate, UserID: userID, OldName: rec.Name, NewName: rec.Name})
+	return nil
 }
 
 // NewSimpleDataStoreは、SimpleDataStoreのインスタンスを生成するファクトリ関数
-func NewSimpleDataStore() SimpleDataStore {
-	return SimpleDataStore{
-		userData: map[string]string{
-			"1": "Fred",
-			"2": "Mary",
-			"3": "Pat",
+func NewSimpleDataStore() *SimpleDataStore {
+	return &SimpleDataStore{
+		userData: map[string]userRecord{
+			"1": {Name: "Fred"},
+			"2": {Name: "Mary"},
+			"3": {Name: "Pat"},
 		},
 	}
 }
 
-// DataStoreは、ビジネスロジックが何に依存するかを説明したインターフェイス
+// DataStoreは、ビジネスロジックが何に依存するかを説明したインターフェイス。
+// ユーザーが見つからないときはokがfalseになり、検索自体に失敗したとき（ctxのキャンセルなど）はerrを返す。
 type DataStore interface {
-	UserNameForID(userID string) (string, bool)
+	UserNameForID(ctx context.Context, userID string) (name string, ok bool, err error)
+}
+
+// Pingerは、自分が使える状態かを確かめられるDataStoreが実装するインターフェイス
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Listerは、全てのユーザーを列挙できるDataStoreが実装するインターフェイス
+type Lister interface {
+	AllUsers() map[string]string
+}
+
+// IDAssignerは、IDを自分で作ってユーザーを追加できるDataStoreが実装するインターフェイス
+type IDAssigner interface {
+	AddUser(name string) (id string, err error)
+}
+
+// Snapshotterは、中身を丸ごと書き出したり戻したりできるDataStoreが実装するインターフェイス
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+// StreamSnapshotterは、中身をメモリに丸ごと作らずに書き出せるSnapshotterが実装するインターフェイス。
+// ユーザーが多いデータストアで、Snapshotのために大きなバイト列を作らずに済む。
+type StreamSnapshotter interface {
+	SnapshotTo(w io.Writer) error
+}
+
+// Reloaderは、元のファイルなどからユーザーを読み直せるDataStoreが実装するインターフェイス。
+// 読み直せなければ、前の状態のままエラーを返す。
+type Reloader interface {
+	Reload() error
+}
+
+// Counterは、ユーザーの数を数えられるDataStoreが実装するインターフェイス
+type Counter interface {
+	UserCount() int
+}
+
+// Searcherは、名前でユーザーを探せるDataStoreが実装するインターフェイス
+type Searcher interface {
+	SearchByNamePrefix(prefix string) []string
+}
+
+// Pagerは、ユーザーをユーザーID順に少しずつ列挙できるDataStoreが実装するインターフェイス。
+// offset番目からlimit人のユーザーと、全てのユーザーの数を返す。
+type Pager interface {
+	UsersPage(offset, limit int) (users []User, total int)
+}
+
+// Disablerは、ユーザーを消さずに無効にできるDataStoreが実装するインターフェイス
+type Disabler interface {
+	DisableUser(userID string) error
+	EnableUser(userID string) error
+}
+
+// GetOrCreaterは、ユーザーがいなければ追加するのを1回の操作でできるDataStoreが実装するインターフェイス
+type GetOrCreater interface {
+	GetOrCreate(userID, defaultName string) (name string, created bool, err error)
+}
+
+// Rekeyerは、ユーザーのIDを変えられるDataStoreが実装するインターフェイス
+type Rekeyer interface {
+	RekeyUser(oldID, newID string) error
+}
+
+// Versionerは、ユーザーごとに書き込むたびに変わる版を持ち、版を確かめてから更新できるDataStoreが実装するインターフェイス。
+// PUT /usersのIf-Matchで、読んだ後に変わったユーザーを上書きしないために使う。
+type Versioner interface {
+	UserVersion(userID string) (version uint64, ok bool)
+	UpdateUserIfVersion(userID, newName string, version uint64) (newVersion uint64, err error)
+}
+
+// Importerは、ユーザーをまとめて追加できるDataStoreが実装するインターフェイス
+type Importer interface {
+	ImportUsers(users map[string]string, overwrite bool) (int, error)
+}
+
+// WritableDataStoreは、書き込みもできるDataStore。
+// 読み取りだけを使うコンポーネントはDataStoreに依存したままでよい。
+type WritableDataStore interface {
+	DataStore
+	AddUserForID(userID, name string) error
+	UpdateUserForID(userID, newName string) error
+	DeleteUserForID(userID string) error
 }
 
 // Loggerは、ビジネスロジックが何に依存するかを説明したインターフェイス
 type Logger interface {
 	Log(message string)
+	Logf(level Level, format string, args ...any)
 }
 
 // LoggerAdapterは、LogOutputが適合するメソッドを持った関数型
@@ -50,75 +587,992 @@ func (lg LoggerAdapter) Log(message string) {
 	lg(message)
 }
 
+// Logfは、レベルを"[INFO] "のような接頭辞にして書式化したメッセージを出力する
+func (lg LoggerAdapter) Logf(level Level, format string, args ...any) {
+	lg("[" + level.String() + "] " + fmt.Sprintf(format, args...))
+}
+
 // SimpleLogicは、LoggerとDataStoreのフィールドを持った構造体。
 // 具象型には触れていないので依存はなく、後になって違うとこらから新たな実装を持ってきて入れ替えても問題ない。
 type SimpleLogic struct {
-	l  Logger
-	ds DataStore
+	l         Logger
+	ds        DataStore
+	greeter   Greeter
+	formatter Formatter
+	// templatesは、greeterの代わりに使う、読み直せるテンプレート。nilならgreeterを使う。
+	templates *TemplateSource
+	// suggestDistanceは、見つからなかったユーザーIDに近いIDを探すときの距離の上限。負なら探さない。
+	suggestDistance int
+	// guestNameは、userIDが空のときに挨拶する名前。空ならuserIDが空でもデータストアを探す。
+	guestName string
+	// clockは、SayHelloDetailedのGreetedAtの時刻を決める
+	clock Clock
 }
 
-func (sl SimpleLogic) SayHello(userID string) (string, error) {
-	sl.l.Log("SayHello(" + userID + ")")
-	name, ok := sl.ds.UserNameForID(userID)
+// SayHelloは、ctxの言語（LanguageFromContext）でuserIDのユーザーに挨拶する。
+// ゲストモードなら、userIDが空のときにゲストの名前で挨拶する。
+func (sl SimpleLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	result, err := sl.SayHelloDetailed(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return result.Message, nil
+}
+
+// SayHelloDetailedは、SayHelloと同じく挨拶し、挨拶の文と一緒に、名前、使った言語、挨拶した時刻を返す
+func (sl SimpleLogic) SayHelloDetailed(ctx context.Context, userID string) (GreetingResult, error) {
+	LoggerWithContext(ctx, sl.l).Log("SayHello(" + escapeForLog(userID) + ")")
+	name := sl.guestName
+	if userID != "" || sl.guestName == "" {
+		var ok bool
+		var err error
+		name, ok, err = sl.ds.UserNameForID(ctx, userID)
+		if err != nil {
+			return GreetingResult{}, err
+		}
+		if !ok {
+			return GreetingResult{}, sl.unknownUser(userID)
+		}
+	}
+	g := Greeting{Name: name, Kind: GreetingHello, Lang: LanguageFromContext(ctx)}
+	result := GreetingResult{Name: name, Message: sl.format(g), GreetedAt: clockOrReal(sl.clock).Now()}
+	if _, ok := sl.formatter.(GreetingFormatter); ok || sl.formatter == nil {
+		result.Language = sl.currentGreeter().Language(g)
+	}
+	return result, nil
+}
+
+func (sl SimpleLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	LoggerWithContext(ctx, sl.l).Log("SayGoodbye(" + escapeForLog(userID) + ")")
+	if userID == "" && sl.guestName != "" {
+		return sl.format(Greeting{Name: sl.guestName, Kind: GreetingGoodbye}), nil
+	}
+	name, ok, err := sl.ds.UserNameForID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
 	if !ok {
-		return "", errors.New("不明なユーザー")
+		return "", ErrUnknownUser
 	}
-	return name + "さん　こんにちは。", nil
+	return sl.format(Greeting{Name: name, Kind: GreetingGoodbye}), nil
 }
 
-func (sl SimpleLogic) SayGoodbye(userID string) (string, error) {
-	sl.l.Log("SayGoodbye(" + userID + ")")
-	name, ok := sl.ds.UserNameForID(userID)
+// unknownUserは、userIDが見つからなかったときのエラーを返す。
+// 近いIDを探すように設定されていて、データストアかデコレーターが包んだデータストアがListerで、近いIDがあれば、UnknownUserErrorで提案する。
+func (sl SimpleLogic) unknownUser(userID string) error {
+	if sl.suggestDistance < 0 {
+		return ErrUnknownUser
+	}
+	lister, ok := listerOf(sl.ds)
 	if !ok {
-		return "", errors.New("不明なユーザー")
+		return ErrUnknownUser
+	}
+	users := lister.AllUsers()
+	ids := make([]string, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	if id, ok := closestID(ids, userID, sl.suggestDistance); ok {
+		return UnknownUserError{Suggestion: id}
+	}
+	return ErrUnknownUser
+}
+
+// formatは、Formatterがあればそれで、なければ言語ごとのテンプレートで挨拶の文を作る。
+// FormatterがGreetingFormatterなら、gの言語と今のテンプレートを渡す。
+func (sl SimpleLogic) format(g Greeting) string {
+	if gf, ok := sl.formatter.(GreetingFormatter); ok {
+		return gf.FormatGreeting(g, sl.currentGreeter())
+	}
+	if sl.formatter != nil {
+		return sl.formatter.Format(g.Name, g.Kind)
+	}
+	return sl.currentGreeter().Format(g)
+}
+
+// currentGreeterは、読み直せるテンプレートがあればその今のGreeterを、なければgreeterを返す
+func (sl SimpleLogic) currentGreeter() Greeter {
+	if sl.templates != nil {
+		return sl.templates.Greeter()
 	}
-	return name + "さん　さようなら", nil
+	return sl.greeter
 }
 
 // NewSimpleLogicは、SimpleLogicのインスタンスを作成するファクトリ関数。インターフェイスを渡すと構造体を返す。
-func NewSimpleLogic(l Logger, ds DataStore) SimpleLogic {
-	return SimpleLogic{
-		l:  l,
-		ds: ds,
+// 挨拶の文はcfgのテンプレートで作る。lはSafeLoggerで包むので、lがパニックしても挨拶は返せる。
+// cfg.SuggestUsersがtrueなら、見つからなかったユーザーIDに近いIDをUnknownUserErrorで提案する。
+func NewSimpleLogic(l Logger, ds DataStore, cfg Config) SimpleLogic {
+	sl := SimpleLogic{
+		l:               NewSafeLogger(l),
+		ds:              ds,
+		greeter:         NewGreeterFromConfig(cfg),
+		suggestDistance: -1,
+	}
+	if cfg.SuggestUsers {
+		sl.suggestDistance = cfg.SuggestMaxDistance
 	}
+	if cfg.GuestMode {
+		sl.guestName = cfg.GuestName
+	}
+	return sl
+}
+
+// NewSimpleLogicWithClockは、SayHelloDetailedのGreetedAtをclockの時刻にするSimpleLogicを作成するファクトリ関数
+func NewSimpleLogicWithClock(l Logger, ds DataStore, cfg Config, clock Clock) SimpleLogic {
+	sl := NewSimpleLogic(l, ds, cfg)
+	sl.clock = clock
+	return sl
+}
+
+// NewSimpleLogicWithTemplatesは、挨拶の文をtsの今のテンプレートで作るSimpleLogicを作成するファクトリ関数。
+// ts.Reloadで読み直したテンプレートは、次の挨拶から使われる。
+func NewSimpleLogicWithTemplates(l Logger, ds DataStore, cfg Config, ts *TemplateSource) SimpleLogic {
+	sl := NewSimpleLogic(l, ds, cfg)
+	sl.templates = ts
+	return sl
 }
 
-// Logicは、Controllerで「こんにちは」を言うためのインターフェイス
+// NewSimpleLogicWithFormatterは、挨拶の文をfで作るSimpleLogicを作成するファクトリ関数。
+// fがGreetingFormatterでなければ、リクエストの言語を見ない。fがnilなら、NewSimpleLogicと同じく既定のテンプレートを使う。
+func NewSimpleLogicWithFormatter(l Logger, ds DataStore, f Formatter) SimpleLogic {
+	sl := NewSimpleLogic(l, ds, Config{})
+	sl.formatter = f
+	return sl
+}
+
+// Logicは、Controllerで「こんにちは」と「さようなら」を言うためのインターフェイス
 type Logic interface {
-	SayHello(userID string) (string, error)
+	SayHello(ctx context.Context, userID string) (string, error)
+	SayGoodbye(ctx context.Context, userID string) (string, error)
 }
 
 type Controller struct {
-	l     Logger
-	logic Logic
+	l               Logger
+	logic           Logic
+	ds              DataStore
+	enc             ResponseEncoder
+	tracer          Tracer
+	page            *template.Template
+	draining        *atomic.Bool
+	maxUserIDLength int
+	maxBodyBytes    int64
+	bodyReadTimeout time.Duration
+	validator       Validator
+	idempotency     *IdempotencyCache
+	inflight        *InflightCounter
+	routeTable      *RouteTable
+	errorRate       *ErrorRateTracker
+	maintenance     *MaintenanceMode
+	requireIfMatch  bool
+	// cachesは、書き込みの後で変わったユーザーの結果を忘れさせるキャッシュ
+	caches []*CacheDataStore
+	// apiKeys、flags、observeは、HandlerがRegisterRoutesに渡す値
+	apiKeys map[string]string
+	flags   FeatureFlags
+	observe []func(http.Handler) http.Handler
+	// metricsとlogStreamは、HandlerがRegisterRoutesの外で/metrics、/metrics.json、/logs/streamに登録するもの。nilなら登録しない。
+	metrics   *Metrics
+	logStream http.Handler
+	// rateLimiter、corsOrigins、maxURLLength、maxConcurrentは、Handlerが全てのルートの外側に掛けるミドルウェアの設定
+	rateLimiter   *RateLimiter
+	corsOrigins   []string
+	maxURLLength  int
+	maxConcurrent int
+	// supportsとdefaultLangは、リクエストの言語を決めるときに使う。supportsがnilなら既定のテンプレートの言語を使う。
+	supports    func(lang string) bool
+	defaultLang string
+	// allowGuestは、user_idが空でもLogicに渡すかどうか。ゲストモードのLogicと一緒に使う。
+	allowGuest bool
+}
+
+func (c Controller) writeMessage(w http.ResponseWriter, message string) {
+	c.encoder().WriteMessage(w, http.StatusOK, message)
+}
+
+func (c Controller) writeError(w http.ResponseWriter, status int, message string) {
+	c.encoder().WriteError(w, status, message)
+}
+
+// encoderは、Controllerのレスポンスの書き込み方を返す。指定されていなければTextEncoderを使う。
+func (c Controller) encoder() ResponseEncoder {
+	if c.enc == nil {
+		return TextEncoder{}
+	}
+	return c.enc
+}
+
+// startSpanは、リクエストヘッダの呼び出し元のトレースを引き継いで、nameのルートスパンを始める
+func (c Controller) startSpan(r *http.Request, name string) (context.Context, Span) {
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	return tracer.Start(tracer.Extract(r.Context(), r.Header), name)
 }
 
+// validUserIDは、userIDが空か長すぎるときにエラーを書き込んでfalseを返す。
+// ゲストを受け付けるなら、空のuserIDはそのまま通す。
+func (c Controller) validUserID(w http.ResponseWriter, userID string) bool {
+	if userID == "" && !c.allowGuest {
+		c.writeError(w, http.StatusBadRequest, "user_id is required")
+		return false
+	}
+	if utf8.RuneCountInString(userID) > c.maxUserIDLength {
+		c.writeError(w, http.StatusUnprocessableEntity, "user_id is too long")
+		return false
+	}
+	return true
+}
+
+// queryは、リクエストのクエリを返す。
+// r.URL.Queryは正しくエンコードされていない値を黙って捨てるので、代わりにこれを使う。
+// 正しくなければ400 "malformed query"を書き込み、falseを返す。
+func (c Controller) query(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	q, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		c.writeError(w, http.StatusBadRequest, "malformed query")
+		return nil, false
+	}
+	return q, true
+}
+
+// SayHelloは、クエリのuser_idのユーザーに挨拶する。
+// create-if-missing=trueなら、ユーザーがいなければ先に追加してから挨拶する。名前はクエリのnameで、なければuser_idにする。
 func (c Controller) SayHello(w http.ResponseWriter, r *http.Request) {
-	c.l.Log("SayHello内: ")
-	userID := r.URL.Query().Get("user_id")
-	message, err := c.logic.SayHello(userID)
+	q, ok := c.query(w, r)
+	if !ok {
+		return
+	}
+	userID := q.Get("user_id")
+	if !c.validUserID(w, userID) {
+		return
+	}
+	if q.Get("create-if-missing") == "true" && userID != "" && !c.createIfMissing(w, r, userID, q.Get("name")) {
+		return
+	}
+	ctx, span := c.startSpan(r, "GET /hello")
+	defer span.End()
+	message, err := c.logic.SayHello(ctx, userID)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		c.writeGreetingError(w, r, userID, err)
+		return
+	}
+	c.writeCacheable(w, r, message)
+}
+
+// createIfMissingは、userIDのユーザーがいなければnameで追加する。nameが空ならuserIDを名前にする。
+// 追加できなければエラーを書き込んでfalseを返す。データストアがGetOrCreaterでなければ501にする。
+func (c Controller) createIfMissing(w http.ResponseWriter, r *http.Request, userID, name string) bool {
+	gc, ok := c.ds.(GetOrCreater)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "ユーザーを追加できないデータストア")
+		return false
+	}
+	if name == "" {
+		name = userID
+	}
+	if c.validator != nil {
+		if err := c.validator.Validate(userID, name); err != nil {
+			c.WriteError(w, r, err)
+			return false
+		}
+	}
+	_, created, err := gc.GetOrCreate(userID, name)
+	if err != nil {
+		c.WriteError(w, r, err)
+		return false
+	}
+	if created {
+		c.forget(userID)
+	}
+	return true
+}
+
+func (c Controller) SayGoodbye(w http.ResponseWriter, r *http.Request) {
+	q, ok := c.query(w, r)
+	if !ok {
+		return
+	}
+	userID := q.Get("user_id")
+	if !c.validUserID(w, userID) {
+		return
+	}
+	ctx, span := c.startSpan(r, "GET /goodbye")
+	defer span.End()
+	message, err := c.logic.SayGoodbye(ctx, userID)
+	if err != nil {
+		c.writeGreetingError(w, r, userID, err)
+		return
+	}
+	c.writeCacheable(w, r, message)
+}
+
+// userNotFoundResponseは、挨拶しようとしたユーザーが見つからなかったときに返すJSON
+type userNotFoundResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	ID      string `json:"id"`
+}
+
+// writeGreetingErrorは、userIDへの挨拶に失敗したerrを書き込む。
+// ユーザーが見つからなかったときは、エンコーダによらず、codeが"user_not_found"のJSONを404で返す。
+// データストアが空のときなどに、ほかのエラーと見分けられるようにするため。
+// ほかのエラーはWriteErrorで書き込む。
+func (c Controller) writeGreetingError(w http.ResponseWriter, r *http.Request, userID string, err error) {
+	if errors.Is(err, ErrUnknownUser) {
+		c.recordUnknownUser(err)
+		writeUserNotFound(w, userID, err.Error())
+		return
+	}
+	c.WriteError(w, r, err)
+}
+
+// writeUserNotFoundは、userIDのユーザーが見つからなかったことを、codeが"user_not_found"のJSONで404で返す
+func writeUserNotFound(w http.ResponseWriter, userID, message string) {
+	writeJSON(w, http.StatusNotFound, userNotFoundResponse{Code: "user_not_found", Message: message, ID: userID})
+}
+
+// statusClientClosedRequestは、応答する前にクライアントが切断したリクエストのステータスコード。
+// nginxに倣った非標準のコードで、アクセスログやメトリクスでサーバーの失敗と区別するために使う。
+const statusClientClosedRequest = 499
+
+// clientGoneは、errがrのクライアントの切断によるものなら、"client cancelled"をログに書いてtrueを返す。
+// 切れた接続にエラーを書いても届かないので、ボディは書かずにステータスコードだけを記録する。
+func (c Controller) clientGone(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, context.Canceled) || !errors.Is(r.Context().Err(), context.Canceled) {
+		return false
+	}
+	LoggerWithContext(r.Context(), c.l).Logf(LevelInfo, "client cancelled: %s %s", r.Method, escapeForLog(r.URL.Path))
+	w.WriteHeader(statusClientClosedRequest)
+	return true
+}
+
+// HealthCheckは、データストアが使えれば200 "ok"を、使えなければ503を返す。
+// データストアがPingerでなければ、存在しないユーザーを検索して失敗しないかを確かめる。
+// Drainされた後は、ロードバランサーに外してもらうために、データストアが使えても503を返す。
+func (c Controller) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	if c.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("draining"))
+		return
+	}
+	var err error
+	if p, ok := c.ds.(Pinger); ok {
+		err = p.Ping(r.Context())
+	} else {
+		_, _, err = c.ds.UserNameForID(r.Context(), "")
+	}
+	if err != nil {
+		LoggerWithContext(r.Context(), c.l).Logf(LevelError, "HealthCheck: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	w.Write([]byte(message))
+	w.Write([]byte("ok"))
+}
+
+// bodyは、最大でmaxBodyBytesまでしか読めず、bodyReadTimeoutの間進まなければ読めなくなるリクエストボディを返す
+func (c Controller) body(w http.ResponseWriter, r *http.Request) io.ReadCloser {
+	body := http.MaxBytesReader(w, r.Body, c.maxBodyBytes)
+	if c.bodyReadTimeout <= 0 {
+		return body
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{newIdleTimeoutReader(body, c.bodyReadTimeout), body}
+}
+
+// bodyErrorStatusは、リクエストボディを読めなかったときのステータスコードを返す。
+// 大きすぎるボディは413、読み込みが進まないボディは408、それ以外（JSONが正しくないなど）は400になる。
+func bodyErrorStatus(err error) int {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, ErrBodyReadTimeout) {
+		return http.StatusRequestTimeout
+	}
+	return http.StatusBadRequest
+}
+
+// userRequestは、ユーザーを書き込むリクエストのボディ
+type userRequest struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+// AddUserは、リクエストボディのuser_idとnameでユーザーを登録する。
+// user_idがなければデータストアにIDを作らせ、そのIDを{"user_id": "..."}で返す。
+func (c Controller) AddUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	wds, ok := c.ds.(WritableDataStore)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "書き込みできないデータストア")
+		return
+	}
+	req, ok := c.decodeUserRequest(w, r, false)
+	if !ok {
+		return
+	}
+	if req.UserID == "" {
+		c.addUserWithGeneratedID(w, r, req.Name)
+		return
+	}
+	if err := wds.AddUserForID(req.UserID, req.Name); err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	c.forget(req.UserID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// addUserWithGeneratedIDは、データストアが作ったIDでnameのユーザーを登録する
+func (c Controller) addUserWithGeneratedID(w http.ResponseWriter, r *http.Request, name string) {
+	assigner, ok := c.ds.(IDAssigner)
+	if !ok {
+		c.writeError(w, http.StatusBadRequest, "user_idは必須")
+		return
+	}
+	id, err := assigner.AddUser(name)
+	if err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	c.forget(id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"user_id": id})
+}
+
+// UpdateUserは、リクエストボディのuser_idのユーザーの名前をnameに変える。
+// AddUserと違い、ユーザーが存在しなければ404を返す。
+// If-Matchヘッダがあれば、GET /users/{id}のETagの版のときだけ変え、違えば412を返す。データストアが版を持たなければ501を返す。
+// WithRequireIfMatchでIf-Matchを必須にしていれば、ないときは428を返す。変えた後の版はETagヘッダで返す。
+func (c Controller) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodPut)
+		return
+	}
+	wds, ok := c.ds.(WritableDataStore)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "書き込みできないデータストア")
+		return
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" && c.requireIfMatch {
+		c.writeError(w, http.StatusPreconditionRequired, "If-Matchヘッダが必要です")
+		return
+	}
+	vs, versioned := c.ds.(Versioner)
+	if ifMatch != "" && !versioned {
+		c.writeError(w, http.StatusNotImplemented, "版を持たないデータストア")
+		return
+	}
+	req, ok := c.decodeUserRequest(w, r, true)
+	if !ok {
+		return
+	}
+	if ifMatch != "" {
+		version, err := updateIfMatch(vs, req.UserID, req.Name, ifMatch)
+		if err != nil {
+			c.WriteError(w, r, err)
+			return
+		}
+		c.forget(req.UserID)
+		w.Header().Set("ETag", userETag(version))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := wds.UpdateUserForID(req.UserID, req.Name); err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	c.forget(req.UserID)
+	if versioned {
+		if version, ok := vs.UserVersion(req.UserID); ok {
+			w.Header().Set("ETag", userETag(version))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeUserRequestは、リクエストボディを読み込み、nameと（requireIDがtrueなら）user_idがあるかを確かめる。
+// 問題があれば400を書き込んでfalseを返す。さらにvalidatorで確かめ、問題があれば全ての問題を422で返す。
+func (c Controller) decodeUserRequest(w http.ResponseWriter, r *http.Request, requireID bool) (userRequest, bool) {
+	var req userRequest
+	if !c.decodeBody(w, r, &req) {
+		return req, false
+	}
+	if (requireID && req.UserID == "") || req.Name == "" {
+		c.writeError(w, http.StatusBadRequest, "user_idとnameは必須")
+		return req, false
+	}
+	if c.validator != nil {
+		if err := c.validator.Validate(req.UserID, req.Name); err != nil {
+			c.WriteError(w, r, err)
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// DeleteUserは、クエリのuser_idのユーザーを削除する
+func (c Controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	wds, ok := c.ds.(WritableDataStore)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "書き込みできないデータストア")
+		return
+	}
+	q, ok := c.query(w, r)
+	if !ok {
+		return
+	}
+	userID := q.Get("user_id")
+	if err := wds.DeleteUserForID(userID); err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	c.forget(userID)
+	LoggerWithContext(r.Context(), c.l).Log("DeleteUser(" + escapeForLog(userID) + ")")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rekeyRequestは、RekeyUserが読むリクエストボディ
+type rekeyRequest struct {
+	OldID string `json:"old_id"`
+	NewID string `json:"new_id"`
+}
+
+// RekeyUserは、リクエストボディのold_idのユーザーのIDをnew_idに変える。アカウントをまとめるときなどに使う。
+// old_idのユーザーがいなければ404を、new_idのユーザーが既にいれば409を返す。
+func (c Controller) RekeyUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	rk, ok := c.ds.(Rekeyer)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "IDを変えられないデータストア")
+		return
+	}
+	var req rekeyRequest
+	if !c.decodeBody(w, r, &req) {
+		return
+	}
+	if req.OldID == "" || req.NewID == "" {
+		c.writeError(w, http.StatusBadRequest, "old_idとnew_idは必須")
+		return
+	}
+	if err := rk.RekeyUser(req.OldID, req.NewID); err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	c.forget(req.OldID, req.NewID)
+	LoggerWithContext(r.Context(), c.l).Log("RekeyUser(" + escapeForLog(req.OldID) + ", " + escapeForLog(req.NewID) + ")")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUsersは、全てのユーザーをユーザーID順のJSONオブジェクトで返す。
+// limitかoffsetが指定されていれば、listUsersPageでその範囲のユーザーだけを返す。
+func (c Controller) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	q, ok := c.query(w, r)
+	if !ok {
+		return
+	}
+	if q.Has("limit") || q.Has("offset") {
+		c.listUsersPage(w, q)
+		return
+	}
+	lister, ok := c.ds.(Lister)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "列挙できないデータストア")
+		return
+	}
+	users := lister.AllUsers()
+	if users == nil {
+		users = map[string]string{}
+	}
+	// encoding/jsonはマップのキーをソートしてから書き込む
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// CountUsersは、ユーザーの数を{"count": n}で返す
+func (c Controller) CountUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	counter, ok := c.ds.(Counter)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "数えられないデータストア")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"count": counter.UserCount()})
+}
+
+// SearchUsersは、名前がクエリのprefixで始まるユーザーのIDをJSONの配列で返す
+func (c Controller) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	searcher, ok := c.ds.(Searcher)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "検索できないデータストア")
+		return
+	}
+	q, ok := c.query(w, r)
+	if !ok {
+		return
+	}
+	ids := searcher.SearchByNamePrefix(q.Get("prefix"))
+	if ids == nil {
+		ids = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ids)
+}
+
+// ImportUsersは、リクエストボディのユーザーIDから名前へのJSONオブジェクトをまとめて追加し、
+// 追加した数を{"imported": n}で返す。クエリがoverwrite=trueなら既存のユーザーを上書きする。
+func (c Controller) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	importer, ok := c.ds.(Importer)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "まとめて追加できないデータストア")
+		return
+	}
+	q, ok := c.query(w, r)
+	if !ok {
+		return
+	}
+	var users map[string]string
+	if !c.decodeBody(w, r, &users) {
+		return
+	}
+	overwrite := q.Get("overwrite") == "true"
+	imported, err := importer.ImportUsers(users, overwrite)
+	var ie ImportError
+	if errors.As(err, &ie) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": ie.Error(), "failed": ie.Keys})
+		return
+	}
+	if err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	if imported > 0 {
+		ids := make([]string, 0, len(users))
+		for id := range users {
+			ids = append(ids, id)
+		}
+		c.forget(ids...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"imported": imported})
+}
+
+// Usersは、/usersへのリクエストをメソッドごとのハンドラに振り分ける
+func (c Controller) Users(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.ListUsers(w, r)
+	case http.MethodPost:
+		c.AddUser(w, r)
+	case http.MethodPut:
+		c.UpdateUser(w, r)
+	case http.MethodDelete:
+		c.DeleteUser(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
 }
 
 // NewSimpleLogicは、Controllerのインスタンスを作成するファクトリ関数。インターフェイスを渡すと構造体を返す。
-func NewController(l Logger, logic Logic) Controller {
-	return Controller{
-		l:     l,
-		logic: logic,
+// lはSafeLoggerで包むので、lがパニックしてもリクエストの処理は続けられる。
+func NewController(l Logger, logic Logic, ds DataStore, opts ...ControllerOption) Controller {
+	c := Controller{
+		l:               NewSafeLogger(l),
+		logic:           logic,
+		ds:              ds,
+		enc:             TextEncoder{},
+		tracer:          noopTracer{},
+		page:            greetPageTemplate,
+		draining:        &atomic.Bool{},
+		maxUserIDLength: defaultMaxUserIDLength,
+		maxBodyBytes:    defaultMaxBodyBytes,
+		bodyReadTimeout: defaultBodyReadTimeout,
+		validator:       DefaultValidator(),
+		idempotency:     NewIdempotencyCache(defaultIdempotencyTTL, RealClock{}),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// NewControllerJSONは、レスポンスを{"message": "..."}や{"error": "..."}のJSONで返すControllerを作成するファクトリ関数
+func NewControllerJSON(l Logger, logic Logic, ds DataStore, opts ...ControllerOption) Controller {
+	return NewController(l, logic, ds, append([]ControllerOption{WithResponseEncoder(JSONEncoder{})}, opts...)...)
+}
+
+// ControllerOptionは、NewControllerに渡してControllerの設定を変える関数
+type ControllerOption func(*Controller)
+
+// WithTracerは、リクエストごとにtで呼び出し元のトレースを引き継いだルートスパンを作るようにする
+func WithTracer(t Tracer) ControllerOption {
+	return func(c *Controller) {
+		c.tracer = t
+	}
+}
+
+// WithResponseEncoderは、レスポンスをencで書き込むようにする
+func WithResponseEncoder(enc ResponseEncoder) ControllerOption {
+	return func(c *Controller) {
+		c.enc = enc
+	}
+}
+
+// defaultMaxUserIDLengthは、user_idの長さ（文字数）の既定の上限
+const defaultMaxUserIDLength = 64
+
+// defaultMaxBodyBytesは、書き込みのリクエストボディの既定の上限（1MB）
+const defaultMaxBodyBytes = 1 << 20
+
+// WithMaxBodyBytesは、書き込みのリクエストボディの上限をnバイトにする
+func WithMaxBodyBytes(n int64) ControllerOption {
+	return func(c *Controller) {
+		c.maxBodyBytes = n
+	}
+}
+
+// defaultBodyReadTimeoutは、リクエストボディの1回の読み込みを待つ既定の時間
+const defaultBodyReadTimeout = 10 * time.Second
+
+// WithBodyReadTimeoutは、リクエストボディの読み込みがdの間進まなければ408を返すようにする。0なら待ち続ける。
+func WithBodyReadTimeout(d time.Duration) ControllerOption {
+	return func(c *Controller) {
+		c.bodyReadTimeout = d
+	}
+}
+
+// WithValidatorは、書き込むユーザーをvで確かめるようにする。nilなら確かめない。
+func WithValidator(v Validator) ControllerOption {
+	return func(c *Controller) {
+		c.validator = v
+	}
+}
+
+// WithIdempotencyCacheは、POST /usersのIdempotency-Keyごとのレスポンスをicに覚えておくようにする。
+// nilならIdempotency-Keyを無視する。
+func WithIdempotencyCache(ic *IdempotencyCache) ControllerOption {
+	return func(c *Controller) {
+		c.idempotency = ic
+	}
+}
+
+// WithInflightCounterは、/admin/inflightでicの数を返すようにする。
+// icはInflightMiddlewareにも渡して、リクエストを数えさせること。
+func WithInflightCounter(ic *InflightCounter) ControllerOption {
+	return func(c *Controller) {
+		c.inflight = ic
+	}
+}
+
+// WithRouteTableは、RegisterRoutesで登録したルートをrtに覚えさせ、/admin/routesでrtの一覧を返すようにする
+func WithRouteTable(rt *RouteTable) ControllerOption {
+	return func(c *Controller) {
+		c.routeTable = rt
+	}
+}
+
+// WithErrorRateTrackerは、不明なユーザーのエラーを返すたびにetに記録し、/admin/error-rateでその回数を返すようにする
+func WithErrorRateTracker(et *ErrorRateTracker) ControllerOption {
+	return func(c *Controller) {
+		c.errorRate = et
 	}
 }
 
-// 全てのコンポーネントを結びつけ、サーバーを起動する。
+// WithMaintenanceModeは、/admin/maintenanceでmmを切り替えられるようにする。
+// mmはMaintenanceMiddlewareにも渡して、メンテナンス中のリクエストを止めさせること。
+func WithMaintenanceMode(mm *MaintenanceMode) ControllerOption {
+	return func(c *Controller) {
+		c.maintenance = mm
+	}
+}
+
+// WithRequireIfMatchは、requireがtrueなら、If-MatchヘッダのないPUT /usersを428にする。
+// falseなら、If-Matchがなければ版を確かめずに上書きする。
+func WithRequireIfMatch(require bool) ControllerOption {
+	return func(c *Controller) {
+		c.requireIfMatch = require
+	}
+}
+
+// WithStoreCachesは、cdsへの書き込みが成功するたびに、cachesから変わったユーザーの結果を忘れさせるようにする。
+// Logicにはcachesで包んだデータストアを、Controllerには包む前のデータストアを渡すときに使う。
+// そうしないと、書き込んだ後もキャッシュの期限が切れるまで古い名前で挨拶してしまう。
+func WithStoreCaches(caches ...*CacheDataStore) ControllerOption {
+	return func(c *Controller) {
+		c.caches = caches
+	}
+}
+
+// forgetは、userIDsの結果をc.cachesから忘れさせる。userIDsがなければ、全ての結果を忘れさせる。
+func (c Controller) forget(userIDs ...string) {
+	for _, cds := range c.caches {
+		if len(userIDs) == 0 {
+			cds.Purge()
+			continue
+		}
+		for _, id := range userIDs {
+			cds.Invalidate(id)
+		}
+	}
+}
+
+// WithAPIKeysは、Handlerが認証の要るルートで受け付けるAPIキーを、キーからユーザーIDへのマップkeysにする
+func WithAPIKeys(keys map[string]string) ControllerOption {
+	return func(c *Controller) {
+		c.apiKeys = keys
+	}
+}
+
+// WithFeatureFlagsは、Handlerがflagsで無効にしたルートを登録しないようにする
+func WithFeatureFlags(flags FeatureFlags) ControllerOption {
+	return func(c *Controller) {
+		c.flags = flags
+	}
+}
+
+// WithRouteMiddlewareは、Handlerが/healthz以外のルートにobserveのミドルウェアを掛けるようにする
+func WithRouteMiddleware(observe ...func(http.Handler) http.Handler) ControllerOption {
+	return func(c *Controller) {
+		c.observe = observe
+	}
+}
+
+// WithMetricsは、Handlerが/metricsと/metrics.jsonでmの値を返すようにする
+func WithMetrics(m *Metrics) ControllerOption {
+	return func(c *Controller) {
+		c.metrics = m
+	}
+}
+
+// WithLogStreamは、Handlerが認証の要るGET /logs/streamでhのログを流すようにする
+func WithLogStream(h http.Handler) ControllerOption {
+	return func(c *Controller) {
+		c.logStream = h
+	}
+}
+
+// WithRateLimiterは、Handlerがrlでユーザーごとのリクエストの数を絞るようにする
+func WithRateLimiter(rl *RateLimiter) ControllerOption {
+	return func(c *Controller) {
+		c.rateLimiter = rl
+	}
+}
+
+// WithCORSOriginsは、Handlerがoriginsからのブラウザのリクエストを受け付けるようにする
+func WithCORSOrigins(origins []string) ControllerOption {
+	return func(c *Controller) {
+		c.corsOrigins = origins
+	}
+}
+
+// WithRequestLimitsは、HandlerがmaxURLLengthより長いURLを断り、同時にmaxConcurrent件までしか処理しないようにする。0なら制限しない。
+func WithRequestLimits(maxURLLength, maxConcurrent int) ControllerOption {
+	return func(c *Controller) {
+		c.maxURLLength = maxURLLength
+		c.maxConcurrent = maxConcurrent
+	}
+}
+
+// WithLanguagesは、挨拶するルートで、supportsが挨拶できるという言語からリクエストの言語を決め、決まらなければdefにするようにする
+func WithLanguages(supports func(lang string) bool, def string) ControllerOption {
+	return func(c *Controller) {
+		c.supports = supports
+		c.defaultLang = def
+	}
+}
+
+// WithGuestsは、allowがtrueなら、user_idが空の挨拶を400にせずにLogicに渡すようにする。
+// LogicはConfig.GuestModeにしたNewSimpleLogicのように、空のuser_idをゲストとして扱うものにすること。
+func WithGuests(allow bool) ControllerOption {
+	return func(c *Controller) {
+		c.allowGuest = allow
+	}
+}
+
+// WithMaxUserIDLengthは、user_idの長さの上限をn文字にする
+func WithMaxUserIDLength(n int) ControllerOption {
+	return func(c *Controller) {
+		c.maxUserIDLength = n
+	}
+}
+
+// runは、Buildで全てのコンポーネントを結びつけ、cfgの設定でサーバーを起動する。
+// SIGINTかSIGTERMを受け取るとサーバーを止めて戻る。
+// SIGHUPを受け取ると、データストアのユーザーとcfg.TemplateFileのテンプレートを読み直す。
+func run(cfg Config) error {
+	if err := cfg.CheckFiles(); err != nil {
+		return err
+	}
+	app, err := Build(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+	cfg.LogSummary(app.l)
+	srv := newServer(cfg.Addr, app.Handler, cfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cfg.StatsInterval > 0 {
+		go NewStatsReporter(app.l, app.metrics, app.ds, cfg.StatsInterval).Run(ctx)
+	}
+	var reloaders multiReloader
+	if r, ok := app.ds.(Reloader); ok {
+		reloaders = append(reloaders, storeReloader{r, app.c})
+	}
+	if app.templates != nil {
+		reloaders = append(reloaders, app.templates)
+	}
+	if len(reloaders) > 0 {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go reloadOnSignal(ctx, app.l, reloaders, hup)
+	}
+	return serve(ctx, app.l, srv, cfg.TLSCertFile, cfg.TLSKeyFile, app.c.Drain, app.inflight)
+}
+
 func main() {
-	l := LoggerAdapter(LogOutput)
-	ds := NewSimpleDataStore()
-	logic := NewSimpleLogic(l, ds)
-	c := NewController(l, logic)
-	http.HandleFunc("/hello", c.SayHello)
-	http.ListenAndServe(":8080", nil)
+	cfg, err := resolveConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// SimpleLogicの不明なユーザーのエラーは、包まれていてもerrors.IsでErrUnknownUserとわかり、Controllerは404にする
+func TestUnknownUserError(t *testing.T) {
+	l := &MemoryLogger{}
+	ds := NewSimpleDataStore()
+	logic := NewSimpleLogic(l, ds, DefaultConfig())
+	for name, call := range map[string]func(context.Context, string) (string, error){
+		"SayHello":   logic.SayHello,
+		"SayGoodbye": logic.SayGoodbye,
+	} {
+		if _, err := call(context.Background(), "99"); !errors.Is(err, ErrUnknownUser) {
+			t.Errorf("%s(99): err = %v, want errors.Is(err, ErrUnknownUser)", name, err)
+		}
+	}
+
+	c := NewController(l, logic, ds)
+	for _, h := range []http.HandlerFunc{c.SayHello, c.SayGoodbye} {
+		if w := send(h, http.MethodGet, "/?user_id=99", nil); w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", w.Code)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResponseEncoderは、Controllerがメッセージやエラーをレスポンスに書き込む方法。
+// 同じビジネスロジックを、APIのバージョンごとに違う形式で返すのに使う。
+type ResponseEncoder interface {
+	WriteMessage(w http.ResponseWriter, status int, message string)
+	WriteError(w http.ResponseWriter, status int, message string)
+}
+
+// TextEncoderは、メッセージやエラーをそのままテキストで書き込む
+type TextEncoder struct{}
+
+func (TextEncoder) WriteMessage(w http.ResponseWriter, status int, message string) {
+	writeText(w, status, message)
+}
+
+func (TextEncoder) WriteError(w http.ResponseWriter, status int, message string) {
+	writeText(w, status, message)
+}
+
+func writeText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(text))
+}
+
+// JSONEncoderは、{"message": "..."}や{"error": "..."}のJSONで書き込む
+type JSONEncoder struct{}
+
+func (JSONEncoder) WriteMessage(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func (JSONEncoder) WriteError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// negotiateは、Acceptヘッダの値acceptから、一番優先度の高いエンコーダを選ぶ。
+// text/plainならTextEncoder、application/jsonならJSONEncoderを返す。
+// Acceptがない場合や、*/*のように形式を選ばない場合、知らない形式しかない場合はnilを返すので、呼び出し元の既定を使う。
+func negotiate(accept string) ResponseEncoder {
+	var best ResponseEncoder
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		var enc ResponseEncoder
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "text/plain", "text/*":
+			enc = TextEncoder{}
+		case "application/json":
+			enc = JSONEncoder{}
+		default:
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// negotiatedは、Acceptヘッダで選んだエンコーダを使うようにしたcでhを呼ぶハンドラを返す。
+// 選べなければcのエンコーダのまま呼ぶ。
+func (c Controller) negotiated(h func(Controller, http.ResponseWriter, *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		nc := c
+		if enc := negotiate(r.Header.Get("Accept")); enc != nil {
+			nc.enc = enc
+		}
+		h(nc, w, r)
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   ResponseEncoder
+	}{
+		{"", nil},
+		{"*/*", nil},
+		{"image/png", nil},
+		{"text/plain", TextEncoder{}},
+		{"application/json", JSONEncoder{}},
+		{"text/plain;q=0.5, application/json", JSONEncoder{}},
+		{"application/json;q=0.1, text/*", TextEncoder{}},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("negotiate(%q) = %T, want %T", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// /helloはAcceptヘッダに合わせた形式で返し、選べなければテキストにする
+func TestHelloContentNegotiation(t *testing.T) {
+	c, _, _ := newTestController()
+	h := newTestHandler(t, c)
+	const text, jsonBody = "Hello, Fred", "{\"message\":\"Hello, Fred\"}\n"
+	tests := []struct {
+		accept   string
+		wantType string
+		wantBody string
+	}{
+		{"", "text/plain", text},
+		{"*/*", "text/plain", text},
+		{"text/plain", "text/plain", text},
+		{"application/json", "application/json", jsonBody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			w := sendWithHeader(h, http.MethodGet, "/hello?user_id=1&lang=en", nil, "Accept", tt.accept)
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) || w.Body.String() != tt.wantBody {
+				t.Errorf("got %s %q, want %s %q", ct, w.Body.String(), tt.wantType, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 既定のErrorRateTrackerの窓。1秒ごとのバケツを60個の輪にして、直近1分の数を数える。
+const (
+	errorRateWindow  = time.Minute
+	errorRateBuckets = 60
+)
+
+// ErrorRateTrackerは、直近の窓の間に何回不明なユーザーのエラーを返したかを数え、1秒あたりの回数を出す。
+// 窓はバケツの輪（リングバッファ）に分けて数え、古いバケツは使い回すときに0に戻すので、記録の数によらずメモリは増えない。
+// 回数がしきい値を超えたとき、またしきい値以下に戻ったときにログに書く。データの読み込みの失敗や総当たりの攻撃に気づくために使う。
+// 複数のゴルーチンから同時に使ってもよい。
+type ErrorRateTracker struct {
+	l         Logger
+	clock     Clock
+	bucket    time.Duration
+	threshold float64
+
+	mu sync.Mutex
+	// countsは、バケツごとの回数。slotsは、そのバケツが今どの時間の区切りを数えているか。
+	counts []int
+	slots  []int64
+	above  bool
+}
+
+// NewErrorRateTrackerは、windowをbuckets個のバケツに分けて数えるErrorRateTrackerを生成するファクトリ関数。
+// thresholdは警告する1秒あたりの回数で、0以下なら警告しない。clockがnilなら本当の時刻を使う。
+func NewErrorRateTracker(window time.Duration, buckets int, threshold float64, l Logger, clock Clock) *ErrorRateTracker {
+	return &ErrorRateTracker{
+		l:         l,
+		clock:     clockOrReal(clock),
+		bucket:    window / time.Duration(buckets),
+		threshold: threshold,
+		counts:    make([]int, buckets),
+		slots:     make([]int64, buckets),
+	}
+}
+
+// Recordは、今不明なユーザーのエラーを1回返したことを記録する
+func (et *ErrorRateTracker) Record() {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	now := et.slot()
+	i := int(now % int64(len(et.counts)))
+	if et.slots[i] != now {
+		et.slots[i] = now
+		et.counts[i] = 0
+	}
+	et.counts[i]++
+	et.check(et.rateLocked(now))
+}
+
+// Rateは、直近の窓の間の1秒あたりの回数を返す
+func (et *ErrorRateTracker) Rate() float64 {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	rate := et.rateLocked(et.slot())
+	et.check(rate)
+	return rate
+}
+
+// slotは、今の時刻がどの時間の区切りかを返す
+func (et *ErrorRateTracker) slot() int64 {
+	return et.clock.Now().UnixNano() / int64(et.bucket)
+}
+
+// rateLockedは、nowの区切りまでの窓にあるバケツの回数を合わせて、1秒あたりにする。et.muを持って呼ぶ。
+func (et *ErrorRateTracker) rateLocked(now int64) float64 {
+	total := 0
+	for i, s := range et.slots {
+		if now-s < int64(len(et.slots)) {
+			total += et.counts[i]
+		}
+	}
+	window := et.bucket * time.Duration(len(et.counts))
+	return float64(total) / window.Seconds()
+}
+
+// checkは、rateがしきい値をまたいだらログに書く。et.muを持って呼ぶ。
+func (et *ErrorRateTracker) check(rate float64) {
+	if et.threshold <= 0 {
+		return
+	}
+	switch above := rate > et.threshold; {
+	case above && !et.above:
+		et.l.Logf(LevelWarn, "error rate: 不明なユーザーのエラーが1秒あたり%.2f回で、しきい値%.2fを超えました", rate, et.threshold)
+	case !above && et.above:
+		et.l.Logf(LevelInfo, "error rate: 不明なユーザーのエラーが1秒あたり%.2f回で、しきい値%.2f以下に戻りました", rate, et.threshold)
+	}
+	et.above = rate > et.threshold
+}
+
+// recordUnknownUserは、errが不明なユーザーのエラーなら、c.errorRateに記録する
+func (c Controller) recordUnknownUser(err error) {
+	if c.errorRate != nil && errors.Is(err, ErrUnknownUser) {
+		c.errorRate.Record()
+	}
+}
+
+// errorRateResponseは、/admin/error-rateが返すJSON
+type errorRateResponse struct {
+	Rate      float64 `json:"rate"`
+	Threshold float64 `json:"threshold"`
+}
+
+// ErrorRateは、GET /admin/error-rateで、直近の1秒あたりの不明なユーザーのエラーの回数をJSONで返す
+func (c Controller) ErrorRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if c.errorRate == nil {
+		c.writeError(w, http.StatusNotImplemented, "エラーの回数を数えていません")
+		return
+	}
+	writeJSON(w, http.StatusOK, errorRateResponse{Rate: c.errorRate.Rate(), Threshold: c.errorRate.threshold})
+}
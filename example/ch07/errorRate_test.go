@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 不明なユーザーのエラーが窓の中でしきい値を超えると警告し、窓から出ると戻ったとログに書く
+func TestErrorRateTrackerThreshold(t *testing.T) {
+	l := &MemoryLogger{}
+	clock := NewManualClock(time.Unix(1000, 0))
+	et := NewErrorRateTracker(10*time.Second, 10, 0.5, l, clock)
+	c := NewController(l, NewSimpleLogic(&MemoryLogger{}, NewSimpleDataStore(), DefaultConfig()), NewSimpleDataStore(), WithErrorRateTracker(et))
+	h := http.HandlerFunc(c.SayHello)
+
+	// 見つかったユーザーは数えない
+	if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+		t.Fatalf("known user: status %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := send(h, http.MethodGet, "/hello?user_id=nope", nil); w.Code != http.StatusNotFound {
+			t.Fatalf("unknown user: status %d, want 404", w.Code)
+		}
+		clock.Advance(time.Second)
+	}
+	if rate := et.Rate(); rate != 0.5 {
+		t.Errorf("Rate() = %v, want 0.5", rate)
+	}
+	if containsMessage(l.Messages(), "超えました") {
+		t.Errorf("warned at the threshold: %v", l.Messages())
+	}
+	send(h, http.MethodGet, "/hello?user_id=nope", nil)
+	if !containsMessage(l.Messages(), "超えました") {
+		t.Errorf("logs %v do not warn above the threshold", l.Messages())
+	}
+
+	// 最初のエラーのバケツが窓から出ると、しきい値以下に戻る
+	clock.Advance(5 * time.Second)
+	if rate := et.Rate(); rate != 0.5 {
+		t.Errorf("Rate() after the first bucket left = %v, want 0.5", rate)
+	}
+	if !containsMessage(l.Messages(), "戻りました") {
+		t.Errorf("logs %v do not show the recovery", l.Messages())
+	}
+
+	clock.Advance(time.Minute)
+	w := send(http.HandlerFunc(c.ErrorRate), http.MethodGet, "/admin/error-rate", nil)
+	if got := strings.TrimSpace(w.Body.String()); got != `{"rate":0,"threshold":0.5}` {
+		t.Errorf("/admin/error-rate = %s, want rate 0", got)
+	}
+}
+
+// しきい値が0なら数えるだけで警告しない。ErrorRateTrackerがなければ501になる。
+func TestErrorRateTrackerNoThreshold(t *testing.T) {
+	l := &MemoryLogger{}
+	et := NewErrorRateTracker(time.Second, 1, 0, l, NewManualClock(time.Unix(0, 0)))
+	for i := 0; i < 100; i++ {
+		et.Record()
+	}
+	if rate := et.Rate(); rate != 100 {
+		t.Errorf("Rate() = %v, want 100", rate)
+	}
+	if msgs := l.Messages(); len(msgs) != 0 {
+		t.Errorf("logs %v, want none without a threshold", msgs)
+	}
+	c := NewController(l, nil, nil)
+	if w := send(http.HandlerFunc(c.ErrorRate), http.MethodGet, "/admin/error-rate", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("without a tracker: status %d, want 501", w.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// errorStatusは、errに合うステータスコードを返す。
+// 見分けられるのは、このパッケージのエラー変数やエラー型だけで、ほかのエラーは500にする。
+func errorStatus(err error) int {
+	var ve ValidationError
+	var ie ImportError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrUnknownUser):
+		return http.StatusNotFound
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrUserDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUserExists), errors.Is(err, ErrDuplicateName):
+		return http.StatusConflict
+	case errors.Is(err, ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrCapacityExceeded):
+		return http.StatusInsufficientStorage
+	case errors.As(err, &ve), errors.Is(err, ErrEmptyName):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &ie):
+		return http.StatusBadRequest
+	case errors.As(err, &mbe):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrBodyReadTimeout):
+		return http.StatusRequestTimeout
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrLogicTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrClosed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// errorResponseは、errを返すときのステータスコードとメッセージを決める。
+// 500になる知らないエラーは、データベースのエラーなどの中身を利用者に見せないように、ログにだけ書いて決まったメッセージにする。
+func (c Controller) errorResponse(r *http.Request, err error) (int, string) {
+	c.recordUnknownUser(err)
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		LoggerWithContext(r.Context(), c.l).Logf(LevelError, "%s %s: %v", r.Method, escapeForLog(r.URL.Path), err)
+		return status, http.StatusText(status)
+	}
+	return status, err.Error()
+}
+
+// WriteErrorは、errをステータスコードに対応付け、c.encoder()の形式で書き込む。
+// ハンドラはエラーを自分で書き込まずにこれを使う。クライアントが切断していたら、何も書かずにログに残すだけにする。
+func (c Controller) WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	if c.clientGone(w, r, err) {
+		return
+	}
+	status, message := c.errorResponse(r, err)
+	c.writeError(w, status, message)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 空のデータストアでも、テキストとJSONのどちらの形式でも、不明なユーザーは同じ形のJSONの404にする
+func TestUnknownUserEnvelope(t *testing.T) {
+	ds := &SimpleDataStore{}
+	c := NewController(&MemoryLogger{}, NewSimpleLogic(&MemoryLogger{}, ds, DefaultConfig()), ds)
+	h := newTestHandler(t, c)
+	const want = `{"code":"user_not_found","message":"不明なユーザー","id":"7"}`
+	for _, path := range []string{"/v1/hello?user_id=7", "/v2/hello?user_id=7", "/goodbye?user_id=7"} {
+		t.Run(path, func(t *testing.T) {
+			w := send(h, http.MethodGet, path, nil)
+			if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusNotFound || got != want {
+				t.Errorf("got %d %s, want 404 %s", w.Code, got, want)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{ErrUnknownUser, http.StatusNotFound},
+		{fmt.Errorf("lookup: %w", ErrUnknownUser), http.StatusNotFound},
+		{UnknownUserError{Suggestion: "1"}, http.StatusNotFound},
+		{ErrForbidden, http.StatusForbidden},
+		{ErrVersionMismatch, http.StatusPreconditionFailed},
+		{ErrBodyReadTimeout, http.StatusRequestTimeout},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{ErrCircuitOpen, http.StatusServiceUnavailable},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+// 500になる知らないエラーの中身は、レスポンスには書かずにログにだけ書く
+func TestWriteErrorHidesInternalErrors(t *testing.T) {
+	c, _, l := newTestController()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.WriteError(w, r, errors.New("password=hunter2"))
+	})
+	w := send(h, http.MethodGet, "/users", nil)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "hunter2") {
+		t.Errorf("got %d %q, want 500 without the error text", w.Code, w.Body.String())
+	}
+	if !containsMessage(l.Messages(), "hunter2") {
+		t.Errorf("the error was not logged: %v", l.Messages())
+	}
+}
+
+// WriteErrorは、エラーごとのステータスコードで、コントローラーのエンコーダの形式で書き込む
+func TestWriteErrorEncoders(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{ErrUnknownUser, http.StatusNotFound, "不明なユーザー"},
+		{ErrForbidden, http.StatusForbidden, ErrForbidden.Error()},
+		{ErrUserExists, http.StatusConflict, ErrUserExists.Error()},
+		{DefaultValidator().Validate("1", ""), http.StatusUnprocessableEntity, "nameが空です"},
+		{errors.New("db password=hunter2"), http.StatusInternalServerError, "Internal Server Error"},
+	}
+	for _, enc := range []ResponseEncoder{TextEncoder{}, JSONEncoder{}} {
+		c := NewController(&MemoryLogger{}, nil, nil, WithResponseEncoder(enc))
+		wantJSON := enc == ResponseEncoder(JSONEncoder{})
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%T/%d", enc, tt.wantStatus), func(t *testing.T) {
+				w := httptest.NewRecorder()
+				c.WriteError(w, httptest.NewRequest(http.MethodGet, "/users", nil), tt.err)
+				if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+					t.Errorf("got %d %q, want %d containing %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+				}
+				if isJSON := w.Header().Get("Content-Type") == "application/json"; isJSON != wantJSON {
+					t.Errorf("Content-Type = %q, want JSON: %v", w.Header().Get("Content-Type"), wantJSON)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInternalは、ErrorTranslatingLogicが知らないエラーの代わりに返すエラー。
+// 元のエラーの中身は利用者に見せず、ログにだけ書く。
+var ErrInternal = errors.New("内部エラーが発生しました")
+
+// safeErrorsは、ErrorTranslatingLogicがそのまま利用者に見せてよいエラー。
+// どれかを包んだエラーは、包んだ側の文にデータストアの中身が入っているかもしれないので、このエラー自体に置き換える。
+var safeErrors = []error{
+	ErrForbidden,
+	ErrUserDisabled,
+	ErrCapacityExceeded,
+	ErrLogicTimeout,
+	ErrCircuitOpen,
+	ErrClosed,
+	context.DeadlineExceeded,
+	context.Canceled,
+}
+
+// ErrorTranslatingLogicは、包んだLogicが返したエラーを利用者に見せてよいエラーに置き換えるLogic。
+// SQLのエラーのようなデータストアの中身がレスポンスに漏れないように、元のエラーはログに書いて、知らないエラーはErrInternalにする。
+// ErrUnknownUserは、404にするためにそのまま返す。
+type ErrorTranslatingLogic struct {
+	logic Logic
+	l     Logger
+}
+
+// NewErrorTranslatingLogicは、logicのエラーを置き換え、元のエラーをlに書くErrorTranslatingLogicを生成するファクトリ関数
+func NewErrorTranslatingLogic(logic Logic, l Logger) ErrorTranslatingLogic {
+	return ErrorTranslatingLogic{
+		logic: logic,
+		l:     l,
+	}
+}
+
+func (el ErrorTranslatingLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	message, err := el.logic.SayHello(ctx, userID)
+	return message, el.translate(ctx, "SayHello", userID, err)
+}
+
+func (el ErrorTranslatingLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	message, err := el.logic.SayGoodbye(ctx, userID)
+	return message, el.translate(ctx, "SayGoodbye", userID, err)
+}
+
+// SayHelloDetailedは、包んだLogicの詳しい挨拶を返す。エラーはSayHelloと同じく置き換える。
+func (el ErrorTranslatingLogic) SayHelloDetailed(ctx context.Context, userID string) (GreetingResult, error) {
+	result, err := sayHelloDetailed(ctx, el.logic, userID)
+	return result, el.translate(ctx, "SayHelloDetailed", userID, err)
+}
+
+// translateは、errを利用者に見せてよいエラーにする。置き換えたときは、元のエラーをログに書く。
+func (el ErrorTranslatingLogic) translate(ctx context.Context, op, userID string, err error) error {
+	if err == nil || errors.Is(err, ErrUnknownUser) {
+		return err
+	}
+	for _, safe := range safeErrors {
+		if errors.Is(err, safe) {
+			if err != safe {
+				LoggerWithContext(ctx, el.l).Logf(LevelWarn, "%s user_id=%s: %v", op, escapeForLog(userID), err)
+			}
+			return safe
+		}
+	}
+	LoggerWithContext(ctx, el.l).Logf(LevelError, "%s user_id=%s: %v", op, escapeForLog(userID), err)
+	return ErrInternal
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// データストアの生のエラーは利用者にはErrInternalとして見せ、中身はログにだけ書く
+func TestErrorTranslatingLogicHidesStoreErrors(t *testing.T) {
+	l := &MemoryLogger{}
+	raw := errors.New("sql: connection refused")
+	el := NewErrorTranslatingLogic(NewSimpleLogic(l, failingStore{raw}, DefaultConfig()), l)
+	if _, err := el.SayHello(context.Background(), "1"); err != ErrInternal {
+		t.Errorf("SayHello = %v, want ErrInternal", err)
+	}
+	if !containsMessage(l.Messages(), "sql: connection refused") {
+		t.Errorf("logs %v do not have the original error", l.Messages())
+	}
+
+	c := NewController(l, el, NewSimpleDataStore())
+	w := send(http.HandlerFunc(c.SayHello), http.MethodGet, "/hello?user_id=1", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "sql") || strings.Contains(w.Body.String(), "refused") {
+		t.Errorf("body %q leaks the store error", w.Body.String())
+	}
+}
+
+// ErrUnknownUserはそのまま、知っているエラーは包んだ文を外して返す
+func TestErrorTranslatingLogicKnownErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"unknown user", fmt.Errorf("user_id=9: %w", ErrUnknownUser), ErrUnknownUser},
+		{"disabled user", fmt.Errorf("table users: %w", ErrUserDisabled), ErrUserDisabled},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el := NewErrorTranslatingLogic(NewSimpleLogic(&MemoryLogger{}, failingStore{tt.err}, DefaultConfig()), &MemoryLogger{})
+			_, err := el.SayGoodbye(context.Background(), "9")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("SayGoodbye = %v, want %v", err, tt.want)
+			}
+			if tt.want != ErrUnknownUser && err != tt.want {
+				t.Errorf("SayGoodbye = %q, want exactly %q", err, tt.want)
+			}
+		})
+	}
+	el := NewErrorTranslatingLogic(NewSimpleLogic(&MemoryLogger{}, NewSimpleDataStore(), DefaultConfig()), &MemoryLogger{})
+	if message, err := el.SayHello(context.Background(), "1"); err != nil || message == "" {
+		t.Errorf("SayHello(1) = %q, %v, want a greeting", message, err)
+	}
+}
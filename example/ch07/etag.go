@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// writeCacheableは、messageをETag付きで書き込む。
+// リクエストのIf-None-MatchがETagと一致すれば、本文を書かずに304を返す。
+// 挨拶はユーザーの名前が変わると変わるので、Cache-Control: no-cacheで毎回確かめさせる。
+func (c Controller) writeCacheable(w http.ResponseWriter, r *http.Request, message string) {
+	etag := messageETag(c.encoder(), message)
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "no-cache")
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.writeMessage(w, message)
+}
+
+// messageETagは、encでmessageを書き込んだレスポンスのETagを返す。
+// 同じ挨拶でもテキストとJSONでは本文が違うので、エンコーダの型も含めて計算する。
+// GzipMiddlewareで圧縮されても同じ値のまま使えるように、弱いETagにする。
+func messageETag(enc ResponseEncoder, message string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%T\x00%s", enc, message)))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatchは、If-None-Matchの値ifNoneMatchがetagと一致するかを弱い比較で調べる
+func etagMatch(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// userETagは、ユーザーの版versionのETagを返す。版が同じときだけ一致させたいので、強いETagにする。
+func userETag(version uint64) string {
+	return `"v` + strconv.FormatUint(version, 10) + `"`
+}
+
+// updateIfMatchは、If-Matchの値ifMatchのどれかの版のときだけ、vsのuserIDのユーザーの名前をnewNameに変えて、新しい版を返す。
+// "*"なら、今の版がどれでも変える。弱いETagや読めないETagは、どの版とも一致しない。一致しなければErrVersionMismatchを返す。
+func updateIfMatch(vs Versioner, userID, newName, ifMatch string) (uint64, error) {
+	if strings.TrimSpace(ifMatch) == "*" {
+		version, ok := vs.UserVersion(userID)
+		if !ok {
+			return 0, ErrUnknownUser
+		}
+		ifMatch = userETag(version)
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		tag := strings.TrimSpace(candidate)
+		if len(tag) < 3 || !strings.HasPrefix(tag, `"v`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		version, err := strconv.ParseUint(tag[2:len(tag)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		newVersion, err := vs.UpdateUserIfVersion(userID, newName, version)
+		if errors.Is(err, ErrVersionMismatch) {
+			continue
+		}
+		return newVersion, err
+	}
+	return 0, ErrVersionMismatch
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 受け取ったETagをIf-None-Matchで送り返すと304になり、名前が変われば200で新しい挨拶が返る
+func TestSayHelloConditionalGet(t *testing.T) {
+	c, ds, _ := newTestController()
+	h := http.HandlerFunc(c.SayHello)
+	first := send(h, http.MethodGet, "/hello?user_id=1", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first request: status = %d, ETag = %q; want 200 with an ETag", first.Code, etag)
+	}
+
+	w := sendWithHeader(h, http.MethodGet, "/hello?user_id=1", nil, "If-None-Match", `"other", `+etag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("revalidation: got %d with %d body bytes, want 304 with no body", w.Code, w.Body.Len())
+	}
+
+	ds.UpdateUserForID("1", "Freddie")
+	w = sendWithHeader(h, http.MethodGet, "/hello?user_id=1", nil, "If-None-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("after renaming: got %d with ETag %q, want 200 with a new ETag", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestETagMatch(t *testing.T) {
+	const etag = `W/"abc"`
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`"x", W/"abc"`, true},
+		{`*`, true},
+		{`"abcd"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatch(tt.ifNoneMatch, etag); got != tt.want {
+			t.Errorf("etagMatch(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+	}
+}
+
+// PUT /usersは、GET /users/{id}で受け取ったETagをIf-Matchで送れば通り、古いETagなら412になる。
+// If-Matchがないときは、WithRequireIfMatchで必須にしていれば428、そうでなければそのまま上書きする。
+func TestUpdateUserIfMatch(t *testing.T) {
+	for _, require := range []bool{false, true} {
+		c, _, _ := newTestController(WithRequireIfMatch(require), WithAPIKeys(map[string]string{"k": ""}))
+		h := newTestHandler(t, c)
+		put := func(name, ifMatch string) *httptest.ResponseRecorder {
+			header := []string{"X-API-Key", "k"}
+			if ifMatch != "" {
+				header = append(header, "If-Match", ifMatch)
+			}
+			return sendWithHeader(h, http.MethodPut, "/users", strings.NewReader(`{"user_id":"1","name":"`+name+`"}`), header...)
+		}
+		etag := sendWithHeader(h, http.MethodGet, "/users/1", nil, "X-API-Key", "k").Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("GET /users/1 returned no ETag")
+		}
+		w := put("Ann", etag)
+		if w.Code != http.StatusNoContent || w.Header().Get("ETag") == "" || w.Header().Get("ETag") == etag {
+			t.Errorf("require=%v matching If-Match: got %d with ETag %q, want 204 and a new ETag", require, w.Code, w.Header().Get("ETag"))
+		}
+		if w := put("Bob", etag); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("require=%v stale If-Match: status %d, want 412", require, w.Code)
+		}
+		if w := put("Bob", `W/"v1", "other"`); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("require=%v unrelated If-Match: status %d, want 412", require, w.Code)
+		}
+		want := http.StatusNoContent
+		if require {
+			want = http.StatusPreconditionRequired
+		}
+		if w := put("Cal", ""); w.Code != want {
+			t.Errorf("require=%v no If-Match: status %d, want %d", require, w.Code, want)
+		}
+		if w := put("Dan", "*"); w.Code != http.StatusNoContent {
+			t.Errorf("require=%v If-Match *: status %d, want 204", require, w.Code)
+		}
+	}
+}
+
+// 消して同じIDで追加し直したユーザーは、前とは違う版になる
+func TestSimpleDataStoreUserVersion(t *testing.T) {
+	sds := NewSimpleDataStore()
+	v1, ok := sds.UserVersion("2")
+	if !ok {
+		t.Fatal("UserVersion(2) not ok")
+	}
+	if err := sds.DeleteUserForID("2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sds.UserVersion("2"); ok {
+		t.Error("UserVersion of a deleted user is ok")
+	}
+	if err := sds.AddUserForID("2", "Mary"); err != nil {
+		t.Fatal(err)
+	}
+	if v2, _ := sds.UserVersion("2"); v2 == v1 {
+		t.Errorf("version %d did not change after delete and re-add", v2)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Config.FeatureFlagsに指定できる、ルートを切り替えるフラグの名前
+const (
+	// FeatureBatchは、POST /hello/batch
+	FeatureBatch = "batch"
+	// FeatureStreamは、POST /hello/stream
+	FeatureStream = "stream"
+	// FeatureAdminは、/admin/以下の全てのルート
+	FeatureAdmin = "admin"
+	// FeaturePprofは、/debug/pprof/以下のnet/http/pprofのルート
+	FeaturePprof = "pprof"
+)
+
+// defaultFeatureFlagsは、FeatureFlagsに書かれていないフラグの値。今までどおり使えるように、前からあるルートは有効にしておく。
+// pprofはプログラムの中身を見せるので、指定したときだけ有効にする。
+var defaultFeatureFlags = map[string]bool{
+	FeatureBatch:  true,
+	FeatureStream: true,
+	FeatureAdmin:  true,
+	FeaturePprof:  false,
+}
+
+// FeatureFlagsは、フラグの名前から、そのルートを登録するかどうかへのマップ。nilなら全て既定の値になる。
+type FeatureFlags map[string]bool
+
+// Enabledは、nameのフラグが有効かを返す。書かれていなければdefaultFeatureFlagsの値を使う。
+func (ff FeatureFlags) Enabled(name string) bool {
+	if on, ok := ff[name]; ok {
+		return on
+	}
+	return defaultFeatureFlags[name]
+}
+
+// Disabledは、無効になっているフラグの名前を並べて返す
+func (ff FeatureFlags) Disabled() []string {
+	var names []string
+	for name := range defaultFeatureFlags {
+		if !ff.Enabled(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// routeFeatureは、patternのルートを切り替えるフラグの名前を返す。フラグで切り替えないルートなら空文字列を返す。
+func routeFeature(pattern string) string {
+	switch {
+	case pattern == "/hello/batch":
+		return FeatureBatch
+	case pattern == "/hello/stream":
+		return FeatureStream
+	case strings.HasPrefix(pattern, "/admin/"):
+		return FeatureAdmin
+	case strings.HasPrefix(pattern, "/debug/pprof/"):
+		return FeaturePprof
+	}
+	return ""
+}
+
+// unknownFeatureFlagは、知らないフラグの名前のエラーを、指定できる名前の一覧と一緒に返す
+func unknownFeatureFlag(name string) error {
+	names := make([]string, 0, len(defaultFeatureFlags))
+	for n := range defaultFeatureFlags {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("不明なfeature_flags: %q（%sのどれかを指定してください）", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 無効にしたルートは登録されずに404になり、有効にすれば応答する。書かれていないフラグは既定の値になる。
+func TestHandlerFeatureFlags(t *testing.T) {
+	for _, on := range []bool{false, true} {
+		c, _, _ := newTestController(WithAPIKeys(map[string]string{"k": ""}), WithFeatureFlags(FeatureFlags{FeatureBatch: on, FeatureAdmin: on}))
+		h := newTestHandler(t, c)
+		batch := send(h, http.MethodPost, "/hello/batch", strings.NewReader(`["1"]`))
+		if (batch.Code == http.StatusNotFound) == on {
+			t.Errorf("batch %v: status %d", on, batch.Code)
+		}
+		admin := sendWithHeader(h, http.MethodGet, "/admin/routes", nil, "X-API-Key", "k")
+		if (admin.Code == http.StatusNotFound) == on {
+			t.Errorf("admin %v: status %d", on, admin.Code)
+		}
+		if w := send(h, http.MethodPost, "/hello/stream", strings.NewReader(`["1"]`)); w.Code == http.StatusNotFound {
+			t.Errorf("stream is on by default, but got 404")
+		}
+		if w := send(h, http.MethodGet, "/debug/pprof/", nil); w.Code != http.StatusNotFound {
+			t.Errorf("pprof is off by default, but got %d", w.Code)
+		}
+	}
+}
+
+func TestFeatureFlagsDisabled(t *testing.T) {
+	tests := []struct {
+		flags FeatureFlags
+		want  []string
+	}{
+		{nil, []string{FeaturePprof}},
+		{FeatureFlags{FeatureAdmin: false, FeatureStream: false}, []string{FeatureAdmin, FeaturePprof, FeatureStream}},
+		{FeatureFlags{FeaturePprof: true}, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.flags.Disabled(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v.Disabled() = %v, want %v", tt.flags, got, tt.want)
+		}
+	}
+}
+
+// 知らないフラグの名前はValidateで弾き、指定できる名前を教える
+func TestConfigValidateUnknownFeatureFlag(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FeatureFlags = FeatureFlags{"nope": true}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), FeatureBatch) {
+		t.Errorf("Validate = %v, want an error listing the known flags", err)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileDataStoreは、ユーザーのデータをJSONファイルに保存するデータストア。
+// 書き込みのたびにファイル全体を書き直す。NewBatchedFileDataStoreで作ると、書き直しをまとめる。
+type FileDataStore struct {
+	mu       sync.RWMutex
+	path     string
+	userData map[string]string
+	// writesは、ファイルを書き直した回数
+	writes int
+
+	// 以下はNewBatchedFileDataStoreで作ったときだけ使う。doneがnilなら書き込みのたびに書き直す。
+	interval   time.Duration
+	maxPending int
+	clock      Clock
+	pending    int
+	lastFlush  time.Time
+	done       chan struct{}
+	stop       sync.Once
+}
+
+// NewFileDataStoreは、pathのJSONファイルを読み込んでFileDataStoreを生成するファクトリ関数。
+// ファイルがなければ空のデータストアになる。
+func NewFileDataStore(path string) (*FileDataStore, error) {
+	userData, err := readUsersJSON(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		userData, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &FileDataStore{
+		path:     path,
+		userData: userData,
+	}, nil
+}
+
+// NewBatchedFileDataStoreは、書き込みをすぐにメモリに反映し、ファイルの書き直しはまとめて行うFileDataStoreを生成するファクトリ関数。
+// 前に書き直してからclockの時刻でinterval経つか、書き直していない書き込みがmaxPending件たまったら書き直す。
+// 書き込みが途絶えても残りが書き直されるように、裏で動くゴルーチンがintervalごとに確かめる。使い終わったらCloseを呼ぶこと。
+// 書き込みが続いても速く答えられる代わりに、プロセスが突然終わると最大でinterval分の書き込みを失う。
+// clockがnilなら本当の時刻を使う。intervalが0以下では確かめる間隔を決められないので、エラーを返す。
+func NewBatchedFileDataStore(path string, interval time.Duration, maxPending int, clock Clock) (*FileDataStore, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("書き直しをまとめる間隔は0より長くしてください: %v", interval)
+	}
+	fds, err := NewFileDataStore(path)
+	if err != nil {
+		return nil, err
+	}
+	fds.interval = interval
+	fds.maxPending = maxPending
+	fds.clock = clockOrReal(clock)
+	fds.lastFlush = fds.clock.Now()
+	fds.done = make(chan struct{})
+	go fds.flushLoop()
+	return fds, nil
+}
+
+// readUsersJSONは、pathのJSONファイルをユーザーIDから名前へのマップにする
+func readUsersJSON(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%sを読み込めません: %w", path, err)
+	}
+	userData := map[string]string{}
+	if err := json.Unmarshal(data, &userData); err != nil {
+		return nil, fmt.Errorf("%sが壊れています: %w", path, err)
+	}
+	return userData, nil
+}
+
+// Reloadは、ファイルを読み直して、中身を丸ごと置き換える。
+// ファイルがない場合や壊れている場合は、前の中身のままエラーを返す。
+func (fds *FileDataStore) Reload() error {
+	userData, err := readUsersJSON(fds.path)
+	if err != nil {
+		return err
+	}
+	fds.mu.Lock()
+	defer fds.mu.Unlock()
+	fds.userData = userData
+	return nil
+}
+
+func (fds *FileDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	fds.mu.RLock()
+	defer fds.mu.RUnlock()
+	name, ok := fds.userData[userID]
+	return name, ok, nil
+}
+
+func (fds *FileDataStore) AllUsers() map[string]string {
+	fds.mu.RLock()
+	defer fds.mu.RUnlock()
+	users := make(map[string]string, len(fds.userData))
+	for id, name := range fds.userData {
+		users[id] = name
+	}
+	return users
+}
+
+func (fds *FileDataStore) AddUserForID(userID, name string) error {
+	fds.mu.Lock()
+	defer fds.mu.Unlock()
+	if _, ok := fds.userData[userID]; ok {
+		return ErrUserExists
+	}
+	fds.userData[userID] = name
+	if err := fds.persist(); err != nil {
+		delete(fds.userData, userID)
+		return err
+	}
+	return nil
+}
+
+func (fds *FileDataStore) UpdateUserForID(userID, newName string) error {
+	fds.mu.Lock()
+	defer fds.mu.Unlock()
+	name, ok := fds.userData[userID]
+	if !ok {
+		return ErrUnknownUser
+	}
+	fds.userData[userID] = newName
+	if err := fds.persist(); err != nil {
+		fds.userData[userID] = name
+		return err
+	}
+	return nil
+}
+
+func (fds *FileDataStore) DeleteUserForID(userID string) error {
+	fds.mu.Lock()
+	defer fds.mu.Unlock()
+	name, ok := fds.userData[userID]
+	if !ok {
+		return ErrUnknownUser
+	}
+	delete(fds.userData, userID)
+	if err := fds.persist(); err != nil {
+		fds.userData[userID] = name
+		return err
+	}
+	return nil
+}
+
+// persistは、書き込みの後に呼び、ファイルを書き直す。まとめる設定なら、書き直す時になるまで待たせておく。
+// 呼び出し側がロックを持っていること。
+func (fds *FileDataStore) persist() error {
+	if fds.done == nil {
+		return fds.flush()
+	}
+	fds.pending++
+	if fds.pending < fds.maxPending && fds.clock.Now().Sub(fds.lastFlush) < fds.interval {
+		return nil
+	}
+	if err := fds.flushPending(); err != nil {
+		fds.pending--
+		return err
+	}
+	return nil
+}
+
+// flushLoopは、intervalごとに、待たせている書き込みがあって書き直す時になっていれば書き直す。
+// 書き直せなければ待たせたままにし、次の書き込みか次の確認でやり直す。
+func (fds *FileDataStore) flushLoop() {
+	t := time.NewTicker(fds.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-fds.done:
+			return
+		case <-t.C:
+		}
+		fds.mu.Lock()
+		if fds.pending > 0 && fds.clock.Now().Sub(fds.lastFlush) >= fds.interval {
+			fds.flushPending()
+		}
+		fds.mu.Unlock()
+	}
+}
+
+// Writesは、これまでにファイルを書き直した回数を返す
+func (fds *FileDataStore) Writes() int {
+	fds.mu.RLock()
+	defer fds.mu.RUnlock()
+	return fds.writes
+}
+
+// Flushは、待たせている書き込みがあれば、すぐにファイルを書き直す
+func (fds *FileDataStore) Flush() error {
+	fds.mu.Lock()
+	defer fds.mu.Unlock()
+	if fds.pending == 0 {
+		return nil
+	}
+	return fds.flushPending()
+}
+
+// Closeは、裏で動くゴルーチンを止め、待たせている書き込みをファイルに書き直す。
+// サーバーを止めるときにApp.Closeから呼ばれるので、書き込みを失わない。
+func (fds *FileDataStore) Close() error {
+	if fds.done == nil {
+		return nil
+	}
+	fds.stop.Do(func() {
+		close(fds.done)
+	})
+	return fds.Flush()
+}
+
+// flushPendingは、ファイルを書き直し、待たせている書き込みをなくす。呼び出し側がロックを持っていること。
+func (fds *FileDataStore) flushPending() error {
+	if err := fds.flush(); err != nil {
+		return err
+	}
+	fds.pending = 0
+	fds.lastFlush = fds.clock.Now()
+	return nil
+}
+
+// flushは、userDataをファイルに書き出す。途中で失敗しても元のファイルが壊れないように、
+// 一時ファイルに書いてから置き換える。呼び出し側がロックを持っていること。
+func (fds *FileDataStore) flush() error {
+	data, err := json.Marshal(fds.userData)
+	if err != nil {
+		return err
+	}
+	tmp := fds.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("%sに書き込めません: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, fds.path); err != nil {
+		return fmt.Errorf("%sに書き込めません: %w", fds.path, err)
+	}
+	fds.writes++
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileDataStoreMissingFileStartsEmpty(t *testing.T) {
+	fds, err := NewFileDataStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatalf("NewFileDataStore: %v", err)
+	}
+	if users := fds.AllUsers(); len(users) != 0 {
+		t.Errorf("AllUsers() = %v, want empty", users)
+	}
+}
+
+// 書き込んだ内容が、同じファイルから作り直したFileDataStoreに残っていることを確かめる
+func TestFileDataStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	fds, err := NewFileDataStore(path)
+	if err != nil {
+		t.Fatalf("NewFileDataStore: %v", err)
+	}
+	if err := fds.AddUserForID("1", "Fred"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	if err := fds.AddUserForID("2", "Mary"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	if err := fds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Fatalf("UpdateUserForID: %v", err)
+	}
+	if err := fds.DeleteUserForID("2"); err != nil {
+		t.Fatalf("DeleteUserForID: %v", err)
+	}
+
+	reopened, err := NewFileDataStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	name, ok, err := reopened.UserNameForID(context.Background(), "1")
+	if err != nil || !ok || name != "Freddie" {
+		t.Errorf("UserNameForID(1) = %q, %v, %v; want Freddie, true, nil", name, ok, err)
+	}
+	if _, ok, _ := reopened.UserNameForID(context.Background(), "2"); ok {
+		t.Error("deleted user 2 came back after reopening")
+	}
+}
+
+func TestFileDataStoreCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewFileDataStore(path)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("NewFileDataStore on a corrupt file: err = %v, want a wrapped *json.SyntaxError", err)
+	}
+}
+
+func TestFileDataStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	fds, err := NewFileDataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := os.WriteFile(path, []byte(`{"9":"Bob"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fds.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if name, _, _ := fds.UserNameForID(ctx, "9"); name != "Bob" {
+		t.Errorf("after Reload: user 9 = %q, want Bob", name)
+	}
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fds.Reload(); err == nil {
+		t.Error("Reload of a corrupt file: no error")
+	}
+	if name, _, _ := fds.UserNameForID(ctx, "9"); name != "Bob" {
+		t.Errorf("after a failed Reload: user 9 = %q, want the previous Bob", name)
+	}
+}
+
+// まとめる設定では、続けて書き込んでもファイルの書き直しはずっと少なく、Closeの後のファイルは全ての書き込みを含む
+func TestBatchedFileDataStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	clock := NewManualClock(time.Unix(0, 0))
+	fds, err := NewBatchedFileDataStore(path, time.Hour, 50, clock)
+	if err != nil {
+		t.Fatalf("NewBatchedFileDataStore: %v", err)
+	}
+	defer fds.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				id := fmt.Sprintf("%d-%d", g, i)
+				if err := fds.AddUserForID(id, "n"+id); err != nil {
+					t.Errorf("AddUserForID(%s): %v", id, err)
+				}
+				if err := fds.UpdateUserForID(id, "m"+id); err != nil {
+					t.Errorf("UpdateUserForID(%s): %v", id, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	// 240回の書き込みを、50件たまるごとに書き直す
+	if w := fds.Writes(); w != 4 {
+		t.Errorf("Writes() after 240 writes = %d, want 4", w)
+	}
+	if name, ok, _ := fds.UserNameForID(context.Background(), "3-29"); !ok || name != "m3-29" {
+		t.Errorf("user 3-29 = %q, %v; want the update in memory before the flush", name, ok)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if err := fds.DeleteUserForID("0-0"); err != nil {
+		t.Fatal(err)
+	}
+	if w := fds.Writes(); w != 5 {
+		t.Errorf("Writes() after the interval passed = %d, want 5", w)
+	}
+	if err := fds.UpdateUserForID("0-1", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if w := fds.Writes(); w != 6 {
+		t.Errorf("Writes() after Close = %d, want 6", w)
+	}
+	got, err := readUsersJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 119 || got["0-1"] != "x" || got["1-5"] != "m1-5" {
+		t.Errorf("the file has %d users with 0-1=%q and 1-5=%q; want 119, x and m1-5", len(got), got["0-1"], got["1-5"])
+	}
+}
+
+// 確かめる間隔が0以下なら、作らずにエラーを返す
+func TestBatchedFileDataStoreInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		fds, err := NewBatchedFileDataStore(filepath.Join(t.TempDir(), "users.json"), interval, 10, nil)
+		if err == nil || fds != nil {
+			t.Errorf("interval %v: got %v, %v; want nil and an error", interval, fds, err)
+		}
+	}
+}
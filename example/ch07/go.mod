@@ -0,0 +1,7 @@
+module ch07
+
+go 1.20
+
+require go.etcd.io/bbolt v1.3.8
+
+require golang.org/x/sys v0.4.0 // indirect
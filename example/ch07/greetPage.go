@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+)
+
+// greetPageTemplateは、/greetが返すHTMLのテンプレート。
+// html/templateなので、名前に<script>などが含まれていてもエスケープされる。
+var greetPageTemplate = template.Must(template.New("greet").Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+// greetPageは、greetPageTemplateに渡す値
+type greetPage struct {
+	Title   string
+	Message string
+}
+
+// Greetは、/greet?user_id=のあいさつをHTMLのページで返す。
+// 不明なユーザーなどのエラーもHTMLのページで返す。
+func (c Controller) Greet(w http.ResponseWriter, r *http.Request) {
+	q, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		c.writePage(w, http.StatusBadRequest, greetPage{Title: "エラー", Message: "malformed query"})
+		return
+	}
+	userID := q.Get("user_id")
+	switch {
+	case userID == "":
+		c.writePage(w, http.StatusBadRequest, greetPage{Title: "エラー", Message: "user_id is required"})
+		return
+	case utf8.RuneCountInString(userID) > c.maxUserIDLength:
+		c.writePage(w, http.StatusUnprocessableEntity, greetPage{Title: "エラー", Message: "user_id is too long"})
+		return
+	}
+	ctx, span := c.startSpan(r, "GET /greet")
+	defer span.End()
+	message, err := c.logic.SayHello(ctx, userID)
+	if c.clientGone(w, r, err) {
+		return
+	}
+	if err != nil {
+		title := "エラー"
+		if errors.Is(err, ErrUnknownUser) {
+			title = "ユーザーが見つかりません"
+		}
+		status, message := c.errorResponse(r, err)
+		c.writePage(w, status, greetPage{Title: title, Message: message})
+		return
+	}
+	c.writePage(w, http.StatusOK, greetPage{Title: "あいさつ", Message: message})
+}
+
+// writePageは、c.pageでpageを描いてstatusで返す。
+// 描くのに失敗したときに途中までのHTMLを返さないように、一度バッファに描く。
+func (c Controller) writePage(w http.ResponseWriter, status int, page greetPage) {
+	tmpl := c.page
+	if tmpl == nil {
+		tmpl = greetPageTemplate
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		c.l.Logf(LevelError, "ページを描けません: %v", err)
+		http.Error(w, "ページを描けません", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 名前に含まれる<script>は、HTMLのページではエスケープされる
+func TestGreetEscapesName(t *testing.T) {
+	c, ds, _ := newTestController()
+	if err := ds.AddUserForID("x", "<script>alert(1)</script>"); err != nil {
+		t.Fatal(err)
+	}
+	w := send(http.HandlerFunc(c.Greet), http.MethodGet, "/greet?user_id=x", nil)
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Errorf("body does not escape the name:\n%s", body)
+	}
+}
+
+func TestGreetUnknownUser(t *testing.T) {
+	c, _, _ := newTestController()
+	w := send(http.HandlerFunc(c.Greet), http.MethodGet, "/greet?user_id=99", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want an HTML error page", ct)
+	}
+	if !strings.Contains(w.Body.String(), "<h1>ユーザーが見つかりません</h1>") {
+		t.Errorf("body = %q, want the not-found title", w.Body.String())
+	}
+}
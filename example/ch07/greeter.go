@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GreetingKindは、挨拶の種類
+type GreetingKind int
+
+const (
+	GreetingHello GreetingKind = iota
+	GreetingGoodbye
+)
+
+// Greetingは、誰にどの種類の挨拶をどの言語でするか。
+// DataStoreを使わずに挨拶の文の組み立てだけを確かめられるように、検索とは分けてある。
+type Greeting struct {
+	Name string
+	Kind GreetingKind
+	Lang string
+}
+
+// Stringは、既定のテンプレートで挨拶の文を作る
+func (g Greeting) String() string {
+	return defaultGreeter.Format(g)
+}
+
+// Greeterは、言語コードと挨拶の種類ごとのテンプレートから挨拶の文を作る。テンプレートの%sに名前が入る。
+type Greeter struct {
+	templates   map[string]map[GreetingKind]string
+	defaultLang string
+}
+
+// defaultGreeterは、Greeting.Stringが使うGreeter
+var defaultGreeter = NewGreeter()
+
+// NewGreeterは、日本語と英語のテンプレートを持ち、日本語を既定にしたGreeterを生成するファクトリ関数
+func NewGreeter() Greeter {
+	return Greeter{
+		templates: map[string]map[GreetingKind]string{
+			"ja": {
+				GreetingHello:   "%sさん　こんにちは。",
+				GreetingGoodbye: "%sさん　さようなら",
+			},
+			"en": {
+				GreetingHello:   "Hello, %s",
+				GreetingGoodbye: "Goodbye, %s",
+			},
+		},
+		defaultLang: "ja",
+	}
+}
+
+// NewGreeterFromConfigは、既定のテンプレートのうち、cfgで指定された「こんにちは」のテンプレートを差し替えたGreeterを生成するファクトリ関数
+func NewGreeterFromConfig(cfg Config) Greeter {
+	gr := NewGreeter()
+	for lang, tmpl := range cfg.GreetingTemplates {
+		if gr.templates[lang] == nil {
+			gr.templates[lang] = map[GreetingKind]string{}
+		}
+		gr.templates[lang][GreetingHello] = tmpl
+	}
+	return gr
+}
+
+// Formatは、gの言語とテンプレートで挨拶の文を作る。その言語のテンプレートがなければ既定の言語を使う。
+// 言語はAccept-Languageと同じ"en-US,en;q=0.9"のような形でもよく、先頭の言語だけを見る。
+func (gr Greeter) Format(g Greeting) string {
+	return fmt.Sprintf(gr.templates[gr.Language(g)][g.Kind], g.Name)
+}
+
+// Languageは、Formatがgの挨拶の文を作るのに使う言語コードを返す。その言語のテンプレートがなければ既定の言語になる。
+func (gr Greeter) Language(g Greeting) string {
+	lang := baseLanguage(g.Lang)
+	if _, ok := gr.templates[lang][g.Kind]; ok {
+		return lang
+	}
+	return gr.defaultLang
+}
+
+// Supportsは、langの言語の「こんにちは」のテンプレートがあるかを返す。既定の言語に頼らずに挨拶できるかを確かめるために使う。
+func (gr Greeter) Supports(lang string) bool {
+	_, ok := gr.templates[baseLanguage(lang)][GreetingHello]
+	return ok
+}
+
+// baseLanguageは、"en-US,en;q=0.9"のような指定から先頭の言語の主タグ（"en"）を取り出す
+func baseLanguage(lang string) string {
+	lang, _, _ = strings.Cut(lang, ",")
+	lang, _, _ = strings.Cut(lang, ";")
+	lang, _, _ = strings.Cut(lang, "-")
+	return strings.ToLower(strings.TrimSpace(lang))
+}
+
+// Formatterは、名前と挨拶の種類から挨拶の文を作るインターフェイス。
+// NewSimpleLogicWithFormatterに渡すと、テンプレートの代わりに使われる。
+type Formatter interface {
+	Format(name string, kind GreetingKind) string
+}
+
+// GreetingFormatterは、リクエストの言語の入ったGreetingから挨拶の文を作るFormatter。
+// SimpleLogicは、FormatterがGreetingFormatterならFormatの代わりにFormatGreetingを呼び、自分のテンプレートのGreeterを渡す。
+type GreetingFormatter interface {
+	Formatter
+	FormatGreeting(g Greeting, gr Greeter) string
+}
+
+// JapaneseFormatterは、既定の日本語のテンプレートで挨拶の文を作るFormatter
+type JapaneseFormatter struct{}
+
+func (JapaneseFormatter) Format(name string, kind GreetingKind) string {
+	return defaultGreeter.Format(Greeting{Name: name, Kind: kind, Lang: "ja"})
+}
+
+// EnglishFormatterは、既定の英語のテンプレートで挨拶の文を作るFormatter
+type EnglishFormatter struct{}
+
+func (EnglishFormatter) Format(name string, kind GreetingKind) string {
+	return defaultGreeter.Format(Greeting{Name: name, Kind: kind, Lang: "en"})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// langクエリで挨拶の言語を選べ、知らない言語なら既定の日本語になることを確かめる
+func TestSayHelloLanguage(t *testing.T) {
+	c, _, _ := newTestController()
+	h := LanguageMiddleware(http.HandlerFunc(c.SayHello))
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"en", "Hello, Fred"},
+		{"ja", "Fredさん　こんにちは。"},
+		{"xx", "Fredさん　こんにちは。"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			w := send(h, http.MethodGet, "/hello?user_id=1&lang="+tt.lang, nil)
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Errorf("got %d %q, want 200 %q", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGreeterFormat(t *testing.T) {
+	gr := NewGreeter()
+	tests := []struct {
+		g    Greeting
+		want string
+	}{
+		{Greeting{Name: "Fred", Kind: GreetingHello, Lang: "en"}, "Hello, Fred"},
+		{Greeting{Name: "Fred", Kind: GreetingGoodbye, Lang: "en-US,en;q=0.9"}, "Goodbye, Fred"},
+		{Greeting{Name: "Fred", Kind: GreetingHello, Lang: "ja"}, "Fredさん　こんにちは。"},
+		{Greeting{Name: "Fred", Kind: GreetingHello, Lang: "fr"}, "Fredさん　こんにちは。"},
+	}
+	for _, tt := range tests {
+		if got := gr.Format(tt.g); got != tt.want {
+			t.Errorf("Format(%+v) = %q, want %q", tt.g, got, tt.want)
+		}
+	}
+}
+
+// Greetingは、DataStoreなしで挨拶の文を作れる
+func TestGreetingString(t *testing.T) {
+	tests := []struct {
+		g    Greeting
+		want string
+	}{
+		{Greeting{Name: "Fred", Kind: GreetingHello}, "Fredさん　こんにちは。"},
+		{Greeting{Name: "Fred", Kind: GreetingGoodbye}, "Fredさん　さようなら"},
+		{Greeting{Name: "Mary", Kind: GreetingHello, Lang: "en"}, "Hello, Mary"},
+		{Greeting{Name: "Mary", Kind: GreetingGoodbye, Lang: "en"}, "Goodbye, Mary"},
+	}
+	for _, tt := range tests {
+		if got := tt.g.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.g, got, tt.want)
+		}
+	}
+}
+
+// shoutFormatterは、テスト用の独自のFormatter
+type shoutFormatter struct{}
+
+func (shoutFormatter) Format(name string, kind GreetingKind) string {
+	if kind == GreetingGoodbye {
+		return "BYE " + name
+	}
+	return "YO " + name
+}
+
+// Formatterがnilなら既定のテンプレートを使い、Formatterを渡せばリクエストの言語より優先される
+func TestSimpleLogicFormatter(t *testing.T) {
+	ds := NewSimpleDataStore()
+	ctx := ContextWithLanguage(context.Background(), "en")
+	tests := []struct {
+		name        string
+		f           Formatter
+		wantHello   string
+		wantGoodbye string
+	}{
+		{"nil", nil, "Hello, Fred", "Fredさん　さようなら"},
+		{"japanese", JapaneseFormatter{}, "Fredさん　こんにちは。", "Fredさん　さようなら"},
+		{"english", EnglishFormatter{}, "Hello, Fred", "Goodbye, Fred"},
+		{"custom", shoutFormatter{}, "YO Fred", "BYE Fred"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sl := NewSimpleLogicWithFormatter(&MemoryLogger{}, ds, tt.f)
+			if got, err := sl.SayHello(ctx, "1"); err != nil || got != tt.wantHello {
+				t.Errorf("SayHello = %q, %v; want %q", got, err, tt.wantHello)
+			}
+			if got, err := sl.SayGoodbye(ctx, "1"); err != nil || got != tt.wantGoodbye {
+				t.Errorf("SayGoodbye = %q, %v; want %q", got, err, tt.wantGoodbye)
+			}
+		})
+	}
+	if got, _ := NewSimpleLogicWithFormatter(&MemoryLogger{}, ds, nil).SayHello(context.Background(), "1"); got != "Fredさん　こんにちは。" {
+		t.Errorf("nil formatter without a language = %q, want the Japanese default", got)
+	}
+}
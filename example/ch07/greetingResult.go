@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// GreetingResultは、挨拶の文と、誰にどの言語でいつ挨拶したか。
+// Languageは実際に使ったテンプレートの言語で、リクエストの言語のテンプレートがなければ既定の言語になる。
+// Formatterで挨拶の文を作ったときのように、言語がわからなければ空にする。
+type GreetingResult struct {
+	Name      string    `json:"name"`
+	Language  string    `json:"language"`
+	Message   string    `json:"message"`
+	GreetedAt time.Time `json:"greeted_at"`
+}
+
+// DetailedLogicは、挨拶の文だけでなく、名前や言語も返せるLogicが実装するインターフェイス
+type DetailedLogic interface {
+	SayHelloDetailed(ctx context.Context, userID string) (GreetingResult, error)
+}
+
+// sayHelloDetailedは、logicがDetailedLogicならそのSayHelloDetailedを呼ぶ。
+// そうでなければSayHelloで挨拶し、挨拶の文と今の時刻だけを入れたGreetingResultを返す。
+func sayHelloDetailed(ctx context.Context, logic Logic, userID string) (GreetingResult, error) {
+	if dl, ok := logic.(DetailedLogic); ok {
+		return dl.SayHelloDetailed(ctx, userID)
+	}
+	message, err := logic.SayHello(ctx, userID)
+	if err != nil {
+		return GreetingResult{}, err
+	}
+	return GreetingResult{Message: message, GreetedAt: time.Now()}, nil
+}
+
+// SayHelloDetailedは、/v2/helloで、クエリのuser_idのユーザーへの挨拶をGreetingResultのJSONで返す。
+// messageはこれまでの/v2/helloと同じ項目なので、それだけを読むクライアントはそのまま使える。
+func (c Controller) SayHelloDetailed(w http.ResponseWriter, r *http.Request) {
+	q, ok := c.query(w, r)
+	if !ok {
+		return
+	}
+	userID := q.Get("user_id")
+	if !c.validUserID(w, userID) {
+		return
+	}
+	ctx, span := c.startSpan(r, "GET /v2/hello")
+	defer span.End()
+	result, err := sayHelloDetailed(ctx, c.logic, userID)
+	if err != nil {
+		c.writeGreetingError(w, r, userID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
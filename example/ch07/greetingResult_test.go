@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// SayHelloDetailedは、名前、実際に使った言語、挨拶の文、Clockの時刻を全て入れて返す
+func TestSimpleLogicSayHelloDetailed(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	sl := NewSimpleLogicWithClock(&MemoryLogger{}, NewSimpleDataStore(), DefaultConfig(), NewManualClock(at))
+	tests := []struct {
+		name string
+		lang string
+		want GreetingResult
+	}{
+		{"english", "en-US", GreetingResult{Name: "Fred", Language: "en", Message: "Hello, Fred", GreetedAt: at}},
+		{"default language", "", GreetingResult{Name: "Fred", Language: "ja", Message: "Fredさん　こんにちは。", GreetedAt: at}},
+		{"unsupported language", "fr", GreetingResult{Name: "Fred", Language: "ja", Message: "Fredさん　こんにちは。", GreetedAt: at}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.lang != "" {
+				ctx = ContextWithLanguage(ctx, tt.lang)
+			}
+			got, err := sl.SayHelloDetailed(ctx, "1")
+			if err != nil {
+				t.Fatalf("SayHelloDetailed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("SayHelloDetailed = %+v, want %+v", got, tt.want)
+			}
+			// SayHelloは、同じ挨拶の文だけを返す
+			if message, _ := sl.SayHello(ctx, "1"); message != tt.want.Message {
+				t.Errorf("SayHello = %q, want %q", message, tt.want.Message)
+			}
+		})
+	}
+}
+
+// /v2/helloは、GreetingResultの全ての項目をJSONで返す
+func TestSayHelloDetailedHandler(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	l := &MemoryLogger{}
+	ds := NewSimpleDataStore()
+	c := NewController(l, NewSimpleLogicWithClock(l, ds, DefaultConfig(), NewManualClock(at)), ds)
+	h := LanguagePreferenceMiddleware(defaultGreeter.Supports, "", http.HandlerFunc(c.SayHelloDetailed))
+	w := send(h, http.MethodGet, "/v2/hello?user_id=2&lang=en", nil)
+	var got GreetingResult
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("body %q: %v", w.Body.String(), err)
+	}
+	want := GreetingResult{Name: "Mary", Language: "en", Message: "Hello, Mary", GreetedAt: at}
+	if !got.GreetedAt.Equal(at) {
+		t.Errorf("greeted_at = %v, want %v", got.GreetedAt, at)
+	}
+	got.GreetedAt = at
+	if got != want {
+		t.Errorf("/v2/hello = %+v, want %+v", got, want)
+	}
+	if w := send(h, http.MethodGet, "/v2/hello?user_id=nope", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// GzipMiddlewareは、Accept-Encodingでgzipを受け付けるクライアントへのレスポンスをgzipで圧縮する。
+// ハンドラが自分でContent-Encodingを設定したレスポンスは、二重に圧縮しないようにそのまま返す。
+func GzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzipは、Accept-Encodingの値がgzipを受け付けているかを返す
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// gzipResponseWriterは、最初に書き込まれるときに圧縮するかを決めるhttp.ResponseWriter
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (gw *gzipResponseWriter) WriteHeader(status int) {
+	if !gw.decided {
+		gw.decided = true
+		h := gw.Header()
+		if h.Get("Content-Encoding") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			gw.gz = gzip.NewWriter(gw.ResponseWriter)
+		}
+	}
+	gw.ResponseWriter.WriteHeader(status)
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !gw.decided {
+		if gw.Header().Get("Content-Type") == "" {
+			// 圧縮した後のバイト列から推測されないように、元のバイト列で推測しておく
+			gw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.gz == nil {
+		return gw.ResponseWriter.Write(b)
+	}
+	return gw.gz.Write(b)
+}
+
+// Flushは、圧縮途中のデータを書き出してからクライアントに送る
+func (gw *gzipResponseWriter) Flush() {
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrapは、http.ResponseControllerが包まれたResponseWriterにたどり着けるようにする
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// Closeは、圧縮していればgzipの末尾を書き出す
+func (gw *gzipResponseWriter) Close() error {
+	if gw.gz == nil {
+		return nil
+	}
+	return gw.gz.Close()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sendWithHeaderは、sendと同じくhにリクエストを送るが、headerのキーと値を交互に並べたヘッダを付ける
+func sendWithHeader(h http.Handler, method, target string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, body)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	body := strings.Repeat("Fredさん　こんにちは。", 100)
+	h := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+
+	w := sendWithHeader(h, http.MethodGet, "/", nil, "Accept-Encoding", "gzip, deflate")
+	if ce := w.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil || string(got) != body {
+		t.Errorf("decompressed body = %d bytes, %v; want the original %d bytes", len(got), err, len(body))
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want it sniffed from the uncompressed body", ct)
+	}
+
+	for _, ae := range []string{"", "deflate", "gzip;q=0"} {
+		w := sendWithHeader(h, http.MethodGet, "/", nil, "Accept-Encoding", ae)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+			t.Errorf("Accept-Encoding %q: response was compressed", ae)
+		}
+	}
+}
+
+// ハンドラが自分で圧縮したレスポンスは、二重に圧縮しない
+func TestGzipMiddlewareSkipsEncodedResponses(t *testing.T) {
+	h := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, "already compressed")
+	}))
+	w := sendWithHeader(h, http.MethodGet, "/", nil, "Accept-Encoding", "gzip")
+	if w.Header().Get("Content-Encoding") != "br" || w.Body.String() != "already compressed" {
+		t.Errorf("got Content-Encoding %q and body %q, want the handler's response unchanged", w.Header().Get("Content-Encoding"), w.Body.String())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"unicode/utf8"
+)
+
+// streamLineは、SayHelloStreamが1人のユーザーごとに書き込む1行のJSON。
+// 挨拶できればMessageが、できなければErrorが入る。
+type streamLine struct {
+	UserID  string `json:"user_id"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SayHelloStreamは、リクエストボディのユーザーIDのJSON配列のそれぞれに順に挨拶し、
+// 1人ごとに1行のJSON（NDJSON）を書き込んではフラッシュする。
+// 全員の挨拶が終わるのを待たずに返すので、クライアントは進み具合を見られる。
+// ボディがユーザーIDの配列として読めなければ400を返す。
+// 不明なユーザーのような利用者の間違いはその行のerrorに理由を入れて、残りのユーザーに続ける。
+// データストアが失敗したような500になるエラーは、まだ1行も書いていなければ500で返す。
+// 既に200を書いた後なら、その行のerrorに書いてそこでやめる。
+// クライアントが切断したら、そこで書き込みをやめる。
+func (c Controller) SayHelloStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		c.writeError(w, http.StatusInternalServerError, "ストリーミングできません")
+		return
+	}
+	var userIDs []string
+	if !c.decodeBody(w, r, &userIDs) {
+		return
+	}
+	ctx := r.Context()
+	// 最初の行が500にならないとわかってから200を書く
+	started := false
+	start := func() {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+	enc := json.NewEncoder(w)
+	for _, id := range userIDs {
+		if ctx.Err() != nil {
+			c.streamCancelled(r)
+			return
+		}
+		line := streamLine{UserID: id}
+		if utf8.RuneCountInString(id) > c.maxUserIDLength {
+			line.Error = "user_id is too long"
+		} else if message, err := c.logic.SayHello(ctx, id); err != nil {
+			if ctx.Err() != nil {
+				c.streamCancelled(r)
+				return
+			}
+			var status int
+			status, line.Error = c.errorResponse(r, err)
+			if status >= http.StatusInternalServerError {
+				if !started {
+					c.writeError(w, status, line.Error)
+					return
+				}
+				enc.Encode(line)
+				flusher.Flush()
+				return
+			}
+		} else {
+			line.Message = message
+		}
+		start()
+		if err := enc.Encode(line); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+	start()
+}
+
+// streamCancelledは、ストリームの途中でクライアントが切断したことをログに書く。
+// ステータスコードは既に書き込んでいるので、clientGoneと違って499は書かない。
+func (c Controller) streamCancelled(r *http.Request) {
+	LoggerWithContext(r.Context(), c.l).Logf(LevelInfo, "client cancelled: %s %s", r.Method, escapeForLog(r.URL.Path))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 本物のHTTPで送ったユーザーIDごとに1行ずつ返り、見つからないIDはその行のerrorになる
+func TestSayHelloStream(t *testing.T) {
+	c, _, _ := newTestController()
+	srv := httptest.NewServer(http.HandlerFunc(c.SayHelloStream))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`["1","nope","2"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "application/x-ndjson" {
+		t.Fatalf("got %d %q, want 200 application/x-ndjson", resp.StatusCode, ct)
+	}
+	var lines []streamLine
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var line streamLine
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("line %d: %v", len(lines)+1, err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines %+v, want 3", len(lines), lines)
+	}
+	want := []streamLine{
+		{UserID: "1", Message: "Fredさん　こんにちは。"},
+		{UserID: "nope", Error: lines[1].Error},
+		{UserID: "2", Message: "Maryさん　こんにちは。"},
+	}
+	if !reflect.DeepEqual(lines, want) || lines[1].Error == "" {
+		t.Errorf("lines = %+v, want %+v with an error for nope", lines, want)
+	}
+}
+
+// cancelAfterLogicは、SayHelloをn回呼んだらcancelを呼ぶLogic
+type cancelAfterLogic struct {
+	Logic
+	n      *int
+	cancel context.CancelFunc
+}
+
+func (cl cancelAfterLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	*cl.n--
+	if *cl.n == 0 {
+		cl.cancel()
+	}
+	return cl.Logic.SayHello(ctx, userID)
+}
+
+// 途中でクライアントが切断したら、残りのユーザーには挨拶しない
+func TestSayHelloStreamCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := &MemoryLogger{}
+	ds := NewSimpleDataStore()
+	n := 2
+	c := NewController(l, cancelAfterLogic{NewSimpleLogic(l, ds, DefaultConfig()), &n, cancel}, ds)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/hello/stream", strings.NewReader(`["1","2","3"]`)).WithContext(ctx)
+	c.SayHelloStream(w, r)
+	if got := strings.Count(w.Body.String(), "\n"); got != 1 {
+		t.Errorf("got %d lines %q, want only the line written before the cancel", got, w.Body.String())
+	}
+	if !containsMessage(l.Messages(), "client cancelled") {
+		t.Errorf("logs %v do not mention the cancel", l.Messages())
+	}
+}
+
+// 最初のユーザーから5xxになるなら、ストリームを始めずにエラーを返す
+func TestSayHelloStreamStoreError(t *testing.T) {
+	l := &MemoryLogger{}
+	ds := failingStore{errors.New("db down")}
+	c := NewController(l, NewSimpleLogic(l, ds, DefaultConfig()), ds)
+	w := send(http.HandlerFunc(c.SayHelloStream), http.MethodPost, "/hello/stream", strings.NewReader(`["1","2"]`))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct == "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want an ordinary error response", ct)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// GreetingHistoryは、1人のユーザーが何回、最後にいつ挨拶されたか
+type GreetingHistory struct {
+	Count       int
+	LastGreeted time.Time
+}
+
+// HistoryReaderは、ユーザーごとの挨拶の履歴を返せるLogicが実装するインターフェイス
+type HistoryReader interface {
+	History(userID string) GreetingHistory
+}
+
+// HistoryLogicは、包んだLogicのSayHelloが成功するたびに、ユーザーごとの回数と時刻を記録するLogic。
+// エラーになった挨拶は数えない。SayGoodbyeはそのまま包んだLogicに渡す。
+type HistoryLogic struct {
+	logic Logic
+	clock Clock
+
+	mu      sync.Mutex
+	history map[string]GreetingHistory
+}
+
+// NewHistoryLogicは、logicの挨拶の履歴をclockの時刻で記録するHistoryLogicを生成するファクトリ関数。
+// clockがnilならRealClockを使う。
+func NewHistoryLogic(logic Logic, clock Clock) *HistoryLogic {
+	return &HistoryLogic{
+		logic:   logic,
+		clock:   clockOrReal(clock),
+		history: map[string]GreetingHistory{},
+	}
+}
+
+func (hl *HistoryLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	message, err := hl.logic.SayHello(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	hl.record(userID)
+	return message, nil
+}
+
+// SayHelloDetailedは、包んだLogicのSayHelloDetailedで挨拶し、SayHelloと同じく成功したら記録する
+func (hl *HistoryLogic) SayHelloDetailed(ctx context.Context, userID string) (GreetingResult, error) {
+	result, err := sayHelloDetailed(ctx, hl.logic, userID)
+	if err != nil {
+		return GreetingResult{}, err
+	}
+	hl.record(userID)
+	return result, nil
+}
+
+// recordは、userIDが今挨拶されたことを記録する
+func (hl *HistoryLogic) record(userID string) {
+	now := hl.clock.Now()
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	h := hl.history[userID]
+	h.Count++
+	h.LastGreeted = now
+	hl.history[userID] = h
+}
+
+func (hl *HistoryLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	return hl.logic.SayGoodbye(ctx, userID)
+}
+
+// SayHelloToManyは、userIDsのユーザーそれぞれに挨拶し、挨拶できたユーザーをそれぞれ1回として記録する
+func (hl *HistoryLogic) SayHelloToMany(ctx context.Context, userIDs []string) (map[string]string, error) {
+	return sayHelloToMany(ctx, hl, userIDs)
+}
+
+// Historyは、userIDの挨拶の履歴を返す。一度も挨拶されていなければゼロ値を返す。
+func (hl *HistoryLogic) History(userID string) GreetingHistory {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	return hl.history[userID]
+}
+
+// historyResponseは、/users/{id}/historyが返すJSON。一度も挨拶されていなければlast_greetedを省く。
+type historyResponse struct {
+	UserID      string     `json:"user_id"`
+	Count       int        `json:"count"`
+	LastGreeted *time.Time `json:"last_greeted,omitempty"`
+}
+
+// UserHistoryは、/users/{id}/historyで、そのユーザーが挨拶された回数と最後の時刻をJSONで返す。
+// パスがその形でなければ404を、c.logicが履歴を持たなければ501を返す。
+func (c Controller) UserHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID, rest := splitUserPath(r.URL.Path)
+	if userID == "" || rest != "history" {
+		http.NotFound(w, r)
+		return
+	}
+	hr, ok := c.logic.(HistoryReader)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "履歴を持たないロジック")
+		return
+	}
+	h := hr.History(userID)
+	resp := historyResponse{UserID: userID, Count: h.Count}
+	if h.Count > 0 {
+		resp.LastGreeted = &h.LastGreeted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
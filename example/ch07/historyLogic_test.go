@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 2回挨拶したユーザーの履歴は2回で、最後の時刻は2回目のもの。失敗した挨拶は数えない。
+func TestHistoryLogic(t *testing.T) {
+	l := &MemoryLogger{}
+	clock := NewManualClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	hl := NewHistoryLogic(NewSimpleLogic(l, NewSimpleDataStore(), DefaultConfig()), clock)
+	ctx := context.Background()
+	hl.SayHello(ctx, "1")
+	clock.Advance(time.Minute)
+	hl.SayHello(ctx, "1")
+	if _, err := hl.SayHello(ctx, "nope"); err == nil {
+		t.Fatal("unknown user: no error")
+	}
+
+	c := NewController(l, hl, NewSimpleDataStore(), WithAPIKeys(map[string]string{"k": ""}))
+	h := newTestHandler(t, c)
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/users/1/history", http.StatusOK, `{"user_id":"1","count":2,"last_greeted":"2024-01-02T03:05:05Z"}`},
+		{"/users/nope/history", http.StatusOK, `{"user_id":"nope","count":0}`},
+		{"/users/1/other", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := sendWithHeader(h, http.MethodGet, tt.path, nil, "X-API-Key", "k")
+			if got := strings.TrimSpace(w.Body.String()); w.Code != tt.wantStatus || (tt.wantBody != "" && got != tt.wantBody) {
+				t.Errorf("got %d %s, want %d %s", w.Code, got, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
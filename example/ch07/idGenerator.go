@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// IDGeneratorは、新しいユーザーのIDを作る
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// SequentialIDGeneratorは、1から順に数字のIDを作るIDGenerator。ゼロ値で使える。
+type SequentialIDGenerator struct {
+	n atomic.Int64
+}
+
+func (sg *SequentialIDGenerator) NewID() (string, error) {
+	return strconv.FormatInt(sg.n.Add(1), 10), nil
+}
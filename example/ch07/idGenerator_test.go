@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeIDGeneratorは、idsを順に返すIDGenerator
+type fakeIDGenerator struct {
+	ids []string
+}
+
+func (fg *fakeIDGenerator) NewID() (string, error) {
+	id := fg.ids[0]
+	fg.ids = fg.ids[1:]
+	return id, nil
+}
+
+// 作ったIDが既にいるユーザーと重なれば、次のIDを作る
+func TestSimpleDataStoreAddUserWithGenerator(t *testing.T) {
+	ds := NewSimpleDataStore()
+	ds.SetIDGenerator(&fakeIDGenerator{ids: []string{"a", "1", "b"}})
+	for _, want := range []string{"a", "b"} {
+		id, err := ds.AddUser("Ann")
+		if err != nil || id != want {
+			t.Errorf("AddUser = %q, %v; want %q, nil", id, err, want)
+		}
+	}
+	if name, _, _ := ds.UserNameForID(context.Background(), "1"); name != "Fred" {
+		t.Errorf("user 1 = %q, want Fred to be kept", name)
+	}
+}
+
+func TestSequentialIDGeneratorSkipsExistingIDs(t *testing.T) {
+	ds := NewSimpleDataStore()
+	if id, err := ds.AddUser("Ann"); err != nil || id != "4" {
+		t.Errorf("AddUser = %q, %v; want 4, nil", id, err)
+	}
+}
+
+// POST /usersは、user_idがあればそれを使い、なければデータストアに作らせる
+func TestAddUserGeneratesID(t *testing.T) {
+	c, ds, _ := newTestController()
+	ds.SetIDGenerator(&fakeIDGenerator{ids: []string{"g1"}})
+	w := send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(`{"name":"Ann"}`))
+	if w.Code != http.StatusCreated || w.Body.String() != `{"user_id":"g1"}`+"\n" {
+		t.Errorf("got %d %q, want 201 {\"user_id\":\"g1\"}", w.Code, w.Body.String())
+	}
+	w = send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(`{"user_id":"mine","name":"Bob"}`))
+	if w.Code != http.StatusCreated {
+		t.Errorf("client-supplied id: status = %d, want 201", w.Code)
+	}
+	if name, _, _ := ds.UserNameForID(context.Background(), "mine"); name != "Bob" {
+		t.Errorf("user mine = %q, want Bob", name)
+	}
+}
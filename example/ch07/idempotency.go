@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultIdempotencyTTLは、Idempotency-Keyごとのレスポンスを覚えておく既定の時間
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyCacheは、Idempotency-Keyヘッダのキーごとに、最初のリクエストへのレスポンスをttlの間覚えておくもの。
+// IdempotencyMiddlewareで使う。複数のゴルーチンから同時に使ってもよい。
+// 期限の切れたエントリは、最初に使われたときに動き出すゴルーチンがttlごとに捨てる。使い終わったらStopを呼ぶこと。
+type IdempotencyCache struct {
+	ttl   time.Duration
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	start   sync.Once
+	done    chan struct{}
+	stop    sync.Once
+}
+
+// idempotencyEntryは、1つのキーのレスポンス。muは、同じキーのリクエストを1つずつ処理するためのロック。
+// 期限を調べられるように、done以下のフィールドはmuとIdempotencyCache.muの両方を持って書き換える。
+// removedは、5xxでエントリがentriesから消されたことを表す。待っていたリクエストは、エントリを取り直す。
+type idempotencyEntry struct {
+	mu      sync.Mutex
+	removed bool
+	done    bool
+	expires time.Time
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+// NewIdempotencyCacheは、レスポンスをttlの間覚えておくIdempotencyCacheを生成するファクトリ関数。
+// clockがnilならRealClockを使う。ttlが正でなければ、defaultIdempotencyTTLを使う。
+func NewIdempotencyCache(ttl time.Duration, clock Clock) *IdempotencyCache {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &IdempotencyCache{
+		ttl:     ttl,
+		clock:   clockOrReal(clock),
+		entries: map[string]*idempotencyEntry{},
+		done:    make(chan struct{}),
+	}
+}
+
+// entryは、keyのエントリを返す。なければ、または期限が切れていれば作り直す。
+func (ic *IdempotencyCache) entry(key string) *idempotencyEntry {
+	ic.start.Do(func() {
+		go ic.sweep()
+	})
+	now := ic.clock.Now()
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	e, ok := ic.entries[key]
+	if !ok || e.expired(now) {
+		e = &idempotencyEntry{}
+		ic.entries[key] = e
+	}
+	return e
+}
+
+// removeは、5xxで終わったkeyのエントリeを捨てる。eの後で作り直されたエントリは残す。e.muを持って呼ぶこと。
+func (ic *IdempotencyCache) remove(key string, e *idempotencyEntry) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	e.removed = true
+	if ic.entries[key] == e {
+		delete(ic.entries, key)
+	}
+}
+
+// sweepは、ttlごとに、期限の切れたエントリを捨てる
+func (ic *IdempotencyCache) sweep() {
+	t := time.NewTicker(ic.ttl)
+	defer t.Stop()
+	for {
+		select {
+		case <-ic.done:
+			return
+		case <-t.C:
+		}
+		ic.removeExpired()
+	}
+}
+
+// removeExpiredは、期限の切れたエントリをすべて捨てる
+func (ic *IdempotencyCache) removeExpired() {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	now := ic.clock.Now()
+	for k, e := range ic.entries {
+		if e.expired(now) {
+			delete(ic.entries, k)
+		}
+	}
+}
+
+// Lenは、覚えているエントリの数を返す
+func (ic *IdempotencyCache) Len() int {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	return len(ic.entries)
+}
+
+// Stopは、期限の切れたエントリを捨てるゴルーチンを止める
+func (ic *IdempotencyCache) Stop() {
+	ic.stop.Do(func() {
+		close(ic.done)
+	})
+}
+
+// expiredは、eがレスポンスを覚えていて、その期限がnowまでに切れたかを返す。IdempotencyCache.muを持って呼ぶこと。
+func (e *idempotencyEntry) expired(now time.Time) bool {
+	return e.done && !now.Before(e.expires)
+}
+
+// IdempotencyMiddlewareは、Idempotency-Keyヘッダの付いたPOSTについて、同じキーで送り直されたリクエストに、
+// nextを呼ばずに最初のレスポンスをそのまま返す。通信が切れたクライアントが、重複を作らずにやり直せるようにするため。
+// 同じキーのリクエストが同時に来たら、後のリクエストは最初のリクエストが終わるのを待つ。
+// 5xxのレスポンスは覚えないので、同じキーで送り直すとnextがもう一度呼ばれる。
+// キーは、APIキーとパスごとに別に扱う。
+func IdempotencyMiddleware(ic *IdempotencyCache, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if ic == nil || key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		k := r.Header.Get("X-API-Key") + "\x00" + r.URL.Path + "\x00" + key
+		e := ic.entry(k)
+		e.mu.Lock()
+		// 待っている間に前のリクエストが5xxで終わってエントリが消されたら、取り直す
+		for e.removed {
+			e.mu.Unlock()
+			e = ic.entry(k)
+			e.mu.Lock()
+		}
+		defer e.mu.Unlock()
+		if !e.done {
+			buf := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(buf, r)
+			if buf.status < 500 {
+				ic.mu.Lock()
+				e.done = true
+				e.expires = ic.clock.Now().Add(ic.ttl)
+				e.status, e.header, e.body = buf.status, buf.header, buf.body.Bytes()
+				ic.mu.Unlock()
+			} else {
+				ic.remove(k, e)
+			}
+			buf.writeTo(w)
+			return
+		}
+		for k, v := range e.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(e.status)
+		w.Write(e.body)
+	})
+}
+
+// bufferedResponseは、ハンドラが書き込んだレスポンスをメモリに貯めておくhttp.ResponseWriter
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (br *bufferedResponse) Header() http.Header {
+	return br.header
+}
+
+func (br *bufferedResponse) WriteHeader(status int) {
+	if br.wroteHeader {
+		return
+	}
+	br.wroteHeader = true
+	br.status = status
+}
+
+func (br *bufferedResponse) Write(b []byte) (int, error) {
+	br.WriteHeader(http.StatusOK)
+	return br.body.Write(b)
+}
+
+// writeToは、貯めておいたレスポンスをwに書き込む
+func (br *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range br.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(br.status)
+	w.Write(br.body.Bytes())
+}
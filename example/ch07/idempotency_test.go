@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// addUserHandlerは、呼ばれるたびにdsへユーザーを追加して201を返すハンドラ
+func addUserHandler(ds *SimpleDataStore, calls *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		ds.AddUserForID("u"+strconv.Itoa(int(n)), "Bob")
+		w.WriteHeader(http.StatusCreated)
+	})
+}
+
+// 同じキーで同時に、そして後からもう一度送っても、データストアは1回しか書き換わらない
+func TestIdempotencyMiddlewareSameKey(t *testing.T) {
+	ds := NewSimpleDataStore()
+	var calls int32
+	ic := NewIdempotencyCache(time.Hour, NewManualClock(time.Unix(0, 0)))
+	defer ic.Stop()
+	h := IdempotencyMiddleware(ic, addUserHandler(ds, &calls))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 3)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "abc").Code
+		}(i)
+	}
+	wg.Wait()
+	w := sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "abc")
+	if got := w.Header().Get("Idempotent-Replayed"); got != "true" || w.Code != http.StatusCreated {
+		t.Errorf("replay: status %d, Idempotent-Replayed %q; want 201, true", w.Code, got)
+	}
+	for i, code := range codes {
+		if code != http.StatusCreated {
+			t.Errorf("concurrent request %d: status %d, want 201", i, code)
+		}
+	}
+	if n := ds.UserCount(); n != 4 {
+		t.Errorf("UserCount() = %d, want 4 (3 initial users and 1 added)", n)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+// 5xxで終わったキーのエントリは残らず、送り直すとハンドラがもう一度呼ばれる
+func TestIdempotencyMiddlewareDropsFailures(t *testing.T) {
+	var calls int32
+	ic := NewIdempotencyCache(time.Hour, NewManualClock(time.Unix(0, 0)))
+	defer ic.Stop()
+	h := IdempotencyMiddleware(ic, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if w := sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "abc"); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first request: status %d, want 503", w.Code)
+	}
+	if n := ic.Len(); n != 0 {
+		t.Errorf("after a 503: Len() = %d, want 0", n)
+	}
+	w := sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "abc")
+	if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry: status %d, Idempotent-Replayed %q; want 201 and not replayed", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if n := ic.Len(); n != 1 {
+		t.Errorf("after a 201: Len() = %d, want 1", n)
+	}
+}
+
+// 期限の切れたエントリは、removeExpiredで捨てられ、同じキーでもハンドラがもう一度呼ばれる
+func TestIdempotencyCacheRemoveExpired(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	ic := NewIdempotencyCache(time.Hour, clock)
+	defer ic.Stop()
+	var calls int32
+	h := IdempotencyMiddleware(ic, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "a")
+	clock.Advance(30 * time.Minute)
+	sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "b")
+
+	clock.Advance(30 * time.Minute)
+	ic.removeExpired()
+	if n := ic.Len(); n != 1 {
+		t.Errorf("after an hour: Len() = %d, want 1", n)
+	}
+	sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "a")
+	if calls != 3 {
+		t.Errorf("handler called %d times, want 3", calls)
+	}
+}
+
+// ttlが正でなければ既定のttlを使うので、Tickerを作ってもpanicしない
+func TestNewIdempotencyCacheNonPositiveTTL(t *testing.T) {
+	ic := NewIdempotencyCache(0, nil)
+	defer ic.Stop()
+	if ic.ttl != defaultIdempotencyTTL {
+		t.Errorf("ttl = %v, want %v", ic.ttl, defaultIdempotencyTTL)
+	}
+	h := IdempotencyMiddleware(ic, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if w := sendWithHeader(h, http.MethodPost, "/users", nil, "Idempotency-Key", "a"); w.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrBodyReadTimeoutは、リクエストボディの読み込みが、決められた時間内に少しも進まなかったときのエラー
+var ErrBodyReadTimeout = errors.New("リクエストボディの読み込みが進みません")
+
+// idleTimeoutReaderは、1回のReadがtimeout以内に終わらなければErrBodyReadTimeoutを返すio.Reader。
+// 1バイトずつゆっくり送ってくるクライアントに、ハンドラを長く占有されないようにする。
+// 一度タイムアウトしたら、以後のReadもErrBodyReadTimeoutを返す。
+type idleTimeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	err     error
+}
+
+// readResultは、別のゴルーチンで読んだ結果
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// newIdleTimeoutReaderは、rの1回のReadをtimeoutで打ち切るidleTimeoutReaderを生成するファクトリ関数
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration) *idleTimeoutReader {
+	return &idleTimeoutReader{r: r, timeout: timeout}
+}
+
+func (itr *idleTimeoutReader) Read(p []byte) (int, error) {
+	if itr.err != nil {
+		return 0, itr.err
+	}
+	// タイムアウトした後も読み込みのゴルーチンは残るので、pではなく自分のバッファに読ませる
+	buf := make([]byte, len(p))
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := itr.r.Read(buf)
+		done <- readResult{data: buf[:n], err: err}
+	}()
+	timer := time.NewTimer(itr.timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return copy(p, res.data), res.err
+	case <-timer.C:
+		itr.err = ErrBodyReadTimeout
+		return 0, itr.err
+	}
+}
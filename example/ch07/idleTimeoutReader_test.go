@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stalledReaderは、releaseが閉じられるまでReadから戻らないio.Reader
+type stalledReader struct {
+	release chan struct{}
+}
+
+func (sr stalledReader) Read(p []byte) (int, error) {
+	<-sr.release
+	return 0, io.EOF
+}
+
+func TestIdleTimeoutReader(t *testing.T) {
+	sr := stalledReader{release: make(chan struct{})}
+	defer close(sr.release)
+	itr := newIdleTimeoutReader(io.MultiReader(strings.NewReader("ab"), sr), 20*time.Millisecond)
+	p := make([]byte, 8)
+	if n, err := itr.Read(p); n != 2 || err != nil || string(p[:n]) != "ab" {
+		t.Fatalf("first Read = %d, %v; want ab", n, err)
+	}
+	if _, err := itr.Read(p); !errors.Is(err, ErrBodyReadTimeout) {
+		t.Fatalf("stalled Read: err = %v, want ErrBodyReadTimeout", err)
+	}
+	// 一度タイムアウトしたら、それ以降も同じエラーを返す
+	if _, err := itr.Read(p); !errors.Is(err, ErrBodyReadTimeout) {
+		t.Errorf("Read after the timeout: err = %v, want ErrBodyReadTimeout", err)
+	}
+}
+
+// ボディの途中で止まったクライアントには408を返し、普通に送ってくるクライアントには影響しない
+func TestAddUserStalledBody(t *testing.T) {
+	c, _, _ := newTestController(WithBodyReadTimeout(20 * time.Millisecond))
+	sr := stalledReader{release: make(chan struct{})}
+	defer close(sr.release)
+	w := send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", io.MultiReader(strings.NewReader(`{"na`), sr))
+	if w.Code != http.StatusRequestTimeout {
+		t.Errorf("stalled body: status = %d, want 408", w.Code)
+	}
+	w = send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(`{"user_id":"7","name":"Ann"}`))
+	if w.Code != http.StatusCreated {
+		t.Errorf("normal body: status = %d, want 201", w.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+// ここでは、各インターフェイスを実装するつもりの型が、本当に実装しているかをコンパイル時に確かめる。
+// メソッドのシグネチャを変えて実装から外れると、このファイルがコンパイルできなくなる。
+// 新しい実装を足したら、ここにも足すこと。
+
+// DataStore
+var (
+	_ DataStore = (*SimpleDataStore)(nil)
+	_ DataStore = (*FileDataStore)(nil)
+	_ DataStore = (*CSVDataStore)(nil)
+	_ DataStore = (*WALDataStore)(nil)
+	_ DataStore = SQLDataStore{}
+	_ DataStore = RedisDataStore{}
+	_ DataStore = RemoteDataStore{}
+	_ DataStore = RetryDataStore{}
+	_ DataStore = (*CircuitBreakerDataStore)(nil)
+	_ DataStore = (*CacheDataStore)(nil)
+	_ DataStore = ChainDataStore{}
+	_ DataStore = ObservedDataStore{}
+	_ DataStore = AuditingDataStore{}
+	_ DataStore = AuthorizedDataStore{}
+	_ DataStore = ShardedDataStore{}
+	_ DataStore = (*WebhookNotifyingDataStore)(nil)
+	_ DataStore = (*BoundedDataStore)(nil)
+	_ DataStore = (*ReplicatedDataStore)(nil)
+	_ DataStore = (*ConflictLoggingDataStore)(nil)
+	_ DataStore = (*DedupingDataStore)(nil)
+)
+
+// WritableDataStore
+var (
+	_ WritableDataStore = (*SimpleDataStore)(nil)
+	_ WritableDataStore = (*FileDataStore)(nil)
+	_ WritableDataStore = (*WALDataStore)(nil)
+	_ WritableDataStore = SQLDataStore{}
+	_ WritableDataStore = RedisDataStore{}
+	_ WritableDataStore = AuditingDataStore{}
+	_ WritableDataStore = ShardedDataStore{}
+	_ WritableDataStore = (*WebhookNotifyingDataStore)(nil)
+	_ WritableDataStore = (*BoundedDataStore)(nil)
+	_ WritableDataStore = (*ReplicatedDataStore)(nil)
+	_ WritableDataStore = (*ConflictLoggingDataStore)(nil)
+	_ WritableDataStore = (*DedupingDataStore)(nil)
+)
+
+// DataStoreが追加で実装できるインターフェイス
+var (
+	_ Pinger            = (*SimpleDataStore)(nil)
+	_ Pinger            = SQLDataStore{}
+	_ Lister            = (*SimpleDataStore)(nil)
+	_ Lister            = (*FileDataStore)(nil)
+	_ Lister            = (*CSVDataStore)(nil)
+	_ Importer          = (*SimpleDataStore)(nil)
+	_ Versioner         = (*SimpleDataStore)(nil)
+	_ IDAssigner        = (*SimpleDataStore)(nil)
+	_ IDAssigner        = ShardedDataStore{}
+	_ IDAssigner        = (*BoundedDataStore)(nil)
+	_ Snapshotter       = (*SimpleDataStore)(nil)
+	_ StreamSnapshotter = (*SimpleDataStore)(nil)
+	_ Counter           = (*SimpleDataStore)(nil)
+	_ Counter           = (*BoundedDataStore)(nil)
+	_ Searcher          = (*SimpleDataStore)(nil)
+	_ Pager             = (*SimpleDataStore)(nil)
+	_ Disabler          = (*SimpleDataStore)(nil)
+	_ Rekeyer           = (*SimpleDataStore)(nil)
+	_ Verifier          = (*SimpleDataStore)(nil)
+	_ Reloader          = (*FileDataStore)(nil)
+	_ Reloader          = (*CSVDataStore)(nil)
+	_ DataStoreWrapper  = ObservedDataStore{}
+	_ DataStoreWrapper  = RetryDataStore{}
+	_ DataStoreWrapper  = (*CacheDataStore)(nil)
+	_ DataStoreWrapper  = (*CircuitBreakerDataStore)(nil)
+)
+
+// Logger
+var (
+	_ Logger = LoggerAdapter(nil)
+	_ Logger = LeveledLogger{}
+	_ Logger = SafeLogger{}
+	_ Logger = MultiLogger{}
+	_ Logger = (*RotatingFileLogger)(nil)
+	_ Logger = (*MemoryLogger)(nil)
+	_ Logger = (*WriterLogger)(nil)
+	_ Logger = (*JSONLogger)(nil)
+	_ Logger = (*FanoutLogger)(nil)
+	_ Logger = requestLogger{}
+)
+
+// Logic
+var (
+	_ Logic         = SimpleLogic{}
+	_ Logic         = TimeoutLogic{}
+	_ Logic         = TracingLogic{}
+	_ Logic         = (*CachingLogic)(nil)
+	_ Logic         = (*HistoryLogic)(nil)
+	_ Logic         = BusinessHoursLogic{}
+	_ Logic         = ABTestLogic{}
+	_ Logic         = uppercaseLogic{}
+	_ Logic         = ErrorTranslatingLogic{}
+	_ BatchLogic    = SimpleLogic{}
+	_ BatchLogic    = (*HistoryLogic)(nil)
+	_ DetailedLogic = SimpleLogic{}
+	_ DetailedLogic = (*HistoryLogic)(nil)
+	_ DetailedLogic = ABTestLogic{}
+	_ DetailedLogic = ErrorTranslatingLogic{}
+)
+
+// その他
+var (
+	_ ResponseEncoder   = TextEncoder{}
+	_ HistoryReader     = (*HistoryLogic)(nil)
+	_ ResponseEncoder   = JSONEncoder{}
+	_ Formatter         = JapaneseFormatter{}
+	_ Formatter         = EnglishFormatter{}
+	_ GreetingFormatter = TimeOfDayFormatter{}
+	_ Tracer            = noopTracer{}
+	_ Clock             = RealClock{}
+	_ Clock             = (*ManualClock)(nil)
+	_ IDGenerator       = (*SequentialIDGenerator)(nil)
+	_ LookupRecorder    = (*Metrics)(nil)
+	_ RequestCounter    = (*Metrics)(nil)
+	_ AuditSink         = AuditSinkFunc(nil)
+)
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// implementationsは、implementations.goと同じ組み合わせを実行時にも確かめるための一覧
+var implementations = []struct {
+	iface reflect.Type
+	impls []any
+}{
+	{reflect.TypeOf((*DataStore)(nil)).Elem(), []any{
+		(*SimpleDataStore)(nil), (*FileDataStore)(nil), (*CSVDataStore)(nil), (*WALDataStore)(nil),
+		SQLDataStore{}, RedisDataStore{}, RemoteDataStore{}, RetryDataStore{}, (*CircuitBreakerDataStore)(nil),
+		(*CacheDataStore)(nil), ChainDataStore{}, ObservedDataStore{}, AuditingDataStore{}, AuthorizedDataStore{},
+		ShardedDataStore{}, (*WebhookNotifyingDataStore)(nil), (*BoundedDataStore)(nil), (*ReplicatedDataStore)(nil),
+		(*ConflictLoggingDataStore)(nil), (*DedupingDataStore)(nil),
+	}},
+	{reflect.TypeOf((*WritableDataStore)(nil)).Elem(), []any{
+		(*SimpleDataStore)(nil), (*FileDataStore)(nil), (*WALDataStore)(nil), SQLDataStore{}, RedisDataStore{},
+		AuditingDataStore{}, ShardedDataStore{}, (*WebhookNotifyingDataStore)(nil), (*BoundedDataStore)(nil),
+		(*ReplicatedDataStore)(nil), (*ConflictLoggingDataStore)(nil), (*DedupingDataStore)(nil),
+	}},
+	{reflect.TypeOf((*Lister)(nil)).Elem(), []any{(*SimpleDataStore)(nil), (*FileDataStore)(nil), (*CSVDataStore)(nil)}},
+	{reflect.TypeOf((*DataStoreWrapper)(nil)).Elem(), []any{
+		ObservedDataStore{}, RetryDataStore{}, (*CacheDataStore)(nil), (*CircuitBreakerDataStore)(nil),
+	}},
+	{reflect.TypeOf((*Logger)(nil)).Elem(), []any{
+		LoggerAdapter(nil), LeveledLogger{}, SafeLogger{}, MultiLogger{}, (*RotatingFileLogger)(nil),
+		(*MemoryLogger)(nil), (*WriterLogger)(nil), (*JSONLogger)(nil), (*FanoutLogger)(nil), requestLogger{},
+	}},
+	{reflect.TypeOf((*Logic)(nil)).Elem(), []any{
+		SimpleLogic{}, TimeoutLogic{}, TracingLogic{}, (*CachingLogic)(nil), (*HistoryLogic)(nil),
+		BusinessHoursLogic{}, ABTestLogic{}, uppercaseLogic{}, ErrorTranslatingLogic{},
+	}},
+}
+
+// 各実装がインターフェイスを満たしていることを確かめる。
+// implementations.goはコンパイルで確かめるが、ここでは一覧のどれが外れたのかをテストの結果で示す。
+func TestImplementations(t *testing.T) {
+	for _, tt := range implementations {
+		for _, impl := range tt.impls {
+			if typ := reflect.TypeOf(impl); !typ.Implements(tt.iface) {
+				t.Errorf("%v does not implement %v", typ, tt.iface)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainLogIntervalは、終了するときに処理中のリクエストの数をログに書く間隔
+const drainLogInterval = time.Second
+
+// InflightCounterは、処理中のリクエストの数を数える。ゼロ値で使える。
+// 終了するときに、あといくつのリクエストが終わるのを待っているかを確かめるために使う。
+type InflightCounter struct {
+	n atomic.Int64
+}
+
+// Countは、今処理中のリクエストの数を返す
+func (ic *InflightCounter) Count() int64 {
+	return ic.n.Load()
+}
+
+// InflightMiddlewareは、nextがリクエストを処理している間、icの数を1つ増やしておく
+func InflightMiddleware(ic *InflightCounter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ic.n.Add(1)
+		// nextがパニックしても数を戻す
+		defer ic.n.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WaitIdleは、処理中のリクエストがなくなるまで待ち、待っている間はintervalごとに残りの数をlに書く。
+// ctxがキャンセルされたら、リクエストが残っていてもctxのエラーを返す。
+func (ic *InflightCounter) WaitIdle(ctx context.Context, l Logger, interval time.Duration) error {
+	// 数が0になったことはすぐに知りたいので、ログより短い間隔で確かめる
+	every := interval / 10
+	if every <= 0 {
+		every = time.Millisecond
+	}
+	poll := time.NewTicker(every)
+	defer poll.Stop()
+	lastLog := time.Now()
+	for {
+		n := ic.Count()
+		if n == 0 {
+			return nil
+		}
+		if time.Since(lastLog) >= interval {
+			l.Logf(LevelInfo, "shutdown: 処理中のリクエスト %d件", n)
+			lastLog = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			l.Logf(LevelWarn, "shutdown: 処理中のリクエストが%d件残ったまま止めます", n)
+			return ctx.Err()
+		case <-poll.C:
+		}
+	}
+}
+
+// inflightResponseは、/admin/inflightが返すJSON
+type inflightResponse struct {
+	Inflight int64 `json:"inflight"`
+}
+
+// Inflightは、GET /admin/inflightで、処理中のリクエストの数をJSONで返す。このリクエスト自身も1件に数える。
+func (c Controller) Inflight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if c.inflight == nil {
+		c.writeError(w, http.StatusNotImplemented, "処理中のリクエストを数えていません")
+		return
+	}
+	writeJSON(w, http.StatusOK, inflightResponse{Inflight: c.inflight.Count()})
+}
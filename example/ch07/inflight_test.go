@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 処理中のリクエストを開いたままにすると、/admin/inflightにその数が出て、WaitIdleはそれが終わるまで待つ
+func TestInflightCounter(t *testing.T) {
+	ic := &InflightCounter{}
+	entered, release := make(chan struct{}), make(chan struct{})
+	slow := InflightMiddleware(ic, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		slow.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-entered
+
+	c := NewController(&MemoryLogger{}, nil, nil, WithInflightCounter(ic))
+	w := send(InflightMiddleware(ic, http.HandlerFunc(c.Inflight)), http.MethodGet, "/admin/inflight", nil)
+	if got := strings.TrimSpace(w.Body.String()); got != `{"inflight":2}` {
+		t.Errorf("/admin/inflight = %s, want the slow request and itself", got)
+	}
+
+	l := &MemoryLogger{}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ic.WaitIdle(ctx, l, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitIdle with a request open = %v, want context.DeadlineExceeded", err)
+	}
+	if !containsMessage(l.Messages(), "処理中のリクエスト 1件") || !containsMessage(l.Messages(), "残ったまま") {
+		t.Errorf("logs %v do not show the progress and the give-up", l.Messages())
+	}
+
+	close(release)
+	<-done
+	if err := ic.WaitIdle(context.Background(), l, 10*time.Millisecond); err != nil {
+		t.Errorf("WaitIdle after the request finished = %v", err)
+	}
+	if n := ic.Count(); n != 0 {
+		t.Errorf("Count() = %d, want 0", n)
+	}
+}
+
+// パニックしたリクエストも数から外れる
+func TestInflightMiddlewarePanic(t *testing.T) {
+	ic := &InflightCounter{}
+	h := InflightMiddleware(ic, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	func() {
+		defer func() { recover() }()
+		send(h, http.MethodGet, "/", nil)
+	}()
+	if n := ic.Count(); n != 0 {
+		t.Errorf("Count() after a panic = %d, want 0", n)
+	}
+}
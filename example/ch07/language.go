@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LanguageMiddlewareは、既定のテンプレートのある言語からリクエストの言語を決めるLanguagePreferenceMiddleware。
+// どれも当てはまらなければ何も入れず、Greeterの既定の言語になる。
+func LanguageMiddleware(next http.Handler) http.Handler {
+	return LanguagePreferenceMiddleware(defaultGreeter.Supports, "", next)
+}
+
+// LanguagePreferenceMiddlewareは、リクエストの言語をresolveLanguageで一度だけ決めて、リクエストのcontextに入れる。LanguageFromContextで取り出せる。
+// supportsは挨拶できる言語かを返す関数で、defはほかの言語が決まらなかったときの言語。defが空なら何も入れない。
+func LanguagePreferenceMiddleware(supports func(lang string) bool, def string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lang := resolveLanguage(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"), supports, def); lang != "" {
+			r = r.WithContext(ContextWithLanguage(r.Context(), lang))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resolveLanguageは、langクエリ、Accept-Languageヘッダ、defの順に、supportsが挨拶できるという言語を探して、その主タグ（"en"）を返す。
+// 挨拶できない言語が指定されていたら、次の指定に進む。Accept-Languageはq値の高いものから、同じq値なら先に書いたものから試す。
+// どれもなければdefの主タグを返す。
+func resolveLanguage(query, acceptLanguage string, supports func(lang string) bool, def string) string {
+	if lang := baseLanguage(query); lang != "" && supports(lang) {
+		return lang
+	}
+	for _, lang := range acceptedLanguages(acceptLanguage) {
+		if supports(lang) {
+			return lang
+		}
+	}
+	return baseLanguage(def)
+}
+
+// acceptedLanguagesは、"fr;q=0.5, en-US, *;q=0.1"のようなAccept-Languageヘッダの言語の主タグを、q値の高い順に並べて返す。
+// q=0の言語は受け付けないという意味なので除く。"*"は特定の言語ではないので除く。q値が読めなければ1として扱う。
+func acceptedLanguages(header string) []string {
+	type accepted struct {
+		lang string
+		q    float64
+	}
+	var langs []accepted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		lang := baseLanguage(tag)
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, accepted{lang: lang, q: q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	out := make([]string, 0, len(langs))
+	for _, a := range langs {
+		out = append(out, a.lang)
+	}
+	return out
+}
+
+// ContextWithLanguageは、挨拶に使う言語をlangにしたctxを返す。HTTPのリクエスト以外からLogicを呼ぶときに使う。
+func ContextWithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey, lang)
+}
+
+// LanguageFromContextは、LanguageMiddlewareかContextWithLanguageがctxに入れた言語を取り出す。
+// なければ空文字列を返し、Greeterは既定の言語を使う。
+func LanguageFromContext(ctx context.Context) string {
+	lang, _ := ctx.Value(languageKey).(string)
+	return lang
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ミドルウェアで一度決めた言語は、CachingLogicを通ってFormatterまで届く
+func TestLanguageFlowsToFormatter(t *testing.T) {
+	ds := NewSimpleDataStore()
+	logic := NewCachingLogic(NewSimpleLogic(&MemoryLogger{}, ds, DefaultConfig()), 10)
+	h := newTestHandler(t, NewController(&MemoryLogger{}, logic, ds))
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		want           string
+	}{
+		{"query", "&lang=en", "", "Hello, Fred"},
+		{"accept-language", "", "en-US,en;q=0.9", "Hello, Fred"},
+		{"query wins", "&lang=ja", "en", "Fredさん　こんにちは。"},
+		{"unsupported query", "&lang=fr", "en", "Hello, Fred"},
+		{"nothing", "", "", "Fredさん　こんにちは。"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/hello?user_id=1"+tt.query, nil)
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// langクエリ、Accept-Language、既定の言語の順に、挨拶できる言語を選ぶ。Accept-Languageはq値の高いものから試す。
+func TestResolveLanguage(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		acceptLanguage string
+		def            string
+		want           string
+	}{
+		{"query over header", "en-US", "ja", "ja", "en"},
+		{"unsupported query falls through", "fr", "en", "ja", "en"},
+		{"highest supported q", "", "fr;q=0.9, ja;q=0.5, en;q=0.8", "ja", "en"},
+		{"q order, not written order", "", "ja;q=0.2, en-US;q=0.7", "", "en"},
+		{"same q keeps written order", "", "ja, en", "", "ja"},
+		{"q=0 and wildcard are skipped", "", "en;q=0, *;q=0.5", "ja-JP", "ja"},
+		{"default", "", "", "EN", "en"},
+		{"nothing matches", "de", "fr", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveLanguage(tt.query, tt.acceptLanguage, defaultGreeter.Supports, tt.def); got != tt.want {
+				t.Errorf("resolveLanguage(%q, %q, %q) = %q, want %q", tt.query, tt.acceptLanguage, tt.def, got, tt.want)
+			}
+		})
+	}
+}
+
+// WithLanguagesで渡した既定の言語は、挨拶できない言語を指定したリクエストに使われる
+func TestHandlerDefaultLanguage(t *testing.T) {
+	ds := NewSimpleDataStore()
+	c := NewController(&MemoryLogger{}, NewSimpleLogic(&MemoryLogger{}, ds, DefaultConfig()), ds, WithLanguages(defaultGreeter.Supports, "en"))
+	h := newTestHandler(t, c)
+	if got := send(h, http.MethodGet, "/v1/hello?user_id=1&lang=fr", nil).Body.String(); got != "Hello, Fred" {
+		t.Errorf("got %q, want the greeting in the default language", got)
+	}
+}
+
+// 言語を入れていないcontextからは空文字列が返る
+func TestLanguageFromContextEmpty(t *testing.T) {
+	if got := LanguageFromContext(context.Background()); got != "" {
+		t.Errorf("LanguageFromContext = %q, want empty", got)
+	}
+	if got := LanguageFromContext(ContextWithLanguage(context.Background(), "en")); got != "en" {
+		t.Errorf("LanguageFromContext = %q, want en", got)
+	}
+}
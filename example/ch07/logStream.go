@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logStreamBufferは、購読者ごとのチャネルにためておけるメッセージの数。
+// 読むのが遅い購読者のためにログを書く側が待たされないように、あふれたメッセージは捨てる。
+const logStreamBuffer = 64
+
+// FanoutLoggerは、包んだLoggerに書き込むと同時に、購読している全てのチャネルにもメッセージを送るLogger。
+// ServeHTTPで、メッセージをServer-Sent Eventsとして流す。
+type FanoutLogger struct {
+	l Logger
+
+	mu   sync.Mutex
+	subs map[chan string]struct{}
+}
+
+// NewFanoutLoggerは、lに書き込みつつ購読者にも送るFanoutLoggerを生成するファクトリ関数
+func NewFanoutLogger(l Logger) *FanoutLogger {
+	return &FanoutLogger{
+		l:    l,
+		subs: map[chan string]struct{}{},
+	}
+}
+
+func (fl *FanoutLogger) Log(message string) {
+	fl.l.Log(message)
+	fl.publish(message)
+}
+
+// Logfは、包んだLoggerと同じく"[INFO] "のような接頭辞を付けて購読者に送る
+func (fl *FanoutLogger) Logf(level Level, format string, args ...any) {
+	fl.l.Logf(level, format, args...)
+	fl.publish("[" + level.String() + "] " + fmt.Sprintf(format, args...))
+}
+
+func (fl *FanoutLogger) publish(message string) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	for ch := range fl.subs {
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+}
+
+// Subscribeは、これから記録されるメッセージを受け取るチャネルを返す。
+// 受け取り終わったら、返された関数を呼んで購読をやめること。
+func (fl *FanoutLogger) Subscribe() (<-chan string, func()) {
+	ch := make(chan string, logStreamBuffer)
+	fl.mu.Lock()
+	fl.subs[ch] = struct{}{}
+	fl.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			fl.mu.Lock()
+			delete(fl.subs, ch)
+			fl.mu.Unlock()
+		})
+	}
+}
+
+// ServeHTTPは、クライアントが切断するまで、記録されたメッセージを1つずつServer-Sent Eventsのイベントとして書き込む
+func (fl *FanoutLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "ストリーミングできません", http.StatusInternalServerError)
+		return
+	}
+	// ストリームはサーバーのWriteTimeoutより長く続くので、このリクエストだけ書き込みの期限を外す。
+	// 期限を変えられないResponseWriterなら、WriteTimeoutで切れるまで流す。
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	ch, unsubscribe := fl.Subscribe()
+	defer unsubscribe()
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case message := <-ch:
+			// 改行を含むメッセージは、行ごとにdata:を付けて1つのイベントにする
+			for _, line := range strings.Split(message, "\n") {
+				fmt.Fprintf(w, "data: %s\n", line)
+			}
+			fmt.Fprint(w, "\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFanoutLoggerSubscribe(t *testing.T) {
+	base := &MemoryLogger{}
+	fl := NewFanoutLogger(base)
+	ch, unsubscribe := fl.Subscribe()
+	fl.Logf(LevelWarn, "disk %d%% full", 90)
+	if got := <-ch; got != "[WARN] disk 90% full" {
+		t.Errorf("received %q, want [WARN] disk 90%% full", got)
+	}
+	if msgs := base.Messages(); len(msgs) != 1 {
+		t.Errorf("wrapped logger got %q, want the message too", msgs)
+	}
+
+	unsubscribe()
+	fl.Log("after unsubscribe")
+	select {
+	case got := <-ch:
+		t.Errorf("received %q after unsubscribing", got)
+	default:
+	}
+}
+
+// /logs/streamに繋いだクライアントに、記録したメッセージがイベントとして届き、切断したら購読をやめる
+func TestFanoutLoggerServesEvents(t *testing.T) {
+	fl := NewFanoutLogger(&MemoryLogger{})
+	srv := httptest.NewServer(fl)
+	defer srv.Close()
+
+	// ヘッダを返す前に購読するので、Getが戻った後のメッセージは全て届く
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	fl.Log("a\nb")
+	r := bufio.NewReader(resp.Body)
+	for _, want := range []string{"data: a\n", "data: b\n", "\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil || line != want {
+			t.Fatalf("read %q, %v; want %q", line, err, want)
+		}
+	}
+
+	resp.Body.Close()
+	deadline := time.Now().Add(time.Second)
+	for subscribers(fl) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the subscriber was not removed after the client disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// subscribersは、flを今購読しているチャネルの数を返す
+func subscribers(fl *FanoutLogger) int {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	return len(fl.subs)
+}
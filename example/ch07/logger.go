@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Levelは、ログの重要度
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Stringは、"INFO"のようなレベル名を返す
+func (lv Level) String() string {
+	switch lv {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(lv)) + ")"
+}
+
+// ParseLevelは、"info"や"WARN"のようなレベル名をLevelにする。大文字と小文字は区別しない。
+func ParseLevel(name string) (Level, error) {
+	for lv := LevelDebug; lv <= LevelError; lv++ {
+		if strings.EqualFold(name, lv.String()) {
+			return lv, nil
+		}
+	}
+	return 0, fmt.Errorf("不明なログレベル: %q", name)
+}
+
+// UnmarshalTextは、設定ファイルに"debug"のようにレベル名で書けるようにする
+func (lv *Level) UnmarshalText(text []byte) error {
+	parsed, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*lv = parsed
+	return nil
+}
+
+// Config.LogFormatに指定できる、ログの形式
+const (
+	// LogFormatTextは、WriterLoggerで1行に1つのメッセージを書く
+	LogFormatText = "text"
+	// LogFormatJSONは、JSONLoggerで1行に1つのJSONオブジェクトを書く
+	LogFormatJSON = "json"
+)
+
+// ログファイルの設定。今は設定ファイルで変えられないので、ここで決めておく。
+const (
+	logFileMaxBytes   = 10 << 20
+	logFileMaxBackups = 5
+)
+
+// NewLoggerFromConfigは、cfg.LogFormatの形式で標準出力に書き、cfg.LogLevelより低いレベルを捨てるLoggerを生成するファクトリ関数。
+// cfg.LogFileがあれば、標準出力ではなくそのファイルにRotatingFileLoggerで書く。
+// 知らない形式なら設定の間違いなので、Loggerを返さずにエラーを返す。
+// ファイルを開けなければ、ログをなくしてサーバーが起動できなくなるよりはよいので、標準出力に書くLoggerと一緒に開けなかったエラーを返す。
+// 呼び出し元は、そのエラーを警告としてログに書いて続ければよい。
+func NewLoggerFromConfig(cfg Config) (Logger, error) {
+	newLogger := func(w io.Writer) Logger { return NewWriterLogger(w) }
+	switch cfg.LogFormat {
+	case "", LogFormatText:
+	case LogFormatJSON:
+		newLogger = func(w io.Writer) Logger { return NewJSONLogger(w) }
+	default:
+		return nil, fmt.Errorf("不明なログの形式: %q", cfg.LogFormat)
+	}
+	stdout := LeveledLogger{Logger: newLogger(os.Stdout), MinLevel: cfg.LogLevel}
+	if cfg.LogFile == "" {
+		return stdout, nil
+	}
+	rl, err := NewRotatingFileLogger(cfg.LogFile, logFileMaxBytes, logFileMaxBackups)
+	if err != nil {
+		return stdout, fmt.Errorf("log_fileを開けないので標準出力に書きます: %w", err)
+	}
+	return LeveledLogger{Logger: newLogger(rl), MinLevel: cfg.LogLevel}, nil
+}
+
+// LeveledLoggerは、MinLevelより低いレベルのメッセージを捨ててから、Loggerに渡すLogger。
+// レベルのないLogはLevelInfoとして扱う。
+type LeveledLogger struct {
+	Logger   Logger
+	MinLevel Level
+}
+
+func (ll LeveledLogger) Log(message string) {
+	if LevelInfo < ll.MinLevel {
+		return
+	}
+	ll.Logger.Log(message)
+}
+
+func (ll LeveledLogger) Logf(level Level, format string, args ...any) {
+	if level < ll.MinLevel {
+		return
+	}
+	ll.Logger.Logf(level, format, args...)
+}
+
+// SafeLoggerは、包んだLoggerがパニックしても、それを呼び出し元に伝えないLogger。
+// ログを書けなかったことは標準エラー出力に書き、ログを書こうとした処理はそのまま続けられる。
+type SafeLogger struct {
+	l Logger
+}
+
+// NewSafeLoggerは、lのパニックを抑えるSafeLoggerを生成するファクトリ関数。
+// lが既にSafeLoggerなら、そのまま返す。
+func NewSafeLogger(l Logger) SafeLogger {
+	if sl, ok := l.(SafeLogger); ok {
+		return sl
+	}
+	return SafeLogger{l: l}
+}
+
+func (sl SafeLogger) Log(message string) {
+	defer sl.recover()
+	sl.l.Log(message)
+}
+
+func (sl SafeLogger) Logf(level Level, format string, args ...any) {
+	defer sl.recover()
+	sl.l.Logf(level, format, args...)
+}
+
+func (sl SafeLogger) recover() {
+	if v := recover(); v != nil {
+		fmt.Fprintf(os.Stderr, "ログを書けません: %v\n", v)
+	}
+}
+
+// MultiLoggerは、全てのLoggerに同じメッセージを書き込むLogger。
+// 標準出力とファイルのように、複数の場所に同時にログを書くときに使う。
+// それぞれのLoggerはSafeLoggerで包むので、1つがパニックしても残りには書き込まれる。
+type MultiLogger struct {
+	ls []SafeLogger
+}
+
+// NewMultiLoggerは、lsの全てに書き込むMultiLoggerを生成するファクトリ関数
+func NewMultiLogger(ls ...Logger) MultiLogger {
+	ml := MultiLogger{ls: make([]SafeLogger, 0, len(ls))}
+	for _, l := range ls {
+		ml.ls = append(ml.ls, NewSafeLogger(l))
+	}
+	return ml
+}
+
+func (ml MultiLogger) Log(message string) {
+	for _, l := range ml.ls {
+		l.Log(message)
+	}
+}
+
+func (ml MultiLogger) Logf(level Level, format string, args ...any) {
+	for _, l := range ml.ls {
+		l.Logf(level, format, args...)
+	}
+}
+
+// MemoryLoggerは、メッセージを標準出力に出さずにメモリに貯めておくLogger。
+// 何がログに記録されたかを確かめられるので、テストではこれを使うとよい。ゼロ値で使える。
+type MemoryLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (ml *MemoryLogger) Log(message string) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.messages = append(ml.messages, message)
+}
+
+// Logfは、LoggerAdapterと同じく"[INFO] "のような接頭辞を付けて記録する
+func (ml *MemoryLogger) Logf(level Level, format string, args ...any) {
+	ml.Log("[" + level.String() + "] " + fmt.Sprintf(format, args...))
+}
+
+// Messagesは、これまでに記録されたメッセージのコピーを返す
+func (ml *MemoryLogger) Messages() []string {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	return append([]string(nil), ml.messages...)
+}
+
+// WriterLoggerは、1行に1つのメッセージをio.Writerに書き込むLogger。
+// 複数のゴルーチンから同時に使ってもよい。
+type WriterLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterLoggerは、wに書き込むWriterLoggerを生成するファクトリ関数。
+// テストでは*bytes.Buffer、本番では*os.Fileなどを渡す。
+func NewWriterLogger(w io.Writer) *WriterLogger {
+	return &WriterLogger{w: w}
+}
+
+func (wl *WriterLogger) Log(message string) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	io.WriteString(wl.w, message+"\n")
+}
+
+// Logfは、LoggerAdapterと同じく"[INFO] "のような接頭辞を付けて書き込む
+func (wl *WriterLogger) Logf(level Level, format string, args ...any) {
+	wl.Log("[" + level.String() + "] " + fmt.Sprintf(format, args...))
+}
+
+// JSONLoggerは、1行に1つ、timestamp、level、messageを持ったJSONオブジェクトを書き込むLogger。
+// レベルのないLogはLevelInfoとして書き込む。
+type JSONLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLoggerは、wに書き込むJSONLoggerを生成するファクトリ関数
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{w: w}
+}
+
+// jsonLogEntryは、JSONLoggerが書き込む1行
+type jsonLogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+}
+
+func (jl *JSONLogger) Log(message string) {
+	jl.write(LevelInfo, message)
+}
+
+func (jl *JSONLogger) Logf(level Level, format string, args ...any) {
+	jl.write(level, fmt.Sprintf(format, args...))
+}
+
+func (jl *JSONLogger) write(level Level, message string) {
+	data, err := json.Marshal(jsonLogEntry{
+		Timestamp: time.Now(),
+		Level:     level.String(),
+		Message:   message,
+	})
+	if err != nil {
+		return
+	}
+	jl.mu.Lock()
+	defer jl.mu.Unlock()
+	jl.w.Write(append(data, '\n'))
+}
+
+// escapeForLogは、改行などの制御文字を"\n"のようにエスケープする。
+// 利用者が送ってきた値をログに書くときに使い、偽のログ行を差し込まれないようにする。
+func escapeForLog(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			q := strconv.QuoteRune(r)
+			b.WriteString(q[1 : len(q)-1])
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
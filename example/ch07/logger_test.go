@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MemoryLoggerは、Controllerのテストで記録されたメッセージを確かめるためのテストダブルとして使う
+func TestMemoryLoggerRecordsSayHello(t *testing.T) {
+	c, _, l := newTestController()
+	send(http.HandlerFunc(c.SayHello), http.MethodGet, "/hello?user_id=1", nil)
+	if !containsMessage(l.Messages(), "SayHello(1)") {
+		t.Errorf("log = %q, want it to contain SayHello(1)", l.Messages())
+	}
+}
+
+// 複数のゴルーチンから同時に記録しても、すべてのメッセージが残ることを確かめる
+func TestMemoryLoggerConcurrent(t *testing.T) {
+	const n = 50
+	l := &MemoryLogger{}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l.Log(strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+	msgs := l.Messages()
+	if len(msgs) != n {
+		t.Fatalf("len(Messages()) = %d, want %d", len(msgs), n)
+	}
+	msgs[0] = "changed"
+	if l.Messages()[0] == "changed" {
+		t.Error("Messages() returned the internal slice, want a copy")
+	}
+}
+
+// containsMessageは、msgsのどれかがwantを含んでいればtrueを返す
+func containsMessage(msgs []string, want string) bool {
+	for _, m := range msgs {
+		if strings.Contains(m, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEscapeForLog(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Fred", "Fred"},
+		{"a\nb", `a\nb`},
+		{"a\r\nb\x00c", `a\r\nb\x00c`},
+		{"山田　太郎", "山田　太郎"},
+	}
+	for _, tt := range tests {
+		if got := escapeForLog(tt.in); got != tt.want {
+			t.Errorf("escapeForLog(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// JSONLoggerが書いた行を、jsonLogEntryに読み戻せることを確かめる
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	jl := NewJSONLogger(&buf)
+	before := time.Now()
+	jl.Logf(LevelWarn, "disk %d%% full", 90)
+	jl.Log("plain")
+
+	dec := json.NewDecoder(&buf)
+	want := []jsonLogEntry{
+		{Level: "WARN", Message: "disk 90% full"},
+		{Level: "INFO", Message: "plain"},
+	}
+	for _, w := range want {
+		var got jsonLogEntry
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("decoding a log line: %v", err)
+		}
+		if got.Level != w.Level || got.Message != w.Message {
+			t.Errorf("got %+v, want level %s and message %q", got, w.Level, w.Message)
+		}
+		if got.Timestamp.Before(before.Truncate(time.Second)) {
+			t.Errorf("timestamp %v is before the call at %v", got.Timestamp, before)
+		}
+	}
+	if dec.More() {
+		t.Error("JSONLogger wrote more lines than messages")
+	}
+}
+
+func TestWriterLogger(t *testing.T) {
+	var buf bytes.Buffer
+	wl := NewWriterLogger(&buf)
+	wl.Log("SayHello(1)")
+	wl.Logf(LevelError, "lookup failed: %v", "timeout")
+	if want := "SayHello(1)\n[ERROR] lookup failed: timeout\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+// 複数のゴルーチンから書き込んでも、行が混ざらない
+func TestWriterLoggerConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	wl := NewWriterLogger(&buf)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wl.Log("line")
+		}()
+	}
+	wg.Wait()
+	if want := strings.Repeat("line\n", 50); buf.String() != want {
+		t.Errorf("output has %d bytes, want 50 whole lines", buf.Len())
+	}
+}
+
+// panicLoggerは、書き込むたびにパニックするLogger
+type panicLogger struct{}
+
+func (panicLogger) Log(string)                 { panic("disk full") }
+func (panicLogger) Logf(Level, string, ...any) { panic("disk full") }
+
+// 挨拶のログを書くLoggerがパニックしても、挨拶は200で返る
+func TestControllerSurvivesPanickingLogger(t *testing.T) {
+	ds := NewSimpleDataStore()
+	c := NewController(panicLogger{}, NewSimpleLogic(panicLogger{}, ds, DefaultConfig()), ds)
+	w := send(LoggingMiddleware(c.l, http.HandlerFunc(c.SayHello)), http.MethodGet, "/hello?user_id=1", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "Fredさん　こんにちは。" {
+		t.Errorf("got %d %q, want 200 and the greeting", w.Code, w.Body.String())
+	}
+}
+
+// MultiLoggerは、1つのLoggerがパニックしても残りに書き込む
+func TestMultiLoggerSkipsPanickingLogger(t *testing.T) {
+	ml := &MemoryLogger{}
+	NewMultiLogger(panicLogger{}, ml).Log("hello")
+	if !containsMessage(ml.Messages(), "hello") {
+		t.Errorf("messages = %v, want hello", ml.Messages())
+	}
+	if sl := NewSafeLogger(panicLogger{}); NewSafeLogger(sl) != sl {
+		t.Error("NewSafeLogger wrapped a SafeLogger again")
+	}
+}
+
+// NewLoggerFromConfigは、形式ごとに決まった型のLoggerを、レベルで絞るLeveledLoggerで包んで返す
+func TestNewLoggerFromConfig(t *testing.T) {
+	tests := []struct {
+		format string
+		want   Logger
+	}{
+		{"", &WriterLogger{}},
+		{LogFormatText, &WriterLogger{}},
+		{LogFormatJSON, &JSONLogger{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			l, err := NewLoggerFromConfig(Config{LogFormat: tt.format, LogLevel: LevelWarn})
+			if err != nil {
+				t.Fatalf("NewLoggerFromConfig: %v", err)
+			}
+			ll, ok := l.(LeveledLogger)
+			if !ok || ll.MinLevel != LevelWarn {
+				t.Fatalf("got %#v, want a LeveledLogger at LevelWarn", l)
+			}
+			if got, want := fmt.Sprintf("%T", ll.Logger), fmt.Sprintf("%T", tt.want); got != want {
+				t.Errorf("inner logger is %s, want %s", got, want)
+			}
+		})
+	}
+	if l, err := NewLoggerFromConfig(Config{LogFormat: "xml"}); err == nil || l != nil {
+		t.Errorf("unknown format: got %v, %v; want nil and an error", l, err)
+	}
+	cfg := DefaultConfig()
+	cfg.LogFormat = "xml"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "log_format") {
+		t.Errorf("Validate with an unknown log format: err = %v, want a log_format error", err)
+	}
+}
+
+// ログのファイルを開けなければ、標準出力に書くLoggerを開けなかったエラーと一緒に返し、Buildはそのまま続ける
+func TestNewLoggerFromConfigFallback(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "missing", "app.log")
+	l, err := NewLoggerFromConfig(Config{LogFile: bad, LogLevel: LevelWarn})
+	if !errors.Is(err, os.ErrNotExist) || l == nil {
+		t.Fatalf("got %v, %v; want a logger and os.ErrNotExist", l, err)
+	}
+	ll, ok := l.(LeveledLogger)
+	if !ok || ll.MinLevel != LevelWarn {
+		t.Fatalf("got %#v, want a LeveledLogger at LevelWarn", l)
+	}
+	if wl, ok := ll.Logger.(*WriterLogger); !ok || wl.w != os.Stdout {
+		t.Errorf("inner logger is %#v, want a WriterLogger on stdout", ll.Logger)
+	}
+
+	good := filepath.Join(t.TempDir(), "app.log")
+	l, err = NewLoggerFromConfig(Config{LogFile: good, LogFormat: LogFormatJSON})
+	if err != nil {
+		t.Fatalf("NewLoggerFromConfig: %v", err)
+	}
+	l.Logf(LevelInfo, "hi")
+	if data, _ := os.ReadFile(good); !strings.Contains(string(data), `"message":"hi"`) {
+		t.Errorf("log file = %q, want the JSON line", data)
+	}
+
+	cfg := DefaultConfig()
+	cfg.LogLevel = LevelError
+	cfg.LogFile = bad
+	app, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build with an unwritable log file: %v", err)
+	}
+	app.Close()
+}
+
+// MultiLoggerは、LogとLogfのどちらも全てのLoggerに届ける
+func TestMultiLoggerDeliversToAll(t *testing.T) {
+	a, b := &MemoryLogger{}, &MemoryLogger{}
+	ml := NewMultiLogger(a, panicLogger{}, b)
+	ml.Log("hello")
+	ml.Logf(LevelWarn, "x=%d", 1)
+	want := []string{"hello", "[WARN] x=1"}
+	for i, m := range []*MemoryLogger{a, b} {
+		if got := m.Messages(); !reflect.DeepEqual(got, want) {
+			t.Errorf("logger %d got %v, want %v", i, got, want)
+		}
+	}
+}
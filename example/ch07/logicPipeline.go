@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// LogicStepは、nextを包んで処理を付け足したLogicを返す関数。
+// ミドルウェアと同じように、ComposeLogicで重ねて使う。
+type LogicStep func(next Logic) Logic
+
+// ComposeLogicは、baseをstepsで包んだLogicを返す。
+// Chainと同じく、最初に渡したstepが一番外側になり、最初に呼ばれる。
+func ComposeLogic(base Logic, steps ...LogicStep) Logic {
+	logic := base
+	for i := len(steps) - 1; i >= 0; i-- {
+		logic = steps[i](logic)
+	}
+	return logic
+}
+
+// UppercaseStepは、挨拶の文を大文字にするLogicStep。
+// 大文字のない日本語のテンプレートでは、名前だけが大文字になる。
+func UppercaseStep(next Logic) Logic {
+	return uppercaseLogic{next: next}
+}
+
+// uppercaseLogicは、UppercaseStepが返すLogic
+type uppercaseLogic struct {
+	next Logic
+}
+
+func (ul uppercaseLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	message, err := ul.next.SayHello(ctx, userID)
+	return strings.ToUpper(message), err
+}
+
+func (ul uppercaseLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	message, err := ul.next.SayGoodbye(ctx, userID)
+	return strings.ToUpper(message), err
+}
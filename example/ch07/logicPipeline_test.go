@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// recordingLogicは、SayHelloが呼ばれた順にnameを記録するLogic
+type recordingLogic struct {
+	Logic
+	name  string
+	order *[]string
+}
+
+func (rl recordingLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	*rl.order = append(*rl.order, rl.name)
+	return rl.Logic.SayHello(ctx, userID)
+}
+
+func TestComposeLogicUppercase(t *testing.T) {
+	var order []string
+	record := func(name string) LogicStep {
+		return func(next Logic) Logic { return recordingLogic{next, name, &order} }
+	}
+	base := NewSimpleLogic(&MemoryLogger{}, NewSimpleDataStore(), DefaultConfig())
+	logic := ComposeLogic(base, record("outer"), UppercaseStep, record("inner"))
+
+	got, err := logic.SayHello(ContextWithLanguage(context.Background(), "en"), "1")
+	if err != nil || got != "HELLO, FRED" {
+		t.Errorf("SayHello = %q, %v; want HELLO, FRED", got, err)
+	}
+	if want := []string{"outer", "inner"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("steps ran in order %v, want %v", order, want)
+	}
+	// 日本語のテンプレートでは名前だけが大文字になり、元のLogicは変わらない
+	if got, _ := logic.SayHello(context.Background(), "1"); got != "FREDさん　こんにちは。" {
+		t.Errorf("ja SayHello = %q", got)
+	}
+	if got, _ := base.SayHello(context.Background(), "1"); got != "Fredさん　こんにちは。" {
+		t.Errorf("base SayHello = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaintenanceMessageは、Config.MaintenanceMessageが空のときにメンテナンス中のリクエストに返すメッセージ
+const defaultMaintenanceMessage = "メンテナンス中です。しばらくしてからもう一度お試しください。"
+
+// MaintenanceModeは、サーバーがメンテナンス中かどうか。複数のゴルーチンから同時に使ってもよい。
+type MaintenanceMode struct {
+	on         atomic.Bool
+	message    string
+	retryAfter time.Duration
+	l          Logger
+}
+
+// NewMaintenanceModeは、メンテナンス中のリクエストにmessageとretryAfterのRetry-Afterヘッダを返すMaintenanceModeを生成するファクトリ関数。
+// messageが空ならdefaultMaintenanceMessageを使い、retryAfterが0以下ならRetry-Afterヘッダを返さない。メンテナンス中ではない状態で始まる。
+func NewMaintenanceMode(message string, retryAfter time.Duration, l Logger) *MaintenanceMode {
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	return &MaintenanceMode{message: message, retryAfter: retryAfter, l: l}
+}
+
+// Enabledは、メンテナンス中かを返す
+func (mm *MaintenanceMode) Enabled() bool {
+	return mm.on.Load()
+}
+
+// Setは、onならメンテナンス中にし、そうでなければメンテナンスを終える。状態が変わったときだけログに書く。
+func (mm *MaintenanceMode) Set(on bool) {
+	if !mm.on.CompareAndSwap(!on, on) {
+		return
+	}
+	if on {
+		mm.l.Logf(LevelWarn, "maintenance: メンテナンスを始めました")
+		return
+	}
+	mm.l.Logf(LevelInfo, "maintenance: メンテナンスを終えました")
+}
+
+// MaintenanceMiddlewareは、メンテナンス中なら、/admin/以下と/healthz、/metrics、/metrics.json以外のリクエストをnextに渡さずに503にする。
+// 運用のための管理用のルートと死活監視、メトリクスの収集は、メンテナンス中も使える。
+func MaintenanceMiddleware(mm *MaintenanceMode, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !mm.Enabled() || maintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if mm.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(mm.retryAfter.Seconds()))))
+		}
+		http.Error(w, mm.message, http.StatusServiceUnavailable)
+	})
+}
+
+// maintenanceExemptは、pathがメンテナンス中も使えるルートかを返す
+func maintenanceExempt(path string) bool {
+	switch path {
+	case "/healthz", "/metrics", "/metrics.json":
+		return true
+	}
+	return strings.HasPrefix(path, "/admin/")
+}
+
+// maintenanceStateは、/admin/maintenanceが受け取って返すJSON
+type maintenanceState struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Maintenanceは、GET /admin/maintenanceでメンテナンス中かを返し、
+// POST /admin/maintenanceで{"enabled": true}のようなボディに合わせてメンテナンスを始めたり終えたりする
+func (c Controller) Maintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+	if c.maintenance == nil {
+		c.writeError(w, http.StatusNotImplemented, "メンテナンスの切り替えができません")
+		return
+	}
+	if r.Method == http.MethodPost {
+		var state maintenanceState
+		if !c.decodeBody(w, r, &state) {
+			return
+		}
+		c.maintenance.Set(state.Enabled)
+	}
+	writeJSON(w, http.StatusOK, maintenanceState{Enabled: c.maintenance.Enabled()})
+}
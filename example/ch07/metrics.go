@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBucketsは、処理時間のヒストグラムのバケットの上限（秒）
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Metricsは、リクエストの数、ステータスコードごとのレスポンスの数、処理時間のヒストグラムを数える。
+// LookupRecorderとして、データストアの検索の回数、エラーの回数、時間の合計も数える。
+// ServeHTTPでPrometheusのテキスト形式で、MetricsJSONHandlerでJSONで書き出す。
+type Metrics struct {
+	mu           sync.Mutex
+	requests     int
+	byStatus     map[int]int
+	bucketCounts []int
+	latencySum   float64
+
+	lookups          int
+	lookupErrors     int
+	lookupLatencySum float64
+}
+
+// NewMetricsは、空のMetricsを生成するファクトリ関数
+func NewMetrics() *Metrics {
+	return &Metrics{
+		byStatus:     map[int]int{},
+		bucketCounts: make([]int, len(latencyBuckets)),
+	}
+}
+
+// observeは、1回のリクエストを記録する
+func (m *Metrics) observe(status int, d time.Duration) {
+	sec := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	m.byStatus[status]++
+	m.latencySum += sec
+	for i, le := range latencyBuckets {
+		if sec <= le {
+			m.bucketCounts[i]++
+		}
+	}
+}
+
+// RequestCountは、これまでに記録したリクエストの数を返す
+func (m *Metrics) RequestCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requests
+}
+
+// ObserveLookupは、データストアの検索1回を記録する
+func (m *Metrics) ObserveLookup(dur time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lookups++
+	if err != nil {
+		m.lookupErrors++
+	}
+	m.lookupLatencySum += dur.Seconds()
+}
+
+// metricsSnapshotは、ある時点のMetricsの値のコピー。
+// テキスト形式とJSONの両方をここから書き出すので、2つの形式の値がずれることはない。
+type metricsSnapshot struct {
+	Requests         int            `json:"requests"`
+	ByStatus         map[string]int `json:"responses_by_status"`
+	Buckets          []latencyCount `json:"latency_buckets"`
+	LatencySum       float64        `json:"latency_sum_seconds"`
+	Lookups          int            `json:"lookups"`
+	LookupErrors     int            `json:"lookup_errors"`
+	LookupLatencySum float64        `json:"lookup_latency_sum_seconds"`
+	// Usersは、ユーザーの数。数えられないデータストアなら省く。
+	Users *int `json:"users,omitempty"`
+}
+
+// latencyCountは、処理時間がLE秒以下だったリクエストの数
+type latencyCount struct {
+	LE    float64 `json:"le"`
+	Count int     `json:"count"`
+}
+
+// snapshotは、今の値のコピーを返す
+func (m *Metrics) snapshot() metricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := metricsSnapshot{
+		Requests:         m.requests,
+		ByStatus:         make(map[string]int, len(m.byStatus)),
+		Buckets:          make([]latencyCount, len(latencyBuckets)),
+		LatencySum:       m.latencySum,
+		Lookups:          m.lookups,
+		LookupErrors:     m.lookupErrors,
+		LookupLatencySum: m.lookupLatencySum,
+	}
+	for code, n := range m.byStatus {
+		snap.ByStatus[strconv.Itoa(code)] = n
+	}
+	for i, le := range latencyBuckets {
+		snap.Buckets[i] = latencyCount{LE: le, Count: m.bucketCounts[i]}
+	}
+	return snap
+}
+
+// ServeHTTPは、これまでの値をPrometheusのテキスト形式で書き出す
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snap := m.snapshot()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	fmt.Fprintf(w, "http_requests_total %d\n", snap.Requests)
+	fmt.Fprintln(w, "# TYPE http_responses_total counter")
+	codes := make([]string, 0, len(snap.ByStatus))
+	for code := range snap.ByStatus {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "http_responses_total{code=\"%s\"} %d\n", code, snap.ByStatus[code])
+	}
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+	for _, b := range snap.Buckets {
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{le=\"%s\"} %d\n",
+			strconv.FormatFloat(b.LE, 'g', -1, 64), b.Count)
+	}
+	fmt.Fprintf(w, "http_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", snap.Requests)
+	fmt.Fprintf(w, "http_request_duration_seconds_sum %s\n", strconv.FormatFloat(snap.LatencySum, 'g', -1, 64))
+	fmt.Fprintf(w, "http_request_duration_seconds_count %d\n", snap.Requests)
+	fmt.Fprintln(w, "# TYPE datastore_lookups_total counter")
+	fmt.Fprintf(w, "datastore_lookups_total %d\n", snap.Lookups)
+	fmt.Fprintln(w, "# TYPE datastore_lookup_errors_total counter")
+	fmt.Fprintf(w, "datastore_lookup_errors_total %d\n", snap.LookupErrors)
+	fmt.Fprintln(w, "# TYPE datastore_lookup_duration_seconds_sum counter")
+	fmt.Fprintf(w, "datastore_lookup_duration_seconds_sum %s\n", strconv.FormatFloat(snap.LookupLatencySum, 'g', -1, 64))
+}
+
+// MetricsJSONHandlerは、mのServeHTTPと同じ値をJSONで書き出すハンドラを返す。
+// dsがCounterなら、ユーザーの数も書き出す。
+func MetricsJSONHandler(m *Metrics, ds DataStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snap := m.snapshot()
+		if counter, ok := ds.(Counter); ok {
+			n := counter.UserCount()
+			snap.Users = &n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snap)
+	})
+}
+
+// MetricsMiddlewareは、全てのリクエストのステータスコードと処理時間をmに記録する
+func MetricsMiddleware(m *Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+		m.observe(sr.status, time.Since(start))
+	})
+}
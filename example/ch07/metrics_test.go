@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// 何回かリクエストした後の/metricsに、リクエストの総数とステータスコードごとの数が出ることを確かめる
+func TestMetricsMiddlewareCounts(t *testing.T) {
+	c, _, _ := newTestController()
+	m := NewMetrics()
+	h := MetricsMiddleware(m, http.HandlerFunc(c.SayHello))
+	for _, target := range []string{"/hello?user_id=1", "/hello?user_id=2", "/hello?user_id=99"} {
+		send(h, http.MethodGet, target, nil)
+	}
+	if n := m.RequestCount(); n != 3 {
+		t.Errorf("RequestCount() = %d, want 3", n)
+	}
+
+	body := send(m, http.MethodGet, "/metrics", nil).Body.String()
+	for _, want := range []string{
+		"http_requests_total 3\n",
+		`http_responses_total{code="200"} 2` + "\n",
+		`http_responses_total{code="404"} 1` + "\n",
+		`http_request_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"http_request_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics does not contain %q:\n%s", want, body)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if !strings.HasPrefix(line, "# TYPE ") && len(strings.Fields(line)) != 2 {
+			t.Errorf("line %q is not \"name value\"", line)
+		}
+	}
+}
+
+// /metricsと/metrics.jsonは同じカウンタを読むので、リクエストの後も同じ数を返す
+func TestMetricsJSONMatchesText(t *testing.T) {
+	c, ds, _ := newTestController()
+	m := NewMetrics()
+	h := MetricsMiddleware(m, http.HandlerFunc(c.SayHello))
+	jh := MetricsJSONHandler(m, ds)
+	for i, target := range []string{"/hello?user_id=1", "/hello?user_id=99"} {
+		send(h, http.MethodGet, target, nil)
+
+		var snap struct {
+			Requests int            `json:"requests"`
+			ByStatus map[string]int `json:"responses_by_status"`
+			Users    *int           `json:"users"`
+		}
+		if err := json.Unmarshal(send(jh, http.MethodGet, "/metrics.json", nil).Body.Bytes(), &snap); err != nil {
+			t.Fatalf("/metrics.json: %v", err)
+		}
+		if snap.Requests != i+1 {
+			t.Errorf("after %d requests: /metrics.json requests = %d", i+1, snap.Requests)
+		}
+		if snap.Users == nil || *snap.Users != 3 {
+			t.Errorf("/metrics.json users = %v, want 3", snap.Users)
+		}
+		text := send(m, http.MethodGet, "/metrics", nil).Body.String()
+		if want := fmt.Sprintf("http_requests_total %d\n", snap.Requests); !strings.Contains(text, want) {
+			t.Errorf("/metrics does not contain %q:\n%s", want, text)
+		}
+		for code, n := range snap.ByStatus {
+			if want := fmt.Sprintf("http_responses_total{code=\"%s\"} %d\n", code, n); !strings.Contains(text, want) {
+				t.Errorf("/metrics does not contain %q:\n%s", want, text)
+			}
+		}
+	}
+}
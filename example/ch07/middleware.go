@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Chainは、middlewaresをまとめて1つのミドルウェアにする。
+// 先に書いたものほど外側になり、リクエストを先に受け取る。
+func Chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+}
+
+// statusRecorderは、ハンドラが書き込んだステータスコードを覚えておくhttp.ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Flushは、包んだhttp.ResponseWriterがhttp.Flusherならそれを呼ぶ
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrapは、http.ResponseControllerが包まれたResponseWriterにたどり着けるようにする
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// LoggingMiddlewareは、リクエストごとにメソッド、パス、ステータスコード、処理時間をログに記録する。
+// RequestIDMiddlewareの内側に置くと、リクエストIDも記録される。項目や形式を選ぶならAccessLogMiddlewareを使う。
+func LoggingMiddleware(l Logger, next http.Handler) http.Handler {
+	return AccessLogMiddleware(l, TextAccessLogFormatter{}, next)
+}
+
+// RecoverMiddlewareは、ハンドラの中で起きたパニックから回復し、スタックトレースをログに記録して500を返す。
+// http.ErrAbortHandlerによるパニックはnet/httpに処理を任せるため、そのまま投げ直す。
+func RecoverMiddleware(l Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			LoggerWithContext(r.Context(), l).Logf(LevelError, "panic: %v\n%s", v, debug.Stack())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DefaultParamMiddlewareは、クエリにparamがなければ、param=valueを足したURLにしてnextに渡す。
+// "user_id="のように空の値が明示されているときは、そのまま渡す。
+func DefaultParamMiddleware(param, value string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Has(param) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		q.Set(param, value)
+		u := *r.URL
+		u.RawQuery = q.Encode()
+		r2 := r.WithContext(r.Context())
+		r2.URL = &u
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// ConcurrencyLimitMiddlewareは、同時に処理するリクエストをmax個までにする。
+// 空きがなければ待たせずにすぐ503を返すので、待っているリクエストでメモリがあふれない。
+// /logs/streamのように長く続くリクエストも、続いている間は1つ分の枠を使う。
+func ConcurrencyLimitMiddleware(max int, next http.Handler) http.Handler {
+	sem := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+		default:
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		// nextがパニックしても枠を返す
+		defer func() { <-sem }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// defaultMaxURLLengthは、Config.MaxURLLengthの既定の値。多くのブラウザやプロキシが扱える長さに合わせてある。
+const defaultMaxURLLength = 8192
+
+// MaxURLLengthMiddlewareは、URLかクエリ文字列がmaxバイトより長いリクエストを、どのハンドラにも渡さずに414にする。
+// 何メガバイトもあるuser_idのような、長すぎるクエリで解析やログに手間をかけさせないために使う。
+func MaxURLLengthMiddleware(max int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.RequestURI
+		if target == "" {
+			target = r.URL.RequestURI()
+		}
+		if len(target) > max || len(r.URL.RawQuery) > max {
+			http.Error(w, http.StatusText(http.StatusRequestURITooLong), http.StatusRequestURITooLong)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestTimeoutMiddlewareは、X-Request-Timeoutヘッダに"2s"のような時間があれば、
+// その時間で打ち切られるcontextにしてからnextに渡す。DataStoreの検索もその時間で打ち切られる。
+// 正しくない時間は、リクエストを断らずに警告をログに書いて無視する。
+func RequestTimeoutMiddleware(l Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get("X-Request-Timeout")
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			LoggerWithContext(r.Context(), l).Logf(LevelWarn, "X-Request-Timeoutを無視します: %q", value)
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RedirectSlashMiddlewareは、"/hello/"のように末尾に"/"の付いたパスを、"/"を取ったパスにリダイレクトする。
+// GETとHEADは301で、ほかのメソッドはボディを送り直してもらえるように308で返す。クエリはそのまま引き継ぐ。
+// ルートの"/"と、"/debug/pprof/"のように末尾に"/"の付いたパターンで登録したsubtreesの下のパスは、そのままnextに渡す。
+// subtreesのパスを"/"を取ったパスに飛ばすと、muxがまた"/"を付けたパスに飛ばし返すので、いつまでもたどり着けない。
+// "//example.com/"のようなパスで別のホストに飛ばされないように、パスは整理してから使う。
+func RedirectSlashMiddleware(subtrees []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if p == "/" || !strings.HasSuffix(p, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range subtrees {
+			if strings.HasPrefix(p, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		target := url.URL{Path: path.Clean("/" + p), RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), status)
+	})
+}
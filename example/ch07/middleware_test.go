@@ -0,0 +1,230 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// LoggingMiddlewareが、ハンドラの返したステータスコードとパスを1行に記録することを確かめる
+func TestLoggingMiddleware(t *testing.T) {
+	l := &MemoryLogger{}
+	h := LoggingMiddleware(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	send(h, http.MethodGet, "/brew?user_id=1", nil)
+
+	msgs := l.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("logged %d lines, want 1: %q", len(msgs), msgs)
+	}
+	for _, want := range []string{"GET", "/brew", "418"} {
+		if !strings.Contains(msgs[0], want) {
+			t.Errorf("log line %q does not contain %q", msgs[0], want)
+		}
+	}
+}
+
+// パニックしたハンドラは500になり、スタックトレースがログに残る
+func TestRecoverMiddleware(t *testing.T) {
+	l := &MemoryLogger{}
+	h := RecoverMiddleware(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := send(h, http.MethodGet, "/", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "boom") {
+		t.Errorf("body %q leaks the panic value", w.Body.String())
+	}
+	msgs := l.Messages()
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "panic: boom") || !strings.Contains(msgs[0], "goroutine ") {
+		t.Errorf("log = %q, want the panic value and a stack trace", msgs)
+	}
+}
+
+// http.ErrAbortHandlerは、net/httpが接続を切れるように投げ直す
+func TestRecoverMiddlewareRepanicsErrAbortHandler(t *testing.T) {
+	h := RecoverMiddleware(&MemoryLogger{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	send(h, http.MethodGet, "/", nil)
+}
+
+// Chainは、先に書いたミドルウェアほど外側にする
+func TestChainOrder(t *testing.T) {
+	var order []string
+	record := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name+" before")
+				next.ServeHTTP(w, r)
+				order = append(order, name+" after")
+			})
+		}
+	}
+	h := Chain(record("outer"), record("inner"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+	send(h, http.MethodGet, "/", nil)
+	want := []string{"outer before", "inner before", "handler", "inner after", "outer after"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %q, want %q", order, want)
+	}
+}
+
+func TestDefaultParamMiddleware(t *testing.T) {
+	var got string
+	h := DefaultParamMiddleware("user_id", "1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query().Get("user_id")
+	}))
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"absent", "/hello", "1"},
+		{"absent with other params", "/hello?lang=en", "1"},
+		{"present", "/hello?user_id=2", "2"},
+		{"explicitly empty", "/hello?user_id=", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send(h, http.MethodGet, tt.target, nil)
+			if got != tt.want {
+				t.Errorf("user_id = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// max個のリクエストが処理中なら、次のリクエストは待たずに503になる。
+// パニックしたリクエストの枠も返される。
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	const max = 2
+	release := make(chan struct{})
+	started := make(chan struct{}, max)
+	h := ConcurrencyLimitMiddleware(max, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		started <- struct{}{}
+		<-release
+	}))
+	for i := 0; i < max+1; i++ {
+		func() {
+			defer func() { recover() }()
+			send(h, http.MethodGet, "/panic", nil)
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			send(h, http.MethodGet, "/", nil)
+		}()
+	}
+	for i := 0; i < max; i++ {
+		<-started
+	}
+	if w := send(h, http.MethodGet, "/", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the limit: status = %d, want 503", w.Code)
+	}
+	close(release)
+	wg.Wait()
+	if w := send(h, http.MethodGet, "/", nil); w.Code != http.StatusOK {
+		t.Errorf("after the requests finished: status = %d, want 200", w.Code)
+	}
+}
+
+// X-Request-Timeoutの時間が過ぎれば遅いデータストアの検索を打ち切って504を返し、
+// 読めない時間は警告をログに書いて無視する
+func TestRequestTimeoutMiddleware(t *testing.T) {
+	l := &MemoryLogger{}
+	slow := slowStore{DataStore: NewSimpleDataStore(), delay: time.Hour}
+	c := NewController(l, NewSimpleLogic(l, slow, DefaultConfig()), slow)
+	h := RequestTimeoutMiddleware(l, http.HandlerFunc(c.SayHello))
+	start := time.Now()
+	w := sendWithHeader(h, http.MethodGet, "/hello?user_id=1", nil, "X-Request-Timeout", "20ms")
+	if w.Code != http.StatusGatewayTimeout || time.Since(start) > time.Second {
+		t.Errorf("got %d after %v, want 504 soon after 20ms", w.Code, time.Since(start))
+	}
+
+	for _, value := range []string{"soon", "-1s"} {
+		var hasDeadline bool
+		h := RequestTimeoutMiddleware(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, hasDeadline = r.Context().Deadline()
+		}))
+		sendWithHeader(h, http.MethodGet, "/", nil, "X-Request-Timeout", value)
+		if hasDeadline {
+			t.Errorf("X-Request-Timeout %q set a deadline", value)
+		}
+		if !containsMessage(l.Messages(), "[WARN] X-Request-Timeoutを無視します: \""+value+"\"") {
+			t.Errorf("X-Request-Timeout %q: no warning in %v", value, l.Messages())
+		}
+	}
+}
+
+// 末尾が"/"のパスはクエリを残したまま"/"のないパスにリダイレクトし、ルートと"/"のないパスとsubtreesの下のパスはそのまま渡す
+func TestRedirectSlashMiddleware(t *testing.T) {
+	h := RedirectSlashMiddleware([]string{"/debug/pprof/"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	}))
+	tests := []struct {
+		method       string
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{http.MethodGet, "/hello/?user_id=1", http.StatusMovedPermanently, "/hello?user_id=1"},
+		{http.MethodPost, "/users/", http.StatusPermanentRedirect, "/users"},
+		{http.MethodGet, "//example.com/", http.StatusMovedPermanently, "/example.com"},
+		{http.MethodGet, "/", http.StatusOK, ""},
+		{http.MethodGet, "/hello", http.StatusOK, ""},
+		{http.MethodGet, "/debug/pprof/", http.StatusOK, ""},
+		{http.MethodGet, "/debug/pprof/heap/", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			w := send(h, tt.method, tt.target, nil)
+			if loc := w.Header().Get("Location"); w.Code != tt.wantStatus || loc != tt.wantLocation {
+				t.Errorf("got %d Location %q, want %d %q", w.Code, loc, tt.wantStatus, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestMaxURLLengthMiddleware(t *testing.T) {
+	h := MaxURLLengthMiddleware(100, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"normal", "/hello?user_id=1", http.StatusOK},
+		{"at the limit", "/hello?user_id=" + strings.Repeat("a", 100-len("/hello?user_id=")), http.StatusOK},
+		{"long query", "/hello?user_id=" + strings.Repeat("a", 200), http.StatusRequestURITooLong},
+		{"long path", "/" + strings.Repeat("a", 200), http.StatusRequestURITooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := send(h, http.MethodGet, tt.target, nil); w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+	if got := DefaultConfig().MaxURLLength; got != defaultMaxURLLength {
+		t.Errorf("DefaultConfig().MaxURLLength = %d, want %d", got, defaultMaxURLLength)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrationsは、SQLDataStoreが使うテーブルを作り変えるSQLを、古い順に並べたもの。
+// i番目を実行するとスキーマのバージョンがi+1になる。一度公開したものは書き換えず、変更は末尾に足す。
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (id TEXT PRIMARY KEY, name TEXT NOT NULL)`,
+}
+
+// Migrateは、dbのスキーマを最新のバージョンにする。
+// どこまで実行したかはschema_versionテーブルに記録するので、何度呼んでもよい。
+// 1つのマイグレーションとその記録は同じトランザクションで行う。
+// 複数のプロセスが同時に呼ぶことは考えていないので、起動時に1つのプロセスから呼ぶこと。
+func Migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("schema_versionを作れません: %w", err)
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return fmt.Errorf("スキーマのバージョンを読めません: %w", err)
+	}
+	for i := version; i < len(migrations); i++ {
+		if err := migrate(ctx, db, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("バージョン%dにできません: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// migrateは、1つのマイグレーションqueryを実行し、スキーマのバージョンをversionとして記録する
+func migrate(ctx context.Context, db *sql.DB, version int, query string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (?)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
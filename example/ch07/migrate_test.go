@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 2回目のMigrateはエラーにならず、済んだマイグレーションを繰り返さない
+func TestMigrateTwice(t *testing.T) {
+	db, mem := openMemSQL(t)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := Migrate(ctx, db); err != nil {
+			t.Fatalf("Migrate #%d: %v", i+1, err)
+		}
+	}
+	if want := []int64{int64(len(migrations))}; !reflect.DeepEqual(mem.versions, want) {
+		t.Errorf("recorded versions = %v, want %v", mem.versions, want)
+	}
+	created := 0
+	for _, q := range mem.execs {
+		if strings.HasPrefix(q, "CREATE TABLE IF NOT EXISTS users") {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("users table migration ran %d times, want 1", created)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// LookupRecorderは、ObservedDataStoreが検索1回ごとに結果を伝える先
+type LookupRecorder interface {
+	ObserveLookup(dur time.Duration, err error)
+}
+
+// ObservedDataStoreは、包んだDataStoreのUserNameForIDにかかった時間とエラーをLookupRecorderに伝えるDataStore。
+// かかった時間は、AddServerTimingでServer-Timingヘッダのstoreにも足す。
+type ObservedDataStore struct {
+	ds  DataStore
+	rec LookupRecorder
+}
+
+// NewObservedDataStoreは、dsの検索をrecに伝えるObservedDataStoreを生成するファクトリ関数
+func NewObservedDataStore(ds DataStore, rec LookupRecorder) ObservedDataStore {
+	return ObservedDataStore{
+		ds:  ds,
+		rec: rec,
+	}
+}
+
+func (ods ObservedDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	start := time.Now()
+	name, ok, err := ods.ds.UserNameForID(ctx, userID)
+	dur := time.Since(start)
+	ods.rec.ObserveLookup(dur, err)
+	AddServerTiming(ctx, "store", dur)
+	return name, ok, err
+}
+
+// Unwrapは、包んだデータストアを返す
+func (ods ObservedDataStore) Unwrap() DataStore {
+	return ods.ds
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeRecorderは、ObserveLookupに伝えられた時間とエラーを覚えておくLookupRecorder
+type fakeRecorder struct {
+	durs []time.Duration
+	errs []error
+}
+
+func (fr *fakeRecorder) ObserveLookup(dur time.Duration, err error) {
+	fr.durs = append(fr.durs, dur)
+	fr.errs = append(fr.errs, err)
+}
+
+func TestObservedDataStore(t *testing.T) {
+	rec := &fakeRecorder{}
+	const delay = 20 * time.Millisecond
+	ods := NewObservedDataStore(slowStore{DataStore: NewSimpleDataStore(), delay: delay}, rec)
+	if name, ok, err := ods.UserNameForID(context.Background(), "1"); name != "Fred" || !ok || err != nil {
+		t.Fatalf("UserNameForID(1) = %q, %v, %v", name, ok, err)
+	}
+	if len(rec.durs) != 1 || rec.durs[0] < delay || rec.errs[0] != nil {
+		t.Errorf("recorded %v, %v; want one lookup of at least %v without an error", rec.durs, rec.errs, delay)
+	}
+
+	down := errors.New("store is down")
+	NewObservedDataStore(failingStore{down}, rec).UserNameForID(context.Background(), "1")
+	if len(rec.errs) != 2 || !errors.Is(rec.errs[1], down) {
+		t.Errorf("recorded errors %v, want the store's error second", rec.errs)
+	}
+}
+
+// Metricsに記録すれば、検索の回数とエラーの回数を数えられる
+func TestObservedDataStoreWithMetrics(t *testing.T) {
+	m := NewMetrics()
+	NewObservedDataStore(NewSimpleDataStore(), m).UserNameForID(context.Background(), "1")
+	NewObservedDataStore(failingStore{errors.New("down")}, m).UserNameForID(context.Background(), "1")
+	snap := m.snapshot()
+	if snap.Lookups != 2 || snap.LookupErrors != 1 {
+		t.Errorf("lookups = %d, errors = %d; want 2, 1", snap.Lookups, snap.LookupErrors)
+	}
+}
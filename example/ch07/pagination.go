@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+const (
+	// defaultPageLimitは、limitを指定しないか0にしたときの1ページのユーザーの数
+	defaultPageLimit = 20
+	// maxPageLimitは、1ページのユーザーの数の上限。これより大きいlimitはこの値にする。
+	maxPageLimit = 100
+)
+
+// Userは、ページ単位の列挙で返す1人のユーザー
+type User struct {
+	ID   string `json:"user_id"`
+	Name string `json:"name"`
+}
+
+// usersPageは、/users?limit=&offset=が返すJSON。
+// NextOffsetは次のページを取るときにoffsetに渡す値で、最後のページなら省く。
+type usersPage struct {
+	Users      []User `json:"users"`
+	Total      int    `json:"total"`
+	NextOffset *int   `json:"next_offset,omitempty"`
+}
+
+// pageUsersは、usersをユーザーID順に並べ、offset番目からlimit人と全体の数を返す。
+// offsetがユーザーの数以上なら空のスライスを返す。
+func pageUsers(users map[string]string, offset, limit int) ([]User, int) {
+	ids := make([]string, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	page := []User{}
+	for i := offset; i < len(ids) && i-offset < limit; i++ {
+		page = append(page, User{ID: ids[i], Name: users[ids[i]]})
+	}
+	return page, len(ids)
+}
+
+// listUsersPageは、qのlimitとoffsetの範囲のユーザーを、全体の数と次のページのoffsetと一緒にJSONで返す。
+// 負の数や数でない値なら400を返す。PagerでないDataStoreでも、Listerなら全てのユーザーから切り出す。
+func (c Controller) listUsersPage(w http.ResponseWriter, q url.Values) {
+	limit, ok := c.pageParam(w, q, "limit", defaultPageLimit)
+	if !ok {
+		return
+	}
+	offset, ok := c.pageParam(w, q, "offset", 0)
+	if !ok {
+		return
+	}
+	switch {
+	case limit == 0:
+		limit = defaultPageLimit
+	case limit > maxPageLimit:
+		limit = maxPageLimit
+	}
+	var page usersPage
+	switch ds := c.ds.(type) {
+	case Pager:
+		page.Users, page.Total = ds.UsersPage(offset, limit)
+	case Lister:
+		page.Users, page.Total = pageUsers(ds.AllUsers(), offset, limit)
+	default:
+		c.writeError(w, http.StatusNotImplemented, "列挙できないデータストア")
+		return
+	}
+	if page.Users == nil {
+		page.Users = []User{}
+	}
+	if next := offset + len(page.Users); len(page.Users) > 0 && next < page.Total {
+		page.NextOffset = &next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// pageParamは、qのnameを0以上の整数として読む。なければdefを返す。
+func (c Controller) pageParam(w http.ResponseWriter, q url.Values, name string, def int) (int, bool) {
+	if !q.Has(name) {
+		return def, true
+	}
+	n, err := strconv.Atoi(q.Get(name))
+	if err != nil || n < 0 {
+		c.writeError(w, http.StatusBadRequest, name+"には0以上の整数を指定してください")
+		return 0, false
+	}
+	return n, true
+}
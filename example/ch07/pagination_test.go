@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestListUsersPage(t *testing.T) {
+	c, _, _ := newTestController()
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"first page", "limit=2", `{"users":[{"user_id":"1","name":"Fred"},{"user_id":"2","name":"Mary"}],"total":3,"next_offset":2}`},
+		{"middle page", "limit=1&offset=1", `{"users":[{"user_id":"2","name":"Mary"}],"total":3,"next_offset":2}`},
+		{"last page", "offset=2", `{"users":[{"user_id":"3","name":"Pat"}],"total":3}`},
+		{"out of range", "offset=10", `{"users":[],"total":3}`},
+		{"limit over the max", "limit=1000", `{"users":[{"user_id":"1","name":"Fred"},{"user_id":"2","name":"Mary"},{"user_id":"3","name":"Pat"}],"total":3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(http.HandlerFunc(c.ListUsers), http.MethodGet, "/users?"+tt.query, nil)
+			if got := strings.TrimSpace(w.Body.String()); w.Code != http.StatusOK || got != tt.want {
+				t.Errorf("got %d %s, want 200 %s", w.Code, got, tt.want)
+			}
+		})
+	}
+	for _, query := range []string{"limit=-1", "offset=-1", "offset=x"} {
+		if w := send(http.HandlerFunc(c.ListUsers), http.MethodGet, "/users?"+query, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+// 上限より多くのユーザーがいても、1ページはmaxPageLimit人まで
+func TestPageUsersCapsAtMax(t *testing.T) {
+	users := map[string]string{}
+	for i := 0; i < maxPageLimit+5; i++ {
+		users["u"+strconv.Itoa(1000+i)] = "name"
+	}
+	ds := &SimpleDataStore{}
+	ds.ImportUsers(users, false)
+	c := NewController(&MemoryLogger{}, nil, ds)
+	w := send(http.HandlerFunc(c.ListUsers), http.MethodGet, "/users?limit=1000", nil)
+	if n := strings.Count(w.Body.String(), `"user_id"`); n != maxPageLimit {
+		t.Errorf("page has %d users, want %d", n, maxPageLimit)
+	}
+	page, total := pageUsers(map[string]string{"b": "B", "a": "A"}, 0, 10)
+	if want := []User{{"a", "A"}, {"b", "B"}}; total != 2 || !reflect.DeepEqual(page, want) {
+		t.Errorf("pageUsers = %v, %d; want %v sorted by ID", page, total, want)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiterは、キーごとのトークンバケットで、interval当たりlimit回までの呼び出しを許す。
+// 使われなくなったバケットは、裏で動くゴルーチンが定期的に捨てる。使い終わったらStopを呼ぶこと。
+type RateLimiter struct {
+	limit    int
+	interval time.Duration
+	clock    Clock
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	done    chan struct{}
+	stop    sync.Once
+}
+
+// tokenBucketは、1つのキーのトークンバケット
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiterは、キーごとにinterval当たりlimit回まで許すRateLimiterを生成するファクトリ関数。
+// トークンの補充はclockの時刻で計算する。clockがnilなら本当の時刻を使う。
+// limitかintervalが正でなければ、バケットを補充も掃除もできないのでエラーを返す。
+func NewRateLimiter(limit int, interval time.Duration, clock Clock) (*RateLimiter, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("RateLimiterのlimitは1以上にしてください: %d", limit)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("RateLimiterのintervalは正の値にしてください: %v", interval)
+	}
+	rl := &RateLimiter{
+		limit:    limit,
+		interval: interval,
+		clock:    clockOrReal(clock),
+		buckets:  map[string]*tokenBucket{},
+		done:     make(chan struct{}),
+	}
+	go rl.sweep()
+	return rl, nil
+}
+
+// Allowは、keyの呼び出しを許すかを返す。許さないときは、次に許すまでの時間も返す。
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.clock.Now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(rl.limit), last: now}
+		rl.buckets[key] = b
+	}
+	// 前回から経った時間の分だけトークンを補充する
+	rate := float64(rl.limit) / rl.interval.Seconds()
+	b.tokens = math.Min(float64(rl.limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweepは、intervalごとに、interval以上使われていない（満タンに戻った）バケットを捨てる
+func (rl *RateLimiter) sweep() {
+	t := time.NewTicker(rl.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-t.C:
+		}
+		rl.mu.Lock()
+		now := rl.clock.Now()
+		for key, b := range rl.buckets {
+			if now.Sub(b.last) >= rl.interval {
+				delete(rl.buckets, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// Stopは、バケットを捨てるゴルーチンを止める
+func (rl *RateLimiter) Stop() {
+	rl.stop.Do(func() {
+		close(rl.done)
+	})
+}
+
+// RateLimitMiddlewareは、クエリのuser_idごとにrlで呼び出しを制限し、超えたら429とRetry-Afterヘッダを返す。
+// user_idのないリクエストは制限しない。
+func RateLimitMiddleware(rl *RateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait := rl.Allow(userID)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
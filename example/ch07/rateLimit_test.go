@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// limit回までは通し、limit+1回目は429とRetry-Afterを返す
+func TestRateLimitMiddleware(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rl, err := NewRateLimiter(3, time.Second, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Stop()
+	h := RateLimitMiddleware(rl, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, w.Code)
+		}
+	}
+	w := send(h, http.MethodGet, "/hello?user_id=1", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("request 4: status = %d, Retry-After = %q; want 429, 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := send(h, http.MethodGet, "/hello?user_id=2", nil); w.Code != http.StatusOK {
+		t.Errorf("another user: status = %d, want 200", w.Code)
+	}
+
+	clock.Advance(time.Second)
+	if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+		t.Errorf("after the interval: status = %d, want 200", w.Code)
+	}
+}
+
+func TestNewRateLimiterRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		interval time.Duration
+	}{
+		{"zero interval", 10, 0},
+		{"negative interval", 10, -time.Second},
+		{"zero limit", 0, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rl, err := NewRateLimiter(tt.limit, tt.interval, nil); err == nil {
+				rl.Stop()
+				t.Error("NewRateLimiter returned no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import "context"
+
+// RedisClientは、RedisDataStoreが使うRedisの操作だけを集めたインターフェイス。
+// 実際のクライアントはこれに合わせる薄いアダプタで包み、テストでは偽物を渡す。
+type RedisClient interface {
+	// Getは、keyの値を返す。keyがなければokがfalseになる。
+	Get(ctx context.Context, key string) (value string, ok bool, err error)
+	Set(ctx context.Context, key, value string) error
+	// Delは、keyを消し、消したキーの数を返す。
+	Del(ctx context.Context, key string) (int64, error)
+}
+
+// RedisDataStoreは、"user:ID"というキーにユーザーの名前を保存するデータストア。
+// GETとSETの2回に分けて確かめるので、AddUserForIDとUpdateUserForIDはアトミックではない。
+type RedisDataStore struct {
+	client RedisClient
+}
+
+// NewRedisDataStoreは、clientを使うRedisDataStoreを生成するファクトリ関数
+func NewRedisDataStore(client RedisClient) RedisDataStore {
+	return RedisDataStore{client: client}
+}
+
+func redisUserKey(userID string) string {
+	return "user:" + userID
+}
+
+func (rds RedisDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	return rds.client.Get(ctx, redisUserKey(userID))
+}
+
+func (rds RedisDataStore) AddUserForID(userID, name string) error {
+	ctx := context.Background()
+	_, ok, err := rds.client.Get(ctx, redisUserKey(userID))
+	if err != nil {
+		return err
+	}
+	if ok {
+		return ErrUserExists
+	}
+	return rds.client.Set(ctx, redisUserKey(userID), name)
+}
+
+func (rds RedisDataStore) UpdateUserForID(userID, newName string) error {
+	ctx := context.Background()
+	_, ok, err := rds.client.Get(ctx, redisUserKey(userID))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUnknownUser
+	}
+	return rds.client.Set(ctx, redisUserKey(userID), newName)
+}
+
+func (rds RedisDataStore) DeleteUserForID(userID string) error {
+	n, err := rds.client.Del(context.Background(), redisUserKey(userID))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUnknownUser
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeRedisは、RedisClientをマップで実装した偽物
+type fakeRedis struct {
+	values map[string]string
+}
+
+func (fr *fakeRedis) Get(ctx context.Context, key string) (string, bool, error) {
+	v, ok := fr.values[key]
+	return v, ok, nil
+}
+
+func (fr *fakeRedis) Set(ctx context.Context, key, value string) error {
+	fr.values[key] = value
+	return nil
+}
+
+func (fr *fakeRedis) Del(ctx context.Context, key string) (int64, error) {
+	if _, ok := fr.values[key]; !ok {
+		return 0, nil
+	}
+	delete(fr.values, key)
+	return 1, nil
+}
+
+func TestRedisDataStore(t *testing.T) {
+	client := &fakeRedis{values: map[string]string{}}
+	rds := NewRedisDataStore(client)
+	ctx := context.Background()
+
+	if _, ok, err := rds.UserNameForID(ctx, "1"); ok || err != nil {
+		t.Fatalf("missing key: ok = %v, err = %v; want false, nil", ok, err)
+	}
+	if err := rds.AddUserForID("1", "Fred"); err != nil {
+		t.Fatal(err)
+	}
+	if client.values["user:1"] != "Fred" {
+		t.Errorf("values = %v, want user:1 = Fred", client.values)
+	}
+	if err := rds.AddUserForID("1", "Mary"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("adding user 1 twice: err = %v, want ErrUserExists", err)
+	}
+	if err := rds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Fatal(err)
+	}
+	if name, ok, _ := rds.UserNameForID(ctx, "1"); name != "Freddie" || !ok {
+		t.Errorf("UserNameForID(1) = %q, %v; want Freddie, true", name, ok)
+	}
+	if err := rds.UpdateUserForID("2", "Mary"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("updating a missing user: err = %v, want ErrUnknownUser", err)
+	}
+	if err := rds.DeleteUserForID("1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rds.DeleteUserForID("1"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("deleting a missing user: err = %v, want ErrUnknownUser", err)
+	}
+}
+
+func TestRedisDataStoreCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rds := NewRedisDataStore(&fakeRedis{values: map[string]string{"user:1": "Fred"}})
+	if _, _, err := rds.UserNameForID(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
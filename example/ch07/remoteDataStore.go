@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RemoteDataStoreは、別のHTTPサービスのGET {baseURL}/users/{id}でユーザーを検索するデータストア。
+// レスポンスは{"name": "..."}を含むJSONで、404は見つからなかったことを表す。
+type RemoteDataStore struct {
+	baseURL string
+	client  *http.Client
+	timeout time.Duration
+}
+
+// NewRemoteDataStoreは、baseURLのサービスをclientで呼ぶRemoteDataStoreを生成するファクトリ関数。
+// 1回の検索はtimeoutで打ち切る。timeoutが0以下なら打ち切らず、ctxとclientのタイムアウトだけに任せる。
+// clientがnilならhttp.DefaultClientを使う。
+func NewRemoteDataStore(baseURL string, client *http.Client, timeout time.Duration) RemoteDataStore {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return RemoteDataStore{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+		timeout: timeout,
+	}
+}
+
+func (rds RemoteDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if rds.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rds.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rds.baseURL+"/users/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return "", false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := rds.client.Do(req)
+	if err != nil {
+		return "", false, fmt.Errorf("リモートのデータストアを呼べません: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", false, nil
+	case resp.StatusCode != http.StatusOK:
+		return "", false, fmt.Errorf("リモートのデータストアが%dを返しました", resp.StatusCode)
+	}
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", false, fmt.Errorf("リモートのデータストアのレスポンスを読めません: %w", err)
+	}
+	return body.Name, true, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newUserServerは、usersのユーザーを{"name": ...}で返し、いなければ404を返すhttptest.Serverを作る
+func newUserServer(t *testing.T, users map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := users[strings.TrimPrefix(r.URL.Path, "/users/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"name": name})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRemoteDataStore(t *testing.T) {
+	srv := newUserServer(t, map[string]string{"1": "Fred"})
+	for _, timeout := range []time.Duration{time.Second, 0} {
+		rds := NewRemoteDataStore(srv.URL+"/", srv.Client(), timeout)
+		if name, ok, err := rds.UserNameForID(context.Background(), "1"); name != "Fred" || !ok || err != nil {
+			t.Errorf("timeout %v: UserNameForID(1) = %q, %v, %v; want Fred, true, nil", timeout, name, ok, err)
+		}
+		if _, ok, err := rds.UserNameForID(context.Background(), "99"); ok || err != nil {
+			t.Errorf("timeout %v: UserNameForID(99) = %v, %v; want not found", timeout, ok, err)
+		}
+	}
+}
+
+// 遅いサービスは、timeoutで打ち切ってエラーにする
+func TestRemoteDataStoreTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	_, _, err := NewRemoteDataStore(srv.URL, srv.Client(), 10*time.Millisecond).UserNameForID(context.Background(), "1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want a wrapped context.DeadlineExceeded", err)
+	}
+}
+
+func TestRemoteDataStoreServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	if _, _, err := NewRemoteDataStore(srv.URL, srv.Client(), time.Second).UserNameForID(context.Background(), "1"); err == nil {
+		t.Error("a 500 from the service returned no error")
+	}
+}
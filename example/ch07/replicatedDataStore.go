@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicationOpは、ReplicatedDataStoreがプライマリに書き込んだ後でレプリカに伝える1つの変更
+type replicationOp struct {
+	op     ChangeOp
+	userID string
+	name   string
+	at     time.Time
+}
+
+// ReplicationLagは、ReplicatedDataStoreのレプリカがプライマリにどれだけ遅れているか。
+// Pendingはまだレプリカに伝えていない変更の数で、Delayはそのうち一番古い変更をプライマリに書き込んでからの時間。
+type ReplicationLag struct {
+	Pending int           `json:"pending"`
+	Delay   time.Duration `json:"delay"`
+}
+
+// ReplicatedDataStoreは、書き込みをプライマリにして、その変更を別のゴルーチンでレプリカに伝えるWritableDataStore。
+// 読み込みはレプリカに順に振り分けるので、書き込んだ直後にはまだ古い名前が返ることがある。
+// レプリカに伝える前の変更がqueueSize件たまっていたら、空くまで書き込みを待たせる。捨てるとレプリカが元に戻らないので捨てない。
+// プライマリへの書き込みと変更を渡すのは1つずつ順にするので、レプリカにはプライマリと同じ順で変更が届く。
+// レプリカへの書き込みが失敗しても、ログに書くだけで送り直さない。使い終わったらCloseを呼ぶ。
+type ReplicatedDataStore struct {
+	primary  WritableDataStore
+	replicas []WritableDataStore
+	l        Logger
+	clock    Clock
+	next     atomic.Uint64
+
+	// writeMuは、プライマリへの書き込みからpropagateまでを持つロック。
+	// 分けると、同じユーザーへの2つの書き込みがプライマリとは逆の順でqueueに入ることがある。
+	writeMu sync.Mutex
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan replicationOp
+	done    chan struct{}
+	lagMu   sync.Mutex
+	pending []time.Time
+}
+
+// NewReplicatedDataStoreは、primaryに書き込み、replicasから読むReplicatedDataStoreを生成するファクトリ関数。
+// replicasが空ならprimaryから読む。clockがnilなら本当の時刻を使う。変更を伝えるゴルーチンもここで始める。
+func NewReplicatedDataStore(primary WritableDataStore, replicas []WritableDataStore, l Logger, clock Clock, queueSize int) *ReplicatedDataStore {
+	rds := &ReplicatedDataStore{
+		primary:  primary,
+		replicas: replicas,
+		l:        l,
+		clock:    clockOrReal(clock),
+		queue:    make(chan replicationOp, queueSize),
+		done:     make(chan struct{}),
+	}
+	go rds.run()
+	return rds
+}
+
+// UserNameForIDは、レプリカの1つからuserIDの名前を探す
+func (rds *ReplicatedDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if len(rds.replicas) == 0 {
+		return rds.primary.UserNameForID(ctx, userID)
+	}
+	i := rds.next.Add(1) % uint64(len(rds.replicas))
+	return rds.replicas[i].UserNameForID(ctx, userID)
+}
+
+func (rds *ReplicatedDataStore) AddUserForID(userID, name string) error {
+	rds.writeMu.Lock()
+	defer rds.writeMu.Unlock()
+	if err := rds.primary.AddUserForID(userID, name); err != nil {
+		return err
+	}
+	rds.propagate(ChangeAdd, userID, name)
+	return nil
+}
+
+func (rds *ReplicatedDataStore) UpdateUserForID(userID, newName string) error {
+	rds.writeMu.Lock()
+	defer rds.writeMu.Unlock()
+	if err := rds.primary.UpdateUserForID(userID, newName); err != nil {
+		return err
+	}
+	rds.propagate(ChangeUpdate, userID, newName)
+	return nil
+}
+
+func (rds *ReplicatedDataStore) DeleteUserForID(userID string) error {
+	rds.writeMu.Lock()
+	defer rds.writeMu.Unlock()
+	if err := rds.primary.DeleteUserForID(userID); err != nil {
+		return err
+	}
+	rds.propagate(ChangeDelete, userID, "")
+	return nil
+}
+
+// Lagは、今レプリカがプライマリにどれだけ遅れているかを返す
+func (rds *ReplicatedDataStore) Lag() ReplicationLag {
+	rds.lagMu.Lock()
+	defer rds.lagMu.Unlock()
+	if len(rds.pending) == 0 {
+		return ReplicationLag{}
+	}
+	return ReplicationLag{Pending: len(rds.pending), Delay: rds.clock.Now().Sub(rds.pending[0])}
+}
+
+// propagateは、変更を伝えるゴルーチンに変更を渡す。queueがいっぱいなら空くまで待つ。
+func (rds *ReplicatedDataStore) propagate(op ChangeOp, userID, name string) {
+	rds.mu.RLock()
+	defer rds.mu.RUnlock()
+	if rds.closed {
+		rds.l.Logf(LevelWarn, "replication: 閉じた後の変更はレプリカに伝えません: %s %s", op, escapeForLog(userID))
+		return
+	}
+	ro := replicationOp{op: op, userID: userID, name: name, at: rds.clock.Now()}
+	rds.lagMu.Lock()
+	rds.pending = append(rds.pending, ro.at)
+	rds.lagMu.Unlock()
+	rds.queue <- ro
+}
+
+// runは、queueが閉じられるまで、変更を1つずつ全てのレプリカに書き込む
+func (rds *ReplicatedDataStore) run() {
+	defer close(rds.done)
+	for ro := range rds.queue {
+		for i, replica := range rds.replicas {
+			if err := applyReplicationOp(replica, ro); err != nil {
+				rds.l.Logf(LevelError, "replication: レプリカ%dに%s %sを伝えられません: %v", i, ro.op, escapeForLog(ro.userID), err)
+			}
+		}
+		rds.lagMu.Lock()
+		rds.pending = rds.pending[1:]
+		rds.lagMu.Unlock()
+	}
+}
+
+// applyReplicationOpは、roの変更をdsに書き込む
+func applyReplicationOp(ds WritableDataStore, ro replicationOp) error {
+	switch ro.op {
+	case ChangeAdd:
+		return ds.AddUserForID(ro.userID, ro.name)
+	case ChangeUpdate:
+		return ds.UpdateUserForID(ro.userID, ro.name)
+	default:
+		return ds.DeleteUserForID(ro.userID)
+	}
+}
+
+// Closeは、たまっている変更を全てのレプリカに伝え終えるまで待ってから、プライマリとレプリカが閉じられるものなら閉じる。
+// Closeの後の書き込みはプライマリにだけ書き、レプリカには伝えない。
+func (rds *ReplicatedDataStore) Close() error {
+	rds.mu.Lock()
+	if !rds.closed {
+		rds.closed = true
+		close(rds.queue)
+	}
+	rds.mu.Unlock()
+	<-rds.done
+	err := closeDataStore(rds.primary)
+	for _, replica := range rds.replicas {
+		if cerr := closeDataStore(replica); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedStoreは、gateが閉じられるまで書き込みを待たせるWritableDataStore。レプリカへの伝達が遅れている様子を作る。
+type gatedStore struct {
+	*SimpleDataStore
+	gate chan struct{}
+}
+
+func (gs gatedStore) AddUserForID(userID, name string) error {
+	<-gs.gate
+	return gs.SimpleDataStore.AddUserForID(userID, name)
+}
+
+func (gs gatedStore) UpdateUserForID(userID, newName string) error {
+	<-gs.gate
+	return gs.SimpleDataStore.UpdateUserForID(userID, newName)
+}
+
+// orderStoreは、更新した名前をその順に覚えるWritableDataStore。
+// 書き込んだ後で他のゴルーチンに順番を譲り、書き込みと次の処理の間に割り込まれやすくする。
+type orderStore struct {
+	*SimpleDataStore
+	mu    sync.Mutex
+	names []string
+}
+
+func (ost *orderStore) UpdateUserForID(userID, newName string) error {
+	ost.mu.Lock()
+	err := ost.SimpleDataStore.UpdateUserForID(userID, newName)
+	ost.names = append(ost.names, newName)
+	ost.mu.Unlock()
+	runtime.Gosched()
+	return err
+}
+
+// Namesは、これまでに更新した名前を順に返す
+func (ost *orderStore) Names() []string {
+	ost.mu.Lock()
+	defer ost.mu.Unlock()
+	return append([]string(nil), ost.names...)
+}
+
+// プライマリに書き込んだ変更は、遅れてレプリカから読めるようになり、その間の遅れがLagに出る
+func TestReplicatedDataStoreEventuallyConsistent(t *testing.T) {
+	gate := make(chan struct{})
+	primary := NewSimpleDataStore()
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rds := NewReplicatedDataStore(primary, []WritableDataStore{gatedStore{NewSimpleDataStore(), gate}}, &MemoryLogger{}, clock, 4)
+	defer rds.Close()
+
+	if err := rds.AddUserForID("new", "Ann"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	if err := rds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Fatalf("UpdateUserForID: %v", err)
+	}
+	if _, ok, _ := primary.UserNameForID(context.Background(), "new"); !ok {
+		t.Error("the primary does not have the new user")
+	}
+	if _, ok, _ := rds.UserNameForID(context.Background(), "new"); ok {
+		t.Error("the replica has the new user before it was propagated")
+	}
+	clock.Advance(3 * time.Second)
+	if lag := rds.Lag(); lag != (ReplicationLag{Pending: 2, Delay: 3 * time.Second}) {
+		t.Errorf("Lag() = %+v, want 2 pending for 3s", lag)
+	}
+
+	close(gate)
+	ctx := context.Background()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		name, ok, _ := rds.UserNameForID(ctx, "1")
+		if ok && name == "Freddie" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the replica still has %q for user 1, want Freddie", name)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if name, ok, _ := rds.UserNameForID(ctx, "new"); !ok || name != "Ann" {
+		t.Errorf("replica name for new = %q, %v, want Ann", name, ok)
+	}
+	if lag := rds.Lag(); lag != (ReplicationLag{}) {
+		t.Errorf("Lag() after propagation = %+v, want none", lag)
+	}
+}
+
+// Closeはたまった変更を伝え終えてから戻り、その後の書き込みはプライマリにだけ書く
+func TestReplicatedDataStoreClose(t *testing.T) {
+	primary, replica := NewSimpleDataStore(), NewSimpleDataStore()
+	l := &MemoryLogger{}
+	rds := NewReplicatedDataStore(primary, []WritableDataStore{replica}, l, nil, 1)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := rds.AddUserForID(id, "Ann"); err != nil {
+			t.Fatalf("AddUserForID(%s): %v", id, err)
+		}
+	}
+	if err := rds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := replica.UserCount(); n != 6 {
+		t.Errorf("replica has %d users after Close, want 6", n)
+	}
+	if err := rds.AddUserForID("d", "Bob"); err != nil {
+		t.Fatalf("AddUserForID after Close: %v", err)
+	}
+	if _, ok, _ := replica.UserNameForID(context.Background(), "d"); ok {
+		t.Error("a write after Close reached the replica")
+	}
+	if !containsMessage(l.Messages(), "閉じた後の変更") {
+		t.Errorf("logs %v do not mention the dropped change", l.Messages())
+	}
+}
+
+// 同じユーザーを並行して書き換えても、レプリカにはプライマリと同じ順で届く
+func TestReplicatedDataStoreConcurrentWriters(t *testing.T) {
+	primary, replica := &orderStore{SimpleDataStore: NewSimpleDataStore()}, &orderStore{SimpleDataStore: NewSimpleDataStore()}
+	rds := NewReplicatedDataStore(primary, []WritableDataStore{replica}, &MemoryLogger{}, nil, 4)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := rds.UpdateUserForID("1", fmt.Sprintf("w%d-%d", w, i)); err != nil {
+					t.Errorf("UpdateUserForID: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := rds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got, want := replica.Names(), primary.Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("the replica got %d updates in a different order from the primary's %d", len(got), len(want))
+	}
+}
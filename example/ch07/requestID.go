@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// contextKeyは、このパッケージがcontextに値を入れるときのキーの型
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	authUserIDKey
+	tenantKey
+	serverTimingKey
+	greetingVariantKey
+	languageKey
+	accessLogKey
+)
+
+// RequestIDMiddlewareは、リクエストごとにランダムなIDを作り、
+// リクエストのcontextに入れてX-Request-IDレスポンスヘッダでも返す
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := newRequestID()
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestIDFromContextは、RequestIDMiddlewareがctxに入れたIDを取り出す
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok
+}
+
+// LoggerWithContextは、ctxにリクエストIDがあれば、各行の先頭にそのIDを付けるLoggerを返す。
+// なければlをそのまま返す。
+func LoggerWithContext(ctx context.Context, l Logger) Logger {
+	id, ok := RequestIDFromContext(ctx)
+	if !ok {
+		return l
+	}
+	return requestLogger{l: l, prefix: "[" + id + "] "}
+}
+
+// requestLoggerは、全てのメッセージの先頭にprefixを付けるLogger
+type requestLogger struct {
+	l      Logger
+	prefix string
+}
+
+func (rl requestLogger) Log(message string) {
+	rl.l.Log(rl.prefix + message)
+}
+
+func (rl requestLogger) Logf(level Level, format string, args ...any) {
+	rl.l.Logf(level, "%s"+format, append([]any{rl.prefix}, args...)...)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// 同時に来た2つのリクエストが、ログでもX-Request-IDでも別のIDを持つことを確かめる
+func TestRequestIDDistinctForConcurrentRequests(t *testing.T) {
+	c, _, l := newTestController()
+	h := RequestIDMiddleware(http.HandlerFunc(c.SayHello))
+	userIDs := []string{"1", "2"}
+	recorders := make([]*httptest.ResponseRecorder, len(userIDs))
+	var wg sync.WaitGroup
+	for i, userID := range userIDs {
+		wg.Add(1)
+		go func(i int, userID string) {
+			defer wg.Done()
+			recorders[i] = send(h, http.MethodGet, "/hello?user_id="+userID, nil)
+		}(i, userID)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i, userID := range userIDs {
+		id := recorders[i].Header().Get("X-Request-ID")
+		if id == "" {
+			t.Fatalf("request for user %s has no X-Request-ID", userID)
+		}
+		if seen[id] {
+			t.Errorf("X-Request-ID %q was given to two requests", id)
+		}
+		seen[id] = true
+		if want := "[" + id + "] SayHello(" + userID + ")"; !containsMessage(l.Messages(), want) {
+			t.Errorf("log = %q, want it to contain %q", l.Messages(), want)
+		}
+	}
+}
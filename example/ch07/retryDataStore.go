@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryDataStoreは、包んだDataStoreのUserNameForIDがエラーを返したときに、
+// 待ち時間を倍にしながらやり直すDataStore。やり直しても変わらないエラーはretryableで見分けて、すぐに返す。
+type RetryDataStore struct {
+	ds        DataStore
+	attempts  int
+	baseDelay time.Duration
+}
+
+// NewRetryDataStoreは、dsを最大attempts回試すRetryDataStoreを生成するファクトリ関数。
+// 1回目の失敗の後はbaseDelay待ち、その後は失敗のたびに待ち時間を倍にする。
+func NewRetryDataStore(ds DataStore, attempts int, baseDelay time.Duration) RetryDataStore {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return RetryDataStore{
+		ds:        ds,
+		attempts:  attempts,
+		baseDelay: baseDelay,
+	}
+}
+
+func (rds RetryDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	delay := rds.baseDelay
+	var err error
+	for i := 0; i < rds.attempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return "", false, ctx.Err()
+			case <-t.C:
+			}
+			delay *= 2
+		}
+		var name string
+		var ok bool
+		name, ok, err = rds.ds.UserNameForID(ctx, userID)
+		if err == nil {
+			return name, ok, nil
+		}
+		if !retryable(err) {
+			return "", false, err
+		}
+	}
+	return "", false, err
+}
+
+// retryableは、errがやり直せば直るかもしれないエラーかどうかを返す。
+// 無効なユーザーや開いたサーキットブレーカー、終わったcontextは、やり直しても同じエラーになる。
+func retryable(err error) bool {
+	for _, permanent := range []error{ErrUserDisabled, ErrCircuitOpen, context.Canceled, context.DeadlineExceeded} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unwrapは、包んだデータストアを返す
+func (rds RetryDataStore) Unwrap() DataStore {
+	return rds.ds
+}
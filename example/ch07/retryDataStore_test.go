@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// flakyStoreは、最初のfailures回はerrを返し、その後はFredを返すDataStore
+type flakyStore struct {
+	failures int
+	err      error
+	calls    int
+}
+
+func (fs *flakyStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	fs.calls++
+	if fs.calls <= fs.failures {
+		return "", false, fs.err
+	}
+	return "Fred", true, nil
+}
+
+func TestRetryDataStoreSucceedsAfterFailures(t *testing.T) {
+	fs := &flakyStore{failures: 2, err: errors.New("flaky")}
+	rds := NewRetryDataStore(fs, 3, time.Millisecond)
+	name, ok, err := rds.UserNameForID(context.Background(), "1")
+	if name != "Fred" || !ok || err != nil {
+		t.Errorf("UserNameForID = %q, %v, %v; want Fred, true, nil", name, ok, err)
+	}
+	if fs.calls != 3 {
+		t.Errorf("calls = %d, want 3", fs.calls)
+	}
+}
+
+func TestRetryDataStoreGivesUp(t *testing.T) {
+	flaky := errors.New("flaky")
+	fs := &flakyStore{failures: 5, err: flaky}
+	_, _, err := NewRetryDataStore(fs, 3, time.Millisecond).UserNameForID(context.Background(), "1")
+	if !errors.Is(err, flaky) {
+		t.Errorf("err = %v, want the last error from the store", err)
+	}
+	if fs.calls != 3 {
+		t.Errorf("calls = %d, want 3", fs.calls)
+	}
+}
+
+// 待っている間にcontextがキャンセルされたら、やり直さずにすぐ戻る
+func TestRetryDataStoreStopsOnCancel(t *testing.T) {
+	fs := &flakyStore{failures: 5, err: errors.New("flaky")}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := NewRetryDataStore(fs, 3, time.Hour).UserNameForID(ctx, "1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if fs.calls != 1 {
+		t.Errorf("calls = %d, want 1", fs.calls)
+	}
+}
+
+// やり直しても変わらないエラーは、包んだエラーでもやり直さずにすぐ返す
+func TestRetryDataStoreDoesNotRetryPermanentErrors(t *testing.T) {
+	for _, permanent := range []error{ErrUserDisabled, ErrCircuitOpen, context.Canceled, context.DeadlineExceeded} {
+		fs := &flakyStore{failures: 5, err: fmt.Errorf("wrapped: %w", permanent)}
+		_, _, err := NewRetryDataStore(fs, 3, time.Hour).UserNameForID(context.Background(), "1")
+		if !errors.Is(err, permanent) {
+			t.Errorf("err = %v, want %v", err, permanent)
+		}
+		if fs.calls != 1 {
+			t.Errorf("%v: calls = %d, want 1", permanent, fs.calls)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rotatedSuffixLayoutは、ローテーションしたファイルの名前の後ろに付ける時刻の形式。名前の順が時刻の順になる。
+const rotatedSuffixLayout = "20060102T150405.000000000"
+
+// RotatingFileLoggerは、1行に1つのメッセージをファイルに書き込み、maxBytesを超えそうになったら新しいファイルに切り替えるLogger。
+// それまでのファイルは"app.log.20240102T030405.000000000"のように時刻を付けた名前に変え、新しいものからmaxBackups個だけ残す。
+// 複数のゴルーチンから同時に使ってもよい。
+type RotatingFileLogger struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewRotatingFileLoggerは、pathに書き込むRotatingFileLoggerを生成するファクトリ関数。
+// pathが既にあれば、その後ろに書き足す。使い終わったらCloseを呼ぶ。
+func NewRotatingFileLogger(path string, maxBytes int64, maxBackups int) (*RotatingFileLogger, error) {
+	rl := &RotatingFileLogger{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := rl.open(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+func (rl *RotatingFileLogger) Log(message string) {
+	rl.write(message + "\n")
+}
+
+// Logfは、LoggerAdapterと同じく"[INFO] "のような接頭辞を付けて書き込む
+func (rl *RotatingFileLogger) Logf(level Level, format string, args ...any) {
+	rl.Log("[" + level.String() + "] " + fmt.Sprintf(format, args...))
+}
+
+// Writeは、pを1つの行としてそのまま書き込む。NewJSONLoggerに渡してJSONの行を書けるようにする。
+func (rl *RotatingFileLogger) Write(p []byte) (int, error) {
+	rl.write(string(p))
+	return len(p), nil
+}
+
+// writeは、lineを書き込む。書き込むとmaxBytesを超えるなら、先にローテーションする。
+// ローテーションに失敗したら、ログをなくさないように今のファイルに書き続ける。
+func (rl *RotatingFileLogger) write(line string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.size > 0 && rl.size+int64(len(line)) > rl.maxBytes {
+		if err := rl.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "ログをローテーションできません: %v\n", err)
+		}
+	}
+	n, _ := rl.f.WriteString(line)
+	rl.size += int64(n)
+}
+
+// openは、rl.pathを書き足す形で開く。rl.muを持って呼ぶこと。
+func (rl *RotatingFileLogger) open() error {
+	f, err := os.OpenFile(rl.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rl.f, rl.size = f, info.Size()
+	return nil
+}
+
+// rotateは、今のファイルを時刻を付けた名前に変えて新しいファイルを開き、古いファイルを消す。rl.muを持って呼ぶこと。
+func (rl *RotatingFileLogger) rotate() error {
+	if err := rl.f.Close(); err != nil {
+		return err
+	}
+	backup := rl.path + "." + time.Now().Format(rotatedSuffixLayout)
+	if err := os.Rename(rl.path, backup); err != nil {
+		// 名前を変えられなくても、書き続けられるように開き直す
+		if oerr := rl.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := rl.open(); err != nil {
+		return err
+	}
+	return rl.removeOldBackups()
+}
+
+// removeOldBackupsは、ローテーションしたファイルのうち、新しいものからmaxBackups個より古いものを消す
+func (rl *RotatingFileLogger) removeOldBackups() error {
+	backups, err := filepath.Glob(rl.path + ".*T*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > rl.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Closeは、今のファイルを閉じる
+func (rl *RotatingFileLogger) Close() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.f.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 同時に書き込んでもmaxBytesを超えたらローテーションし、バックアップはmaxBackups個だけ残る
+func TestRotatingFileLogger(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	rl, err := NewRotatingFileLogger(path, 100, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFileLogger: %v", err)
+	}
+	line := strings.Repeat("x", 19) // 改行を入れて20バイト
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				rl.Log(line)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := rl.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("backups = %v, want 2", backups)
+	}
+	for _, b := range backups {
+		data, err := os.ReadFile(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != 100 {
+			t.Errorf("%s has %d bytes, want 100", filepath.Base(b), len(data))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2000バイトを100バイトずつ書いたので、最後のローテーションの後に書いた分だけが残る
+	if len(data) == 0 || len(data) > 100 || len(data)%20 != 0 {
+		t.Errorf("active file has %d bytes, want a whole number of lines up to 100", len(data))
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if l != line {
+			t.Errorf("active file has a torn line %q", l)
+		}
+	}
+}
+
+// 既にあるファイルには書き足し、その大きさもmaxBytesに数える
+func TestRotatingFileLoggerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(strings.Repeat("y", 90)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rl, err := NewRotatingFileLogger(path, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl.Log("first line")
+	rl.Close()
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1", backups)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first line\n" {
+		t.Errorf("active file = %q, want only the new line", data)
+	}
+}
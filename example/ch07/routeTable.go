@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// RouteInfoは、登録された1つのパターンと、そのパターンで受け付けるメソッド。
+// Methodsが空なら、どのメソッドも受け付ける。
+type RouteInfo struct {
+	Pattern string   `json:"pattern"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// RouteTableは、muxに登録したパターンを覚えておく。ゼロ値で使える。
+// http.ServeMuxは登録されたパターンの一覧を返せないので、実際に何が登録されたかを/admin/routesで確かめるために使う。
+type RouteTable struct {
+	mu     sync.Mutex
+	routes map[string][]string
+}
+
+// Addは、patternをmethodsで受け付けることを覚える。同じパターンをもう一度Addすると、methodsを置き換える。
+func (rt *RouteTable) Add(pattern string, methods ...string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.routes == nil {
+		rt.routes = map[string][]string{}
+	}
+	rt.routes[pattern] = append([]string(nil), methods...)
+}
+
+// Routesは、覚えているパターンをパターンの順に並べて返す。それぞれのメソッドも並べておく。
+func (rt *RouteTable) Routes() []RouteInfo {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	out := make([]RouteInfo, 0, len(rt.routes))
+	for p, ms := range rt.routes {
+		ms = append([]string(nil), ms...)
+		sort.Strings(ms)
+		out = append(out, RouteInfo{Pattern: p, Methods: ms})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Pattern < out[j].Pattern })
+	return out
+}
+
+// RouteListは、GET /admin/routesで、登録されているパターンとメソッドの一覧をパターンの順にJSONで返す
+func (c Controller) RouteList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if c.routeTable == nil {
+		c.writeError(w, http.StatusNotImplemented, "登録したルートを覚えていません")
+		return
+	}
+	writeJSON(w, http.StatusOK, c.routeTable.Routes())
+}
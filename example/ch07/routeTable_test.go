@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// RegisterRoutesで登録したルートとAddで足したルートが、全て並んで/admin/routesに出る。APIキーがなければ401になる。
+func TestRouteList(t *testing.T) {
+	table := &RouteTable{}
+	c, _, _ := newTestController(WithRouteTable(table), WithAPIKeys(map[string]string{"k": ""}))
+	h := newTestHandler(t, c)
+	table.Add("/metrics")
+
+	if w := send(h, http.MethodGet, "/admin/routes", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: status %d, want 401", w.Code)
+	}
+	w := sendWithHeader(h, http.MethodGet, "/admin/routes", nil, "X-API-Key", "k")
+	var got []RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d %q, %v", w.Code, w.Body.String(), err)
+	}
+	if !sort.SliceIsSorted(got, func(i, j int) bool { return got[i].Pattern < got[j].Pattern }) {
+		t.Errorf("routes are not sorted by pattern: %+v", got)
+	}
+	routes := map[string][]string{}
+	for _, ri := range got {
+		routes[ri.Pattern] = ri.Methods
+	}
+	want := map[string][]string{
+		"/hello":        {http.MethodGet},
+		"/users":        {http.MethodDelete, http.MethodGet, http.MethodPost, http.MethodPut},
+		"/healthz":      {http.MethodGet},
+		"/admin/routes": {http.MethodGet},
+		"/metrics":      nil,
+	}
+	for pattern, methods := range want {
+		got, ok := routes[pattern]
+		if !ok {
+			t.Errorf("%s is not listed", pattern)
+			continue
+		}
+		if !reflect.DeepEqual(got, methods) {
+			t.Errorf("%s methods = %v, want %v", pattern, got, methods)
+		}
+	}
+}
+
+// Addし直すとメソッドを置き換え、Routesの結果を変えても中身は変わらない
+func TestRouteTableAdd(t *testing.T) {
+	var rt RouteTable
+	rt.Add("/b", http.MethodPost, http.MethodGet)
+	rt.Add("/a")
+	rt.Add("/b", http.MethodPut)
+	got := rt.Routes()
+	want := []RouteInfo{{Pattern: "/a"}, {Pattern: "/b", Methods: []string{http.MethodPut}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes() = %+v, want %+v", got, want)
+	}
+	got[1].Methods[0] = "changed"
+	if again := rt.Routes(); again[1].Methods[0] != http.MethodPut {
+		t.Errorf("changing the result changed the table: %+v", again)
+	}
+}
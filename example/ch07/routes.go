@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// routeは、muxに登録する1つのパターンとハンドラ、そのパターンで受け付けるメソッド、
+// ハンドラに掛けるミドルウェア。middlewareは先に書いたものほど外側になる。
+type route struct {
+	pattern    string
+	methods    []string
+	handler    http.Handler
+	middleware []func(http.Handler) http.Handler
+}
+
+// pprofPrefixは、net/http/pprofのハンドラを登録するパターン。この下のパスは、RedirectSlashMiddlewareで"/"を取らない。
+const pprofPrefix = "/debug/pprof/"
+
+// routesは、cのハンドラを登録するパターンの一覧を返す。
+// /healthz以外のルートにはobserveのミドルウェアを掛ける。ロードバランサーからの頻繁な確認でログやメトリクスが埋まらないように、/healthzには何も掛けない。
+// /users以下と/admin以下と/debug/pprof/以下と/whoamiは、さらにAuthMiddlewareを掛け、apiKeysのどれかをX-API-Keyヘッダで送ったリクエストだけが使える。
+// POST /usersは、Idempotency-Keyヘッダで送り直しても重複しない。
+// /users/{id}と/users/{id}/historyは、ほかの/users/で始まるパターンに当てはまらないパスを全て受け取るので、UserResourceで振り分ける。
+// /debug/pprof/以下はnet/http/pprofのハンドラで、/debug/pprof/heapのような名前のプロファイルはpprof.Indexが返す。
+// 挨拶するルートは、langクエリ、Accept-Languageヘッダ、WithLanguagesの既定の言語の順に、挨拶できる言語を探して挨拶する。/helloはAcceptヘッダに合わせてテキストかJSONで、/v1/helloはテキストで答える。/v2/helloは、名前や言語も入れたJSONで答える。
+func routes(c Controller, apiKeys map[string]string, observe ...func(http.Handler) http.Handler) []route {
+	v1, v2 := c, c
+	v1.enc = TextEncoder{}
+	v2.enc = JSONEncoder{}
+	get := []string{http.MethodGet}
+	post := []string{http.MethodPost}
+	auth := func(h http.Handler) http.Handler {
+		return AuthMiddleware(apiKeys, h)
+	}
+	idempotent := func(h http.Handler) http.Handler {
+		return IdempotencyMiddleware(c.idempotency, h)
+	}
+	// withは、observeの後ろにextraを足したミドルウェアの一覧を返す。observeの配列を共有しないように毎回作る。
+	with := func(extra ...func(http.Handler) http.Handler) []func(http.Handler) http.Handler {
+		return append(append([]func(http.Handler) http.Handler{}, observe...), extra...)
+	}
+	observed, authed := with(), with(auth)
+	// greetingは、挨拶するルートのミドルウェア。言語を一度だけ決めてcontextに入れ、Logicに伝える。
+	supports := c.supports
+	if supports == nil {
+		supports = defaultGreeter.Supports
+	}
+	language := func(h http.Handler) http.Handler {
+		return LanguagePreferenceMiddleware(supports, c.defaultLang, h)
+	}
+	greeting := with(language)
+	return []route{
+		{"/hello", get, c.negotiated(Controller.SayHello), greeting},
+		{"/v1/hello", get, http.HandlerFunc(v1.SayHello), greeting},
+		{"/v2/hello", get, http.HandlerFunc(v2.SayHelloDetailed), greeting},
+		{"/hello/batch", post, http.HandlerFunc(c.SayHelloBatch), greeting},
+		{"/hello/stream", post, http.HandlerFunc(c.SayHelloStream), greeting},
+		{"/goodbye", get, http.HandlerFunc(c.SayGoodbye), observed},
+		{"/greet", get, http.HandlerFunc(c.Greet), greeting},
+		{"/users", []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}, http.HandlerFunc(c.Users), with(auth, idempotent)},
+		{"/users/import", post, http.HandlerFunc(c.ImportUsers), authed},
+		{"/users/rekey", post, http.HandlerFunc(c.RekeyUser), authed},
+		{"/users/count", get, http.HandlerFunc(c.CountUsers), authed},
+		{"/users/search", get, http.HandlerFunc(c.SearchUsers), authed},
+		{"/users/", get, http.HandlerFunc(c.UserResource), authed},
+		{"/whoami", get, http.HandlerFunc(c.WhoAmI), with(auth, language)},
+		{"/healthz", get, http.HandlerFunc(c.HealthCheck), nil},
+		{"/admin/snapshot", get, http.HandlerFunc(c.Snapshot), authed},
+		{"/admin/restore", post, http.HandlerFunc(c.Restore), authed},
+		{"/admin/drain", post, http.HandlerFunc(c.DrainHandler), authed},
+		{"/admin/reload", post, http.HandlerFunc(c.Reload), authed},
+		{"/admin/verify", get, http.HandlerFunc(c.Verify), authed},
+		{"/admin/inflight", get, http.HandlerFunc(c.Inflight), authed},
+		{"/admin/routes", get, http.HandlerFunc(c.RouteList), authed},
+		{"/admin/error-rate", get, http.HandlerFunc(c.ErrorRate), authed},
+		{"/admin/maintenance", []string{http.MethodGet, http.MethodPost}, http.HandlerFunc(c.Maintenance), authed},
+		{pprofPrefix, get, http.HandlerFunc(pprof.Index), authed},
+		{pprofPrefix + "cmdline", get, http.HandlerFunc(pprof.Cmdline), authed},
+		{pprofPrefix + "profile", get, withoutWriteTimeout(http.HandlerFunc(pprof.Profile)), authed},
+		{pprofPrefix + "symbol", []string{http.MethodGet, http.MethodPost}, http.HandlerFunc(pprof.Symbol), authed},
+		{pprofPrefix + "trace", get, withoutWriteTimeout(http.HandlerFunc(pprof.Trace)), authed},
+	}
+}
+
+// RegisterRoutesは、cの全てのハンドラを、それぞれのルートのミドルウェアを掛けてからmuxに登録する。
+// observeは、/healthz以外のルートに掛けるLoggingMiddlewareやMetricsMiddlewareのようなミドルウェア。
+// 受け付けないメソッドは、どのミドルウェアよりも先に405にする。
+// http.DefaultServeMuxを使わないので、1つのプロセスで複数のサーバーを動かせる。
+// muxに既に登録されているパターンがあれば、net/httpのようにパニックせず、何も登録せずにエラーを返す。
+// flagsで無効にしたルートは、503を返すのではなく登録しないので、404になる。
+// cにWithRouteTableでRouteTableを渡してあれば、登録したパターンとメソッドをそこに覚えさせる。
+func RegisterRoutes(mux *http.ServeMux, c Controller, apiKeys map[string]string, flags FeatureFlags, observe ...func(http.Handler) http.Handler) error {
+	var rs []route
+	for _, rt := range routes(c, apiKeys, observe...) {
+		if feature := routeFeature(rt.pattern); feature == "" || flags.Enabled(feature) {
+			rs = append(rs, rt)
+		}
+	}
+	for _, rt := range rs {
+		if registered(mux, rt.pattern) {
+			return fmt.Errorf("%sは既に登録されています", rt.pattern)
+		}
+	}
+	for _, rt := range rs {
+		mux.Handle(rt.pattern, allowMethods(rt.methods, Chain(rt.middleware...)(rt.handler)))
+		if c.routeTable != nil {
+			c.routeTable.Add(rt.pattern, rt.methods...)
+		}
+	}
+	return nil
+}
+
+// Handlerは、cの全てのハンドラをそれぞれのルートのミドルウェアを掛けて登録し、全体にリクエストIDやパニックからの回復などのミドルウェアを掛けたハンドラを返す。
+// APIキーとフラグとミドルウェアは、WithAPIKeys、WithFeatureFlags、WithRouteMiddlewareで渡したものを使う。
+// WithMetricsやWithLogStream、WithRateLimiterのように渡さなかったものは、登録したり掛けたりしない。
+// Buildも結合テストもこれで組み立てるので、テストと本番でルートやミドルウェアの掛け方が食い違わない。
+// routesに同じパターンを2つ書いたときは、エラーを返す。
+func (c Controller) Handler() (http.Handler, error) {
+	mux, err := c.serveMux()
+	if err != nil {
+		return nil, err
+	}
+	if c.metrics != nil {
+		c.handleExtra(mux, "/metrics", c.metrics)
+		c.handleExtra(mux, "/metrics.json", MetricsJSONHandler(c.metrics, c.ds))
+	}
+	if c.logStream != nil {
+		c.handleExtra(mux, "/logs/stream", AuthMiddleware(c.apiKeys, c.logStream), http.MethodGet)
+	}
+	return c.globalMiddleware()(mux), nil
+}
+
+// handleExtraは、RegisterRoutesの外でmuxにpatternのhを登録する。/admin/routesにも出す。
+func (c Controller) handleExtra(mux *http.ServeMux, pattern string, h http.Handler, methods ...string) {
+	mux.Handle(pattern, h)
+	if c.routeTable != nil {
+		c.routeTable.Add(pattern, methods...)
+	}
+}
+
+// globalMiddlewareは、Handlerが全てのルートの外側に掛けるミドルウェアを、外側から順にまとめて返す
+func (c Controller) globalMiddleware() func(http.Handler) http.Handler {
+	mws := []func(http.Handler) http.Handler{
+		func(h http.Handler) http.Handler { return CORSMiddleware(c.corsOrigins, h) },
+	}
+	if c.inflight != nil {
+		mws = append(mws, func(h http.Handler) http.Handler { return InflightMiddleware(c.inflight, h) })
+	}
+	mws = append(mws, RequestIDMiddleware, ServerTimingMiddleware, GreetingVariantMiddleware)
+	if c.maintenance != nil {
+		mws = append(mws, func(h http.Handler) http.Handler { return MaintenanceMiddleware(c.maintenance, h) })
+	}
+	if c.maxURLLength > 0 {
+		mws = append(mws, func(h http.Handler) http.Handler { return MaxURLLengthMiddleware(c.maxURLLength, h) })
+	}
+	mws = append(mws, func(h http.Handler) http.Handler { return RedirectSlashMiddleware([]string{pprofPrefix}, h) })
+	if c.maxConcurrent > 0 {
+		mws = append(mws, func(h http.Handler) http.Handler { return ConcurrencyLimitMiddleware(c.maxConcurrent, h) })
+	}
+	mws = append(mws,
+		GzipMiddleware,
+		func(h http.Handler) http.Handler { return RecoverMiddleware(c.l, h) },
+		func(h http.Handler) http.Handler { return RequestTimeoutMiddleware(c.l, h) },
+	)
+	if c.rateLimiter != nil {
+		mws = append(mws, func(h http.Handler) http.Handler { return RateLimitMiddleware(c.rateLimiter, h) })
+	}
+	return Chain(mws...)
+}
+
+// serveMuxは、新しいmuxにRegisterRoutesでcのハンドラを登録する
+func (c Controller) serveMux() (*http.ServeMux, error) {
+	mux := http.NewServeMux()
+	if err := RegisterRoutes(mux, c, c.apiKeys, c.flags, c.observe...); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// registeredは、muxにpatternが既に登録されているかを返す
+func registered(mux *http.ServeMux, pattern string) bool {
+	_, p := mux.Handler(&http.Request{Method: http.MethodGet, URL: &url.URL{Path: pattern}})
+	return p == pattern
+}
+
+// allowMethodsは、methodsのリクエストだけをnextに渡し、ほかは405にする
+func allowMethods(methods []string, next http.Handler) http.Handler {
+	allowed := map[string]bool{}
+	for _, m := range methods {
+		allowed[m] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowed[r.Method] {
+			methodNotAllowed(w, methods...)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withoutWriteTimeoutは、サーバーのWriteTimeoutより長く書き続けるプロファイルのハンドラのために、このリクエストだけ書き込みの期限を外す。
+// pprofはcontextのサーバーのWriteTimeoutより長いsecondsを断るので、nextにはサーバーを見せない。
+func withoutWriteTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, nil)))
+	})
+}
+
+// methodNotAllowedは、受け付けるメソッドをAllowヘッダに入れて405を返す
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Controller.Handlerに、httptest.NewServerを通して/helloを送る
+func TestHandlerServesHello(t *testing.T) {
+	c, _, _ := newTestController(WithFeatureFlags(FeatureFlags{}))
+	srv := httptest.NewServer(newTestHandler(t, c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/hello?user_id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "Fredさん　こんにちは。" {
+		t.Errorf("got %d %q, want 200 Fredさん　こんにちは。", resp.StatusCode, body)
+	}
+}
+
+// 同じmuxに2回登録しようとしたら、パニックせずにどのパターンかがわかるエラーを返す
+func TestRegisterRoutesTwice(t *testing.T) {
+	c, _, _ := newTestController()
+	mux := http.NewServeMux()
+	if err := RegisterRoutes(mux, c, nil, nil); err != nil {
+		t.Fatalf("first RegisterRoutes: %v", err)
+	}
+	err := RegisterRoutes(mux, c, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "/hello") {
+		t.Errorf("second RegisterRoutes: err = %v, want an error naming /hello", err)
+	}
+}
+
+// /v1/helloと/v2/helloは、同じLogicの挨拶をテキストとJSONで返す
+func TestVersionedHello(t *testing.T) {
+	c, _, _ := newTestController()
+	h := newTestHandler(t, c)
+
+	w := send(h, http.MethodGet, "/v1/hello?user_id=1", nil)
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" || w.Body.String() != "Fredさん　こんにちは。" {
+		t.Errorf("/v1/hello: Content-Type %q, body %q", ct, w.Body.String())
+	}
+
+	w = send(h, http.MethodGet, "/v2/hello?user_id=1", nil)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("/v2/hello: Content-Type = %q, want application/json", ct)
+	}
+	var got GreetingResult
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("/v2/hello body %q: %v", w.Body.String(), err)
+	}
+	if got.Message != "Fredさん　こんにちは。" || got.Name != "Fred" {
+		t.Errorf("/v2/hello = %+v, want Fred's greeting", got)
+	}
+}
+
+// ルートが受け付けないメソッドは、ハンドラを呼ばずに405にし、Allowヘッダで受け付けるメソッドを示す
+func TestRoutesMethodNotAllowed(t *testing.T) {
+	c, _, _ := newTestController(WithAPIKeys(map[string]string{"secret": ""}))
+	h := newTestHandler(t, c)
+	tests := []struct {
+		method, target string
+		wantAllow      string
+	}{
+		{http.MethodPost, "/hello?user_id=1", "GET"},
+		{http.MethodDelete, "/goodbye?user_id=1", "GET"},
+		{http.MethodGet, "/hello/batch", "POST"},
+		{http.MethodPatch, "/users", "GET, POST, PUT, DELETE"},
+	}
+	for _, tt := range tests {
+		w := sendWithHeader(h, tt.method, tt.target, nil, "X-API-Key", "secret")
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != tt.wantAllow {
+			t.Errorf("%s %s: status = %d, Allow = %q; want 405, %q", tt.method, tt.target, w.Code, w.Header().Get("Allow"), tt.wantAllow)
+		}
+	}
+	if w := send(h, http.MethodGet, "/hello?user_id=1", nil); w.Code != http.StatusOK {
+		t.Errorf("GET /hello: status = %d, want 200", w.Code)
+	}
+}
+
+// ルートごとのミドルウェア: /usersだけがAPIキーを求め、/healthz以外はobserveを通る
+func TestHandlerPerRouteMiddleware(t *testing.T) {
+	var observed []string
+	observe := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			observed = append(observed, r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+	c, _, _ := newTestController(WithAPIKeys(map[string]string{"k": ""}), WithRouteMiddleware(observe))
+	h := newTestHandler(t, c)
+	tests := []struct {
+		name   string
+		target string
+		key    string
+		want   int
+	}{
+		{"users without a key", "/users", "", http.StatusUnauthorized},
+		{"users with a wrong key", "/users", "bad", http.StatusForbidden},
+		{"users with a key", "/users", "k", http.StatusOK},
+		{"healthz without a key", "/healthz", "", http.StatusOK},
+		{"hello without a key", "/hello?user_id=1", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header []string
+			if tt.key != "" {
+				header = []string{"X-API-Key", tt.key}
+			}
+			if w := sendWithHeader(h, http.MethodGet, tt.target, nil, header...); w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+	want := []string{"/users", "/users", "/users", "/hello"}
+	if strings.Join(observed, ",") != strings.Join(want, ",") {
+		t.Errorf("observed %v, want %v: /healthz must not be observed", observed, want)
+	}
+}
+
+// newTestHandlerは、c.Handlerで組み立てたハンドラを返す。組み立てられなければテストを止める。
+func newTestHandler(t *testing.T, c Controller) http.Handler {
+	t.Helper()
+	h, err := c.Handler()
+	if err != nil {
+		t.Fatalf("Handler: %v", err)
+	}
+	return h
+}
+
+// pprofのルートは、フラグで有効にしたときだけ登録され、APIキーがなければ使えない。
+// 全体のミドルウェアを掛けたHandlerでも、/debug/pprof/は末尾の"/"を取るリダイレクトにならない。
+func TestHandlerPprof(t *testing.T) {
+	for _, flags := range []FeatureFlags{nil, {FeaturePprof: false}, {FeaturePprof: true}} {
+		c, _, _ := newTestController(WithAPIKeys(map[string]string{"k": ""}), WithFeatureFlags(flags))
+		h := newTestHandler(t, c)
+		want := http.StatusNotFound
+		if flags.Enabled(FeaturePprof) {
+			want = http.StatusOK
+		}
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline"} {
+			if w := sendWithHeader(h, http.MethodGet, path, nil, "X-API-Key", "k"); w.Code != want {
+				t.Errorf("%v %s: status %d Location %q, want %d", flags, path, w.Code, w.Header().Get("Location"), want)
+			}
+		}
+		if want == http.StatusOK {
+			if w := send(h, http.MethodGet, "/debug/pprof/heap", nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("without a key: status %d, want 401", w.Code)
+			}
+		}
+	}
+}
+
+// CPUプロファイルは、サーバーのWriteTimeoutより長く取っても最後まで返る
+func TestHandlerPprofProfileOutlivesWriteTimeout(t *testing.T) {
+	c, _, _ := newTestController(WithAPIKeys(map[string]string{"k": ""}), WithFeatureFlags(FeatureFlags{FeaturePprof: true}))
+	srv := httptest.NewUnstartedServer(newTestHandler(t, c))
+	srv.Config.WriteTimeout = 200 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/debug/pprof/profile?seconds=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", "k")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /debug/pprof/profile: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Errorf("got %d with %d bytes, %v; want 200 and a profile", resp.StatusCode, len(body), err)
+	}
+}
+
+// Controller.Handlerが返すハンドラだけで、ルートごとのミドルウェアも全体のミドルウェアも掛かった/helloが動く
+func TestControllerHandler(t *testing.T) {
+	l := &MemoryLogger{}
+	c := NewController(l, NewSimpleLogic(l, NewSimpleDataStore(), DefaultConfig()), NewSimpleDataStore(),
+		WithAPIKeys(map[string]string{"k": "1"}), WithFeatureFlags(FeatureFlags{FeatureBatch: false}),
+		WithRouteMiddleware(func(h http.Handler) http.Handler { return LoggingMiddleware(l, h) }),
+		WithMetrics(NewMetrics()))
+	h, err := c.Handler()
+	if err != nil {
+		t.Fatalf("Handler: %v", err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/hello?user_id=1&lang=en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || string(body) != "Hello, Fred" {
+		t.Fatalf("got %d %q, %v; want 200 and the greeting", resp.StatusCode, body, err)
+	}
+	if resp.Header.Get("X-Request-ID") == "" {
+		t.Error("no X-Request-ID: the global middleware is missing")
+	}
+	if msgs := l.Messages(); len(msgs) == 0 || !strings.Contains(msgs[len(msgs)-1], "GET /hello 200") {
+		t.Errorf("logs %v do not have the access line from the route middleware", msgs)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/users/count", http.StatusUnauthorized},
+		{http.MethodPost, "/hello/batch", http.StatusNotFound},
+		{http.MethodGet, "/metrics", http.StatusOK},
+		{http.MethodGet, "/logs/stream", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader("[]"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
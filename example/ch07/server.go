@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// shutdownTimeoutは、終了時に処理中のリクエストを待つ最長の時間
+const shutdownTimeout = 5 * time.Second
+
+// defaultAddrは、-addrフラグにも設定ファイルにも環境変数ADDRにもアドレスがないときに使うアドレス
+const defaultAddr = ":8080"
+
+// resolveConfigは、サーバーの設定を決める。
+// -configフラグがあればそのファイルを、なければ環境変数を読む。
+// アドレスは、-addrフラグ、設定ファイル（なければ環境変数ADDR）、defaultAddrの順に優先する。
+// APIキーは、どちらの場合も環境変数API_KEYSから読む。
+func resolveConfig(args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	addr := fs.String("addr", defaultAddr, "サーバーが待ち受けるアドレス")
+	path := fs.String("config", "", "設定を読むJSONファイル")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if *path != "" {
+		var err error
+		if cfg, err = LoadConfig(*path); err != nil {
+			return Config{}, err
+		}
+	} else {
+		cfg = ConfigFromEnv(getenv)
+		if env := getenv("ADDR"); env != "" {
+			cfg.Addr = env
+		}
+	}
+	cfg.APIKeys = apiKeysFromEnv(getenv("API_KEYS"))
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "addr" {
+			cfg.Addr = *addr
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// newServerは、cfgのタイムアウトを設定したhttp.Serverを生成する
+func newServer(addr string, h http.Handler, cfg Config) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      h,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+}
+
+// serveは、ctxがキャンセルされるまでsrvでリクエストを処理する。
+// certFileとkeyFileがあればHTTPSで待ち受け、クライアントが対応していればHTTP/2を使う。
+// キャンセルされたらまずdrainを呼び、新しいリクエストの受付をやめ、処理中のリクエストが終わるのを待ってから戻る。
+// 待っている間は、inflightがnilでなければ残りの数を定期的にログに書く。待つのはshutdownTimeoutまで。
+func serve(ctx context.Context, l Logger, srv *http.Server, certFile, keyFile string, drain func(), inflight *InflightCounter) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if certFile != "" {
+			errCh <- srv.ListenAndServeTLS(certFile, keyFile)
+			return
+		}
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	l.Log("shutting down")
+	drain()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(shutdownCtx) }()
+	var waitErr error
+	if inflight != nil {
+		waitErr = inflight.WaitIdle(shutdownCtx, l, drainLogInterval)
+	}
+	if err := <-shutdownErr; err != nil {
+		return err
+	}
+	return waitErr
+}
+
+// reloadOnSignalは、ctxがキャンセルされるまで、sigに届くたびにrを読み直す。
+// 読み直せなくても前の状態のまま動き続けられるので、エラーはログに書くだけにする。
+func reloadOnSignal(ctx context.Context, l Logger, r Reloader, sig <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			if err := r.Reload(); err != nil {
+				l.Logf(LevelError, "reload: %v", err)
+				continue
+			}
+			l.Log("reloaded")
+		}
+	}
+}
+
+// multiReloaderは、全てのReloaderを読み直すReloader。
+// 1つが読み直せなくても残りは読み直し、読み直せなかったもののエラーをまとめて返す。
+type multiReloader []Reloader
+
+func (mr multiReloader) Reload() error {
+	var errs []error
+	for _, r := range mr {
+		if err := r.Reload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// storeReloaderは、データストアを読み直した後で、Controllerのキャッシュに覚えている結果を全て忘れさせるReloader
+type storeReloader struct {
+	Reloader
+	c Controller
+}
+
+func (sr storeReloader) Reload() error {
+	err := sr.Reloader.Reload()
+	sr.c.forget()
+	return err
+}
+
+// splitListは、"a, b,c"のようなカンマ区切りの値を、空の要素を除いたスライスにする
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// apiKeysFromEnvは、"key1:1,key2"のようなカンマ区切りの値をAuthMiddlewareに渡すマップにする。
+// ":"の後ろはそのキーを持つユーザーのIDで、省略するとユーザーのいないキーになる。
+func apiKeysFromEnv(value string) map[string]string {
+	keys := map[string]string{}
+	for _, item := range splitList(value) {
+		key, userID, _ := strings.Cut(item, ":")
+		keys[key] = userID
+	}
+	return keys
+}
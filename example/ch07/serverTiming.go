@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverTimingは、Server-Timingヘッダの1つの項目
+type serverTiming struct {
+	name string
+	dur  time.Duration
+}
+
+// serverTimingsは、1つのリクエストの間にAddServerTimingで足された時間。
+// ハンドラの中で別のゴルーチンから足されてもよいように、ロックで守る。
+type serverTimings struct {
+	mu      sync.Mutex
+	timings []serverTiming
+}
+
+// AddServerTimingは、ServerTimingMiddlewareの内側で、nameの処理にかかった時間dをServer-Timingヘッダに足す。
+// 同じnameを何度も足したら合計する。ServerTimingMiddlewareの外なら何もしない。
+func AddServerTiming(ctx context.Context, name string, d time.Duration) {
+	st, ok := ctx.Value(serverTimingKey).(*serverTimings)
+	if !ok {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i := range st.timings {
+		if st.timings[i].name == name {
+			st.timings[i].dur += d
+			return
+		}
+	}
+	st.timings = append(st.timings, serverTiming{name: name, dur: d})
+}
+
+// headerは、足された時間と、totalの時間をServer-Timingヘッダの値にする。時間はミリ秒で書く。
+func (st *serverTimings) header(total time.Duration) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	parts := make([]string, 0, len(st.timings)+1)
+	for _, t := range st.timings {
+		parts = append(parts, t.String())
+	}
+	parts = append(parts, serverTiming{name: "total", dur: total}.String())
+	return strings.Join(parts, ", ")
+}
+
+// Stringは、"store;dur=1.250"のようなServer-Timingヘッダの1項目を返す
+func (t serverTiming) String() string {
+	return t.name + ";dur=" + strconv.FormatFloat(float64(t.dur)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// ServerTimingMiddlewareは、レスポンスのServer-Timingヘッダで、ハンドラにかかった時間をtotalとして返す。
+// ハンドラやデータストアがAddServerTimingで足した時間も一緒に返す。
+// ヘッダは書き込む前にしか設定できないので、totalはハンドラが最初に書き込むまでの時間になる。
+func ServerTimingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := &serverTimings{}
+		tw := &serverTimingWriter{ResponseWriter: w, timings: st, start: time.Now()}
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingKey, st)))
+		if !tw.wrote {
+			tw.WriteHeader(http.StatusOK)
+		}
+	})
+}
+
+// serverTimingWriterは、最初に書き込まれるときにServer-Timingヘッダを設定するhttp.ResponseWriter
+type serverTimingWriter struct {
+	http.ResponseWriter
+	timings *serverTimings
+	start   time.Time
+	wrote   bool
+}
+
+func (tw *serverTimingWriter) WriteHeader(status int) {
+	if !tw.wrote {
+		tw.wrote = true
+		tw.Header().Set("Server-Timing", tw.timings.header(time.Since(tw.start)))
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *serverTimingWriter) Write(b []byte) (int, error) {
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flushは、包んだhttp.ResponseWriterがhttp.Flusherならそれを呼ぶ
+func (tw *serverTimingWriter) Flush() {
+	if !tw.wrote {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrapは、http.ResponseControllerが包まれたResponseWriterにたどり着けるようにする
+func (tw *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
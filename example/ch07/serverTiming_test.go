@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseServerTimingは、Server-Timingヘッダを名前からdurの値に変える。仕様どおりでなければエラーにする。
+func parseServerTiming(t *testing.T, header string) map[string]float64 {
+	t.Helper()
+	metrics := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+		if !ok || !strings.HasPrefix(params, "dur=") {
+			t.Fatalf("Server-Timing %q: %q has no dur", header, part)
+		}
+		dur, err := strconv.ParseFloat(strings.TrimPrefix(params, "dur="), 64)
+		if err != nil || dur < 0 {
+			t.Fatalf("Server-Timing %q: bad dur in %q", header, part)
+		}
+		metrics[name] = dur
+	}
+	return metrics
+}
+
+// 圧縮されるレスポンスにも、全体の時間とデータストアの検索の時間が付く
+func TestServerTimingMiddleware(t *testing.T) {
+	ds := NewObservedDataStore(NewSimpleDataStore(), NewMetrics())
+	c := NewController(&MemoryLogger{}, NewSimpleLogic(&MemoryLogger{}, ds, DefaultConfig()), ds)
+	h := ServerTimingMiddleware(GzipMiddleware(http.HandlerFunc(c.SayHello)))
+	w := sendWithHeader(h, http.MethodGet, "/hello?user_id=1", nil, "Accept-Encoding", "gzip")
+	metrics := parseServerTiming(t, w.Header().Get("Server-Timing"))
+	if _, ok := metrics["total"]; !ok {
+		t.Errorf("metrics = %v, want total", metrics)
+	}
+	if _, ok := metrics["store"]; !ok {
+		t.Errorf("metrics = %v, want store", metrics)
+	}
+
+	// 何も書かないハンドラにも、全体の時間だけは付く
+	w = send(ServerTimingMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})), http.MethodGet, "/", nil)
+	if metrics := parseServerTiming(t, w.Header().Get("Server-Timing")); len(metrics) != 1 {
+		t.Errorf("metrics = %v, want only total", metrics)
+	}
+}
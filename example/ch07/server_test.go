@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// freeAddrは、テストのサーバーが待ち受けられる"127.0.0.1:<port>"を返す
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// 終了の合図の後も、処理中のリクエストは最後まで返してからserveが戻ることを確かめる
+func TestServeGracefulShutdown(t *testing.T) {
+	addr := freeAddr(t)
+	started := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	l := &MemoryLogger{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, l, newServer(addr, h, DefaultConfig()), "", "", func() {}, nil)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + addr + "/"); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		got <- result{string(b), err}
+	}()
+	<-started
+	cancel()
+
+	if r := <-got; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request = %q, %v; want done, nil", r.body, r.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+	if !containsMessage(l.Messages(), "shutting down") {
+		t.Errorf("log = %q, want shutting down", l.Messages())
+	}
+}
+
+// アドレスは、-addrフラグ、環境変数ADDR、defaultAddrの順に優先する
+func TestResolveConfigAddrPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"default", nil, nil, defaultAddr},
+		{"env", nil, map[string]string{"ADDR": ":9000"}, ":9000"},
+		{"flag over env", []string{"-addr", ":9100"}, map[string]string{"ADDR": ":9000"}, ":9100"},
+		{"flag set to default over env", []string{"-addr", defaultAddr}, map[string]string{"ADDR": ":9000"}, defaultAddr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := resolveConfig(tt.args, func(key string) string { return tt.env[key] })
+			if err != nil {
+				t.Fatalf("resolveConfig: %v", err)
+			}
+			if cfg.Addr != tt.want {
+				t.Errorf("Addr = %q, want %q", cfg.Addr, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	srv := newServer(":0", http.NotFoundHandler(), DefaultConfig())
+	if srv.ReadTimeout != 5*time.Second || srv.WriteTimeout != 10*time.Second || srv.IdleTimeout != 120*time.Second {
+		t.Errorf("timeouts = %v/%v/%v, want 5s/10s/120s", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+// WriteTimeoutを過ぎてから書き込んだレスポンスは、クライアントに届かずに切られる
+func TestNewServerWriteTimeoutCutsOff(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.WriteTimeout = 50 * time.Millisecond
+	srv := newServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "late")
+	}), cfg)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if b, err := io.ReadAll(resp.Body); err == nil {
+		t.Errorf("got %d %q, want the response to be cut off", resp.StatusCode, b)
+	}
+}
+
+// countingReloaderは、Reloadが呼ばれた回数を数え、errを返すReloader
+type countingReloader struct {
+	calls chan struct{}
+	err   error
+}
+
+func (cr countingReloader) Reload() error {
+	cr.calls <- struct{}{}
+	return cr.err
+}
+
+// シグナルが届くたびに読み直し、読み直せなくても止まらずにエラーをログに書く
+func TestReloadOnSignal(t *testing.T) {
+	for _, reloadErr := range []error{nil, errors.New("broken file")} {
+		l := &MemoryLogger{}
+		cr := countingReloader{calls: make(chan struct{}), err: reloadErr}
+		sig := make(chan os.Signal)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			reloadOnSignal(ctx, l, cr, sig)
+			close(done)
+		}()
+		for i := 0; i < 2; i++ {
+			sig <- syscall.SIGHUP
+			<-cr.calls
+		}
+		cancel()
+		<-done
+		want := "reloaded"
+		if reloadErr != nil {
+			want = "reload: broken file"
+		}
+		if n := strings.Count(strings.Join(l.Messages(), "\n"), want); n != 2 {
+			t.Errorf("reload error %v: logged %q %d times, want 2 (messages %v)", reloadErr, want, n, l.Messages())
+		}
+	}
+}
+
+// SIGHUPでデータストアを読み直したら、Controllerのキャッシュも空になる
+func TestStoreReloaderPurgesCaches(t *testing.T) {
+	cds := NewCacheDataStore(NewSimpleDataStore(), time.Hour, 100, nil)
+	cds.UserNameForID(context.Background(), "1")
+	c, _, _ := newTestController(WithStoreCaches(cds))
+	reloadErr := errors.New("broken file")
+	cr := countingReloader{calls: make(chan struct{}, 1), err: reloadErr}
+	if err := (storeReloader{cr, c}).Reload(); !errors.Is(err, reloadErr) {
+		t.Errorf("Reload() = %v, want %v", err, reloadErr)
+	}
+	if len(cr.calls) != 1 {
+		t.Error("the store was not reloaded")
+	}
+	if n := cds.Len(); n != 0 {
+		t.Errorf("after Reload: cache Len() = %d, want 0", n)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+)
+
+// ShardedDataStoreは、ユーザーIDのハッシュで選んだ1つのDataStoreだけを使うDataStore。
+// ユーザーを複数のSimpleDataStoreに分けて持てば、1つの大きなマップより書き込みのロックを取り合わずに済む。
+// 同じユーザーIDは常に同じシャードに入るので、シャードの数を変えると、それまでのユーザーは見つからなくなる。
+type ShardedDataStore struct {
+	shards []WritableDataStore
+	// idGenは、AddUserが全てのシャードに共通のIDを作るのに使う
+	idGen IDGenerator
+}
+
+// NewShardedDataStoreは、shardsにユーザーを分けて持つShardedDataStoreを生成するファクトリ関数。
+// shardsは1つ以上渡すこと。AddUserのIDはSequentialIDGeneratorで作る。
+func NewShardedDataStore(shards ...WritableDataStore) ShardedDataStore {
+	return NewShardedDataStoreWithIDGenerator(&SequentialIDGenerator{}, shards...)
+}
+
+// NewShardedDataStoreWithIDGeneratorは、AddUserのIDをgで作るShardedDataStoreを生成するファクトリ関数。
+// gは全てのシャードで1つだけなので、シャードの数によらずIDは重ならない。
+func NewShardedDataStoreWithIDGenerator(g IDGenerator, shards ...WritableDataStore) ShardedDataStore {
+	return ShardedDataStore{shards: shards, idGen: g}
+}
+
+// shardIndexは、userIDのFNV-1aハッシュをシャードの数で割った余りを返す
+func (sds ShardedDataStore) shardIndex(userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return int(h.Sum32() % uint32(len(sds.shards)))
+}
+
+func (sds ShardedDataStore) shard(userID string) WritableDataStore {
+	return sds.shards[sds.shardIndex(userID)]
+}
+
+func (sds ShardedDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	return sds.shard(userID).UserNameForID(ctx, userID)
+}
+
+func (sds ShardedDataStore) AddUserForID(userID, name string) error {
+	return sds.shard(userID).AddUserForID(userID, name)
+}
+
+func (sds ShardedDataStore) UpdateUserForID(userID, newName string) error {
+	return sds.shard(userID).UpdateUserForID(userID, newName)
+}
+
+func (sds ShardedDataStore) DeleteUserForID(userID string) error {
+	return sds.shard(userID).DeleteUserForID(userID)
+}
+
+// AddUserは、全てのシャードに共通のIDGeneratorで作ったIDでユーザーを追加し、そのIDを返す。
+// シャードごとのAddUserを使うと、それぞれが別々に数えたIDが重なるので使わない。
+// 作ったIDがAddUserForIDで既に使われていれば、使われていないIDができるまで作り直す。
+func (sds ShardedDataStore) AddUser(name string) (string, error) {
+	for {
+		id, err := sds.idGen.NewID()
+		if err != nil {
+			return "", err
+		}
+		err = sds.AddUserForID(id, name)
+		if errors.Is(err, ErrUserExists) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return id, nil
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// ユーザーはIDで決まるシャードに入り、ShardedDataStoreからはどのシャードのユーザーも見つかる
+func TestShardedDataStoreRouting(t *testing.T) {
+	shards := []*SimpleDataStore{{}, {}, {}}
+	sds := NewShardedDataStore(shards[0], shards[1], shards[2])
+	ctx := context.Background()
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, id := range ids {
+		if err := sds.AddUserForID(id, "N"+id); err != nil {
+			t.Fatalf("AddUserForID(%s): %v", id, err)
+		}
+	}
+	used := map[int]bool{}
+	for _, id := range ids {
+		i := sds.shardIndex(id)
+		if again := NewShardedDataStore(shards[0], shards[1], shards[2]).shardIndex(id); again != i {
+			t.Errorf("shardIndex(%s) = %d, then %d; want the same shard", id, i, again)
+		}
+		used[i] = true
+		for j, shard := range shards {
+			if _, ok, _ := shard.UserNameForID(ctx, id); ok != (j == i) {
+				t.Errorf("user %s on shard %d: %v, want only on shard %d", id, j, ok, i)
+			}
+		}
+		if name, ok, _ := sds.UserNameForID(ctx, id); !ok || name != "N"+id {
+			t.Errorf("UserNameForID(%s) = %q, %v; want N%s", id, name, ok, id)
+		}
+	}
+	if len(used) < 2 {
+		t.Errorf("all users landed on shards %v, want them spread", used)
+	}
+	if err := sds.UpdateUserForID("a", "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	if name, _, _ := shards[sds.shardIndex("a")].UserNameForID(ctx, "a"); name != "Ann" {
+		t.Errorf("update went elsewhere: user a on its shard = %q", name)
+	}
+	if err := sds.DeleteUserForID("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := sds.UserNameForID(ctx, "a"); ok {
+		t.Error("user a is still there after DeleteUserForID")
+	}
+}
+
+// AddUserは、全てのシャードで共通のIDを使い、重なったら作り直す
+func TestShardedDataStoreAddUser(t *testing.T) {
+	// どちらのシャードに振られても重なるように、両方に"1"を入れておく
+	a, b := &SimpleDataStore{}, &SimpleDataStore{}
+	a.AddUserForID("1", "Fred")
+	b.AddUserForID("1", "Fred")
+	sds := NewShardedDataStoreWithIDGenerator(&fakeIDGenerator{ids: []string{"1", "2"}}, a, b)
+	if id, err := sds.AddUser("Ann"); err != nil || id != "2" {
+		t.Errorf("AddUser = %q, %v; want 2, nil", id, err)
+	}
+}
+
+// 多くのゴルーチンから同時にAddUserしても、どのシャードに振られたIDも重ならず、正しいシャードに入る
+func TestShardedDataStoreAddUserUnique(t *testing.T) {
+	shards := []*SimpleDataStore{{}, {}, {}}
+	sds := NewShardedDataStore(shards[0], shards[1], shards[2])
+	if err := sds.AddUserForID("5", "Pre"); err != nil {
+		t.Fatal(err)
+	}
+	const goroutines, perGoroutine = 8, 100
+	var (
+		mu   sync.Mutex
+		seen = map[string]bool{"5": true}
+		wg   sync.WaitGroup
+	)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				id, err := sds.AddUser("Ann")
+				if err != nil {
+					t.Errorf("AddUser: %v", err)
+					return
+				}
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("AddUser returned %q twice", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i, shard := range shards {
+		for id := range shard.AllUsers() {
+			if got := sds.shardIndex(id); got != i {
+				t.Errorf("user %q is in shard %d, want %d", id, i, got)
+			}
+			total++
+		}
+	}
+	if want := goroutines*perGoroutine + 1; total != want {
+		t.Errorf("%d users across the shards, want %d", total, want)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// 100個のゴルーチンから同時に読み書きしても壊れないことを確かめる。go test -raceで走らせること。
+func TestSimpleDataStoreConcurrentAccess(t *testing.T) {
+	const goroutines = 100
+	ds := NewSimpleDataStore()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := "u" + strconv.Itoa(i)
+			if err := ds.AddUserForID(id, "name"+strconv.Itoa(i)); err != nil {
+				t.Errorf("AddUserForID(%q): %v", id, err)
+				return
+			}
+			if _, _, err := ds.UserNameForID(ctx, "1"); err != nil {
+				t.Errorf("UserNameForID(1): %v", err)
+			}
+			if err := ds.UpdateUserForID(id, "renamed"); err != nil {
+				t.Errorf("UpdateUserForID(%q): %v", id, err)
+			}
+			ds.AllUsers()
+			if i%2 == 0 {
+				if err := ds.DeleteUserForID(id); err != nil {
+					t.Errorf("DeleteUserForID(%q): %v", id, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < goroutines; i++ {
+		id := "u" + strconv.Itoa(i)
+		name, ok, err := ds.UserNameForID(ctx, id)
+		if err != nil {
+			t.Fatalf("UserNameForID(%q): %v", id, err)
+		}
+		if wantOK := i%2 == 1; ok != wantOK || (ok && name != "renamed") {
+			t.Errorf("UserNameForID(%q) = %q, %v; want renamed, %v", id, name, ok, wantOK)
+		}
+	}
+}
+
+// ゼロ値のSimpleDataStoreも、空のデータストアとしてそのまま書き込めることを確かめる
+func TestSimpleDataStoreZeroValue(t *testing.T) {
+	var ds SimpleDataStore
+	if _, ok, err := ds.UserNameForID(context.Background(), "1"); ok || err != nil {
+		t.Fatalf("UserNameForID on zero value = %v, %v; want not found", ok, err)
+	}
+	if err := ds.AddUserForID("1", "Fred"); err != nil {
+		t.Fatalf("AddUserForID on zero value: %v", err)
+	}
+	if name, ok, _ := ds.UserNameForID(context.Background(), "1"); !ok || name != "Fred" {
+		t.Errorf("UserNameForID(1) = %q, %v; want Fred, true", name, ok)
+	}
+}
+
+// AllUsersは内部のマップではなくコピーを返す
+func TestSimpleDataStoreAllUsersCopy(t *testing.T) {
+	ds := NewSimpleDataStore()
+	ds.AllUsers()["1"] = "changed"
+	if name, _, _ := ds.UserNameForID(context.Background(), "1"); name != "Fred" {
+		t.Errorf("UserNameForID(1) = %q after changing the AllUsers result, want Fred", name)
+	}
+}
+
+func TestSimpleDataStoreImportUsers(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+		want      int
+		wantFred  string
+	}{
+		{"skip", false, 1, "Fred"},
+		{"overwrite", true, 2, "Freddie"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := NewSimpleDataStore()
+			n, err := ds.ImportUsers(map[string]string{"1": "Freddie", "4": "Ann"}, tt.overwrite)
+			if err != nil || n != tt.want {
+				t.Fatalf("ImportUsers = %d, %v; want %d, nil", n, err, tt.want)
+			}
+			if name, _, _ := ds.UserNameForID(context.Background(), "1"); name != tt.wantFred {
+				t.Errorf("user 1 = %q, want %q", name, tt.wantFred)
+			}
+			if name, _, _ := ds.UserNameForID(context.Background(), "4"); name != "Ann" {
+				t.Errorf("user 4 = %q, want Ann", name)
+			}
+		})
+	}
+}
+
+// 空の名前が1つでもあれば、何も追加せずにどのキーが悪いかを返す
+func TestSimpleDataStoreImportUsersInvalid(t *testing.T) {
+	ds := NewSimpleDataStore()
+	_, err := ds.ImportUsers(map[string]string{"4": "Ann", "5": "", "6": ""}, false)
+	var ie ImportError
+	if !errors.As(err, &ie) || !reflect.DeepEqual(ie.Keys, []string{"5", "6"}) {
+		t.Fatalf("err = %v, want ImportError for keys 5 and 6", err)
+	}
+	if _, ok, _ := ds.UserNameForID(context.Background(), "4"); ok {
+		t.Error("user 4 was imported although the batch was rejected")
+	}
+}
+
+// 同時に追加と削除をしても、UserCountが正しく数える
+func TestSimpleDataStoreUserCount(t *testing.T) {
+	ds := NewSimpleDataStore()
+	if n := ds.UserCount(); n != 3 {
+		t.Fatalf("UserCount() = %d, want 3", n)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ds.AddUserForID("u"+strconv.Itoa(i), "name")
+		}(i)
+	}
+	wg.Wait()
+	if n := ds.UserCount(); n != 23 {
+		t.Errorf("after adding 20 users: UserCount() = %d, want 23", n)
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ds.DeleteUserForID("u" + strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+	if n := ds.UserCount(); n != 13 {
+		t.Errorf("after deleting 10 users: UserCount() = %d, want 13", n)
+	}
+}
+
+// スナップショットを取ってから書き換えても、Restoreすれば元の中身に戻る
+func TestSimpleDataStoreSnapshotRestore(t *testing.T) {
+	ds := NewSimpleDataStore()
+	snap, err := ds.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ds.AllUsers()
+	ds.AddUserForID("4", "Ann")
+	ds.UpdateUserForID("1", "Freddie")
+	ds.DeleteUserForID("2")
+
+	if err := ds.Restore(snap); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got := ds.AllUsers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after Restore: AllUsers() = %v, want %v", got, want)
+	}
+	if err := ds.Restore([]byte("{not json")); err == nil {
+		t.Error("Restore of invalid JSON: no error")
+	}
+	if got := ds.AllUsers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("a failed Restore changed the store to %v", got)
+	}
+}
+
+func TestSimpleDataStoreSearchByNamePrefix(t *testing.T) {
+	ds := NewSimpleDataStore()
+	ds.AddUserForID("4", "mark")
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"ma", []string{"2", "4"}},
+		{"MA", []string{"2", "4"}},
+		{"Fr", []string{"1"}},
+		{"zz", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := ds.SearchByNamePrefix(tt.prefix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SearchByNamePrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+// RekeyUserは名前を新しいIDに移し、OnChangeには古いIDの削除と新しいIDの追加を知らせる
+func TestSimpleDataStoreRekeyUser(t *testing.T) {
+	ds := NewSimpleDataStore()
+	var events []ChangeEvent
+	ds.OnChange(func(e ChangeEvent) { events = append(events, e) })
+	if err := ds.RekeyUser("1", "10"); err != nil {
+		t.Fatalf("RekeyUser: %v", err)
+	}
+	if name, ok, _ := ds.UserNameForID(context.Background(), "10"); !ok || name != "Fred" {
+		t.Errorf("user 10 = %q, %v; want Fred", name, ok)
+	}
+	if _, ok, _ := ds.UserNameForID(context.Background(), "1"); ok {
+		t.Error("user 1 is still there after the rekey")
+	}
+	want := []ChangeEvent{
+		{Op: ChangeDelete, UserID: "1", OldName: "Fred"},
+		{Op: ChangeAdd, UserID: "10", NewName: "Fred"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+
+	errTests := []struct {
+		name         string
+		oldID, newID string
+		want         error
+	}{
+		{"missing source", "nope", "11", ErrUnknownUser},
+		{"conflicting destination", "2", "3", ErrUserExists},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ds.RekeyUser(tt.oldID, tt.newID); !errors.Is(err, tt.want) {
+				t.Errorf("RekeyUser(%s, %s) = %v, want %v", tt.oldID, tt.newID, err, tt.want)
+			}
+		})
+	}
+	if name, _, _ := ds.UserNameForID(context.Background(), "2"); name != "Mary" {
+		t.Errorf("a failed rekey changed user 2 to %q", name)
+	}
+}
+
+// 無効にしたユーザーは残ったままErrUserDisabledを返し、SnapshotとRestoreを通しても無効のまま
+func TestSimpleDataStoreDisableUser(t *testing.T) {
+	ds := NewSimpleDataStore()
+	ctx := context.Background()
+	if err := ds.DisableUser("1"); err != nil {
+		t.Fatalf("DisableUser: %v", err)
+	}
+	if _, _, err := ds.UserNameForID(ctx, "1"); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("UserNameForID(1) err = %v, want ErrUserDisabled", err)
+	}
+	if n := ds.UserCount(); n != 3 {
+		t.Errorf("UserCount() = %d, want 3: a disabled user is still stored", n)
+	}
+
+	snap, err := ds.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"1":{"name":"Fred","disabled":true}`, `"2":"Mary"`} {
+		if !strings.Contains(string(snap), want) {
+			t.Errorf("Snapshot() = %s, want it to contain %s", snap, want)
+		}
+	}
+	restored := &SimpleDataStore{}
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if _, _, err := restored.UserNameForID(ctx, "1"); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("restored user 1: err = %v, want ErrUserDisabled", err)
+	}
+
+	if err := ds.EnableUser("1"); err != nil {
+		t.Fatalf("EnableUser: %v", err)
+	}
+	if name, ok, err := ds.UserNameForID(ctx, "1"); err != nil || !ok || name != "Fred" {
+		t.Errorf("after EnableUser: UserNameForID(1) = %q, %v, %v; want Fred", name, ok, err)
+	}
+	for _, f := range []func(string) error{ds.DisableUser, ds.EnableUser} {
+		if err := f("nope"); !errors.Is(err, ErrUnknownUser) {
+			t.Errorf("unknown user: err = %v, want ErrUnknownUser", err)
+		}
+	}
+}
+
+// SnapshotToは、Snapshotと同じJSONを書き、Restoreすると元の中身に戻る
+func TestSimpleDataStoreSnapshotTo(t *testing.T) {
+	ds := NewSimpleDataStore()
+	ds.AddUserForID(`a"b`, "Q")
+	ds.DisableUser("2")
+	var buf bytes.Buffer
+	if err := ds.SnapshotTo(&buf); err != nil {
+		t.Fatalf("SnapshotTo: %v", err)
+	}
+	want, err := ds.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(want) {
+		t.Errorf("SnapshotTo wrote %s, want the same as Snapshot: %s", buf.String(), want)
+	}
+	restored := &SimpleDataStore{}
+	if err := restored.Restore(buf.Bytes()); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if !reflect.DeepEqual(restored.userData, ds.userData) {
+		t.Errorf("restored %v, want %v", restored.userData, ds.userData)
+	}
+
+	buf.Reset()
+	if err := (&SimpleDataStore{}).SnapshotTo(&buf); err != nil || buf.String() != "{}" {
+		t.Errorf("empty store: SnapshotTo wrote %q, %v; want {}", buf.String(), err)
+	}
+}
+
+// 同じ新しいIDに同時にGetOrCreateしても、作るのは1回だけで、全員が同じ名前を受け取る
+func TestSimpleDataStoreGetOrCreate(t *testing.T) {
+	ds := NewSimpleDataStore()
+	var (
+		mu      sync.Mutex
+		created int
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name, c, err := ds.GetOrCreate("new", "Newbie"+strconv.Itoa(i))
+			if err != nil || !strings.HasPrefix(name, "Newbie") {
+				t.Errorf("GetOrCreate = %q, %v", name, err)
+			}
+			if c {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("%d callers reported created, want 1", created)
+	}
+	stored, _, _ := ds.UserNameForID(context.Background(), "new")
+	if name, c, err := ds.GetOrCreate("new", "Other"); err != nil || c || name != stored {
+		t.Errorf("existing user: GetOrCreate = %q, %v, %v; want %q, false, nil", name, c, err, stored)
+	}
+	if name, c, _ := ds.GetOrCreate("1", "Other"); c || name != "Fred" {
+		t.Errorf("GetOrCreate(1) = %q, %v; want Fred, false", name, c)
+	}
+}
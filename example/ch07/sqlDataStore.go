@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SQLDataStoreは、database/sqlのusersテーブル（id, name）にユーザーを保存するデータストア。
+// プレースホルダには?を使うので、SQLiteやMySQLのようなドライバを前提にしている。
+// テーブルはMigrateで作る。
+type SQLDataStore struct {
+	db *sql.DB
+}
+
+// NewSQLDataStoreは、dbを使うSQLDataStoreを生成するファクトリ関数
+func NewSQLDataStore(db *sql.DB) SQLDataStore {
+	return SQLDataStore{db: db}
+}
+
+func (sqds SQLDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	var name string
+	err := sqds.db.QueryRowContext(ctx, "SELECT name FROM users WHERE id = ?", userID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return name, true, nil
+}
+
+func (sqds SQLDataStore) Ping(ctx context.Context) error {
+	return sqds.db.PingContext(ctx)
+}
+
+// Closeは、データベースへの接続を閉じる
+func (sqds SQLDataStore) Close() error {
+	return sqds.db.Close()
+}
+
+func (sqds SQLDataStore) AddUserForID(userID, name string) error {
+	res, err := sqds.db.ExecContext(context.Background(),
+		"INSERT INTO users (id, name) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = ?)",
+		userID, name, userID)
+	if err != nil {
+		return err
+	}
+	return errIfNoRows(res, ErrUserExists)
+}
+
+func (sqds SQLDataStore) UpdateUserForID(userID, newName string) error {
+	res, err := sqds.db.ExecContext(context.Background(), "UPDATE users SET name = ? WHERE id = ?", newName, userID)
+	if err != nil {
+		return err
+	}
+	return errIfNoRows(res, ErrUnknownUser)
+}
+
+func (sqds SQLDataStore) DeleteUserForID(userID string) error {
+	res, err := sqds.db.ExecContext(context.Background(), "DELETE FROM users WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+	return errIfNoRows(res, ErrUnknownUser)
+}
+
+// errIfNoRowsは、resで1行も変更されていなければerrを返す
+func errIfNoRows(res sql.Result, err error) error {
+	n, rerr := res.RowsAffected()
+	if rerr != nil {
+		return rerr
+	}
+	if n == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memDBは、memSQLDriverが1つのDSNごとに持つ、メモリ上のusersテーブルとschema_versionテーブル
+type memDB struct {
+	mu       sync.Mutex
+	users    map[string]string
+	versions []int64
+	execs    []string
+}
+
+// memSQLDriverは、SQLDataStoreとMigrateが実行するSQLだけを解釈する、テスト用のdatabase/sqlドライバ
+type memSQLDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*memDB
+}
+
+var memSQL = &memSQLDriver{dbs: map[string]*memDB{}}
+
+func init() {
+	sql.Register("memsql", memSQL)
+}
+
+// openMemSQLは、テストごとに別のメモリ上のデータベースを開き、テストの終わりに閉じる
+func openMemSQL(t *testing.T) (*sql.DB, *memDB) {
+	t.Helper()
+	db, err := sql.Open("memsql", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, memSQL.db(t.Name())
+}
+
+func (d *memSQLDriver) db(dsn string) *memDB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dbs[dsn] == nil {
+		d.dbs[dsn] = &memDB{users: map[string]string{}}
+	}
+	return d.dbs[dsn]
+}
+
+func (d *memSQLDriver) Open(dsn string) (driver.Conn, error) {
+	return memConn{d.db(dsn)}, nil
+}
+
+type memConn struct {
+	db *memDB
+}
+
+func (c memConn) Prepare(query string) (driver.Stmt, error) { return memStmt{c.db, query}, nil }
+func (c memConn) Close() error                              { return nil }
+func (c memConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c memConn) Commit() error                             { return nil }
+func (c memConn) Rollback() error                           { return nil }
+
+type memStmt struct {
+	db    *memDB
+	query string
+}
+
+func (s memStmt) Close() error  { return nil }
+func (s memStmt) NumInput() int { return strings.Count(s.query, "?") }
+
+func (s memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.execs = append(db.execs, s.query)
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(s.query, "INSERT INTO schema_version"):
+		db.versions = append(db.versions, args[0].(int64))
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "INSERT INTO users"):
+		id := args[0].(string)
+		if _, ok := db.users[id]; ok {
+			return driver.RowsAffected(0), nil
+		}
+		db.users[id] = args[1].(string)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "UPDATE users"):
+		id := args[1].(string)
+		if _, ok := db.users[id]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		db.users[id] = args[0].(string)
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "DELETE FROM users"):
+		id := args[0].(string)
+		if _, ok := db.users[id]; !ok {
+			return driver.RowsAffected(0), nil
+		}
+		delete(db.users, id)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("memsql: unsupported exec %q", s.query)
+}
+
+func (s memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "SELECT name FROM users"):
+		name, ok := db.users[args[0].(string)]
+		if !ok {
+			return &memRows{}, nil
+		}
+		return &memRows{values: []driver.Value{name}}, nil
+	case strings.Contains(s.query, "FROM schema_version"):
+		var max int64
+		for _, v := range db.versions {
+			if v > max {
+				max = v
+			}
+		}
+		return &memRows{values: []driver.Value{max}}, nil
+	}
+	return nil, fmt.Errorf("memsql: unsupported query %q", s.query)
+}
+
+// memRowsは、1列の結果を1行ずつ返す
+type memRows struct {
+	values []driver.Value
+}
+
+func (r *memRows) Columns() []string { return []string{"value"} }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func TestSQLDataStore(t *testing.T) {
+	db, _ := openMemSQL(t)
+	ds := NewSQLDataStore(db)
+	ctx := context.Background()
+
+	if _, ok, err := ds.UserNameForID(ctx, "1"); ok || err != nil {
+		t.Fatalf("UserNameForID on an empty table = %v, %v; want not found (sql.ErrNoRows mapped to false)", ok, err)
+	}
+	if err := ds.AddUserForID("1", "Fred"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	if err := ds.AddUserForID("1", "Mary"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("adding user 1 twice: err = %v, want ErrUserExists", err)
+	}
+	if name, ok, err := ds.UserNameForID(ctx, "1"); name != "Fred" || !ok || err != nil {
+		t.Errorf("UserNameForID(1) = %q, %v, %v; want Fred, true, nil", name, ok, err)
+	}
+	if err := ds.UpdateUserForID("1", "Freddie"); err != nil {
+		t.Errorf("UpdateUserForID: %v", err)
+	}
+	if err := ds.UpdateUserForID("2", "Mary"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("updating a missing user: err = %v, want ErrUnknownUser", err)
+	}
+	if err := ds.DeleteUserForID("1"); err != nil {
+		t.Errorf("DeleteUserForID: %v", err)
+	}
+	if err := ds.DeleteUserForID("1"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("deleting a missing user: err = %v, want ErrUnknownUser", err)
+	}
+}
+
+// キャンセルされたcontextでは問い合わせずにエラーを返す
+func TestSQLDataStoreCanceledContext(t *testing.T) {
+	db, _ := openMemSQL(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := NewSQLDataStore(db).UserNameForID(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// RequestCounterは、これまでに処理したリクエストの数を教えてくれるもの
+type RequestCounter interface {
+	RequestCount() int
+}
+
+// StatsReporterは、intervalごとに、リクエストの数、ゴルーチンの数、ユーザーの数を1行のログに書く。
+// メトリクスを集める仕組みがない環境でも、ログを見れば様子がわかる。
+type StatsReporter struct {
+	l        Logger
+	requests RequestCounter
+	ds       DataStore
+	interval time.Duration
+}
+
+// NewStatsReporterは、requestsとdsの数をintervalごとにlに書くStatsReporterを生成するファクトリ関数。
+// dsがCounterでなければ、ユーザーの数は"-"と書く。
+func NewStatsReporter(l Logger, requests RequestCounter, ds DataStore, interval time.Duration) StatsReporter {
+	return StatsReporter{
+		l:        l,
+		requests: requests,
+		ds:       ds,
+		interval: interval,
+	}
+}
+
+// Runは、ctxがキャンセルされるまでintervalごとにログを書く。別のゴルーチンで呼ぶ。
+func (sr StatsReporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(sr.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sr.report()
+		}
+	}
+}
+
+// reportは、今の数を1行のログに書く
+func (sr StatsReporter) report() {
+	users := "-"
+	if c, ok := sr.ds.(Counter); ok {
+		users = strconv.Itoa(c.UserCount())
+	}
+	sr.l.Logf(LevelInfo, "stats: requests=%d goroutines=%d users=%s",
+		sr.requests.RequestCount(), runtime.NumGoroutine(), users)
+}
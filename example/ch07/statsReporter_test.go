@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRequestCounterは、決まった数を返すRequestCounter
+type fakeRequestCounter int
+
+func (n fakeRequestCounter) RequestCount() int { return int(n) }
+
+// 短い間隔で動かすと要約の行を書き、ctxをキャンセルすれば止まる
+func TestStatsReporterLogsSummary(t *testing.T) {
+	l := &MemoryLogger{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewStatsReporter(l, fakeRequestCounter(7), NewSimpleDataStore(), time.Millisecond).Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(l.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+	msgs := l.Messages()
+	if len(msgs) == 0 {
+		t.Fatal("no summary line was logged")
+	}
+	if !strings.Contains(msgs[0], "requests=7 ") || !strings.Contains(msgs[0], "users=3") {
+		t.Errorf("summary = %q, want requests=7 and users=3", msgs[0])
+	}
+}
+
+// Counterでないデータストアでは、ユーザーの数を"-"と書く
+func TestStatsReporterWithoutCounter(t *testing.T) {
+	l := &MemoryLogger{}
+	NewStatsReporter(l, fakeRequestCounter(0), failingStore{}, time.Second).report()
+	if msgs := l.Messages(); len(msgs) != 1 || !strings.HasSuffix(msgs[0], "users=-") {
+		t.Errorf("messages = %v, want one line ending in users=-", msgs)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config.StoreDecoratorsに指定できる、データストアに掛けるデコレーターの名前
+const (
+	// StoreDecoratorMetricsは、検索の回数と時間をMetricsに記録するObservedDataStore
+	StoreDecoratorMetrics = "metrics"
+	// StoreDecoratorRetryは、失敗した検索をやり直すRetryDataStore
+	StoreDecoratorRetry = "retry"
+	// StoreDecoratorCacheは、見つかった名前を覚えておくCacheDataStore
+	StoreDecoratorCache = "cache"
+	// StoreDecoratorCircuitBreakerは、失敗が続いたら検索をやめるCircuitBreakerDataStore
+	StoreDecoratorCircuitBreaker = "circuit_breaker"
+)
+
+// storeDecoratorNamesは、Config.StoreDecoratorsに指定できる名前の一覧。設定を間違えたときのエラーで示す。
+var storeDecoratorNames = []string{StoreDecoratorMetrics, StoreDecoratorRetry, StoreDecoratorCache, StoreDecoratorCircuitBreaker}
+
+// デコレーターの設定。今は設定ファイルで変えられないので、ここで決めておく。
+const (
+	storeRetryAttempts    = 3
+	storeRetryBaseDelay   = 50 * time.Millisecond
+	storeCacheTTL         = time.Minute
+	storeCacheMaxEntries  = 10000
+	storeBreakerThreshold = 5
+	storeBreakerCooldown  = 30 * time.Second
+)
+
+// defaultCacheWarmupWorkersは、Config.CacheWarmupWorkersの既定の値
+const defaultCacheWarmupWorkers = 4
+
+// unknownStoreDecoratorは、知らないデコレーターの名前のエラーを、指定できる名前の一覧と一緒に返す
+func unknownStoreDecorator(name string) error {
+	return fmt.Errorf("不明なstore_decorators: %q（%sのどれかを指定してください）", name, strings.Join(storeDecoratorNames, ", "))
+}
+
+// DecorateDataStoreは、namesのデコレーターをdsに掛けたDataStoreを返す。
+// Chainのミドルウェアと同じく、先に書いたものほど外側になる。たとえば["metrics", "retry"]なら、
+// やり直しも含めて1回の検索として記録し、["retry", "metrics"]なら、やり直すたびに1回として記録する。
+// metricsはrecに記録し、cacheとcircuit_breakerはclockで時間を測る。知らない名前があれば、何も掛けずにエラーを返す。
+func DecorateDataStore(ds DataStore, names []string, rec LookupRecorder, clock Clock) (DataStore, error) {
+	ds, _, err := decorateDataStore(ds, names, rec, clock)
+	return ds, err
+}
+
+// decorateDataStoreは、DecorateDataStoreと同じくデコレーターを掛け、掛けたCacheDataStoreも返す。
+// Buildが起動するときにキャッシュを温めるのに使う。
+func decorateDataStore(ds DataStore, names []string, rec LookupRecorder, clock Clock) (DataStore, []*CacheDataStore, error) {
+	var caches []*CacheDataStore
+	decorators := make([]func(DataStore) DataStore, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case StoreDecoratorMetrics:
+			decorators = append(decorators, func(ds DataStore) DataStore { return NewObservedDataStore(ds, rec) })
+		case StoreDecoratorRetry:
+			decorators = append(decorators, func(ds DataStore) DataStore {
+				return NewRetryDataStore(ds, storeRetryAttempts, storeRetryBaseDelay)
+			})
+		case StoreDecoratorCache:
+			decorators = append(decorators, func(ds DataStore) DataStore {
+				cds := NewCacheDataStore(ds, storeCacheTTL, storeCacheMaxEntries, clock)
+				caches = append(caches, cds)
+				return cds
+			})
+		case StoreDecoratorCircuitBreaker:
+			decorators = append(decorators, func(ds DataStore) DataStore {
+				return NewCircuitBreakerDataStore(ds, storeBreakerThreshold, storeBreakerCooldown, clock)
+			})
+		default:
+			return nil, nil, unknownStoreDecorator(name)
+		}
+	}
+	for i := len(decorators) - 1; i >= 0; i-- {
+		ds = decorators[i](ds)
+	}
+	return ds, caches, nil
+}
+
+// DataStoreWrapperは、Unwrapで包んだデータストアを返すデコレーターが実装するインターフェイス。
+// DecorateDataStoreのデコレーターはUserNameForIDしか持たないので、Listerのような基のデータストアの機能はlisterOfで探す。
+type DataStoreWrapper interface {
+	Unwrap() DataStore
+}
+
+// listerOfは、dsからUnwrapでたどれるデータストアのうち、外側から見て最初のListerを返す
+func listerOf(ds DataStore) (Lister, bool) {
+	for ds != nil {
+		if lister, ok := ds.(Lister); ok {
+			return lister, true
+		}
+		w, ok := ds.(DataStoreWrapper)
+		if !ok {
+			break
+		}
+		ds = w.Unwrap()
+	}
+	return nil, false
+}
+
+// warmupCachesは、cachesのキャッシュをdsの全てのユーザーで温める。dsがListerでなければ何もしない。
+// 温められなくてもキャッシュが冷たいだけで動くので、エラーはlに書くだけで返さない。
+func warmupCaches(ctx context.Context, l Logger, ds DataStore, caches []*CacheDataStore, concurrency int) {
+	if len(caches) == 0 {
+		return
+	}
+	lister, ok := listerOf(ds)
+	if !ok {
+		l.Logf(LevelWarn, "キャッシュを温められません: データストアがユーザーを列挙できません")
+		return
+	}
+	for _, cds := range caches {
+		if err := cds.Warmup(ctx, lister, concurrency); err != nil {
+			l.Logf(LevelWarn, "キャッシュを温められません: %v", err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 先に書いたデコレーターほど外側になるので、metricsとretryの順で、やり直しを1回と数えるか3回と数えるかが変わる
+func TestDecorateDataStoreOrder(t *testing.T) {
+	tests := []struct {
+		names       []string
+		wantLookups int
+	}{
+		{[]string{StoreDecoratorMetrics, StoreDecoratorRetry}, 1},
+		{[]string{StoreDecoratorRetry, StoreDecoratorMetrics}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			m := NewMetrics()
+			ds, err := DecorateDataStore(&flakyStore{failures: 2, err: errors.New("flaky")}, tt.names, m, nil)
+			if err != nil {
+				t.Fatalf("DecorateDataStore: %v", err)
+			}
+			if name, ok, err := ds.UserNameForID(context.Background(), "1"); err != nil || !ok || name != "Fred" {
+				t.Fatalf("UserNameForID = %q, %v, %v; want Fred after retrying", name, ok, err)
+			}
+			if got := m.snapshot().Lookups; got != tt.wantLookups {
+				t.Errorf("lookups = %d, want %d", got, tt.wantLookups)
+			}
+		})
+	}
+}
+
+// 知らない名前があれば、使える名前を挙げたエラーを返す
+func TestDecorateDataStoreUnknown(t *testing.T) {
+	_, err := DecorateDataStore(NewSimpleDataStore(), []string{StoreDecoratorMetrics, "bogus"}, NewMetrics(), nil)
+	if err == nil {
+		t.Fatal("unknown decorator: no error")
+	}
+	for _, want := range []string{"bogus", StoreDecoratorCircuitBreaker} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %q, want it to mention %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import "sort"
+
+// UnknownUserErrorは、見つからなかったユーザーIDに近いIDがあったときに、それを添えて返すエラー。
+// errors.IsでErrUnknownUserとして扱える。
+type UnknownUserError struct {
+	Suggestion string
+}
+
+func (ue UnknownUserError) Error() string {
+	return ErrUnknownUser.Error() + ": did you mean " + ue.Suggestion + "?"
+}
+
+func (ue UnknownUserError) Unwrap() error {
+	return ErrUnknownUser
+}
+
+// closestIDは、idsのうちtargetとのレーベンシュタイン距離が一番小さいIDを返す。
+// 距離がmaxDistanceより大きいIDしかなければfalseを返す。同じ距離のIDが複数あれば、辞書順で最初のものを選ぶ。
+func closestID(ids []string, target string, maxDistance int) (string, bool) {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	best, bestDist := "", maxDistance+1
+	for _, id := range sorted {
+		if d := levenshtein(id, target); d < bestDist {
+			best, bestDist = id, d
+		}
+	}
+	return best, bestDist <= maxDistance
+}
+
+// levenshteinは、aとbのレーベンシュタイン距離（1文字の挿入、削除、置換で何回で一致するか）を文字単位で返す
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(prev))
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	m := first
+	for _, v := range rest {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClosestID(t *testing.T) {
+	ids := []string{"alice", "bob", "carol"}
+	tests := []struct {
+		target string
+		want   string
+		wantOK bool
+	}{
+		{"alise", "alice", true},
+		{"bobb", "bob", true},
+		{"zzzzzz", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := closestID(ids, tt.target, 2)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("closestID(%q) = %q, %v; want %q, %v", tt.target, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// デコレーターを掛けたデータストアでも、包まれたデータストアのユーザーから近いIDを提案する
+func TestSimpleLogicSuggestsThroughDecorators(t *testing.T) {
+	sds := NewSimpleDataStore()
+	sds.AddUserForID("alice", "Alice")
+	ds, err := DecorateDataStore(sds, storeDecoratorNames, NewMetrics(), RealClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.SuggestUsers = true
+	sl := NewSimpleLogic(&MemoryLogger{}, ds, cfg)
+
+	_, err = sl.SayHello(context.Background(), "alise")
+	var ue UnknownUserError
+	if !errors.As(err, &ue) || ue.Suggestion != "alice" || !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("near miss: err = %v, want a suggestion of alice", err)
+	}
+	if _, err := sl.SayHello(context.Background(), "nobody-like-this"); !errors.Is(err, ErrUnknownUser) || errors.As(err, &ue) {
+		t.Errorf("no near match: err = %v, want plain ErrUnknownUser", err)
+	}
+	cfg.SuggestUsers = false
+	if _, err := NewSimpleLogic(&MemoryLogger{}, ds, cfg).SayHello(context.Background(), "alise"); errors.As(err, &ue) {
+		t.Errorf("suggestions disabled: err = %v, want no suggestion", err)
+	}
+}
+
+// 提案がある404には"did you mean"を添える
+func TestSayHelloSuggestion(t *testing.T) {
+	l := &MemoryLogger{}
+	ds := NewSimpleDataStore()
+	cfg := DefaultConfig()
+	cfg.SuggestUsers = true
+	c := NewController(l, NewSimpleLogic(l, NewObservedDataStore(ds, NewMetrics()), cfg), ds)
+	w := send(http.HandlerFunc(c.SayHello), http.MethodGet, "/hello?user_id=11", nil)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "did you mean 1?") {
+		t.Errorf("got %d %q, want 404 suggesting 1", w.Code, w.Body.String())
+	}
+}
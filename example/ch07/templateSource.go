@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// templateFileは、TemplateSourceが読むJSONファイルの形。言語コードごとに「こんにちは」と「さようなら」のテンプレートを書く。
+// 書かれていないテンプレートは、Configのテンプレートか既定のテンプレートのままになる。
+//
+//	{"ja": {"hello": "%sさん　こんにちは。", "goodbye": "%sさん　さようなら"}, "en": {"hello": "Hello, %s"}}
+type templateFile map[string]struct {
+	Hello   string `json:"hello"`
+	Goodbye string `json:"goodbye"`
+}
+
+// TemplateSourceは、ファイルから読んだテンプレートのGreeterを持ち、Reloadで読み直せる。
+// 読み直したGreeterは丸ごと入れ替えるので、挨拶の途中で古いテンプレートと新しいテンプレートが混ざらない。
+// 複数のゴルーチンから同時に使ってもよい。
+type TemplateSource struct {
+	path string
+	cfg  Config
+	gr   atomic.Pointer[Greeter]
+}
+
+// NewTemplateSourceは、pathのファイルのテンプレートで、cfgのテンプレートを上書きしたGreeterを持つTemplateSourceを生成するファクトリ関数。
+// ファイルを読めないか、テンプレートが正しくなければエラーを返す。
+func NewTemplateSource(path string, cfg Config) (*TemplateSource, error) {
+	ts := &TemplateSource{path: path, cfg: cfg}
+	if err := ts.Reload(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Greeterは、今のテンプレートのGreeterを返す
+func (ts *TemplateSource) Greeter() Greeter {
+	return *ts.gr.Load()
+}
+
+// Supportsは、今のテンプレートでlangの言語で挨拶できるかを返す。読み直して増えた言語もすぐに使える。
+func (ts *TemplateSource) Supports(lang string) bool {
+	return ts.Greeter().Supports(lang)
+}
+
+// Reloadは、ファイルを読み直してGreeterを入れ替える。
+// ファイルを読めないか、テンプレートが正しくなければ、エラーを返して前のテンプレートのまま使い続ける。
+func (ts *TemplateSource) Reload() error {
+	data, err := os.ReadFile(ts.path)
+	if err != nil {
+		return err
+	}
+	var tf templateFile
+	if err := json.Unmarshal(data, &tf); err != nil {
+		return fmt.Errorf("%s: テンプレートを読めません: %w", ts.path, err)
+	}
+	gr := NewGreeterFromConfig(ts.cfg)
+	for lang, t := range tf {
+		for kind, tmpl := range map[GreetingKind]string{GreetingHello: t.Hello, GreetingGoodbye: t.Goodbye} {
+			if tmpl == "" {
+				continue
+			}
+			if strings.Count(tmpl, "%s") != 1 {
+				return fmt.Errorf("%s: %sのテンプレートには%%sを1つだけ含めてください: %q", ts.path, lang, tmpl)
+			}
+			if gr.templates[lang] == nil {
+				gr.templates[lang] = map[GreetingKind]string{}
+			}
+			gr.templates[lang][kind] = tmpl
+		}
+	}
+	ts.gr.Store(&gr)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// テンプレートのファイルを書き換えてSIGHUPを送ると、新しい文で挨拶する。壊れたファイルに読み直しても前のテンプレートのまま。
+func TestTemplateSourceReloadOnSignal(t *testing.T) {
+	path := writeTempFile(t, "templates.json", `{"en": {"hello": "Hi, %s"}}`)
+	cfg := DefaultConfig()
+	cfg.LogLevel = LevelError
+	cfg.TemplateFile = path
+	app, err := Build(cfg)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	defer app.Close()
+	hello := func() string {
+		return send(app.Handler, http.MethodGet, "/v1/hello?user_id=1&lang=en", nil).Body.String()
+	}
+	if got := hello(); got != "Hi, Fred" {
+		t.Fatalf("before the reload: %q, want Hi, Fred", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"en": {"hello": "Yo, %s"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	go reloadOnSignal(ctx, app.l, multiReloader{app.templates}, sig)
+	sig <- syscall.SIGHUP
+	deadline := time.Now().Add(2 * time.Second)
+	for hello() != "Yo, Fred" {
+		if time.Now().After(deadline) {
+			t.Fatalf("after SIGHUP: %q, want Yo, Fred", hello())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for _, broken := range []string{`{"en": {"hello": "no verb"}}`, `{"en":`} {
+		if err := os.WriteFile(path, []byte(broken), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.templates.Reload(); err == nil {
+			t.Errorf("Reload(%s) = nil, want an error", broken)
+		}
+		if got := hello(); got != "Yo, Fred" {
+			t.Errorf("after a failed reload of %s: %q, want Yo, Fred", broken, got)
+		}
+	}
+}
+
+// ファイルに書いていない言語やテンプレートは、Configのテンプレートのまま
+func TestTemplateSourceKeepsConfigTemplates(t *testing.T) {
+	ts, err := NewTemplateSource(writeTempFile(t, "templates.json", `{"en": {"hello": "Hi, %s"}, "fr": {"hello": "Bonjour, %s"}}`), DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewTemplateSource: %v", err)
+	}
+	gr := ts.Greeter()
+	if got := gr.Format(Greeting{Name: "Fred", Lang: "en", Kind: GreetingGoodbye}); got != "Goodbye, Fred" {
+		t.Errorf("en goodbye = %q, want Goodbye, Fred", got)
+	}
+	if !ts.Supports("fr") {
+		t.Error("Supports(fr) = false, want true after the file added it")
+	}
+	if _, err := NewTemplateSource(writeTempFile(t, "missing.json", "")+".nope", DefaultConfig()); err == nil {
+		t.Error("NewTemplateSource of a missing file = nil error")
+	}
+}
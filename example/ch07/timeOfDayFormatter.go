@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// DayPeriodは、挨拶を変える1日の時間帯
+type DayPeriod int
+
+const (
+	PeriodMorning DayPeriod = iota
+	PeriodAfternoon
+	PeriodEvening
+	PeriodNight
+)
+
+// DayBoundariesは、それぞれの時間帯が始まる時刻を、0時からの時間で表したもの。
+// Morning、Afternoon、Evening、Nightの順に遅くし、Nightから翌日のMorningまでを夜とする。
+type DayBoundaries struct {
+	Morning   time.Duration
+	Afternoon time.Duration
+	Evening   time.Duration
+	Night     time.Duration
+}
+
+// DefaultDayBoundariesは、朝を5時、昼を12時、夕方を17時、夜を22時からにしたDayBoundariesを返す
+func DefaultDayBoundaries() DayBoundaries {
+	return DayBoundaries{
+		Morning:   5 * time.Hour,
+		Afternoon: 12 * time.Hour,
+		Evening:   17 * time.Hour,
+		Night:     22 * time.Hour,
+	}
+}
+
+// Validateは、bの時刻が0時から24時の間にあり、Morning、Afternoon、Evening、Nightの順に遅くなっているかを確かめる
+func (b DayBoundaries) Validate() error {
+	if b.Morning < 0 || b.Morning >= b.Afternoon || b.Afternoon >= b.Evening || b.Evening >= b.Night || b.Night > 24*time.Hour {
+		return fmt.Errorf("day_boundariesは0時から24時の間で、morning、afternoon、evening、nightの順に遅くしてください: %+v", b)
+	}
+	return nil
+}
+
+// Periodは、0時からsinceMidnight経った時刻の時間帯を返す
+func (b DayBoundaries) Period(sinceMidnight time.Duration) DayPeriod {
+	switch {
+	case sinceMidnight < b.Morning || sinceMidnight >= b.Night:
+		return PeriodNight
+	case sinceMidnight >= b.Evening:
+		return PeriodEvening
+	case sinceMidnight >= b.Afternoon:
+		return PeriodAfternoon
+	}
+	return PeriodMorning
+}
+
+// timeOfDayTemplatesは、言語コードと時間帯ごとの「こんにちは」のテンプレート。%sに名前が入る。
+var timeOfDayTemplates = map[string]map[DayPeriod]string{
+	"ja": {
+		PeriodMorning:   "%sさん　おはようございます。",
+		PeriodAfternoon: "%sさん　こんにちは。",
+		PeriodEvening:   "%sさん　こんばんは。",
+		PeriodNight:     "%sさん　こんばんは。",
+	},
+	"en": {
+		PeriodMorning:   "Good morning, %s",
+		PeriodAfternoon: "Good afternoon, %s",
+		PeriodEvening:   "Good evening, %s",
+		PeriodNight:     "Good night, %s",
+	},
+}
+
+// TimeOfDayFormatterは、「こんにちは」をclockの今の時間帯に合った挨拶にするGreetingFormatter。
+// 言語はGreetingの言語をGreeterで決めたもので、「さようなら」と、時間帯ごとのテンプレートのない言語は、そのGreeterに任せる。
+type TimeOfDayFormatter struct {
+	clock  Clock
+	loc    *time.Location
+	bounds DayBoundaries
+}
+
+// NewTimeOfDayFormatterは、locでの時刻からboundsで時間帯を決めるTimeOfDayFormatterを生成するファクトリ関数。
+// locがnilならUTCを、clockがnilならRealClockを使う。
+func NewTimeOfDayFormatter(clock Clock, loc *time.Location, bounds DayBoundaries) TimeOfDayFormatter {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return TimeOfDayFormatter{
+		clock:  clockOrReal(clock),
+		loc:    loc,
+		bounds: bounds,
+	}
+}
+
+// Formatは、既定のテンプレートの既定の言語で挨拶の文を作る
+func (tf TimeOfDayFormatter) Format(name string, kind GreetingKind) string {
+	return tf.FormatGreeting(Greeting{Name: name, Kind: kind}, defaultGreeter)
+}
+
+// FormatGreetingは、grがgに使う言語に時間帯ごとのテンプレートがあれば、今の時間帯の「こんにちは」を作る
+func (tf TimeOfDayFormatter) FormatGreeting(g Greeting, gr Greeter) string {
+	templates, ok := timeOfDayTemplates[gr.Language(g)]
+	if g.Kind != GreetingHello || !ok {
+		return gr.Format(g)
+	}
+	return fmt.Sprintf(templates[tf.period()], g.Name)
+}
+
+// periodは、locでの今の時刻の時間帯を返す
+func (tf TimeOfDayFormatter) period() DayPeriod {
+	now := tf.clock.Now().In(tf.loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, tf.loc)
+	return tf.bounds.Period(now.Sub(midnight))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTimeOfDayFormatterPeriods(t *testing.T) {
+	tests := []struct {
+		hour int
+		want string
+	}{
+		{3, "Good night, Fred"},
+		{5, "Good morning, Fred"},
+		{11, "Good morning, Fred"},
+		{12, "Good afternoon, Fred"},
+		{17, "Good evening, Fred"},
+		{22, "Good night, Fred"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%02d:00", tt.hour), func(t *testing.T) {
+			clock := NewManualClock(time.Date(2024, 1, 1, tt.hour, 0, 0, 0, time.UTC))
+			tf := NewTimeOfDayFormatter(clock, nil, DefaultDayBoundaries())
+			if got := tf.FormatGreeting(Greeting{Name: "Fred", Kind: GreetingHello, Lang: "en"}, defaultGreeter); got != tt.want {
+				t.Errorf("FormatGreeting = %q, want %q", got, tt.want)
+			}
+			// 「さようなら」は時間帯で変えない
+			if got := tf.FormatGreeting(Greeting{Name: "Fred", Kind: GreetingGoodbye, Lang: "en"}, defaultGreeter); got != "Goodbye, Fred" {
+				t.Errorf("goodbye = %q, want Goodbye, Fred", got)
+			}
+		})
+	}
+}
+
+// 時間帯はlocの時刻で決まり、境目はDayBoundariesで変えられる
+func TestTimeOfDayFormatterTimezone(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	// UTCでは23時の夜だが、JSTでは8時の朝
+	clock := NewManualClock(time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC))
+	bounds := DefaultDayBoundaries()
+	if got := NewTimeOfDayFormatter(clock, jst, bounds).Format("Fred", GreetingHello); got != "Fredさん　おはようございます。" {
+		t.Errorf("8:00 JST = %q, want the morning greeting", got)
+	}
+	if got := NewTimeOfDayFormatter(clock, nil, bounds).Format("Fred", GreetingHello); got != "Fredさん　こんばんは。" {
+		t.Errorf("23:00 UTC = %q, want the night greeting", got)
+	}
+	bounds.Morning = 9 * time.Hour
+	if got := NewTimeOfDayFormatter(clock, jst, bounds).Format("Fred", GreetingHello); got != "Fredさん　こんばんは。" {
+		t.Errorf("8:00 JST with mornings from 9:00 = %q, want the night greeting", got)
+	}
+}
+
+// 時間帯ごとのテンプレートのない言語は、渡したGreeterのテンプレートで挨拶する
+func TestTimeOfDayFormatterFallback(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.GreetingTemplates = map[string]string{"fr": "Salut %s"}
+	tf := NewTimeOfDayFormatter(NewManualClock(time.Now()), nil, DefaultDayBoundaries())
+	if got := tf.FormatGreeting(Greeting{Name: "Fred", Kind: GreetingHello, Lang: "fr"}, NewGreeterFromConfig(cfg)); got != "Salut Fred" {
+		t.Errorf("FormatGreeting = %q, want Salut Fred from the greeter", got)
+	}
+}
+
+// SimpleLogicに渡すと、リクエストごとの言語で時間帯の挨拶をし、使った言語も返す
+func TestTimeOfDayFormatterLanguageFromContext(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	sl := NewSimpleLogicWithFormatter(&MemoryLogger{}, NewSimpleDataStore(), NewTimeOfDayFormatter(clock, nil, DefaultDayBoundaries()))
+	tests := []struct {
+		lang     string
+		want     string
+		wantLang string
+	}{
+		{"en", "Good morning, Fred", "en"},
+		{"ja", "Fredさん　おはようございます。", "ja"},
+		{"", "Fredさん　おはようございます。", "ja"},
+	}
+	for _, tt := range tests {
+		got, err := sl.SayHelloDetailed(ContextWithLanguage(context.Background(), tt.lang), "1")
+		if err != nil || got.Message != tt.want || got.Language != tt.wantLang {
+			t.Errorf("lang %q: got %q in %q, %v; want %q in %q", tt.lang, got.Message, got.Language, err, tt.want, tt.wantLang)
+		}
+	}
+}
+
+// 時間帯の境目は、0時から24時の間で順に遅くなっていなければValidateで弾く
+func TestDayBoundariesValidate(t *testing.T) {
+	if err := DefaultDayBoundaries().Validate(); err != nil {
+		t.Errorf("DefaultDayBoundaries().Validate() = %v", err)
+	}
+	bounds := DefaultDayBoundaries()
+	bounds.Evening = 11 * time.Hour
+	cfg := DefaultConfig()
+	cfg.DayBoundaries = bounds
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate with evening before afternoon = nil")
+	}
+	cfg = DefaultConfig()
+	cfg.TimeZone = "Mars/Olympus"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate with an unknown time_zone = nil")
+	}
+}
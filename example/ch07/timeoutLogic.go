@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLogicTimeoutは、TimeoutLogicの制限時間内に処理が終わらなかったときのエラー
+var ErrLogicTimeout = errors.New("制限時間内に処理が終わりませんでした")
+
+// TimeoutLogicは、包んだLogicの呼び出しごとに制限時間を設けるLogic。
+// 制限時間はcontextで下に伝わるので、DataStoreの検索も打ち切られる。
+type TimeoutLogic struct {
+	logic   Logic
+	timeout time.Duration
+}
+
+// NewTimeoutLogicは、logicの呼び出しをtimeoutで打ち切るTimeoutLogicを生成するファクトリ関数
+func NewTimeoutLogic(logic Logic, timeout time.Duration) TimeoutLogic {
+	return TimeoutLogic{
+		logic:   logic,
+		timeout: timeout,
+	}
+}
+
+func (tl TimeoutLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	return tl.call(ctx, func(ctx context.Context) (string, error) {
+		return tl.logic.SayHello(ctx, userID)
+	})
+}
+
+func (tl TimeoutLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	return tl.call(ctx, func(ctx context.Context) (string, error) {
+		return tl.logic.SayGoodbye(ctx, userID)
+	})
+}
+
+// callは、制限時間付きのcontextでfを呼ぶ。
+// 呼び出し元のcontextではなくTimeoutLogicの制限時間で打ち切られたときはErrLogicTimeoutを返す。
+func (tl TimeoutLogic) call(ctx context.Context, f func(context.Context) (string, error)) (string, error) {
+	tctx, cancel := context.WithTimeout(ctx, tl.timeout)
+	defer cancel()
+	message, err := f(tctx)
+	if err != nil && ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+		return "", ErrLogicTimeout
+	}
+	return message, err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowStoreは、delayだけ待ってから包んだDataStoreを検索するDataStore。待っている間にctxが終われば、そのエラーを返す。
+type slowStore struct {
+	DataStore
+	delay time.Duration
+}
+
+func (ss slowStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	t := time.NewTimer(ss.delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return "", false, ctx.Err()
+	case <-t.C:
+	}
+	return ss.DataStore.UserNameForID(ctx, userID)
+}
+
+func TestTimeoutLogic(t *testing.T) {
+	l := &MemoryLogger{}
+	slow := slowStore{DataStore: NewSimpleDataStore(), delay: time.Hour}
+	tl := NewTimeoutLogic(NewSimpleLogic(l, slow, DefaultConfig()), 10*time.Millisecond)
+
+	start := time.Now()
+	_, err := tl.SayHello(context.Background(), "1")
+	if !errors.Is(err, ErrLogicTimeout) {
+		t.Errorf("err = %v, want ErrLogicTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SayHello took %v, want it to stop at the timeout", elapsed)
+	}
+}
+
+func TestTimeoutLogicFastCall(t *testing.T) {
+	l := &MemoryLogger{}
+	fast := slowStore{DataStore: NewSimpleDataStore(), delay: 0}
+	tl := NewTimeoutLogic(NewSimpleLogic(l, fast, DefaultConfig()), time.Second)
+	if message, err := tl.SayGoodbye(context.Background(), "1"); err != nil || message != "Fredさん　さようなら" {
+		t.Errorf("SayGoodbye = %q, %v", message, err)
+	}
+}
+
+// 呼び出し元がキャンセルしたときは、TimeoutLogicの制限時間とは区別する
+func TestTimeoutLogicCallerCanceled(t *testing.T) {
+	l := &MemoryLogger{}
+	slow := slowStore{DataStore: NewSimpleDataStore(), delay: time.Hour}
+	tl := NewTimeoutLogic(NewSimpleLogic(l, slow, DefaultConfig()), time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tl.SayHello(ctx, "1"); errors.Is(err, ErrLogicTimeout) || err == nil {
+		t.Errorf("err = %v, want an error that is not ErrLogicTimeout", err)
+	}
+}
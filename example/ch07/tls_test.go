@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCertは、127.0.0.1の自己署名証明書と鍵を一時ディレクトリに書き、そのパスを返す
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// 証明書と鍵は両方そろっていて、起動時に読めなければならない
+func TestTLSConfigFiles(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t)
+	cfg := DefaultConfig()
+	cfg.TLSCertFile = certFile
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate with only a certificate: no error")
+	}
+	cfg.TLSKeyFile = filepath.Join(filepath.Dir(keyFile), "missing.pem")
+	if err := cfg.CheckFiles(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("CheckFiles with a missing key: err = %v, want a wrapped os.ErrNotExist", err)
+	}
+	cfg.TLSKeyFile = keyFile
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if err := cfg.CheckFiles(); err != nil {
+		t.Errorf("CheckFiles: %v", err)
+	}
+}
+
+// 証明書を渡したserveには、HTTP/2のHTTPSで届く
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t)
+	addr := freeAddr(t)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, r.Proto) })
+	srv := newServer(addr, h, DefaultConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, &MemoryLogger{}, srv, certFile, keyFile, func() {}, nil)
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("https://" + addr + "/"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET over TLS: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Errorf("got %s with body %q, want HTTP/2", resp.Proto, body)
+	}
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracerは、分散トレーシングのスパンを作る。OpenTelemetryなどに直接依存しないように、使う操作だけを集めてある。
+type Tracer interface {
+	// Extractは、リクエストヘッダ（traceparentなど）に含まれる呼び出し元のトレースをctxに入れて返す
+	Extract(ctx context.Context, h http.Header) context.Context
+	// Startは、ctxにあるスパンの子としてnameのスパンを始め、そのスパンを入れたctxも返す
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Spanは、トレースの中の1つの処理
+type Span interface {
+	SetAttribute(key, value string)
+	// SetErrorは、スパンを失敗として記録する
+	SetError(err error)
+	End()
+}
+
+// noopTracerは、何も記録しないTracer
+type noopTracer struct{}
+
+func (noopTracer) Extract(ctx context.Context, h http.Header) context.Context {
+	return ctx
+}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key, value string) {}
+func (noopSpan) SetError(err error)             {}
+func (noopSpan) End()                           {}
+
+// TracingLogicは、包んだLogicの呼び出しごとにスパンを作るLogic
+type TracingLogic struct {
+	logic  Logic
+	tracer Tracer
+}
+
+// NewTracingLogicは、logicの呼び出しをtracerで記録するTracingLogicを生成するファクトリ関数
+func NewTracingLogic(logic Logic, tracer Tracer) TracingLogic {
+	return TracingLogic{
+		logic:  logic,
+		tracer: tracer,
+	}
+}
+
+func (tl TracingLogic) SayHello(ctx context.Context, userID string) (string, error) {
+	return tl.trace(ctx, "SayHello", userID, func(ctx context.Context) (string, error) {
+		return tl.logic.SayHello(ctx, userID)
+	})
+}
+
+func (tl TracingLogic) SayGoodbye(ctx context.Context, userID string) (string, error) {
+	return tl.trace(ctx, "SayGoodbye", userID, func(ctx context.Context) (string, error) {
+		return tl.logic.SayGoodbye(ctx, userID)
+	})
+}
+
+// traceは、nameのスパンの中でfを呼び、失敗したらスパンを失敗として記録する
+func (tl TracingLogic) trace(ctx context.Context, name, userID string, f func(context.Context) (string, error)) (string, error) {
+	ctx, span := tl.tracer.Start(ctx, name)
+	defer span.End()
+	span.SetAttribute("user_id", userID)
+	message, err := f(ctx)
+	if err != nil {
+		span.SetError(err)
+	}
+	return message, err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// fakeSpanは、fakeTracerが記録する1つのスパン
+type fakeSpan struct {
+	name   string
+	parent string
+	attrs  map[string]string
+	err    error
+	ended  bool
+}
+
+func (fs *fakeSpan) SetAttribute(key, value string) { fs.attrs[key] = value }
+func (fs *fakeSpan) SetError(err error)             { fs.err = err }
+func (fs *fakeSpan) End()                           { fs.ended = true }
+
+// fakeSpanKeyは、fakeTracerが今のスパンの名前をcontextに入れるときのキー
+type fakeSpanKey struct{}
+
+// fakeTracerは、始めたスパンを全て覚えておくTracer。traceparentヘッダの値を、最初のスパンの親の名前にする。
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (ft *fakeTracer) Extract(ctx context.Context, h http.Header) context.Context {
+	if tp := h.Get("traceparent"); tp != "" {
+		return context.WithValue(ctx, fakeSpanKey{}, tp)
+	}
+	return ctx
+}
+
+func (ft *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(fakeSpanKey{}).(string)
+	span := &fakeSpan{name: name, parent: parent, attrs: map[string]string{}}
+	ft.mu.Lock()
+	ft.spans = append(ft.spans, span)
+	ft.mu.Unlock()
+	return context.WithValue(ctx, fakeSpanKey{}, name), span
+}
+
+func TestTracingLogic(t *testing.T) {
+	ft := &fakeTracer{}
+	tl := NewTracingLogic(NewSimpleLogic(&MemoryLogger{}, NewSimpleDataStore(), DefaultConfig()), ft)
+
+	tl.SayHello(context.Background(), "1")
+	tl.SayHello(context.Background(), "99")
+	if len(ft.spans) != 2 {
+		t.Fatalf("started %d spans, want 2", len(ft.spans))
+	}
+	ok, failed := ft.spans[0], ft.spans[1]
+	if ok.name != "SayHello" || ok.attrs["user_id"] != "1" || !ok.ended || ok.err != nil {
+		t.Errorf("successful span = %+v, want an ended SayHello span for user 1 without an error", ok)
+	}
+	if !failed.ended || !errors.Is(failed.err, ErrUnknownUser) {
+		t.Errorf("failed span = %+v, want it ended and marked with ErrUnknownUser", failed)
+	}
+}
+
+// Controllerは、リクエストヘッダのトレースを親にしてルートのスパンを始め、Logicのスパンはその子になる
+func TestControllerStartsRootSpan(t *testing.T) {
+	ft := &fakeTracer{}
+	l := &MemoryLogger{}
+	ds := NewSimpleDataStore()
+	logic := NewTracingLogic(NewSimpleLogic(l, ds, DefaultConfig()), ft)
+	c := NewController(l, logic, ds, WithTracer(ft))
+
+	sendWithHeader(http.HandlerFunc(c.SayHello), http.MethodGet, "/hello?user_id=1", nil, "traceparent", "caller")
+	if len(ft.spans) != 2 {
+		t.Fatalf("started %d spans, want 2", len(ft.spans))
+	}
+	root, child := ft.spans[0], ft.spans[1]
+	if root.name != "GET /hello" || root.parent != "caller" || !root.ended {
+		t.Errorf("root span = %+v, want an ended GET /hello span under caller", root)
+	}
+	if child.name != "SayHello" || child.parent != "GET /hello" {
+		t.Errorf("logic span = %+v, want SayHello under GET /hello", child)
+	}
+}
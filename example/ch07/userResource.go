@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// splitUserPathは、"/users/{id}/history"のようなパスを、ユーザーIDとその後ろ（"history"）に分ける
+func splitUserPath(path string) (userID, rest string) {
+	userID, rest, _ = strings.Cut(strings.TrimPrefix(path, "/users/"), "/")
+	return userID, rest
+}
+
+// UserResourceは、/users/{id}と/users/{id}/historyへのリクエストを振り分ける。
+// どちらの形でもなければ404を返す。
+func (c Controller) UserResource(w http.ResponseWriter, r *http.Request) {
+	userID, rest := splitUserPath(r.URL.Path)
+	switch {
+	case userID == "":
+		http.NotFound(w, r)
+	case rest == "":
+		c.GetUser(w, r)
+	case rest == "history":
+		c.UserHistory(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GetUserは、/users/{id}のユーザーのIDと名前を、挨拶の文にせずにそのままJSONで返す。管理用のツールのため。
+// ユーザーがいなければ、挨拶と同じcodeが"user_not_found"のJSONを404で返す。
+func (c Controller) GetUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	userID, _ := splitUserPath(r.URL.Path)
+	name, ok, err := c.ds.UserNameForID(r.Context(), userID)
+	if err != nil {
+		c.WriteError(w, r, err)
+		return
+	}
+	if !ok {
+		writeUserNotFound(w, userID, ErrUnknownUser.Error())
+		return
+	}
+	if vs, ok := c.ds.(Versioner); ok {
+		if version, ok := vs.UserVersion(userID); ok {
+			w.Header().Set("ETag", userETag(version))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(User{ID: userID, Name: name})
+}
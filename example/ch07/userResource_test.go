@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// GET /users/{id}は挨拶の文にせずに名前を返し、いなければ挨拶と同じ形の404を返す
+func TestGetUser(t *testing.T) {
+	c, _, _ := newTestController(WithAPIKeys(map[string]string{"k": ""}))
+	h := newTestHandler(t, c)
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/users/2", http.StatusOK, `{"user_id":"2","name":"Mary"}`},
+		{"/users/9", http.StatusNotFound, `{"code":"user_not_found","message":"不明なユーザー","id":"9"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := sendWithHeader(h, http.MethodGet, tt.path, nil, "X-API-Key", "k")
+			if got := strings.TrimSpace(w.Body.String()); w.Code != tt.wantStatus || got != tt.wantBody {
+				t.Errorf("got %d %s, want %d %s", w.Code, got, tt.wantStatus, tt.wantBody)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+		})
+	}
+}
+
+func TestSplitUserPath(t *testing.T) {
+	tests := []struct {
+		path, wantID, wantRest string
+	}{
+		{"/users/2", "2", ""},
+		{"/users/2/history", "2", "history"},
+		{"/users/", "", ""},
+	}
+	for _, tt := range tests {
+		if id, rest := splitUserPath(tt.path); id != tt.wantID || rest != tt.wantRest {
+			t.Errorf("splitUserPath(%q) = %q, %q; want %q, %q", tt.path, id, rest, tt.wantID, tt.wantRest)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validatorは、書き込もうとしているユーザーのIDと名前を確かめるインターフェイス
+type Validator interface {
+	Validate(id, name string) error
+}
+
+// ValidatorFuncは、関数をValidatorとして使うためのアダプタ
+type ValidatorFunc func(id, name string) error
+
+func (f ValidatorFunc) Validate(id, name string) error {
+	return f(id, name)
+}
+
+// ValidationErrorは、CompositeValidatorで見つかった全ての問題
+type ValidationError struct {
+	Errors []error
+}
+
+func (ve ValidationError) Error() string {
+	msgs := make([]string, len(ve.Errors))
+	for i, err := range ve.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrapは、errors.Isやerrors.Asで個々の問題を調べられるようにする
+func (ve ValidationError) Unwrap() []error {
+	return ve.Errors
+}
+
+// CompositeValidatorは、全てのValidatorを順に試し、見つかった問題をまとめてValidationErrorで返すValidator。
+// 最初の問題で止めないので、利用者は一度に全ての問題を直せる。
+type CompositeValidator []Validator
+
+func (cv CompositeValidator) Validate(id, name string) error {
+	var errs []error
+	for _, v := range cv {
+		if err := v.Validate(id, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// ErrEmptyNameは、名前が空のときのエラー
+var ErrEmptyName = errors.New("nameが空です")
+
+// RequireNameは、名前が空でないことを確かめるValidatorを返す
+func RequireName() Validator {
+	return ValidatorFunc(func(id, name string) error {
+		if strings.TrimSpace(name) == "" {
+			return ErrEmptyName
+		}
+		return nil
+	})
+}
+
+// MaxNameLengthは、名前がn文字以下であることを確かめるValidatorを返す
+func MaxNameLength(n int) Validator {
+	return ValidatorFunc(func(id, name string) error {
+		if utf8.RuneCountInString(name) > n {
+			return fmt.Errorf("nameは%d文字までです", n)
+		}
+		return nil
+	})
+}
+
+// AllowedNameCharsは、名前の全ての文字がallowedを満たすことを確かめるValidatorを返す
+func AllowedNameChars(allowed func(rune) bool) Validator {
+	return ValidatorFunc(func(id, name string) error {
+		for _, r := range name {
+			if !allowed(r) {
+				return fmt.Errorf("nameに使えない文字があります: %q", r)
+			}
+		}
+		return nil
+	})
+}
+
+// DefaultValidatorは、NewControllerが既定で使うValidatorを返す。
+// 名前は空でなく、64文字までで、改行などの制御文字を含まないこと。
+// unicode.IsPrintはASCIIの空白しか認めないので、"山田　太郎"の全角空白も通すunicode.IsGraphicを使う。
+func DefaultValidator() Validator {
+	return CompositeValidator{
+		RequireName(),
+		MaxNameLength(64),
+		AllowedNameChars(unicode.IsGraphic),
+	}
+}
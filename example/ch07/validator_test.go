@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestDefaultValidator(t *testing.T) {
+	tests := []struct {
+		name     string
+		userName string
+		wantErrs int
+	}{
+		{"ascii", "Bob", 0},
+		{"ascii space", "Bob Smith", 0},
+		{"ideographic space", "山田　太郎", 0},
+		{"too long", strings.Repeat("a", 65), 1},
+		{"newline", "a\nb", 1},
+		{"empty", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DefaultValidator().Validate("1", tt.userName)
+			if tt.wantErrs == 0 {
+				if err != nil {
+					t.Errorf("Validate(%q) = %v, want nil", tt.userName, err)
+				}
+				return
+			}
+			var ve ValidationError
+			if !errors.As(err, &ve) || len(ve.Errors) != tt.wantErrs {
+				t.Errorf("Validate(%q) = %v, want %d problems", tt.userName, err, tt.wantErrs)
+			}
+		})
+	}
+}
+
+// 全ての問題を1つのValidationErrorにまとめ、それぞれをerrors.Isで調べられる
+func TestCompositeValidatorReportsAllFailures(t *testing.T) {
+	err := CompositeValidator{RequireName(), MaxNameLength(0), AllowedNameChars(unicode.IsLetter)}.Validate("1", " \n")
+	var ve ValidationError
+	if !errors.As(err, &ve) || len(ve.Errors) != 3 {
+		t.Fatalf("err = %v, want 3 problems", err)
+	}
+	if !errors.Is(err, ErrEmptyName) {
+		t.Errorf("err = %v, want it to wrap ErrEmptyName", err)
+	}
+}
+
+// 書き込みのハンドラは、確かめられなかった名前を422で返す
+func TestAddUserValidation(t *testing.T) {
+	c, _, _ := newTestController()
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"user_id":"9","name":"a\nb"}`, http.StatusUnprocessableEntity},
+		{`{"user_id":"9","name":"山田　太郎"}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if w := send(http.HandlerFunc(c.AddUser), http.MethodPost, "/users", strings.NewReader(tt.body)); w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.body, w.Code, tt.want)
+		}
+	}
+}
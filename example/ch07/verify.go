@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Verifierは、中身が壊れていないかを確かめられるDataStoreが実装するインターフェイス。
+// 見つけた問題を全て返し、問題がなければ空のスライスを返す。
+type Verifier interface {
+	Verify() []error
+}
+
+// Verifyは、全てのユーザーを調べ、名前が空のユーザーと、IDが正しくないユーザーを報告する。
+// IDは、空でなく、defaultMaxUserIDLength文字以下で、空白や制御文字を含まないものを正しいとする。
+// 同じ名前のユーザーは何人いてもよいので、名前の重複は報告しない。問題はユーザーID順に並べる。
+func (sds *SimpleDataStore) Verify() []error {
+	sds.mu.RLock()
+	ids := make([]string, 0, len(sds.userData))
+	for id := range sds.userData {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	problems := []error{}
+	for _, id := range ids {
+		if msg := verifyUserID(id); msg != "" {
+			problems = append(problems, fmt.Errorf("ユーザーID %q: %s", id, msg))
+		}
+		if strings.TrimSpace(sds.userData[id].Name) == "" {
+			problems = append(problems, fmt.Errorf("ユーザーID %q: 名前が空です", id))
+		}
+	}
+	sds.mu.RUnlock()
+	return problems
+}
+
+// verifyUserIDは、idが正しくなければその理由を、正しければ空文字列を返す
+func verifyUserID(id string) string {
+	switch {
+	case id == "":
+		return "IDが空です"
+	case utf8.RuneCountInString(id) > defaultMaxUserIDLength:
+		return "IDが長すぎます"
+	case strings.IndexFunc(id, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+		return "IDに空白か制御文字が含まれています"
+	}
+	return ""
+}
+
+// verifyResponseは、/admin/verifyが返すJSON
+type verifyResponse struct {
+	OK       bool     `json:"ok"`
+	Problems []string `json:"problems"`
+}
+
+// Verifyは、GET /admin/verifyで、データストアの中身を調べた結果をJSONで返す。
+// 問題が見つかっても、調べること自体はできたので200を返す。
+func (c Controller) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	v, ok := c.ds.(Verifier)
+	if !ok {
+		c.writeError(w, http.StatusNotImplemented, "調べられないデータストア")
+		return
+	}
+	resp := verifyResponse{Problems: []string{}}
+	for _, err := range v.Verify() {
+		resp.Problems = append(resp.Problems, err.Error())
+	}
+	resp.OK = len(resp.Problems) == 0
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
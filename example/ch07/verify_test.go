@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSimpleDataStoreVerify(t *testing.T) {
+	ds := NewSimpleDataStore()
+	if problems := ds.Verify(); len(problems) != 0 {
+		t.Fatalf("Verify() on the default store = %v, want none", problems)
+	}
+	ds.userData["bad id"] = userRecord{Name: "Bob"}
+	ds.userData["4"] = userRecord{Name: " "}
+	ds.userData[strings.Repeat("x", defaultMaxUserIDLength+1)] = userRecord{Name: "Ann"}
+
+	want := []string{"4", "bad id", strings.Repeat("x", defaultMaxUserIDLength+1)}
+	problems := ds.Verify()
+	if len(problems) != len(want) {
+		t.Fatalf("Verify() = %v, want %d problems", problems, len(want))
+	}
+	for i, id := range want {
+		if !strings.Contains(problems[i].Error(), id) {
+			t.Errorf("problem %d = %q, want it to name user %q", i, problems[i], id)
+		}
+	}
+}
+
+// /admin/verifyは、問題が見つかっても200で、okをfalseにして問題を並べる
+func TestVerifyHandler(t *testing.T) {
+	c, ds, _ := newTestController()
+	h := http.HandlerFunc(c.Verify)
+	var resp verifyResponse
+	w := send(h, http.MethodGet, "/admin/verify", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, %v", w.Code, err)
+	}
+	if !resp.OK || !reflect.DeepEqual(resp.Problems, []string{}) {
+		t.Errorf("default store: got %+v, want ok and no problems", resp)
+	}
+
+	ds.userData["4"] = userRecord{}
+	w = send(h, http.MethodGet, "/admin/verify", nil)
+	resp = verifyResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, %v", w.Code, err)
+	}
+	if resp.OK || len(resp.Problems) != 1 {
+		t.Errorf("store with an empty name: got %+v, want one problem", resp)
+	}
+
+	c.ds = failingStore{}
+	if w := send(http.HandlerFunc(c.Verify), http.MethodGet, "/admin/verify", nil); w.Code != http.StatusNotImplemented {
+		t.Errorf("store without Verify: status %d, want 501", w.Code)
+	}
+}
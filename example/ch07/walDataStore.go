@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WALDataStoreは、ユーザーのデータをスナップショットのJSONファイルと、先行書き込みログ（WAL）に保存するデータストア。
+// 書き込みのたびにファイル全体を書き直すFileDataStoreと違い、変更を1行ずつログの末尾に足してからメモリに反映する。
+// 起動時にはスナップショットを読んでからログを再生するので、書き込みの途中で落ちても、ログに書けた変更までは戻る。
+// Compactでスナップショットを書き直すと、ログは空になる。
+type WALDataStore struct {
+	mu       sync.RWMutex
+	path     string
+	log      *os.File
+	logSize  int64
+	userData map[string]string
+}
+
+// walEntryは、WALの1行
+type walEntry struct {
+	Op     string `json:"op"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name,omitempty"`
+}
+
+// NewWALDataStoreは、pathのスナップショットとpath+".wal"のログからWALDataStoreを生成するファクトリ関数。
+// どちらのファイルもなければ空のデータストアになる。
+// ログの最後の行が途中で切れていれば、書き込みの途中で落ちたものとして捨てる。
+func NewWALDataStore(path string) (*WALDataStore, error) {
+	wds := &WALDataStore{
+		path:     path,
+		userData: map[string]string{},
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%sを読み込めません: %w", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &wds.userData); err != nil {
+			return nil, fmt.Errorf("%sが壊れています: %w", path, err)
+		}
+	}
+	if err := wds.replay(); err != nil {
+		return nil, err
+	}
+	wds.log, err = os.OpenFile(wds.logPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%sを開けません: %w", wds.logPath(), err)
+	}
+	// 捨てた行の後ろに書き足さないように、再生できたところまでに切り詰める
+	if err := wds.log.Truncate(wds.logSize); err != nil {
+		wds.log.Close()
+		return nil, fmt.Errorf("%sを切り詰められません: %w", wds.logPath(), err)
+	}
+	return wds, nil
+}
+
+func (wds *WALDataStore) logPath() string {
+	return wds.path + ".wal"
+}
+
+// replayは、ログの変更をuserDataに順に反映し、反映できたところまでのバイト数をlogSizeにする
+func (wds *WALDataStore) replay() error {
+	data, err := os.ReadFile(wds.logPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%sを読み込めません: %w", wds.logPath(), err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Bytes()
+		if wds.logSize+int64(len(line)) >= int64(len(data)) {
+			// 改行で終わっていない最後の行は、書き込みの途中で落ちたもの
+			return nil
+		}
+		var e walEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("%sの%d行目が壊れています: %w", wds.logPath(), lineNo, err)
+		}
+		wds.apply(e)
+		wds.logSize += int64(len(line)) + 1
+	}
+	return sc.Err()
+}
+
+// applyは、eをuserDataに反映する。
+// Compactの途中で落ちると、スナップショットに入った変更をもう一度再生することがあるので、何度反映しても同じ結果になるようにする。
+func (wds *WALDataStore) apply(e walEntry) {
+	switch e.Op {
+	case ChangeAdd.String(), ChangeUpdate.String():
+		wds.userData[e.UserID] = e.Name
+	case ChangeDelete.String():
+		delete(wds.userData, e.UserID)
+	}
+}
+
+// appendは、eをログの末尾に書いてディスクに同期してから、userDataに反映する。
+// 書けなければ、書きかけの行を切り詰めて、何も変えずにエラーを返す。呼び出し側がロックを持っていること。
+func (wds *WALDataStore) append(e walEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := wds.log.Write(line); err != nil {
+		wds.log.Truncate(wds.logSize)
+		return fmt.Errorf("%sに書き込めません: %w", wds.logPath(), err)
+	}
+	if err := wds.log.Sync(); err != nil {
+		wds.log.Truncate(wds.logSize)
+		return fmt.Errorf("%sに書き込めません: %w", wds.logPath(), err)
+	}
+	wds.logSize += int64(len(line))
+	wds.apply(e)
+	return nil
+}
+
+func (wds *WALDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	wds.mu.RLock()
+	defer wds.mu.RUnlock()
+	name, ok := wds.userData[userID]
+	return name, ok, nil
+}
+
+func (wds *WALDataStore) AddUserForID(userID, name string) error {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	if _, ok := wds.userData[userID]; ok {
+		return ErrUserExists
+	}
+	return wds.append(walEntry{Op: ChangeAdd.String(), UserID: userID, Name: name})
+}
+
+func (wds *WALDataStore) UpdateUserForID(userID, newName string) error {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	if _, ok := wds.userData[userID]; !ok {
+		return ErrUnknownUser
+	}
+	return wds.append(walEntry{Op: ChangeUpdate.String(), UserID: userID, Name: newName})
+}
+
+func (wds *WALDataStore) DeleteUserForID(userID string) error {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	if _, ok := wds.userData[userID]; !ok {
+		return ErrUnknownUser
+	}
+	return wds.append(walEntry{Op: ChangeDelete.String(), UserID: userID})
+}
+
+// Compactは、今の全てのユーザーをスナップショットに書き出してから、ログを空にする。
+// 一時ファイルに書いてディスクに同期し、スナップショットに置き換えて、その置き換えもディレクトリを同期して残してから、ログを切り詰める。
+// 途中で落ちても、古いスナップショットとログか、新しいスナップショットとまだ切り詰めていないログのどちらかが残る。
+// スナップショットを書けなければ、ログはそのまま残す。
+func (wds *WALDataStore) Compact() error {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	data, err := json.Marshal(wds.userData)
+	if err != nil {
+		return err
+	}
+	tmp := wds.path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("%sに書き込めません: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, wds.path); err != nil {
+		return fmt.Errorf("%sに書き込めません: %w", wds.path, err)
+	}
+	if err := syncDir(filepath.Dir(wds.path)); err != nil {
+		return fmt.Errorf("%sの置き換えを同期できません: %w", wds.path, err)
+	}
+	if err := wds.log.Truncate(0); err != nil {
+		return fmt.Errorf("%sを切り詰められません: %w", wds.logPath(), err)
+	}
+	wds.logSize = 0
+	return nil
+}
+
+// writeFileSyncは、dataをpathに書いて、閉じる前にディスクに同期する
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDirは、dirを開いて同期し、その中で済ませたファイルの置き換えをディスクに残す
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Closeは、ログのファイルを閉じる。閉じた後は書き込めない。
+func (wds *WALDataStore) Close() error {
+	wds.mu.Lock()
+	defer wds.mu.Unlock()
+	return wds.log.Close()
+}
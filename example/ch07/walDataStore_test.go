@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 書き込んだ後に作り直したWALDataStoreは、ログを再生して同じ状態に戻る。
+// 最後の行が途中で切れていれば、その行だけを捨てる。
+func TestWALDataStoreRecovers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	ctx := context.Background()
+	wds, err := NewWALDataStore(path)
+	if err != nil {
+		t.Fatalf("NewWALDataStore: %v", err)
+	}
+	wds.AddUserForID("1", "Fred")
+	wds.AddUserForID("2", "Mary")
+	wds.UpdateUserForID("1", "Freddie")
+	wds.DeleteUserForID("2")
+	wds.Close()
+
+	// 書き込みの途中で落ちたように、切れた行を足す
+	f, err := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"add","user_id":"3"`)
+	f.Close()
+
+	wds, err = NewWALDataStore(path)
+	if err != nil {
+		t.Fatalf("restarting: %v", err)
+	}
+	defer wds.Close()
+	tests := []struct {
+		id       string
+		wantName string
+		wantOK   bool
+	}{
+		{"1", "Freddie", true},
+		{"2", "", false},
+		{"3", "", false},
+	}
+	for _, tt := range tests {
+		if name, ok, err := wds.UserNameForID(ctx, tt.id); err != nil || ok != tt.wantOK || name != tt.wantName {
+			t.Errorf("UserNameForID(%s) = %q, %v, %v; want %q, %v, nil", tt.id, name, ok, err, tt.wantName, tt.wantOK)
+		}
+	}
+	// 切れた行を捨てた後も、続けて書き込める
+	if err := wds.AddUserForID("4", "Ann"); err != nil {
+		t.Errorf("AddUserForID after recovery: %v", err)
+	}
+}
+
+// Compactの後はログが空になり、それより後の変更だけがログに残る
+func TestWALDataStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	wds, err := NewWALDataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wds.AddUserForID("1", "Fred")
+	if err := wds.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if st, err := os.Stat(path + ".wal"); err != nil || st.Size() != 0 {
+		t.Fatalf("log after Compact: %v, %v; want an empty file", st, err)
+	}
+	wds.AddUserForID("2", "Mary")
+	wds.Close()
+
+	wds, err = NewWALDataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wds.Close()
+	for _, id := range []string{"1", "2"} {
+		if _, ok, _ := wds.UserNameForID(context.Background(), id); !ok {
+			t.Errorf("user %s was lost across Compact and restart", id)
+		}
+	}
+}
+
+// スナップショットの一時ファイルを書けなければ、Compactはエラーを返し、ログを切り詰めない
+func TestWALDataStoreCompactKeepsLogOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	wds, err := NewWALDataStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wds.Close()
+	wds.AddUserForID("1", "Fred")
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := wds.Compact(); err == nil {
+		t.Fatal("Compact with an unwritable temp file: err = nil")
+	}
+	if st, err := os.Stat(path + ".wal"); err != nil || st.Size() == 0 {
+		t.Errorf("log after a failed Compact: %v, %v; want it kept", st, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("snapshot after a failed Compact: %v, want none", err)
+	}
+}
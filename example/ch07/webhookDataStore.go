@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// webhookTimeoutは、Webhookへの1回の通知を打ち切るまでの時間
+const webhookTimeout = 5 * time.Second
+
+// WebhookEventは、WebhookNotifyingDataStoreがWebhookにPOSTするJSON。
+// Nameは、追加と更新のときは新しい名前で、削除のときは空になる。
+type WebhookEvent struct {
+	Op     string    `json:"op"`
+	UserID string    `json:"user_id"`
+	Name   string    `json:"name,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// WebhookNotifyingDataStoreは、包んだWritableDataStoreへの書き込みが成功した後に、
+// その変更をWebhookEventのJSONにして、設定したURLにPOSTするWritableDataStore。
+// 通知は別のゴルーチンで順に送るので、Webhookが遅くても書き込みは待たされない。
+// 書き込みと通知を渡すのは1つずつ順にするので、通知は包んだデータストアに書き込んだ順に届く。
+// 送る前の通知がqueueSize件たまっていたら、新しい通知は捨ててログに書く。送れなかった通知もログに書くだけで、送り直さない。
+// 使い終わったらCloseを呼ぶ。
+type WebhookNotifyingDataStore struct {
+	ds     WritableDataStore
+	url    string
+	client *http.Client
+	l      Logger
+	clock  Clock
+
+	// writeMuは、dsへの書き込みからnotifyまでを持つロック
+	writeMu sync.Mutex
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan WebhookEvent
+	done    chan struct{}
+}
+
+// NewWebhookNotifyingDataStoreは、dsへの書き込みをurlにclientで通知するWebhookNotifyingDataStoreを生成するファクトリ関数。
+// clientがnilならhttp.DefaultClientを、clockがnilなら本当の時刻を使う。通知を送るゴルーチンもここで始める。
+func NewWebhookNotifyingDataStore(ds WritableDataStore, url string, client *http.Client, l Logger, clock Clock, queueSize int) *WebhookNotifyingDataStore {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	wds := &WebhookNotifyingDataStore{
+		ds:     ds,
+		url:    url,
+		client: client,
+		l:      l,
+		clock:  clockOrReal(clock),
+		queue:  make(chan WebhookEvent, queueSize),
+		done:   make(chan struct{}),
+	}
+	go wds.run()
+	return wds
+}
+
+func (wds *WebhookNotifyingDataStore) UserNameForID(ctx context.Context, userID string) (string, bool, error) {
+	return wds.ds.UserNameForID(ctx, userID)
+}
+
+func (wds *WebhookNotifyingDataStore) AddUserForID(userID, name string) error {
+	wds.writeMu.Lock()
+	defer wds.writeMu.Unlock()
+	if err := wds.ds.AddUserForID(userID, name); err != nil {
+		return err
+	}
+	wds.notify(ChangeAdd, userID, name)
+	return nil
+}
+
+func (wds *WebhookNotifyingDataStore) UpdateUserForID(userID, newName string) error {
+	wds.writeMu.Lock()
+	defer wds.writeMu.Unlock()
+	if err := wds.ds.UpdateUserForID(userID, newName); err != nil {
+		return err
+	}
+	wds.notify(ChangeUpdate, userID, newName)
+	return nil
+}
+
+func (wds *WebhookNotifyingDataStore) DeleteUserForID(userID string) error {
+	wds.writeMu.Lock()
+	defer wds.writeMu.Unlock()
+	if err := wds.ds.DeleteUserForID(userID); err != nil {
+		return err
+	}
+	wds.notify(ChangeDelete, userID, "")
+	return nil
+}
+
+// notifyは、通知を送るゴルーチンに変更を渡す。待たずに済むように、たまっていれば捨てる。
+func (wds *WebhookNotifyingDataStore) notify(op ChangeOp, userID, name string) {
+	ev := WebhookEvent{Op: op.String(), UserID: userID, Name: name, Time: wds.clock.Now()}
+	wds.mu.RLock()
+	defer wds.mu.RUnlock()
+	if wds.closed {
+		wds.l.Logf(LevelWarn, "webhook: 閉じた後の通知を捨てました: %s %s", ev.Op, escapeForLog(userID))
+		return
+	}
+	select {
+	case wds.queue <- ev:
+	default:
+		wds.l.Logf(LevelWarn, "webhook: 通知がたまっているので捨てました: %s %s", ev.Op, escapeForLog(userID))
+	}
+}
+
+// runは、queueが閉じられるまで、通知を1つずつ送る
+func (wds *WebhookNotifyingDataStore) run() {
+	defer close(wds.done)
+	for ev := range wds.queue {
+		if err := wds.send(ev); err != nil {
+			wds.l.Logf(LevelError, "webhook: %s %sを通知できません: %v", ev.Op, escapeForLog(ev.UserID), err)
+		}
+	}
+}
+
+// sendは、evをJSONにしてurlにPOSTする。2xx以外のステータスコードもエラーにする。
+func (wds *WebhookNotifyingDataStore) send(ev WebhookEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wds.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := wds.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhookが%dを返しました", resp.StatusCode)
+	}
+	return nil
+}
+
+// Closeは、たまっている通知を全て送り終えるまで待ってから、包んだデータストアが閉じられるものなら閉じる。
+// Closeの後の書き込みは通知しない。
+func (wds *WebhookNotifyingDataStore) Close() error {
+	wds.mu.Lock()
+	if !wds.closed {
+		wds.closed = true
+		close(wds.queue)
+	}
+	wds.mu.Unlock()
+	<-wds.done
+	return closeDataStore(wds.ds)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 成功した書き込みだけが、その順にJSONでWebhookに届く
+func TestWebhookNotifyingDataStore(t *testing.T) {
+	got := make(chan WebhookEvent, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); r.Method != http.MethodPost || ct != "application/json" {
+			t.Errorf("got %s with Content-Type %q, want a JSON POST", r.Method, ct)
+		}
+		var ev WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decoding the event: %v", err)
+		}
+		got <- ev
+	}))
+	defer srv.Close()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	wds := NewWebhookNotifyingDataStore(&SimpleDataStore{}, srv.URL, srv.Client(), &MemoryLogger{}, NewManualClock(now), 8)
+
+	if err := wds.AddUserForID("9", "Zed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wds.UpdateUserForID("9", "Zack"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wds.DeleteUserForID("nope"); err == nil {
+		t.Error("deleting an unknown user: no error")
+	}
+	if err := wds.DeleteUserForID("9"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	close(got)
+
+	var events []WebhookEvent
+	for ev := range got {
+		events = append(events, ev)
+	}
+	want := []WebhookEvent{
+		{Op: "add", UserID: "9", Name: "Zed", Time: now},
+		{Op: "update", UserID: "9", Name: "Zack", Time: now},
+		{Op: "delete", UserID: "9", Time: now},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+}
+
+// 同じユーザーを並行して書き換えても、通知は包んだデータストアに書き込んだ順に届く
+func TestWebhookNotifyingDataStoreConcurrentWriters(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decoding the event: %v", err)
+		}
+		mu.Lock()
+		got = append(got, ev.Name)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	ds := &orderStore{SimpleDataStore: NewSimpleDataStore()}
+	wds := NewWebhookNotifyingDataStore(ds, srv.URL, srv.Client(), &MemoryLogger{}, nil, 400)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 40; i++ {
+				if err := wds.UpdateUserForID("1", fmt.Sprintf("w%d-%d", w, i)); err != nil {
+					t.Errorf("UpdateUserForID: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := wds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := ds.Names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d events in a different order from the store's %d updates", len(got), len(want))
+	}
+}
+
+// Webhookがエラーを返しても書き込みは成功し、送れなかったことをログに書く
+func TestWebhookNotifyingDataStoreFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	l := &MemoryLogger{}
+	wds := NewWebhookNotifyingDataStore(&SimpleDataStore{}, srv.URL, srv.Client(), l, nil, 8)
+	if err := wds.AddUserForID("9", "Zed"); err != nil {
+		t.Fatalf("AddUserForID: %v", err)
+	}
+	wds.Close()
+	if !containsMessage(l.Messages(), "502") {
+		t.Errorf("logs %v do not mention the 502", l.Messages())
+	}
+	// Closeの後の書き込みは通知せず、そのことをログに書く
+	if err := wds.AddUserForID("10", "Ann"); err != nil {
+		t.Fatalf("AddUserForID after Close: %v", err)
+	}
+	if !containsMessage(l.Messages(), "閉じた後") {
+		t.Errorf("logs %v do not mention the dropped event", l.Messages())
+	}
+}